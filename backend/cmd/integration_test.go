@@ -0,0 +1,715 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/email"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/events"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/outbox"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/pgtest"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/utils"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// TestFlowsPostgres drives the full mux against a throwaway Postgres database
+func TestFlowsPostgres(t *testing.T) {
+	dbConn := pgtest.Start(t)
+	runFlows(t, newTestServer(t, dbConn, store.NewPostgres(dbConn)))
+}
+
+// TestFlowsMemory runs the same flows on the in-memory stores, so the golden
+// files are checked even where no Postgres is available
+func TestFlowsMemory(t *testing.T) {
+	runFlows(t, newTestServer(t, nil, store.NewMemory()))
+}
+
+func newTestServer(t *testing.T, dbConn *sql.DB, stores *store.Store) *server {
+	t.Helper()
+
+	templates, err := parseTemplates("../../web/templates/*.html")
+	if err != nil {
+		t.Fatalf("parsing templates: %v", err)
+	}
+	cfg := config.Defaults(config.Test)
+	emailTemplates, err := email.LoadTemplates("../../web/templates/email", cfg.Mail.DefaultLocale)
+	if err != nil {
+		t.Fatalf("parsing email templates: %v", err)
+	}
+
+	return &server{
+		DB:             dbConn,
+		Stores:         stores,
+		Templates:      templates,
+		EmailTemplates: emailTemplates,
+		Payments:       payments.NewFakeProvider("test-secret"),
+		Events:         events.NewHub(),
+		Config:         cfg,
+	}
+}
+
+// runFlows walks a farmer and a buyer through register, login, add product,
+// add to cart and checkout, comparing every response with testdata/golden
+func runFlows(t *testing.T, srv *server) {
+	seedFixtures(t, srv.Stores)
+	mux := srv.routes()
+
+	farmer := &client{t: t, handler: mux}
+	rec := farmer.do(http.MethodPost, "/farmer/register", map[string]interface{}{
+		"first_name": "Ada",
+		"last_name":  "Field",
+		"email":      "ada@example.com",
+		"password":   "harvest-2024",
+		"farm_name":  "Sunny Rows",
+		"farm_size":  "12 acres",
+		"location":   "Almaty",
+	})
+	checkGolden(t, "farmer_register", rec)
+
+	registered, err := srv.Stores.Farmers.GetByEmail(context.Background(), "ada@example.com")
+	if err != nil {
+		t.Fatalf("looking up registered farmer: %v", err)
+	}
+	admin := &client{t: t, handler: mux, session: adminSession(t, srv.Stores, models.RoleSuperAdmin)}
+	rec = admin.postForm("/admin/dashboard/approve-farmer", url.Values{"id": {strconv.Itoa(registered.ID)}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("approving farmer: status %d: %s", rec.Code, rec.Body.String())
+	}
+	// The approval queues its email; nothing goes out until the outbox worker runs
+	mailer := email.NewMemory("no-reply@test.local")
+	if err := outbox.NewWorker(srv.Stores, mailer, srv.Payments, srv.Config.Outbox).DeliverDue(context.Background()); err != nil {
+		t.Fatalf("delivering outbox: %v", err)
+	}
+	sent := mailer.Sent()
+	if len(sent) != 1 || sent[0].To != "ada@example.com" || sent[0].Subject != "Your Farmer Account Has Been Approved" || sent[0].HTML == "" {
+		t.Fatalf("approval email not sent as expected: %+v", sent)
+	}
+	// Activation is a separate admin action
+	if err := srv.Stores.Farmers.SetActive(context.Background(), registered.ID, true); err != nil {
+		t.Fatalf("activating farmer: %v", err)
+	}
+
+	rec = farmer.do(http.MethodPost, "/farmer/login", map[string]interface{}{
+		"email":    "ada@example.com",
+		"password": "harvest-2024",
+	})
+	checkGolden(t, "farmer_login", rec)
+	farmer.keepSession(rec)
+
+	// The worker also delivered the approval notification to the farmer's inbox
+	checkGolden(t, "farmer_notifications", farmer.do(http.MethodGet, "/notifications", nil))
+
+	rec = farmer.do(http.MethodPost, "/farmer/product/add-product", map[string]interface{}{
+		"name":        "Tomatoes",
+		"category_id": 1,
+		"price":       2.5,
+		"quantity":    20,
+		"description": "Vine ripened",
+		"images":      []string{"https://images.example.com/tomatoes.jpg"},
+	})
+	checkGolden(t, "farmer_add_product", rec)
+
+	// Invalid fields are all reported at once
+	rec = farmer.do(http.MethodPost, "/api/v1/farmer/product/add-product", map[string]interface{}{
+		"name":        "",
+		"category_id": 1,
+		"price":       -1,
+		"quantity":    20,
+		"images":      []string{"tomatoes.jpg"},
+	})
+	checkGolden(t, "v1_farmer_add_product_invalid", rec)
+
+	buyer := &client{t: t, handler: mux}
+	rec = buyer.do(http.MethodPost, "/buyer/register", map[string]interface{}{
+		"email":            "bo@example.com",
+		"password":         "basket-2024",
+		"first_name":       "Bo",
+		"last_name":        "Market",
+		"delivery_address": "1 Market Street",
+	})
+	checkGolden(t, "buyer_register", rec)
+
+	rec = (&client{t: t, handler: mux}).do(http.MethodPost, "/buyer/register", map[string]interface{}{
+		"email":      "not-an-email",
+		"password":   "short",
+		"first_name": "Bo",
+	})
+	checkGolden(t, "buyer_register_invalid", rec)
+
+	// 40 characters, but more bytes than bcrypt can hash
+	rec = (&client{t: t, handler: mux}).do(http.MethodPost, "/buyer/register", map[string]interface{}{
+		"email":            "bo.long@example.com",
+		"password":         strings.Repeat("пароль", 6) + "2024",
+		"first_name":       "Bo",
+		"last_name":        "Market",
+		"delivery_address": "1 Market Street",
+	})
+	checkGolden(t, "buyer_register_long_password", rec)
+
+	rec = buyer.do(http.MethodPost, "/buyer/login", map[string]interface{}{
+		"email":    "bo@example.com",
+		"password": "basket-2024",
+	})
+	checkGolden(t, "buyer_login", rec)
+	buyer.keepSession(rec)
+
+	checkGolden(t, "buyer_home", buyer.do(http.MethodGet, "/buyer/home", nil))
+
+	rec = buyer.do(http.MethodPost, "/cart/add", map[string]interface{}{"productId": 2, "quantity": 3})
+	checkGolden(t, "cart_add", rec)
+	rec = buyer.do(http.MethodPost, "/cart/add", map[string]interface{}{"productId": 1, "quantity": 100})
+	checkGolden(t, "cart_add_insufficient_stock", rec)
+	checkGolden(t, "cart_get", buyer.do(http.MethodGet, "/cart", nil))
+
+	rec = buyer.do(http.MethodPost, "/checkout", map[string]interface{}{
+		"payment_method": "card",
+		"payment_token":  "tok_visa",
+	})
+	checkGolden(t, "checkout", rec)
+	checkGolden(t, "cart_after_checkout", buyer.do(http.MethodGet, "/cart", nil))
+	checkGolden(t, "product_after_checkout", buyer.do(http.MethodGet, "/buyer/product/2", nil))
+
+	// The versioned API wraps the same handlers in one envelope; the old
+	// paths point to it
+	if rec := buyer.do(http.MethodGet, "/cart", nil); rec.Header().Get("Deprecation") != "true" ||
+		rec.Header().Get("Link") != `</api/v1/cart>; rel="successor-version"` {
+		t.Fatalf("GET /cart: Deprecation %q, Link %q", rec.Header().Get("Deprecation"), rec.Header().Get("Link"))
+	}
+	checkGolden(t, "v1_cart_get", buyer.do(http.MethodGet, "/api/v1/cart", nil))
+	checkGolden(t, "v1_farmer_notifications", farmer.do(http.MethodGet, "/api/v1/notifications", nil))
+	rec = buyer.do(http.MethodPost, "/api/v1/cart/add", map[string]interface{}{"productId": 1, "quantity": 100})
+	checkGolden(t, "v1_cart_add_insufficient_stock", rec)
+	checkGolden(t, "v1_checkout_method_not_allowed", buyer.do(http.MethodDelete, "/api/v1/checkout", nil))
+	checkGolden(t, "v1_unauthorized", (&client{t: t, handler: mux}).do(http.MethodGet, "/api/v1/cart", nil))
+
+	// A known path with the wrong method is refused by the router
+	rec = buyer.do(http.MethodDelete, "/checkout", nil)
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") == "" {
+		t.Fatalf("DELETE /checkout: status %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+
+	runOrders(t, srv, farmer, buyer, admin)
+	runCheckoutErrors(t, srv, buyer)
+	runAdminRoles(t, srv, mux, admin)
+	runProductDeletion(t, farmer, buyer)
+}
+
+// runProductDeletion deletes the product the buyer bought and checks that it
+// is gone from the shop while its stock ledger is still there
+func runProductDeletion(t *testing.T, farmer, buyer *client) {
+	t.Helper()
+
+	rec := farmer.do(http.MethodDelete, "/farmer/product/delete-product", map[string]interface{}{"id": 2})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("deleting product: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := farmer.do(http.MethodDelete, "/farmer/product/delete-product", map[string]interface{}{"id": 2}); rec.Code != http.StatusNotFound {
+		t.Fatalf("deleting a deleted product: status %d", rec.Code)
+	}
+	if rec := buyer.do(http.MethodGet, "/buyer/product/2", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET a deleted product: status %d", rec.Code)
+	}
+	if rec := buyer.do(http.MethodPost, "/cart/add", map[string]interface{}{"productId": 2, "quantity": 1}); rec.Code != http.StatusNotFound {
+		t.Fatalf("adding a deleted product to the cart: status %d", rec.Code)
+	}
+
+	rec = farmer.do(http.MethodGet, "/farmer/product/2/stock-history", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stock history of a deleted product: status %d: %s", rec.Code, rec.Body.String())
+	}
+	var history struct {
+		Movements []models.InventoryMovement `json:"movements"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatalf("decoding stock history: %v", err)
+	}
+	sold := false
+	for _, movement := range history.Movements {
+		sold = sold || movement.MovementType == models.MovementSale
+	}
+	if !sold {
+		t.Errorf("stock history of a deleted product lost its sale: %+v", history.Movements)
+	}
+}
+
+// runOrders takes the checked-out order through fulfillment, payment capture
+// and a refund the admin approves
+func runOrders(t *testing.T, srv *server, farmer, buyer, admin *client) {
+	t.Helper()
+
+	checkGolden(t, "buyer_orders", buyer.do(http.MethodGet, "/buyer/orders", nil))
+
+	// Buyer and farmer routes are closed to the other kind of account
+	if rec := farmer.do(http.MethodGet, "/buyer/orders/1", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("GET /buyer/orders/1 as a farmer: status %d", rec.Code)
+	}
+	if rec := buyer.do(http.MethodGet, "/farmer/orders/1", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("GET /farmer/orders/1 as a buyer: status %d", rec.Code)
+	}
+
+	for _, status := range []string{"confirmed", "packed", "shipped"} {
+		rec := farmer.do(http.MethodPost, "/farmer/orders/1/status", map[string]interface{}{"status": status})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("moving order to %s: status %d: %s", status, rec.Code, rec.Body.String())
+		}
+	}
+	// Delivery orders cannot go to ready_for_pickup
+	rec := farmer.do(http.MethodPost, "/farmer/orders/1/status", map[string]interface{}{"status": "ready_for_pickup"})
+	checkGolden(t, "farmer_order_invalid_transition", rec)
+	rec = farmer.do(http.MethodPost, "/farmer/orders/1/status", map[string]interface{}{"status": "lost"})
+	checkGolden(t, "farmer_order_unknown_status", rec)
+
+	// The fixture farmer has nothing in the order, so it is not theirs to move
+	other := &client{t: t, handler: farmer.handler}
+	rec = other.do(http.MethodPost, "/farmer/login", map[string]interface{}{
+		"email":    "greenacres@example.com",
+		"password": "fixture-password",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("fixture farmer login: status %d: %s", rec.Code, rec.Body.String())
+	}
+	other.keepSession(rec)
+	rec = other.do(http.MethodPost, "/farmer/orders/1/status", map[string]interface{}{"status": "delivered"})
+	checkGolden(t, "farmer_order_other_farmer", rec)
+
+	rec = farmer.do(http.MethodPost, "/farmer/orders/1/status", map[string]interface{}{"status": "delivered", "note": "Left at the door"})
+	checkGolden(t, "farmer_order_delivered", rec)
+
+	// Delivered is as far as the farmer goes; refunds take their own route
+	for _, status := range []string{"cancelled", "refunded"} {
+		rec := farmer.do(http.MethodPost, "/farmer/orders/1/status", map[string]interface{}{"status": status})
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("moving a delivered order to %s: status %d: %s", status, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Delivering the whole order queues the capture of the authorized payment
+	payment, err := srv.Stores.Payments.GetByOrder(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("looking up payment: %v", err)
+	}
+	if payment.Status != models.PaymentStatusAuthorized {
+		t.Fatalf("payment captured before the outbox ran: status %s", payment.Status)
+	}
+	if err := outbox.NewWorker(srv.Stores, email.NewMemory("no-reply@test.local"), srv.Payments, srv.Config.Outbox).DeliverDue(context.Background()); err != nil {
+		t.Fatalf("delivering outbox: %v", err)
+	}
+	payment, err = srv.Stores.Payments.GetByOrder(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("looking up payment: %v", err)
+	}
+	if payment.Status != models.PaymentStatusCaptured || payment.CapturedAmount != 7.5 {
+		t.Fatalf("payment after delivery: status %s, captured %.2f", payment.Status, payment.CapturedAmount)
+	}
+
+	rec = buyer.do(http.MethodPost, "/buyer/orders/1/refund-request", map[string]interface{}{
+		"items":  []map[string]int{{"order_item_id": 1, "quantity": 1}},
+		"reason": "One was bruised",
+	})
+	checkGolden(t, "buyer_refund_request", rec)
+
+	if rec := admin.do(http.MethodGet, "/admin/dashboard", nil); rec.Code != http.StatusOK {
+		t.Fatalf("GET /admin/dashboard with a pending refund: status %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = admin.postForm("/admin/refunds/approve", url.Values{"id": {"1"}, "restock": {"on"}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("approving refund: status %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = admin.postForm("/admin/refunds/approve", url.Values{"id": {"1"}})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("approving a refund twice: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	checkGolden(t, "buyer_order_refunded", buyer.do(http.MethodGet, "/buyer/orders/1", nil))
+	if rec := buyer.do(http.MethodGet, "/buyer/orders/2", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET a missing order: status %d", rec.Code)
+	}
+}
+
+// runCheckoutErrors checks out an empty cart and a cart the stock no longer covers
+func runCheckoutErrors(t *testing.T, srv *server, buyer *client) {
+	t.Helper()
+
+	card := map[string]interface{}{"payment_method": "card", "payment_token": "tok_visa"}
+	checkGolden(t, "checkout_empty_cart", buyer.do(http.MethodPost, "/checkout", card))
+
+	rec := buyer.do(http.MethodPost, "/cart/add", map[string]interface{}{"productId": 1, "quantity": 5})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("adding carrots to the cart: status %d: %s", rec.Code, rec.Body.String())
+	}
+	// The farmer writes off most of the carrots while they sit in the cart
+	carrots, err := srv.Stores.Products.GetByID(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("looking up carrots: %v", err)
+	}
+	carrots.Quantity = 2
+	if err := srv.Stores.Products.Update(context.Background(), carrots, "Spoiled"); err != nil {
+		t.Fatalf("lowering carrot stock: %v", err)
+	}
+	checkGolden(t, "checkout_insufficient_stock", buyer.do(http.MethodPost, "/checkout", card))
+
+	if rec := buyer.do(http.MethodDelete, "/cart/remove/1", nil); rec.Code != http.StatusOK {
+		t.Fatalf("removing carrots from the cart: status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// runAdminRoles invites an admin, who signs up through the emailed link, and
+// checks that the role decides which admin routes they can use
+func runAdminRoles(t *testing.T, srv *server, mux http.Handler, superAdmin *client) {
+	t.Helper()
+
+	// The first admin comes from the create-admin command, not a public form
+	if rec := (&client{t: t, handler: mux}).postForm("/admin/register", url.Values{"email": {"eve@example.com"}, "password": {"takeover-2024"}}); rec.Code != http.StatusNotFound {
+		t.Fatalf("POST /admin/register: status %d", rec.Code)
+	}
+
+	// Another site cannot post the admin forms for a signed-in admin, since
+	// it has no way to read the token from the dashboard
+	if rec := superAdmin.postFormCookies("/admin/admins/invite", url.Values{"email": {"eve@example.com"}, "role": {"super_admin"}}); rec.Code != http.StatusForbidden {
+		t.Fatalf("inviting without a CSRF token: status %d", rec.Code)
+	}
+	forged := url.Values{"csrf_token": {"guessed"}, "id": {"1"}, "role": {"support"}}
+	if rec := superAdmin.postFormCookies("/admin/admins/role", forged, &http.Cookie{Name: "csrf_token", Value: "test-csrf-token"}); rec.Code != http.StatusForbidden {
+		t.Fatalf("changing a role with a mismatched CSRF token: status %d", rec.Code)
+	}
+
+	rec := superAdmin.postForm("/admin/admins/invite", url.Values{"email": {"finn@example.com"}, "role": {"finance"}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("inviting an admin: status %d: %s", rec.Code, rec.Body.String())
+	}
+	token := invitationToken(t, srv, "finn@example.com")
+	acceptPath := "/admin/invitations/accept?token=" + token
+
+	invitee := &client{t: t, handler: mux}
+	if rec := invitee.do(http.MethodGet, acceptPath, nil); rec.Code != http.StatusOK {
+		t.Fatalf("GET invitation form: status %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = acceptInvitation(mux, token, "ledger-2024")
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("accepting invitation: status %d: %s", rec.Code, rec.Body.String())
+	}
+	invitee.keepSession(rec)
+	if rec := invitee.do(http.MethodGet, acceptPath, nil); rec.Code != http.StatusGone {
+		t.Fatalf("GET used invitation: status %d", rec.Code)
+	}
+
+	// Finance may see users but not edit them
+	if rec := invitee.do(http.MethodGet, "/admin/users", nil); rec.Code != http.StatusOK {
+		t.Fatalf("GET /admin/users as finance: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := invitee.do(http.MethodGet, "/admin/users/edit-farmer?id=1", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("GET farmer edit form as finance: status %d", rec.Code)
+	}
+	if rec := invitee.postForm("/admin/admins/invite", url.Values{"email": {"eve@example.com"}, "role": {"super_admin"}}); rec.Code != http.StatusForbidden {
+		t.Fatalf("inviting as finance: status %d", rec.Code)
+	}
+
+	finn, err := srv.Stores.Admins.GetByEmail(context.Background(), "finn@example.com")
+	if err != nil {
+		t.Fatalf("looking up invited admin: %v", err)
+	}
+	rec = superAdmin.postForm("/admin/admins/role", url.Values{"id": {strconv.Itoa(finn.ID)}, "role": {"moderator"}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("changing role: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := invitee.do(http.MethodGet, "/admin/users/edit-farmer?id=1", nil); rec.Code != http.StatusOK {
+		t.Fatalf("GET farmer edit form as moderator: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Admins cannot demote themselves, and nobody can demote the last super admin
+	current, err := srv.Stores.Admins.GetByEmail(context.Background(), string(models.RoleSuperAdmin)+"@example.com")
+	if err != nil {
+		t.Fatalf("looking up super admin: %v", err)
+	}
+	if err := srv.Stores.Admins.SetRole(context.Background(), current.ID, models.RoleSupport); !errors.Is(err, models.ErrLastSuperAdmin) {
+		t.Fatalf("demoting the last super admin: got %v, want ErrLastSuperAdmin", err)
+	}
+
+	// An admin created with the same email after the invitation went out
+	// keeps the invitation from being accepted
+	rec = superAdmin.postForm("/admin/admins/invite", url.Values{"email": {"dana@example.com"}, "role": {"support"}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("inviting an admin: status %d: %s", rec.Code, rec.Body.String())
+	}
+	token = invitationToken(t, srv, "dana@example.com")
+	dana := &models.Admin{Email: "dana@example.com", PasswordHash: "unused", IsActive: true, Role: models.RoleSupport}
+	if err := srv.Stores.Admins.Create(context.Background(), dana); err != nil {
+		t.Fatalf("creating admin: %v", err)
+	}
+	if rec := acceptInvitation(mux, token, "support-2024"); rec.Code != http.StatusConflict {
+		t.Fatalf("accepting an invitation for an existing admin: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Farmers and buyers are not admins at all
+	farmer := &client{t: t, handler: mux}
+	farmer.keepSession(farmer.do(http.MethodPost, "/farmer/login", map[string]interface{}{
+		"email":    "greenacres@example.com",
+		"password": "fixture-password",
+	}))
+	if rec := farmer.do(http.MethodGet, "/admin/users", nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("GET /admin/users as a farmer: status %d", rec.Code)
+	}
+}
+
+// invitationToken delivers the queued invitation email to recipient and
+// returns the token from its link, which must point at BASE_URL whatever
+// Host the invite was requested with
+func invitationToken(t *testing.T, srv *server, recipient string) string {
+	t.Helper()
+
+	mailer := email.NewMemory("no-reply@test.local")
+	if err := outbox.NewWorker(srv.Stores, mailer, srv.Payments, srv.Config.Outbox).DeliverDue(context.Background()); err != nil {
+		t.Fatalf("delivering outbox: %v", err)
+	}
+	sent := mailer.Sent()
+	if len(sent) != 1 || sent[0].To != recipient {
+		t.Fatalf("invitation email not sent as expected: %+v", sent)
+	}
+	_, link, ok := strings.Cut(sent[0].Body, srv.Config.Server.BaseURL+"/admin/invitations/accept?token=")
+	if !ok {
+		t.Fatalf("invitation email has no link to %s: %s", srv.Config.Server.BaseURL, sent[0].Body)
+	}
+	return strings.Fields(link)[0]
+}
+
+// acceptInvitation posts the accept form for token with a matching CSRF cookie
+func acceptInvitation(mux http.Handler, token, password string) *httptest.ResponseRecorder {
+	form := url.Values{
+		"csrf_token":       {"test-csrf-token"},
+		"token":            {token},
+		"password":         {password},
+		"confirm_password": {password},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/admin/invitations/accept", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "csrf_token", Value: "test-csrf-token"})
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// seedFixtures adds an approved farmer with one product older than anything the flows create
+func seedFixtures(t *testing.T, stores *store.Store) {
+	t.Helper()
+
+	hash, err := utils.HashPassword("fixture-password")
+	if err != nil {
+		t.Fatalf("hashing fixture password: %v", err)
+	}
+
+	farmer := &models.Farmer{
+		Email:        "greenacres@example.com",
+		PasswordHash: hash,
+		FirstName:    "Gus",
+		LastName:     "Green",
+		FarmName:     "Green Acres",
+		FarmSize:     "40 acres",
+		Location:     "Shymkent",
+	}
+	if err := stores.Farmers.Create(context.Background(), farmer); err != nil {
+		t.Fatalf("creating fixture farmer: %v", err)
+	}
+	approveFarmer(t, stores, farmer.ID)
+
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	product := &models.Product{
+		FarmerID:    farmer.ID,
+		Name:        "Carrots",
+		CategoryID:  1,
+		Price:       1.5,
+		Quantity:    40,
+		Description: "Sweet orange carrots",
+		IsActive:    true,
+		CreatedAt:   created,
+		UpdatedAt:   created,
+		Images:      []string{"carrots.jpg"},
+	}
+	if err := stores.Products.Create(context.Background(), product); err != nil {
+		t.Fatalf("creating fixture product: %v", err)
+	}
+}
+
+func approveFarmer(t *testing.T, stores *store.Store, farmerID int) {
+	t.Helper()
+
+	if err := stores.Farmers.Approve(context.Background(), farmerID); err != nil {
+		t.Fatalf("approving farmer %d: %v", farmerID, err)
+	}
+	if err := stores.Farmers.SetActive(context.Background(), farmerID, true); err != nil {
+		t.Fatalf("activating farmer %d: %v", farmerID, err)
+	}
+}
+
+// adminSession creates an admin with role and logs it in without going
+// through the CSRF-protected form
+func adminSession(t *testing.T, stores *store.Store, role models.Role) *http.Cookie {
+	t.Helper()
+
+	admin := &models.Admin{Email: string(role) + "@example.com", IsActive: true, Role: role}
+	if err := stores.Admins.Create(context.Background(), admin); err != nil {
+		t.Fatalf("creating admin: %v", err)
+	}
+	session, err := models.NewSession(admin.ID, "admin", time.Hour)
+	if err != nil {
+		t.Fatalf("creating admin session: %v", err)
+	}
+	if err := stores.Sessions.Create(context.Background(), session); err != nil {
+		t.Fatalf("saving admin session: %v", err)
+	}
+	return &http.Cookie{Name: "session_id", Value: session.ID}
+}
+
+// client sends requests straight to the mux, carrying the session cookie
+// from the last login. A cookie jar would drop it, since it is Secure.
+type client struct {
+	t       *testing.T
+	handler http.Handler
+	session *http.Cookie
+}
+
+func (c *client) do(method, path string, body interface{}) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			c.t.Fatalf("encoding %s %s body: %v", method, path, err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if c.session != nil {
+		req.AddCookie(c.session)
+	}
+
+	rec := httptest.NewRecorder()
+	c.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// postForm submits an HTML form, the way the admin pages do, with the CSRF
+// token the page would have set
+func (c *client) postForm(path string, form url.Values) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	withToken := url.Values{"csrf_token": {"test-csrf-token"}}
+	for key, values := range form {
+		withToken[key] = values
+	}
+	return c.postFormCookies(path, withToken, &http.Cookie{Name: "csrf_token", Value: "test-csrf-token"})
+}
+
+// postFormCookies submits form with the session cookie and any others given
+func (c *client) postFormCookies(path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.session != nil {
+		req.AddCookie(c.session)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	c.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (c *client) keepSession(rec *httptest.ResponseRecorder) {
+	c.t.Helper()
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "session_id" {
+			c.session = cookie
+			return
+		}
+	}
+	c.t.Fatalf("login response did not set a session cookie (status %d): %s", rec.Code, rec.Body.String())
+}
+
+// goldenResponse is what a golden file holds: the status code and the JSON body
+// with timestamps and payment references replaced, since they change on every run
+type goldenResponse struct {
+	Status int         `json:"status"`
+	Body   interface{} `json:"body"`
+}
+
+func checkGolden(t *testing.T, name string, rec *httptest.ResponseRecorder) {
+	t.Helper()
+
+	decoder := json.NewDecoder(bytes.NewReader(rec.Body.Bytes()))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		t.Fatalf("%s: response is not JSON (status %d): %s", name, rec.Code, rec.Body.String())
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(goldenResponse{Status: rec.Code, Body: normalize(body)}); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("%s: writing golden file: %v", name, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s: reading golden file (run go test -update to create it): %v", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: response does not match %s\n--- got\n%s--- want\n%s", name, path, got, want)
+	}
+}
+
+// normalize replaces every RFC 3339 timestamp and fake provider reference in a
+// decoded JSON value
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalize(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+	case string:
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return "<timestamp>"
+		}
+		if strings.HasPrefix(v, "fake_pay_") || strings.HasPrefix(v, "fake_ref_") {
+			return "<provider ref>"
+		}
+	}
+	return value
+}
@@ -1,26 +1,52 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/api"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/db"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/email"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/events"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/handlers"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/jobs"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/middleware"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/migrations"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/outbox"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/router"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/utils"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/validation"
 	_ "github.com/lib/pq"
 )
 
 func main() {
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL is not set")
+	// CONFIG_FILE names an optional YAML file; environment variables override it
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	log.Printf("Using the %s profile", cfg.Env)
+	models.QueryTimeout = cfg.Database.QueryTimeout
 
-	dbConn, err := db.NewPostgresDB(dbURL)
+	dbConn, err := db.NewPostgresDB(cfg.Database.URL)
 	if err != nil {
 		log.Fatalf("Failed to connect to the database: %v", err)
 	}
@@ -28,6 +54,27 @@ func main() {
 
 	log.Println("Successfully connected to the database!")
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(dbConn, os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	// Set MIGRATE_ON_START=false to apply migrations separately with the migrate subcommand
+	if cfg.Database.MigrateOnStart {
+		if err := migrations.Up(context.Background(), dbConn); err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		if err := runCreateAdmin(dbConn, os.Args[2:]); err != nil {
+			log.Fatalf("create-admin: %v", err)
+		}
+		return
+	}
+
 	cwd, _ := os.Getwd()
 	log.Printf("Current working directory: %s\n", cwd)
 
@@ -36,69 +83,353 @@ func main() {
 		log.Fatalf("Error parsing templates: %v", err)
 	}
 
-	adminHandler := handlers.NewAdminHandler(dbConn, templates)
-	farmerHandler := handlers.NewFarmerHandler(dbConn, templates)
-	buyerHandler := handlers.NewBuyerHandler(dbConn, templates)
-	productHandler := handlers.NewProductHandler(dbConn, templates)
-	cartHandler := handlers.NewCartHandler(dbConn)
+	emailTemplates, err := email.LoadTemplates("web/templates/email", cfg.Mail.DefaultLocale)
+	if err != nil {
+		log.Fatalf("Error parsing email templates: %v", err)
+	}
+
+	mailer, err := email.New(cfg.Mail, cfg.SMTP)
+	if err != nil {
+		log.Fatalf("Failed to configure email: %v", err)
+	}
+	log.Printf("Sending email with the %s driver", cfg.Mail.Driver)
+
+	srv := &server{
+		DB:             dbConn,
+		Stores:         store.NewPostgres(dbConn),
+		Templates:      templates,
+		EmailTemplates: emailTemplates,
+		Payments:       newPaymentProvider(cfg.Payments),
+		Events:         events.NewHub(),
+		Config:         cfg,
+	}
+	httpServer := newHTTPServer(cfg.Server, srv.routes())
+	// Shutdown waits for handlers to return, so end the event streams first
+	httpServer.RegisterOnShutdown(srv.Events.Close)
+
+	// ctx is cancelled on SIGINT or SIGTERM, which stops the background jobs
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	deliveries := outbox.NewWorker(srv.Stores, mailer, srv.Payments, cfg.Outbox)
+
+	var workers sync.WaitGroup
+	workers.Add(4)
+	go func() {
+		defer workers.Done()
+		if err := events.Listen(ctx, cfg.Database.URL, srv.Events); err != nil {
+			log.Printf("Events: %v; /events only carries replayed notifications", err)
+		}
+	}()
+	go func() {
+		defer workers.Done()
+		jobs.RunPeriodic(ctx, "deliver-outbox", cfg.Outbox.PollInterval, deliveries.DeliverDue)
+	}()
+	go func() {
+		defer workers.Done()
+		jobs.RunPeriodic(ctx, "cancel-unpaid-orders", 10*time.Minute, func(ctx context.Context) error {
+			cancelled, err := models.CancelUnpaidSubOrders(ctx, dbConn, time.Now().Add(-cfg.Orders.UnpaidOrderTTL))
+			if cancelled > 0 {
+				log.Printf("Cancelled %d unpaid sub-orders", cancelled)
+			}
+			return err
+		})
+	}()
+	go func() {
+		defer workers.Done()
+		jobs.RunPeriodic(ctx, "release-expired-reservations", time.Minute, func(ctx context.Context) error {
+			released, err := models.ReleaseExpiredReservations(ctx, dbConn)
+			if released > 0 {
+				log.Printf("Released %d expired stock reservations", released)
+			}
+			return err
+		})
+	}()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on port %s", cfg.Server.Port)
+		serverErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.Fatalf("Server failed to start: %v", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Printf("Shutting down, waiting up to %s for in-flight requests", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error draining HTTP server: %v", err)
+	}
+	workers.Wait()
+	log.Println("Server stopped")
+}
 
-	http.Handle("/favicon.ico", http.HandlerFunc(http.NotFound))
+// server holds what the routes depend on. main builds it from the environment;
+// the integration tests build it around a throwaway database.
+type server struct {
+	DB             *sql.DB
+	Stores         *store.Store
+	Templates      map[string]*template.Template
+	EmailTemplates *email.Templates
+	Payments       payments.PaymentProvider
+	Events         *events.Hub
+	Config         *config.Config
+}
 
-	// Admin routes
-	http.HandleFunc("/", adminHandler.Root)
-	http.HandleFunc("/admin/register", adminHandler.Register)
-	http.HandleFunc("/admin/login", adminHandler.Login)
-	http.Handle("/admin/logout", middleware.Authenticate(dbConn, http.HandlerFunc(adminHandler.Logout)))
+// routes registers every endpoint on a new router
+func (s *server) routes() *router.Router {
+	stores := s.Stores
 
-	http.Handle("/admin/dashboard", middleware.Authenticate(dbConn, http.HandlerFunc(adminHandler.Dashboard)))
-	http.Handle("/admin/dashboard/pending-farmers", middleware.Authenticate(dbConn, middleware.AdminOnly(http.HandlerFunc(farmerHandler.ListPendingFarmers))))
-	http.Handle("/admin/dashboard/farmer-profile", middleware.Authenticate(dbConn, middleware.AdminOnly(http.HandlerFunc(farmerHandler.ViewFarmerProfile))))
-	http.Handle("/admin/dashboard/approve-farmer", middleware.Authenticate(dbConn, middleware.AdminOnly(http.HandlerFunc(farmerHandler.ApproveFarmer))))
-	http.Handle("/admin/dashboard/reject-farmer", middleware.Authenticate(dbConn, middleware.AdminOnly(http.HandlerFunc(farmerHandler.RejectFarmer))))
+	adminHandler := handlers.NewAdminHandler(stores, s.Templates, s.EmailTemplates, s.Config)
+	farmerHandler := handlers.NewFarmerHandler(stores, s.Templates, s.EmailTemplates, s.Config)
+	buyerHandler := handlers.NewBuyerHandler(stores, s.Templates, s.Config)
+	productHandler := handlers.NewProductHandler(stores, s.Templates)
+	cartHandler := handlers.NewCartHandler(stores, s.Payments, s.Config)
+	orderHandler := handlers.NewOrderHandler(stores, s.Payments)
+	paymentHandler := handlers.NewPaymentHandler(stores, s.Payments)
+	healthHandler := handlers.NewHealthHandler(s.DB)
+	emailHandler := handlers.NewEmailHandler(s.EmailTemplates)
+	notificationHandler := handlers.NewNotificationHandler(stores)
+	eventsHandler := handlers.NewEventsHandler(stores, s.Events, s.Config)
 
-	http.Handle("/admin/users", middleware.Authenticate(dbConn, middleware.AdminOnly(http.HandlerFunc(adminHandler.ListUsers))))
+	authenticate := func(next http.Handler) http.Handler {
+		return middleware.Authenticate(stores, next)
+	}
 
-	http.Handle("/admin/users/toggle-farmer-status", middleware.Authenticate(dbConn, middleware.AdminOnly(http.HandlerFunc(farmerHandler.ToggleFarmerStatus))))
-	http.Handle("/admin/users/edit-farmer", middleware.Authenticate(dbConn, middleware.AdminOnly(http.HandlerFunc(farmerHandler.EditFarmer))))
-	http.Handle("/admin/users/delete-farmer", middleware.Authenticate(dbConn, middleware.AdminOnly(http.HandlerFunc(farmerHandler.DeleteFarmer))))
+	root := router.New()
 
-	http.Handle("/admin/users/toggle-buyer-status", middleware.Authenticate(dbConn, middleware.AdminOnly(http.HandlerFunc(buyerHandler.ToggleBuyerStatus))))
-	http.Handle("/admin/users/edit-buyer", middleware.Authenticate(dbConn, middleware.AdminOnly(http.HandlerFunc(buyerHandler.EditBuyer))))
-	http.Handle("/admin/users/delete-buyer", middleware.Authenticate(dbConn, middleware.AdminOnly(http.HandlerFunc(buyerHandler.DeleteBuyer))))
+	root.Get("/favicon.ico", http.NotFound)
 
-	// Buyer Routes
-	http.Handle("/buyer/register", middleware.CORS(http.HandlerFunc(buyerHandler.Register)))
-	http.Handle("/buyer/login", middleware.CORS(http.HandlerFunc(buyerHandler.Login)))
-	http.Handle("/buyer/logout", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(buyerHandler.Logout))))
-	http.Handle("/buyer/home", middleware.CORS(middleware.Authenticate(dbConn,http.HandlerFunc(buyerHandler.Home))))
-	http.Handle("/buyer/product/", middleware.CORS(http.HandlerFunc(productHandler.GetProductDetails)))
+	spec := apiSpec()
+	root.Get("/api/openapi.json", spec.ServeHTTP)
 
-	http.Handle("/cart", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(cartHandler.GetCart))))
-	http.Handle("/cart/add", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(cartHandler.AddToCart))))
-	http.Handle("/cart/remove/", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(cartHandler.RemoveFromCart))))
-	http.Handle("/cart/update", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(cartHandler.UpdateCart))))
+	// Probes for the container orchestrator
+	root.Get("/healthz", healthHandler.Healthz)
+	root.Get("/readyz", healthHandler.Readyz)
 
-	http.Handle("/checkout", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(cartHandler.Checkout))))
+	// Admin pages. The first admin is created with the create-admin command;
+	// the rest are invited.
+	root.Get("/{$}", adminHandler.Root)
+	root.Get("/admin/login", adminHandler.LoginForm)
+	root.Post("/admin/login", adminHandler.Login)
+	root.Get("/admin/invitations/accept", adminHandler.AcceptInvitationForm)
+	root.Post("/admin/invitations/accept", adminHandler.AcceptInvitation)
 
-	// Farmer Routes
-	http.Handle("/farmer/register", middleware.CORS(http.HandlerFunc(farmerHandler.Register)))
-	http.Handle("/farmer/login", middleware.CORS(http.HandlerFunc(farmerHandler.Login)))
-	http.Handle("/farmer/logout", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(farmerHandler.Logout))))
-	http.Handle("/farmer/dashboard", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(farmerHandler.Dashboard))))
-	http.Handle("/farmer/product/add-product", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(farmerHandler.AddProduct))))
-	http.Handle("/farmer/product/list-products", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(farmerHandler.ListProducts))))
-	http.Handle("/farmer/product/edit-product", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(farmerHandler.EditProduct))))
-	http.Handle("/farmer/product/delete-product", middleware.CORS(middleware.Authenticate(dbConn, http.HandlerFunc(farmerHandler.DeleteProduct))))
+	// Dashboard redirects non-admins to the login page itself, and shows
+	// each admin the sections their role allows
+	session := root.Group("/admin", authenticate)
+	session.Get("/logout", adminHandler.Logout)
+	session.Post("/logout", adminHandler.Logout)
+	session.Get("/dashboard", adminHandler.Dashboard)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Everything else needs a permission of the admin's role
+	can := func(permission models.Permission) *router.Router {
+		return root.Group("/admin", authenticate, middleware.RequirePermission(permission))
 	}
 
-	log.Printf("Server starting on port %s", port)
-	err = http.ListenAndServe(":"+port, nil)
+	farmerReview := can(models.PermReviewFarmers)
+	farmerReview.Get("/dashboard/pending-farmers", farmerHandler.ListPendingFarmers)
+	farmerReview.Get("/dashboard/farmer-profile", farmerHandler.ViewFarmerProfile)
+	farmerReview.Post("/dashboard/approve-farmer", farmerHandler.ApproveFarmer)
+	farmerReview.Post("/dashboard/reject-farmer", farmerHandler.RejectFarmer)
+
+	refunds := can(models.PermManageRefunds)
+	refunds.Post("/orders/refund", orderHandler.AdminIssueRefund)
+	refunds.Post("/refunds/approve", orderHandler.ApproveRefund)
+	refunds.Post("/refunds/reject", orderHandler.RejectRefund)
+
+	deliveries := can(models.PermManageDeliveries)
+	deliveries.Post("/outbox/retry", adminHandler.RetryDelivery)
+	deliveries.Get("/email/preview", emailHandler.Preview)
+
+	can(models.PermViewUsers).Get("/users", adminHandler.ListUsers)
+
+	users := can(models.PermManageUsers)
+	users.Post("/users/toggle-farmer-status", farmerHandler.ToggleFarmerStatus)
+	users.Get("/users/edit-farmer", farmerHandler.EditFarmerForm)
+	users.Post("/users/edit-farmer", farmerHandler.EditFarmer)
+	users.Post("/users/delete-farmer", farmerHandler.DeleteFarmer)
+
+	users.Post("/users/toggle-buyer-status", buyerHandler.ToggleBuyerStatus)
+	users.Get("/users/edit-buyer", buyerHandler.EditBuyerForm)
+	users.Post("/users/edit-buyer", buyerHandler.EditBuyer)
+	users.Post("/users/delete-buyer", buyerHandler.DeleteBuyer)
+
+	admins := can(models.PermManageAdmins)
+	admins.Post("/admins/invite", adminHandler.InviteAdmin)
+	admins.Post("/admins/role", adminHandler.SetAdminRole)
+	admins.Post("/invitations/revoke", adminHandler.RevokeInvitation)
+
+	root.Post("/payments/webhook", paymentHandler.Webhook)
+
+	// JSON API for the frontend, which runs on another origin. It is served
+	// under /api/v1 in the api.Response envelope, and at its original paths
+	// with the original bodies until the frontend has moved over.
+	jsonAPI := func(base *router.Router) {
+		public := base.Group("", middleware.CORS).Preflight()
+		authed := public.Group("", authenticate)
+		buyer := public.Group("", authenticate, middleware.BuyerOnly)
+		farmer := public.Group("", authenticate, middleware.FarmerOnly)
+
+		// Buyer routes
+		public.Post("/buyer/register", buyerHandler.Register)
+		public.Post("/buyer/login", buyerHandler.Login)
+		public.Get("/buyer/product/{id}", productHandler.GetProductDetails)
+		buyer.Post("/buyer/logout", buyerHandler.Logout)
+		buyer.Get("/buyer/home", buyerHandler.Home)
+
+		buyer.Get("/cart", cartHandler.GetCart)
+		buyer.Post("/cart/add", cartHandler.AddToCart)
+		buyer.Delete("/cart/remove/{productId}", cartHandler.RemoveFromCart)
+		buyer.Post("/cart/update", cartHandler.UpdateCart)
+
+		buyer.Post("/checkout", cartHandler.Checkout)
+
+		buyer.Get("/buyer/orders", orderHandler.ListBuyerOrders)
+		buyer.Get("/buyer/orders/{id}", orderHandler.GetBuyerOrder)
+		buyer.Post("/buyer/orders/{id}/refund-request", orderHandler.RequestBuyerRefund)
+
+		// Inbox and live events of the signed-in farmer or buyer
+		authed.Get("/notifications", notificationHandler.List)
+		authed.Post("/notifications/read-all", notificationHandler.MarkAllRead)
+		authed.Post("/notifications/{id}/read", notificationHandler.MarkRead)
+		authed.Delete("/notifications/{id}", notificationHandler.Delete)
+		authed.Get("/events", eventsHandler.Stream)
+
+		// Farmer routes
+		public.Post("/farmer/register", farmerHandler.Register)
+		public.Post("/farmer/login", farmerHandler.Login)
+		farmer.Post("/farmer/logout", farmerHandler.Logout)
+		farmer.Get("/farmer/dashboard", farmerHandler.Dashboard)
+		farmer.Post("/farmer/product/add-product", farmerHandler.AddProduct)
+		farmer.Post("/farmer/product/list-products", farmerHandler.ListProducts)
+		farmer.Post("/farmer/product/edit-product", farmerHandler.EditProduct)
+		farmer.Delete("/farmer/product/delete-product", farmerHandler.DeleteProduct)
+		farmer.Get("/farmer/product/{id}/stock-history", farmerHandler.StockHistory)
+
+		farmer.Get("/farmer/orders", orderHandler.ListFarmerOrders)
+		farmer.Get("/farmer/orders/{id}", orderHandler.GetFarmerOrder)
+		farmer.Post("/farmer/orders/{id}/status", orderHandler.UpdateFarmerOrderStatus)
+		farmer.Post("/farmer/orders/{id}/mark-paid", orderHandler.MarkFarmerOrderPaid)
+		farmer.Post("/farmer/orders/{id}/refund", orderHandler.IssueFarmerRefund)
+	}
+	root.Use(api.Envelope(api.Prefix))
+	jsonAPI(root.Group(api.Prefix))
+	jsonAPI(root.Group("", api.Deprecated(api.Prefix)))
+
+	return root
+}
+
+// runMigrate implements "migrate up", "migrate down [steps]" and "migrate status"
+func runMigrate(dbConn *sql.DB, args []string) error {
+	ctx := context.Background()
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up | down [steps] | status")
+	}
+
+	switch args[0] {
+	case "up":
+		return migrations.Up(ctx, dbConn)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid steps %q", args[1])
+			}
+			steps = n
+		}
+		return migrations.Down(ctx, dbConn, steps)
+	case "status":
+		statuses, err := migrations.GetStatus(ctx, dbConn)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+// runCreateAdmin implements "create-admin EMAIL", which sets up the first
+// admin as a super admin. The password is read from ADMIN_PASSWORD or, if
+// that is unset, from the first line of standard input.
+func runCreateAdmin(dbConn *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: create-admin EMAIL")
+	}
+
+	password, ok := os.LookupEnv("ADMIN_PASSWORD")
+	if !ok {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("reading password: %v", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	req := firstAdmin{Email: strings.TrimSpace(args[0]), Password: password}
+	if errs := validation.Struct(&req); errs != nil {
+		return errs
+	}
+	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+		return err
+	}
+
+	admin := &models.Admin{
+		Email:        req.Email,
+		PasswordHash: hashedPassword,
+		IsActive:     true,
+		Role:         models.RoleSuperAdmin,
+	}
+	if err := models.CreateFirstAdmin(context.Background(), dbConn, admin); err != nil {
+		if errors.Is(err, models.ErrAdminSetupDone) {
+			return fmt.Errorf("%v; ask a super admin for an invitation", err)
+		}
+		return err
+	}
+	log.Printf("Created super admin %d (%s)", admin.ID, admin.Email)
+	return nil
+}
+
+// firstAdmin is what create-admin checks before creating the first admin
+type firstAdmin struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+// newPaymentProvider builds the gateway the configuration names; Validate
+// has already checked the provider and its keys
+func newPaymentProvider(settings config.Payments) payments.PaymentProvider {
+	if settings.Provider == "stripe" {
+		return payments.NewStripeProvider(settings.StripeAPIBase, settings.StripeSecretKey, settings.WebhookSecret)
+	}
+	log.Println("Using the fake payment provider")
+	return payments.NewFakeProvider(settings.WebhookSecret)
+}
+
+func newHTTPServer(settings config.Server, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:           ":" + settings.Port,
+		Handler:        handler,
+		ReadTimeout:    settings.ReadTimeout,
+		WriteTimeout:   settings.WriteTimeout,
+		IdleTimeout:    settings.IdleTimeout,
+		MaxHeaderBytes: settings.MaxHeaderBytes,
 	}
 }
 
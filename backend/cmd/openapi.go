@@ -0,0 +1,303 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/api"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/handlers"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/openapi"
+)
+
+// apiSpec documents every route registered in routes(). The JSON API is
+// documented at its /api/v1 paths only; the deprecated aliases at the old
+// paths take the same requests.
+func apiSpec() *openapi.Document {
+	doc := openapi.New("Farmer Market System API", "1.0.0",
+		"JSON API for the buyer and farmer apps under "+api.Prefix+", and the server-rendered admin pages. "+
+			"Sign-in sets the session_id cookie that the other endpoints require.")
+	doc.Components.SecuritySchemes["session"] = openapi.SecurityScheme{Type: "apiKey", In: "cookie", Name: "session_id"}
+	doc.Components.Schemas["ErrorResponse"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"data":  {Nullable: true},
+			"error": doc.SchemaOf(api.Error{}),
+		},
+	}
+	doc.SchemaOf(api.Meta{})
+
+	s := &specBuilder{doc: doc}
+
+	// Probes
+	s.page(http.MethodGet, "/healthz", "system", "Liveness probe", "application/json")
+	s.page(http.MethodGet, "/readyz", "system", "Readiness probe; 503 when the database is unreachable", "application/json")
+	s.page(http.MethodGet, "/api/openapi.json", "system", "This document", "application/json")
+
+	// Admin pages
+	s.redirect(s.page(http.MethodGet, "/{$}", "admin", "Redirects to the admin login page", "text/html"))
+	s.page(http.MethodGet, "/admin/login", "admin", "Admin login form", "text/html")
+	s.form(http.MethodPost, "/admin/login", "Sign in as an admin", false, "csrf_token", "email", "password")
+	s.query(s.page(http.MethodGet, "/admin/invitations/accept", "admin", "Form to accept an admin invitation; 410 once it is used or expired", "text/html"),
+		"token", "string", true, "Token from the invitation email")
+	s.form(http.MethodPost, "/admin/invitations/accept", "Accept an admin invitation by choosing a password, and sign in", false, "csrf_token", "token", "password", "confirm_password")
+	s.redirect(s.admin(s.page(http.MethodGet, "/admin/logout", "admin", "Sign out", "text/html")))
+	s.form(http.MethodPost, "/admin/logout", "Sign out", true)
+	s.admin(s.page(http.MethodGet, "/admin/dashboard", "admin", "Dashboard with the sections the admin's role allows: pending farmers, refund requests, failed deliveries and admins", "text/html"))
+	s.requires(s.page(http.MethodGet, "/admin/dashboard/pending-farmers", "admin", "Farmers waiting for approval", "text/html"), models.PermReviewFarmers)
+	s.query(s.requires(s.page(http.MethodGet, "/admin/dashboard/farmer-profile", "admin", "A farmer's profile", "text/html"), models.PermReviewFarmers), "id", "integer", true, "Farmer ID")
+	s.requires(s.form(http.MethodPost, "/admin/dashboard/approve-farmer", "Approve a farmer", true, "id"), models.PermReviewFarmers)
+	s.requires(s.form(http.MethodPost, "/admin/dashboard/reject-farmer", "Reject a farmer", true, "id", "reason"), models.PermReviewFarmers)
+	s.requires(s.form(http.MethodPost, "/admin/orders/refund", "Refund an order; repeat order_item_id and quantity to refund part of it", true, "order_id", "reason", "order_item_id", "quantity", "restock"), models.PermManageRefunds)
+	s.requires(s.form(http.MethodPost, "/admin/refunds/approve", "Approve a buyer's refund request", true, "id", "restock", "note"), models.PermManageRefunds)
+	s.requires(s.form(http.MethodPost, "/admin/refunds/reject", "Reject a buyer's refund request", true, "id", "note"), models.PermManageRefunds)
+	s.requires(s.form(http.MethodPost, "/admin/outbox/retry", "Retry a failed email or notification delivery", true, "id"), models.PermManageDeliveries)
+	emailPreview := s.requires(s.page(http.MethodGet, "/admin/email/preview", "admin", "Render an email template with sample data; without template, list the templates", "text/html"), models.PermManageDeliveries)
+	s.query(emailPreview, "template", "string", false, "Template name, such as farmer_approved")
+	s.query(emailPreview, "locale", "string", false, "Locale to render, falling back to the default")
+	s.query(emailPreview, "format", "string", false, "html (default) or text")
+	s.requires(s.page(http.MethodGet, "/admin/users", "admin", "Farmers and buyers", "text/html"), models.PermViewUsers)
+	s.requires(s.form(http.MethodPost, "/admin/users/toggle-farmer-status", "Activate or deactivate a farmer", true, "id"), models.PermManageUsers)
+	s.query(s.requires(s.page(http.MethodGet, "/admin/users/edit-farmer", "admin", "Farmer edit form", "text/html"), models.PermManageUsers), "id", "integer", true, "Farmer ID")
+	s.requires(s.form(http.MethodPost, "/admin/users/edit-farmer", "Update a farmer", true, "id", "email", "first_name", "last_name", "farm_name", "farm_size", "location", "status", "is_active"), models.PermManageUsers)
+	s.requires(s.form(http.MethodPost, "/admin/users/delete-farmer", "Delete a farmer", true, "id"), models.PermManageUsers)
+	s.requires(s.form(http.MethodPost, "/admin/users/toggle-buyer-status", "Activate or deactivate a buyer", true, "id"), models.PermManageUsers)
+	s.query(s.requires(s.page(http.MethodGet, "/admin/users/edit-buyer", "admin", "Buyer edit form", "text/html"), models.PermManageUsers), "id", "integer", true, "Buyer ID")
+	s.requires(s.form(http.MethodPost, "/admin/users/edit-buyer", "Update a buyer", true, "id", "email", "first_name", "last_name", "delivery_address", "is_active"), models.PermManageUsers)
+	s.requires(s.form(http.MethodPost, "/admin/users/delete-buyer", "Delete a buyer", true, "id"), models.PermManageUsers)
+	s.requires(s.form(http.MethodPost, "/admin/admins/invite", "Invite an admin with a role; the invitation link is emailed and valid for 7 days", true, "email", "role"), models.PermManageAdmins)
+	s.requires(s.form(http.MethodPost, "/admin/admins/role", "Change another admin's role", true, "id", "role"), models.PermManageAdmins)
+	s.requires(s.form(http.MethodPost, "/admin/invitations/revoke", "Withdraw an invitation that was not accepted yet", true, "id"), models.PermManageAdmins)
+
+	s.page(http.MethodPost, "/payments/webhook", "payments",
+		"Payment provider callback; the provider signs the payload with the webhook secret", "application/json")
+
+	message := object(map[string]*openapi.Schema{"message": {Type: "string"}})
+	product := doc.SchemaOf(models.Product{})
+	refund := object(map[string]*openapi.Schema{"message": {Type: "string"}, "refund": doc.SchemaOf(models.Refund{})})
+	subOrder := object(map[string]*openapi.Schema{"message": {Type: "string"}, "order": doc.SchemaOf(models.SubOrder{})})
+
+	// Buyers
+	s.json(http.MethodPost, "/buyer/register", "buyer", "Register a buyer", false, handlers.BuyerRegisterRequest{}, http.StatusCreated,
+		object(map[string]*openapi.Schema{"id": {Type: "integer"}, "email": {Type: "string"}}))
+	s.json(http.MethodPost, "/buyer/login", "buyer", "Sign in as a buyer; sets the session cookie", false, handlers.LoginRequest{}, http.StatusOK, message)
+	s.json(http.MethodPost, "/buyer/logout", "buyer", "Sign out", true, nil, http.StatusOK, message)
+	home := s.json(http.MethodGet, "/buyer/home", "buyer", "Browse active products; the X-Unread-Notifications header has the unread count", true, nil, http.StatusOK,
+		&openapi.Schema{Type: "array", Items: product})
+	s.query(home, "category", "string", false, "vegetables, fruits or seeds")
+	s.query(home, "search", "string", false, "Matches the name or description")
+	s.query(home, "sort", "string", false, "price_asc, price_desc, date_asc or date_desc")
+	s.paginated(home)
+	s.pathID(s.json(http.MethodGet, "/buyer/product/{id}", "buyer", "A product", false, nil, http.StatusOK, product), "id")
+
+	// Cart
+	s.json(http.MethodGet, "/cart", "cart", "The buyer's cart", true, nil, http.StatusOK,
+		object(map[string]*openapi.Schema{"cart": {Type: "array", Items: doc.SchemaOf(models.CartItem{})}}))
+	s.json(http.MethodPost, "/cart/add", "cart", "Add a product; 409 insufficient_stock when the quantity is not available", true, handlers.AddToCartRequest{}, http.StatusOK, message)
+	s.pathID(s.json(http.MethodDelete, "/cart/remove/{productId}", "cart", "Remove a product", true, nil, http.StatusOK, message), "productId")
+	s.json(http.MethodPost, "/cart/update", "cart", "Change a product's quantity; 0 removes it", true, handlers.UpdateCartRequest{}, http.StatusOK, message)
+	checkout := s.json(http.MethodPost, "/checkout", "cart", "Place an order for the cart and pay for it; 400 empty_cart or payment_method_mismatch, 402 payment_declined, 409 insufficient_stock or cart_changed", true, handlers.CheckoutRequest{}, http.StatusOK,
+		object(map[string]*openapi.Schema{"message": {Type: "string"}, "order_id": {Type: "integer"}}))
+	checkout.RequestBody.Required = false
+
+	// Buyer orders
+	buyerOrders := s.json(http.MethodGet, "/buyer/orders", "orders", "The buyer's orders, newest first", true, nil, http.StatusOK,
+		object(map[string]*openapi.Schema{"orders": {Type: "array", Items: doc.SchemaOf(models.Order{})}}))
+	s.orderFilters(buyerOrders)
+	s.pathID(s.json(http.MethodGet, "/buyer/orders/{id}", "orders", "An order with its per-farmer subtotals and refunds", true, nil, http.StatusOK,
+		object(map[string]*openapi.Schema{
+			"order":            doc.SchemaOf(models.Order{}),
+			"farmer_subtotals": {Type: "array", Items: doc.SchemaOf(models.FarmerSubtotal{})},
+			"refunds":          {Type: "array", Items: doc.SchemaOf(models.Refund{})},
+		})), "id")
+	s.pathID(s.json(http.MethodPost, "/buyer/orders/{id}/refund-request", "orders", "Ask for a refund of a delivered order; items may be omitted to refund everything", true,
+		handlers.RefundPayload{}, http.StatusCreated, refund), "id")
+
+	// Inbox and live events
+	notifications := s.json(http.MethodGet, "/notifications", "notifications", "The signed-in farmer's or buyer's notifications, newest first", true, nil, http.StatusOK,
+		object(map[string]*openapi.Schema{
+			"notifications": {Type: "array", Items: doc.SchemaOf(models.Notification{})},
+			"unread_count":  {Type: "integer"},
+		}))
+	s.query(notifications, "unread", "boolean", false, "Only unread notifications")
+	s.paginated(notifications)
+	s.json(http.MethodPost, "/notifications/read-all", "notifications", "Mark every notification read", true, nil, http.StatusOK,
+		object(map[string]*openapi.Schema{"marked": {Type: "integer"}}))
+	s.pathID(s.json(http.MethodPost, "/notifications/{id}/read", "notifications", "Mark a notification read", true, nil, http.StatusOK, message), "id")
+	s.pathID(s.json(http.MethodDelete, "/notifications/{id}", "notifications", "Delete a notification", true, nil, http.StatusOK, message), "id")
+	events := s.page(http.MethodGet, api.Prefix+"/events", "notifications",
+		"Server-Sent Events: notification, order and stock events for the signed-in farmer or buyer. "+
+			"Reconnecting with Last-Event-ID replays missed notifications.", "text/event-stream")
+	s.authed(events)
+	s.query(events, "last_event_id", "integer", false, "Replay notifications after this ID, like the Last-Event-ID header")
+
+	// Farmers
+	s.json(http.MethodPost, "/farmer/register", "farmer", "Register a farmer; an admin approves the account", false, handlers.FarmerRegisterRequest{}, http.StatusCreated, message)
+	s.json(http.MethodPost, "/farmer/login", "farmer", "Sign in as a farmer; sets the session cookie", false, handlers.LoginRequest{}, http.StatusOK, message)
+	s.json(http.MethodPost, "/farmer/logout", "farmer", "Sign out", true, nil, http.StatusOK, message)
+	s.json(http.MethodGet, "/farmer/dashboard", "farmer", "The farmer's profile, low-stock products and unread count", true, nil, http.StatusOK,
+		doc.SchemaOf(handlers.FarmerDashboardResponse{}))
+	s.json(http.MethodPost, "/farmer/product/add-product", "farmer", "Add a product", true, handlers.AddProductRequest{}, http.StatusCreated,
+		object(map[string]*openapi.Schema{"product": product}))
+	s.json(http.MethodPost, "/farmer/product/list-products", "farmer", "The farmer's products", true, nil, http.StatusOK,
+		object(map[string]*openapi.Schema{"products": {Type: "array", Items: product}}))
+	s.json(http.MethodPost, "/farmer/product/edit-product", "farmer", "Update a product; a quantity change is recorded with stock_reason", true,
+		handlers.EditProductRequest{}, http.StatusOK, object(map[string]*openapi.Schema{"product": product}))
+	s.json(http.MethodDelete, "/farmer/product/delete-product", "farmer", "Delete a product", true, handlers.DeleteProductRequest{}, http.StatusOK, message)
+	stockHistory := s.json(http.MethodGet, "/farmer/product/{id}/stock-history", "farmer", "A product's stock movements, newest first", true, nil, http.StatusOK,
+		object(map[string]*openapi.Schema{"movements": {Type: "array", Items: doc.SchemaOf(models.InventoryMovement{})}}))
+	s.pathID(stockHistory, "id")
+	s.paginated(stockHistory)
+
+	// Farmer orders
+	farmerOrders := s.json(http.MethodGet, "/farmer/orders", "orders", "The farmer's share of orders, newest first", true, nil, http.StatusOK,
+		object(map[string]*openapi.Schema{"orders": {Type: "array", Items: doc.SchemaOf(models.SubOrder{})}}))
+	s.orderFilters(farmerOrders)
+	s.pathID(s.json(http.MethodGet, "/farmer/orders/{id}", "orders", "The farmer's share of an order with its status history", true, nil, http.StatusOK,
+		object(map[string]*openapi.Schema{
+			"order":   doc.SchemaOf(models.SubOrder{}),
+			"history": {Type: "array", Items: doc.SchemaOf(models.OrderStatusChange{})},
+		})), "id")
+	s.pathID(s.json(http.MethodPost, "/farmer/orders/{id}/status", "orders", "Move the order to the next status; 409 invalid_status_transition otherwise", true,
+		handlers.OrderStatusRequest{}, http.StatusOK, subOrder), "id")
+	s.pathID(s.json(http.MethodPost, "/farmer/orders/{id}/mark-paid", "orders", "Record a cash payment", true, nil, http.StatusOK, subOrder), "id")
+	s.pathID(s.json(http.MethodPost, "/farmer/orders/{id}/refund", "orders", "Refund the farmer's share of a delivered order; items may be omitted to refund everything", true,
+		handlers.RefundPayload{}, http.StatusCreated, refund), "id")
+
+	return doc
+}
+
+// specBuilder adds the operations of apiSpec with their common parts
+type specBuilder struct {
+	doc *openapi.Document
+}
+
+// json documents a JSON API operation at its /api/v1 path. The success body
+// is the envelope with data; errors are ErrorResponse.
+func (s *specBuilder) json(method, path, tag, summary string, authed bool, request interface{}, status int, data *openapi.Schema) *openapi.Operation {
+	op := &openapi.Operation{
+		Tags:    []string{tag},
+		Summary: summary,
+		Responses: map[string]openapi.Response{
+			strconv.Itoa(status): {
+				Description: http.StatusText(status),
+				Content: map[string]openapi.MediaType{"application/json": {Schema: object(map[string]*openapi.Schema{
+					"data": data,
+					"meta": openapi.Ref("Meta"),
+				})}},
+			},
+			"default": {
+				Description: "Error",
+				Content:     map[string]openapi.MediaType{"application/json": {Schema: openapi.Ref("ErrorResponse")}},
+			},
+		},
+	}
+	if request != nil {
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]openapi.MediaType{"application/json": {Schema: s.doc.SchemaOf(request)}},
+		}
+		op.Responses["422"] = openapi.Response{
+			Description: "validation_failed, with the problems of each field in error.fields",
+			Content:     map[string]openapi.MediaType{"application/json": {Schema: openapi.Ref("ErrorResponse")}},
+		}
+	}
+	if authed {
+		s.authed(op)
+	}
+	s.doc.Add(method, api.Prefix+path, op)
+	return op
+}
+
+// page documents an operation that answers with something other than the
+// JSON envelope, such as an admin page
+func (s *specBuilder) page(method, path, tag, summary, contentType string) *openapi.Operation {
+	op := &openapi.Operation{
+		Tags:    []string{tag},
+		Summary: summary,
+		Responses: map[string]openapi.Response{
+			"200": {Description: "OK", Content: map[string]openapi.MediaType{contentType: {Schema: &openapi.Schema{}}}},
+		},
+	}
+	s.doc.Add(method, path, op)
+	return op
+}
+
+// form documents an admin form post, which redirects back to a page
+func (s *specBuilder) form(method, path, summary string, admin bool, fields ...string) *openapi.Operation {
+	op := &openapi.Operation{
+		Tags:    []string{"admin"},
+		Summary: summary,
+	}
+	s.redirect(op)
+	if len(fields) > 0 {
+		properties := make(map[string]*openapi.Schema)
+		for _, field := range fields {
+			properties[field] = &openapi.Schema{Type: "string"}
+		}
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]openapi.MediaType{"application/x-www-form-urlencoded": {Schema: object(properties)}},
+		}
+	}
+	if admin {
+		s.admin(op)
+	}
+	s.doc.Add(method, path, op)
+	return op
+}
+
+func (s *specBuilder) redirect(op *openapi.Operation) *openapi.Operation {
+	op.Responses = map[string]openapi.Response{"303": {Description: "Redirect to the next admin page"}}
+	return op
+}
+
+func (s *specBuilder) authed(op *openapi.Operation) *openapi.Operation {
+	op.Security = []map[string][]string{{"session": {}}}
+	return op
+}
+
+func (s *specBuilder) admin(op *openapi.Operation) *openapi.Operation {
+	op.Description = "Requires an admin session."
+	return s.authed(op)
+}
+
+// requires documents the permission an admin's role needs for op
+func (s *specBuilder) requires(op *openapi.Operation, permission models.Permission) *openapi.Operation {
+	s.admin(op)
+	op.Description = "Requires an admin session whose role has the " + string(permission) + " permission."
+	op.Responses["403"] = openapi.Response{Description: "The admin's role does not have the permission"}
+	return op
+}
+
+func (s *specBuilder) pathID(op *openapi.Operation, name string) *openapi.Operation {
+	op.Parameters = append(op.Parameters, openapi.Parameter{Name: name, In: "path", Required: true, Schema: &openapi.Schema{Type: "integer"}})
+	return op
+}
+
+func (s *specBuilder) query(op *openapi.Operation, name, schemaType string, required bool, description string) *openapi.Operation {
+	op.Parameters = append(op.Parameters, openapi.Parameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Required:    required,
+		Schema:      &openapi.Schema{Type: schemaType},
+	})
+	return op
+}
+
+func (s *specBuilder) paginated(op *openapi.Operation) {
+	s.query(op, "page", "integer", false, "Page number, from 1")
+	s.query(op, "limit", "integer", false, "Page size")
+}
+
+func (s *specBuilder) orderFilters(op *openapi.Operation) {
+	s.query(op, "status", "string", false, "Only orders with this status")
+	s.query(op, "from", "string", false, "Placed on or after this date (YYYY-MM-DD or RFC 3339)")
+	s.query(op, "to", "string", false, "Placed on or before this date (YYYY-MM-DD or RFC 3339)")
+	s.paginated(op)
+}
+
+func object(properties map[string]*openapi.Schema) *openapi.Schema {
+	return &openapi.Schema{Type: "object", Properties: properties}
+}
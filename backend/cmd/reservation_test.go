@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/pgtest"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
+)
+
+// TestExpiredHoldReleasedOnReserve changes a cart whose hold ran out before the
+// sweeper got to it: the old hold must be released in the ledger, not
+// overwritten, so the reservation rows still add up to what is held
+func TestExpiredHoldReleasedOnReserve(t *testing.T) {
+	dbConn := pgtest.Start(t)
+	stores := store.NewPostgres(dbConn)
+	seedFixtures(t, stores)
+	ctx := context.Background()
+
+	buyer := &models.Buyer{
+		Email:           "bo@example.com",
+		PasswordHash:    "unused",
+		FirstName:       "Bo",
+		LastName:        "Market",
+		DeliveryAddress: "1 Market Street",
+		IsActive:        true,
+	}
+	if err := stores.Buyers.Create(ctx, buyer); err != nil {
+		t.Fatalf("creating buyer: %v", err)
+	}
+
+	if err := stores.Carts.Add(ctx, buyer.ID, 1, 5, time.Minute); err != nil {
+		t.Fatalf("adding carrots to the cart: %v", err)
+	}
+	_, err := dbConn.ExecContext(ctx, `UPDATE stock_reservations SET expires_at = NOW() - INTERVAL '1 minute' WHERE buyer_id = $1`, buyer.ID)
+	if err != nil {
+		t.Fatalf("expiring the hold: %v", err)
+	}
+	if err := stores.Carts.Update(ctx, buyer.ID, 1, 3, time.Minute); err != nil {
+		t.Fatalf("updating the cart: %v", err)
+	}
+
+	movements, _, err := stores.Products.GetStockHistory(ctx, 1, 50, 0)
+	if err != nil {
+		t.Fatalf("reading stock history: %v", err)
+	}
+	held, released := 0, 0
+	for _, movement := range movements {
+		switch movement.MovementType {
+		case models.MovementReservation:
+			held += movement.QuantityChange
+		case models.MovementReservationRelease:
+			held += movement.QuantityChange
+			released++
+		}
+	}
+	if held != 3 || released != 1 {
+		t.Fatalf("ledger holds %d carrots with %d releases, want 3 with 1", held, released)
+	}
+}
@@ -0,0 +1,104 @@
+// Package api defines the response envelope of the versioned JSON API under
+// /api/v1 and its error codes. Every response there has the shape
+//
+//	{"data": ..., "error": {"code", "message", "fields"}, "meta": {"pagination"}}
+//
+// where error and meta are only present when they apply.
+package api
+
+import "net/http"
+
+// Prefix is the path prefix of the current API version
+const Prefix = "/api/v1"
+
+// Code identifies an error independently of its message, so clients can
+// branch on it
+type Code string
+
+// Codes for the HTTP status of an error that has no more specific code
+const (
+	CodeBadRequest       Code = "bad_request"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodeTooLarge         Code = "request_too_large"
+	CodeValidation       Code = "validation_failed"
+	CodeInternal         Code = "internal_error"
+	CodeUnavailable      Code = "service_unavailable"
+)
+
+// Cart, order and refund errors
+const (
+	CodeInsufficientStock     Code = "insufficient_stock"
+	CodeEmptyCart             Code = "empty_cart"
+	CodePaymentMethodMismatch Code = "payment_method_mismatch"
+	CodePaymentDeclined       Code = "payment_declined"
+	CodeCartChanged           Code = "cart_changed"
+	CodeNotDelivered          Code = "not_delivered"
+	CodeNothingToRefund       Code = "nothing_to_refund"
+	CodeInvalidRefundQuantity Code = "invalid_refund_quantity"
+	CodeRefundNotPending      Code = "refund_not_pending"
+	CodePaymentNotCaptured    Code = "payment_not_captured"
+	CodeAlreadyPaid           Code = "already_paid"
+	CodeNotCashPayment        Code = "not_cash_payment"
+	CodeOrderClosed           Code = "order_closed"
+	CodeUnknownStatus         Code = "unknown_status"
+	CodeInvalidTransition     Code = "invalid_status_transition"
+)
+
+// CodeForStatus is the code of an error response that did not name one
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// Response is the envelope of every /api/v1 response
+type Response struct {
+	Data  interface{} `json:"data"`
+	Error *Error      `json:"error,omitempty"`
+	Meta  *Meta       `json:"meta,omitempty"`
+}
+
+type Error struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+	// Fields maps a request field to what is wrong with it
+	Fields map[string][]string `json:"fields,omitempty"`
+	// Details holds anything else the error reports, such as the from and to
+	// statuses of a refused status transition
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+type Meta struct {
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+type Pagination struct {
+	Page  int `json:"page"`
+	Limit int `json:"limit"`
+	Total int `json:"total"`
+}
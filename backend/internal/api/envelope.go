@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Envelope serves requests under prefix in a Response. Handlers write it
+// themselves with WriteJSON and WriteError. Responses written without them,
+// such as the router's 404 and 405 and the auth middleware's errors, are
+// rewritten once the handler returns:
+//
+//   - an error status becomes error, with the code and fields of a JSON
+//     error body when it has them and its other fields as details, else the
+//     code for the status and the body as the message
+//   - a JSON success body becomes data, without its "success" flag and
+//     "message"; top-level page, limit and total move to meta.pagination
+//
+// Numbers are copied digit for digit rather than through float64.
+//
+// Redirects, preflight requests and non-JSON successes such as the event
+// stream pass through unchanged.
+func Envelope(prefix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if (r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/")) || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ew := &envelopeWriter{ResponseWriter: w}
+			next.ServeHTTP(ew, withEnvelope(r, ew))
+			ew.finish()
+		})
+	}
+}
+
+// Deprecated marks a response as coming from a deprecated route and links to
+// its successor under prefix
+func Deprecated(prefix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Add("Link", "<"+prefix+r.URL.Path+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// envelopeWriter buffers a JSON or error response until the handler returns.
+// WriteJSON and WriteError set passThrough before they write the envelope.
+type envelopeWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	passThrough bool
+	body        bytes.Buffer
+}
+
+func (w *envelopeWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+
+	contentType := w.Header().Get("Content-Type")
+	if w.passThrough || status < http.StatusBadRequest && (status >= http.StatusMultipleChoices || status == http.StatusNoContent ||
+		(contentType != "" && !strings.HasPrefix(contentType, "application/json"))) {
+		w.passThrough = true
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *envelopeWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passThrough {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the connection, which the event
+// stream needs to flush and to clear its write deadline
+func (w *envelopeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *envelopeWriter) finish() {
+	if w.passThrough {
+		return
+	}
+	if !w.wroteHeader {
+		w.status = http.StatusOK
+	}
+
+	var response Response
+	if w.status >= http.StatusBadRequest {
+		response.Error = parseError(w.status, w.body.Bytes())
+	} else {
+		response.Data, response.Meta = parseData(w.body.Bytes())
+	}
+
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Del("X-Content-Type-Options")
+	header.Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.status)
+	json.NewEncoder(w.ResponseWriter).Encode(response)
+}
+
+// parseError reads the {"success": false, "error", "message", "fields", ...}
+// body written by the handlers, or a plain-text body from http.Error
+func parseError(status int, body []byte) *Error {
+	apiError := &Error{Code: CodeForStatus(status)}
+	object, ok := decodeObject(body)
+	if !ok {
+		apiError.Message = strings.TrimSpace(string(body))
+	}
+	for key, value := range object {
+		switch key {
+		case "success":
+		case "error":
+			if code, ok := value.(string); ok && code != "" {
+				apiError.Code = Code(code)
+			}
+		case "message":
+			apiError.Message, _ = value.(string)
+		case "fields":
+			apiError.Fields = stringLists(value)
+		default:
+			if apiError.Details == nil {
+				apiError.Details = make(map[string]interface{})
+			}
+			apiError.Details[key] = value
+		}
+	}
+	if apiError.Message == "" {
+		apiError.Message = http.StatusText(status)
+	}
+	return apiError
+}
+
+// parseData turns a success body into the envelope's data and meta
+func parseData(body []byte) (interface{}, *Meta) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	data, err := decode(body)
+	if err != nil {
+		return string(body), nil
+	}
+	object, ok := data.(map[string]interface{})
+	if !ok {
+		return data, nil
+	}
+	return splitData(object)
+}
+
+// decode reads one JSON value, keeping numbers as json.Number
+func decode(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("more than one JSON value")
+	}
+	return value, nil
+}
+
+func decodeObject(body []byte) (map[string]interface{}, bool) {
+	value, err := decode(body)
+	if err != nil {
+		return nil, false
+	}
+	object, ok := value.(map[string]interface{})
+	return object, ok
+}
+
+// intField reads an int from a body built by a handler or decoded with
+// json.Number
+func intField(object map[string]interface{}, key string) (int, bool) {
+	switch value := object[key].(type) {
+	case int:
+		return value, true
+	case json.Number:
+		n, err := strconv.Atoi(value.String())
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// stringLists converts the decoded "fields" of a validation error
+func stringLists(value interface{}) map[string][]string {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	lists := make(map[string][]string, len(object))
+	for key, messages := range object {
+		items, _ := messages.([]interface{})
+		for _, item := range items {
+			if message, ok := item.(string); ok {
+				lists[key] = append(lists[key], message)
+			}
+		}
+	}
+	return lists
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// envelope serves handler under the envelope and returns the status and the
+// raw JSON of the response
+func envelope(t *testing.T, handler http.HandlerFunc) (int, map[string]json.RawMessage) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	Envelope(Prefix)(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Prefix+"/orders", nil))
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func writeJSON(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+func TestEnvelopeData(t *testing.T) {
+	status, body := envelope(t, writeJSON(http.StatusOK,
+		`{"success": true, "message": "Order status updated", "order": {"id": 9007199254740993, "total": 12.10}, "page": 2, "limit": 20, "total": 41}`))
+
+	if status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if got, want := string(body["data"]), `{"order":{"id":9007199254740993,"total":12.10}}`; got != want {
+		t.Errorf("data %s, want %s", got, want)
+	}
+	if got, want := string(body["meta"]), `{"pagination":{"page":2,"limit":20,"total":41}}`; got != want {
+		t.Errorf("meta %s, want %s", got, want)
+	}
+	if _, ok := body["error"]; ok {
+		t.Errorf("success response has an error: %s", body["error"])
+	}
+}
+
+func TestEnvelopeError(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		want    Error
+	}{
+		{
+			"coded with details",
+			writeJSON(http.StatusConflict, `{"success": false, "error": "invalid_status_transition", "message": "Cannot move from shipped to ready_for_pickup", "from": "shipped", "to": "ready_for_pickup"}`),
+			http.StatusConflict,
+			Error{
+				Code:    CodeInvalidTransition,
+				Message: "Cannot move from shipped to ready_for_pickup",
+				Details: map[string]interface{}{"from": "shipped", "to": "ready_for_pickup"},
+			},
+		},
+		{
+			"validation fields",
+			writeJSON(http.StatusUnprocessableEntity, `{"success": false, "error": "validation_failed", "message": "Invalid request: name is required", "fields": {"name": ["is required"]}}`),
+			http.StatusUnprocessableEntity,
+			Error{Code: CodeValidation, Message: "Invalid request: name is required", Fields: map[string][]string{"name": {"is required"}}},
+		},
+		{
+			"uncoded",
+			writeJSON(http.StatusNotFound, `{"success": false, "message": "Order not found"}`),
+			http.StatusNotFound,
+			Error{Code: CodeNotFound, Message: "Order not found"},
+		},
+		{
+			"plain text",
+			func(w http.ResponseWriter, r *http.Request) { http.Error(w, "Unauthorized", http.StatusUnauthorized) },
+			http.StatusUnauthorized,
+			Error{Code: CodeUnauthorized, Message: "Unauthorized"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := envelope(t, tt.handler)
+			if status != tt.status {
+				t.Errorf("status %d, want %d", status, tt.status)
+			}
+			if string(body["data"]) != "null" {
+				t.Errorf("data %s, want null", body["data"])
+			}
+			var got Error
+			if err := json.Unmarshal(body["error"], &got); err != nil {
+				t.Fatalf("decoding error %s: %v", body["error"], err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("error %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvelopeSkipsOtherPaths(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handler := writeJSON(http.StatusOK, `{"success": true}`)
+	Envelope(Prefix)(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cart", nil))
+	if got := rec.Body.String(); got != `{"success": true}` {
+		t.Errorf("body %s, want it unchanged", got)
+	}
+}
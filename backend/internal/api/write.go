@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+type envelopeKey struct{}
+
+// envelopeOf returns the envelope r is served under, or nil on the
+// unversioned routes
+func envelopeOf(r *http.Request) *envelopeWriter {
+	ew, _ := r.Context().Value(envelopeKey{}).(*envelopeWriter)
+	return ew
+}
+
+// WriteJSON writes a success response. body is what the unversioned routes
+// answer, usually a {"success": true, ...} object; under Envelope it becomes
+// the Response's data instead. An object loses "success" and "message" there,
+// and its top-level page, limit and total move to meta.pagination.
+func WriteJSON(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	ew := envelopeOf(r)
+	if ew == nil {
+		write(w, status, body)
+		return
+	}
+
+	ew.passThrough = true
+	response := Response{Data: body}
+	if object, ok := body.(map[string]interface{}); ok {
+		response.Data, response.Meta = splitData(object)
+	}
+	write(w, status, response)
+}
+
+// WriteError writes an error response. Under Envelope it is written as the
+// Response's error, with the code for the status if apiErr has none. On the
+// unversioned routes it is the {"success": false, "error", "message",
+// "fields"} body, with the details as further top-level fields and "error"
+// left out when there is no code.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, apiErr Error) {
+	if ew := envelopeOf(r); ew != nil {
+		ew.passThrough = true
+		if apiErr.Code == "" {
+			apiErr.Code = CodeForStatus(status)
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(status)
+		}
+		write(w, status, Response{Error: &apiErr})
+		return
+	}
+
+	body := map[string]interface{}{
+		"success": false,
+		"message": apiErr.Message,
+	}
+	if apiErr.Code != "" {
+		body["error"] = apiErr.Code
+	}
+	if apiErr.Fields != nil {
+		body["fields"] = apiErr.Fields
+	}
+	for key, value := range apiErr.Details {
+		body[key] = value
+	}
+	write(w, status, body)
+}
+
+func write(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// splitData turns a success body into the envelope's data and meta; body is
+// left as it is
+func splitData(body map[string]interface{}) (map[string]interface{}, *Meta) {
+	data := make(map[string]interface{}, len(body))
+	for key, value := range body {
+		if key != "success" && key != "message" {
+			data[key] = value
+		}
+	}
+
+	page, hasPage := intField(data, "page")
+	limit, hasLimit := intField(data, "limit")
+	total, hasTotal := intField(data, "total")
+	if !hasPage || !hasLimit || !hasTotal {
+		return data, nil
+	}
+	delete(data, "page")
+	delete(data, "limit")
+	delete(data, "total")
+	return data, &Meta{Pagination: &Pagination{Page: page, Limit: limit, Total: total}}
+}
+
+// withEnvelope marks r as served under ew, so WriteJSON and WriteError write
+// the envelope themselves
+func withEnvelope(r *http.Request, ew *envelopeWriter) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), envelopeKey{}, ew))
+}
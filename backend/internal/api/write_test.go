@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// serve runs handler for path behind Envelope and returns the response
+func serve(handler http.HandlerFunc, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	Envelope(Prefix)(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestWriteJSON(t *testing.T) {
+	type order struct {
+		ID    int     `json:"id"`
+		Total float64 `json:"total"`
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, r, http.StatusCreated, map[string]interface{}{
+			"success": true,
+			"message": "Order placed",
+			"order":   order{ID: 9, Total: 12.1},
+			"page":    2,
+			"limit":   20,
+			"total":   41,
+		})
+	}
+
+	rec := serve(handler, Prefix+"/orders")
+	if rec.Code != http.StatusCreated {
+		t.Errorf("status %d, want 201", rec.Code)
+	}
+	if got, want := rec.Body.String(), `{"data":{"order":{"id":9,"total":12.1}},"meta":{"pagination":{"page":2,"limit":20,"total":41}}}`+"\n"; got != want {
+		t.Errorf("body %s, want %s", got, want)
+	}
+
+	rec = serve(handler, "/orders")
+	if got, want := rec.Body.String(), `{"limit":20,"message":"Order placed","order":{"id":9,"total":12.1},"page":2,"success":true,"total":41}`+"\n"; got != want {
+		t.Errorf("unversioned body %s, want %s", got, want)
+	}
+}
+
+func TestWriteJSONNonObject(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, r, http.StatusOK, []int{1, 2})
+	}
+	if got, want := serve(handler, Prefix+"/products").Body.String(), `{"data":[1,2]}`+"\n"; got != want {
+		t.Errorf("body %s, want %s", got, want)
+	}
+	if got, want := serve(handler, "/products").Body.String(), "[1,2]\n"; got != want {
+		t.Errorf("unversioned body %s, want %s", got, want)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		err         Error
+		want        Error
+		unversioned map[string]interface{}
+	}{
+		{
+			"coded with details",
+			http.StatusConflict,
+			Error{Code: CodeInvalidTransition, Message: "Cannot move", Details: map[string]interface{}{"from": "shipped"}},
+			Error{Code: CodeInvalidTransition, Message: "Cannot move", Details: map[string]interface{}{"from": "shipped"}},
+			map[string]interface{}{"success": false, "error": "invalid_status_transition", "message": "Cannot move", "from": "shipped"},
+		},
+		{
+			"validation fields",
+			http.StatusUnprocessableEntity,
+			Error{Code: CodeValidation, Message: "Invalid request", Fields: map[string][]string{"name": {"is required"}}},
+			Error{Code: CodeValidation, Message: "Invalid request", Fields: map[string][]string{"name": {"is required"}}},
+			map[string]interface{}{"success": false, "error": "validation_failed", "message": "Invalid request", "fields": map[string]interface{}{"name": []interface{}{"is required"}}},
+		},
+		{
+			"uncoded",
+			http.StatusNotFound,
+			Error{Message: "Order not found"},
+			Error{Code: CodeNotFound, Message: "Order not found"},
+			map[string]interface{}{"success": false, "message": "Order not found"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := func(w http.ResponseWriter, r *http.Request) { WriteError(w, r, tt.status, tt.err) }
+
+			rec := serve(handler, Prefix+"/orders")
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+			var response struct {
+				Data  json.RawMessage `json:"data"`
+				Error Error           `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decoding %s: %v", rec.Body, err)
+			}
+			if string(response.Data) != "null" {
+				t.Errorf("data %s, want null", response.Data)
+			}
+			if !reflect.DeepEqual(response.Error, tt.want) {
+				t.Errorf("error %+v, want %+v", response.Error, tt.want)
+			}
+
+			rec = serve(handler, "/orders")
+			if rec.Code != tt.status {
+				t.Errorf("unversioned status %d, want %d", rec.Code, tt.status)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding %s: %v", rec.Body, err)
+			}
+			if !reflect.DeepEqual(body, tt.unversioned) {
+				t.Errorf("unversioned body %v, want %v", body, tt.unversioned)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+// Package config loads the server settings from an optional YAML file and the
+// environment, and checks them before anything starts.
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Profiles that Load accepts in APP_ENV or the file's env key
+const (
+	Development = "development"
+	Test        = "test"
+	Production  = "production"
+)
+
+type Config struct {
+	Env       string    `yaml:"env"`
+	Server    Server    `yaml:"server"`
+	Database  Database  `yaml:"database"`
+	Session   Session   `yaml:"session"`
+	Mail      Mail      `yaml:"mail"`
+	SMTP      SMTP      `yaml:"smtp"`
+	Outbox    Outbox    `yaml:"outbox"`
+	Payments  Payments  `yaml:"payments"`
+	Orders    Orders    `yaml:"orders"`
+	Inventory Inventory `yaml:"inventory"`
+}
+
+type Server struct {
+	// BaseURL is the address users reach the server at. Links in emails are
+	// built from it rather than from the Host header of the request.
+	BaseURL         string        `yaml:"base_url"`
+	Port            string        `yaml:"port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes  int           `yaml:"max_header_bytes"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type Database struct {
+	URL            string        `yaml:"url"`
+	MigrateOnStart bool          `yaml:"migrate_on_start"`
+	QueryTimeout   time.Duration `yaml:"query_timeout"`
+}
+
+// Session covers the login session and the cookies the server sets
+type Session struct {
+	TTL            time.Duration `yaml:"ttl"`
+	CookieSameSite string        `yaml:"cookie_same_site"` // "lax", "strict" or "none"
+	CookieSecure   bool          `yaml:"cookie_secure"`
+}
+
+// SameSite converts CookieSameSite for http.Cookie
+func (s Session) SameSite() http.SameSite {
+	switch strings.ToLower(s.CookieSameSite) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "strict":
+		return http.SameSiteStrictMode
+	default:
+		return http.SameSiteNoneMode
+	}
+}
+
+// Mail picks how outgoing email is delivered
+type Mail struct {
+	Driver  string `yaml:"driver"` // "smtp", "file" or "memory"
+	From    string `yaml:"from"`
+	DropDir string `yaml:"drop_dir"` // where the file driver writes .eml files
+	// DefaultLocale is used for recipients with no language preference, and
+	// every email template must have a variant in it
+	DefaultLocale string `yaml:"default_locale"`
+}
+
+// SMTP is the outgoing mail server used by the smtp mail driver
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Outbox tunes the worker that delivers queued emails and notifications
+type Outbox struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`
+	// Lease is how long a claimed entry is hidden from other workers
+	Lease time.Duration `yaml:"lease"`
+	// MaxAttempts failed deliveries dead-letter an entry
+	MaxAttempts int           `yaml:"max_attempts"`
+	BaseBackoff time.Duration `yaml:"base_backoff"`
+	MaxBackoff  time.Duration `yaml:"max_backoff"`
+}
+
+type Payments struct {
+	Provider        string `yaml:"provider"` // "fake" or "stripe"
+	Currency        string `yaml:"currency"`
+	WebhookSecret   string `yaml:"webhook_secret"`
+	StripeSecretKey string `yaml:"stripe_secret_key"`
+	StripeAPIBase   string `yaml:"stripe_api_base"`
+}
+
+type Orders struct {
+	// UnpaidOrderTTL is how long cash sub-orders may stay unpaid
+	UnpaidOrderTTL time.Duration `yaml:"unpaid_order_ttl"`
+	// ReservationTTL is how long cart items hold stock; zero disables holds
+	ReservationTTL time.Duration `yaml:"reservation_ttl"`
+}
+
+type Inventory struct {
+	// LowStockThreshold is the quantity at or below which the farmer dashboard flags a product
+	LowStockThreshold int `yaml:"low_stock_threshold"`
+}
+
+// Defaults returns the built-in settings for a profile. Only the database URL
+// has no default.
+func Defaults(env string) *Config {
+	cfg := &Config{
+		Env: env,
+		Server: Server{
+			BaseURL:         "http://localhost:8080",
+			Port:            "8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			MaxHeaderBytes:  1 << 20,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: Database{
+			MigrateOnStart: true,
+			QueryTimeout:   5 * time.Second,
+		},
+		Session: Session{
+			TTL:            24 * time.Hour,
+			CookieSameSite: "none",
+			CookieSecure:   true,
+		},
+		Mail: Mail{
+			Driver:        "file",
+			From:          "no-reply@farmermarket.local",
+			DropDir:       "tmp/mail",
+			DefaultLocale: "en",
+		},
+		SMTP: SMTP{
+			Port: 587,
+		},
+		Outbox: Outbox{
+			PollInterval: 5 * time.Second,
+			BatchSize:    20,
+			Lease:        2 * time.Minute,
+			MaxAttempts:  8,
+			BaseBackoff:  30 * time.Second,
+			MaxBackoff:   time.Hour,
+		},
+		Payments: Payments{
+			Provider: "fake",
+			Currency: "usd",
+		},
+		Orders: Orders{
+			UnpaidOrderTTL: 72 * time.Hour,
+			ReservationTTL: 15 * time.Minute,
+		},
+		Inventory: Inventory{
+			LowStockThreshold: 5,
+		},
+	}
+
+	switch env {
+	case Test:
+		cfg.Mail.Driver = "memory"
+		cfg.Database.QueryTimeout = 2 * time.Second
+		cfg.Server.ShutdownTimeout = 5 * time.Second
+	case Production:
+		cfg.Server.BaseURL = ""
+		cfg.Mail.Driver = "smtp"
+		cfg.Payments.Provider = "stripe"
+	}
+	return cfg
+}
+
+// Validate reports every setting that is missing or out of range at once
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Env == Development || c.Env == Test || c.Env == Production,
+		"env must be %q, %q or %q, got %q", Development, Test, Production, c.Env)
+
+	baseURL, err := url.Parse(c.Server.BaseURL)
+	check(err == nil && (baseURL.Scheme == "http" || baseURL.Scheme == "https") && baseURL.Host != "" && baseURL.RawQuery == "",
+		"server.base_url (BASE_URL) must be an absolute http or https URL, got %q", c.Server.BaseURL)
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port <= 65535, "server.port (PORT) must be a port number, got %q", c.Server.Port)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout (HTTP_READ_TIMEOUT) must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout (HTTP_WRITE_TIMEOUT) must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout (HTTP_IDLE_TIMEOUT) must be positive")
+	check(c.Server.MaxHeaderBytes > 0, "server.max_header_bytes (HTTP_MAX_HEADER_BYTES) must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout (SHUTDOWN_TIMEOUT) must be positive")
+
+	check(c.Database.URL != "", "database.url (DATABASE_URL) is required")
+	check(c.Database.QueryTimeout >= 0, "database.query_timeout (QUERY_TIMEOUT) must not be negative")
+
+	check(c.Session.TTL > 0, "session.ttl (SESSION_TTL) must be positive")
+	switch strings.ToLower(c.Session.CookieSameSite) {
+	case "lax", "strict":
+	case "none":
+		check(c.Session.CookieSecure, "session.cookie_same_site (COOKIE_SAME_SITE) none needs session.cookie_secure (COOKIE_SECURE)")
+	default:
+		check(false, "session.cookie_same_site (COOKIE_SAME_SITE) must be lax, strict or none, got %q", c.Session.CookieSameSite)
+	}
+
+	check(c.Mail.From != "", "mail.from (MAIL_FROM) is required")
+	check(c.Mail.DefaultLocale != "" && c.Mail.DefaultLocale == strings.ToLower(c.Mail.DefaultLocale),
+		"mail.default_locale (MAIL_DEFAULT_LOCALE) must be a lower-case language tag, got %q", c.Mail.DefaultLocale)
+	switch c.Mail.Driver {
+	case "smtp":
+		check(c.SMTP.Host != "", "smtp.host (SMTP_HOST) is required for the smtp mail driver")
+		check(c.SMTP.Port > 0 && c.SMTP.Port <= 65535, "smtp.port (SMTP_PORT) must be a port number, got %d", c.SMTP.Port)
+	case "file":
+		check(c.Mail.DropDir != "", "mail.drop_dir (MAIL_DROP_DIR) is required for the file mail driver")
+	case "memory":
+	default:
+		check(false, "mail.driver (MAIL_DRIVER) must be smtp, file or memory, got %q", c.Mail.Driver)
+	}
+
+	check(c.Outbox.PollInterval > 0, "outbox.poll_interval (OUTBOX_POLL_INTERVAL) must be positive")
+	check(c.Outbox.BatchSize > 0, "outbox.batch_size (OUTBOX_BATCH_SIZE) must be positive")
+	check(c.Outbox.Lease > 0, "outbox.lease (OUTBOX_LEASE) must be positive")
+	check(c.Outbox.MaxAttempts > 0, "outbox.max_attempts (OUTBOX_MAX_ATTEMPTS) must be positive")
+	check(c.Outbox.BaseBackoff > 0, "outbox.base_backoff (OUTBOX_BASE_BACKOFF) must be positive")
+	check(c.Outbox.MaxBackoff >= c.Outbox.BaseBackoff, "outbox.max_backoff (OUTBOX_MAX_BACKOFF) must not be less than outbox.base_backoff")
+
+	switch c.Payments.Provider {
+	case "fake":
+	case "stripe":
+		check(c.Payments.StripeSecretKey != "", "payments.stripe_secret_key (STRIPE_SECRET_KEY) is required for the stripe provider")
+	default:
+		check(false, "payments.provider (PAYMENT_PROVIDER) must be fake or stripe, got %q", c.Payments.Provider)
+	}
+	check(c.Payments.Currency != "", "payments.currency (CURRENCY) is required")
+
+	check(c.Orders.UnpaidOrderTTL > 0, "orders.unpaid_order_ttl (UNPAID_ORDER_TTL) must be positive")
+	check(c.Orders.ReservationTTL >= 0, "orders.reservation_ttl (CART_RESERVATION_TTL) must not be negative")
+	check(c.Inventory.LowStockThreshold >= 0, "inventory.low_stock_threshold (LOW_STOCK_THRESHOLD) must not be negative")
+
+	if c.Env == Production {
+		check(c.Payments.Provider != "fake", "payments.provider (PAYMENT_PROVIDER) cannot be fake in production")
+		check(c.Payments.WebhookSecret != "", "payments.webhook_secret (PAYMENT_WEBHOOK_SECRET) is required in production")
+		check(c.Mail.Driver == "smtp", "mail.driver (MAIL_DRIVER) must be smtp in production")
+		check(c.Session.CookieSecure, "session.cookie_secure (COOKIE_SECURE) must be on in production")
+		check(strings.HasPrefix(c.Server.BaseURL, "https://"), "server.base_url (BASE_URL) must be an https URL in production")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// file is the layout of the YAML config file: the same keys as Config, plus
+// a profiles section whose entries override them for one env
+type file struct {
+	Config   `yaml:",inline"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// Load builds the configuration in layers: the built-in defaults for the
+// profile, then the YAML file at path (if path is not empty), then that
+// file's profiles entry for the profile, then environment variables. The
+// profile comes from APP_ENV, else the file's env key, else development.
+// The result is validated.
+func Load(path string) (*Config, error) {
+	var data []byte
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+	}
+
+	env := os.Getenv("APP_ENV")
+	if env == "" && len(data) > 0 {
+		var header struct {
+			Env string `yaml:"env"`
+		}
+		if err := yaml.Unmarshal(data, &header); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		env = header.Env
+	}
+	if env == "" {
+		env = Development
+	}
+
+	cfg := Defaults(env)
+	if len(data) > 0 {
+		f := file{Config: *cfg}
+		if err := decodeStrict(data, &f); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		if profile, ok := f.Profiles[env]; ok {
+			// yaml.Node.Decode ignores unknown keys, so the entry goes back
+			// through a strict decoder
+			raw, err := yaml.Marshal(&profile)
+			if err == nil {
+				err = decodeStrict(raw, &f.Config)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s: profiles.%s: %w", path, env, err)
+			}
+		}
+		cfg = &f.Config
+	}
+	// The profile is fixed before the file is read, so the file cannot switch it
+	cfg.Env = env
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// decodeStrict decodes YAML into out, failing on keys out has no field for
+func decodeStrict(data []byte, out interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	return decoder.Decode(out)
+}
+
+// applyEnv overrides cfg with the environment variables that are set
+func applyEnv(cfg *Config) error {
+	e := envReader{}
+
+	e.str("BASE_URL", &cfg.Server.BaseURL)
+	e.str("PORT", &cfg.Server.Port)
+	e.duration("HTTP_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	e.duration("HTTP_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	e.duration("HTTP_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	e.integer("HTTP_MAX_HEADER_BYTES", &cfg.Server.MaxHeaderBytes)
+	e.duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+
+	e.str("DATABASE_URL", &cfg.Database.URL)
+	e.boolean("MIGRATE_ON_START", &cfg.Database.MigrateOnStart)
+	e.duration("QUERY_TIMEOUT", &cfg.Database.QueryTimeout)
+
+	e.duration("SESSION_TTL", &cfg.Session.TTL)
+	e.str("COOKIE_SAME_SITE", &cfg.Session.CookieSameSite)
+	e.boolean("COOKIE_SECURE", &cfg.Session.CookieSecure)
+
+	e.str("MAIL_DRIVER", &cfg.Mail.Driver)
+	e.str("MAIL_FROM", &cfg.Mail.From)
+	e.str("MAIL_DROP_DIR", &cfg.Mail.DropDir)
+	e.str("MAIL_DEFAULT_LOCALE", &cfg.Mail.DefaultLocale)
+	e.str("SMTP_HOST", &cfg.SMTP.Host)
+	e.integer("SMTP_PORT", &cfg.SMTP.Port)
+	e.str("SMTP_USERNAME", &cfg.SMTP.Username)
+	e.str("SMTP_PASSWORD", &cfg.SMTP.Password)
+
+	e.duration("OUTBOX_POLL_INTERVAL", &cfg.Outbox.PollInterval)
+	e.integer("OUTBOX_BATCH_SIZE", &cfg.Outbox.BatchSize)
+	e.duration("OUTBOX_LEASE", &cfg.Outbox.Lease)
+	e.integer("OUTBOX_MAX_ATTEMPTS", &cfg.Outbox.MaxAttempts)
+	e.duration("OUTBOX_BASE_BACKOFF", &cfg.Outbox.BaseBackoff)
+	e.duration("OUTBOX_MAX_BACKOFF", &cfg.Outbox.MaxBackoff)
+
+	e.str("PAYMENT_PROVIDER", &cfg.Payments.Provider)
+	e.str("CURRENCY", &cfg.Payments.Currency)
+	e.str("PAYMENT_WEBHOOK_SECRET", &cfg.Payments.WebhookSecret)
+	e.str("STRIPE_SECRET_KEY", &cfg.Payments.StripeSecretKey)
+	e.str("STRIPE_API_BASE", &cfg.Payments.StripeAPIBase)
+
+	e.duration("UNPAID_ORDER_TTL", &cfg.Orders.UnpaidOrderTTL)
+	e.duration("CART_RESERVATION_TTL", &cfg.Orders.ReservationTTL)
+	e.integer("LOW_STOCK_THRESHOLD", &cfg.Inventory.LowStockThreshold)
+
+	return e.err
+}
+
+// envReader parses environment variables into config fields, keeping the
+// first parse error
+type envReader struct {
+	err error
+}
+
+func (e *envReader) lookup(key string) (string, bool) {
+	value, ok := os.LookupEnv(key)
+	return value, ok && value != "" && e.err == nil
+}
+
+func (e *envReader) fail(key, value string, err error) {
+	e.err = fmt.Errorf("invalid %s %q: %w", key, value, err)
+}
+
+func (e *envReader) str(key string, target *string) {
+	if value, ok := e.lookup(key); ok {
+		*target = value
+	}
+}
+
+func (e *envReader) duration(key string, target *time.Duration) {
+	if value, ok := e.lookup(key); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*target = d
+	}
+}
+
+func (e *envReader) integer(key string, target *int) {
+	if value, ok := e.lookup(key); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*target = n
+	}
+}
+
+func (e *envReader) boolean(key string, target *bool) {
+	if value, ok := e.lookup(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			e.fail(key, value, err)
+			return
+		}
+		*target = b
+	}
+}
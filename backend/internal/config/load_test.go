@@ -0,0 +1,220 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envKeys are the variables Load reads. Each test clears them so the
+// developer's own environment cannot leak in.
+var envKeys = []string{
+	"APP_ENV", "BASE_URL", "PORT", "HTTP_READ_TIMEOUT", "HTTP_WRITE_TIMEOUT",
+	"HTTP_IDLE_TIMEOUT", "HTTP_MAX_HEADER_BYTES", "SHUTDOWN_TIMEOUT",
+	"DATABASE_URL", "MIGRATE_ON_START", "QUERY_TIMEOUT", "SESSION_TTL",
+	"COOKIE_SAME_SITE", "COOKIE_SECURE", "MAIL_DRIVER", "MAIL_FROM",
+	"MAIL_DROP_DIR", "MAIL_DEFAULT_LOCALE", "SMTP_HOST", "SMTP_PORT",
+	"SMTP_USERNAME", "SMTP_PASSWORD", "OUTBOX_POLL_INTERVAL", "OUTBOX_BATCH_SIZE",
+	"OUTBOX_LEASE", "OUTBOX_MAX_ATTEMPTS", "OUTBOX_BASE_BACKOFF",
+	"OUTBOX_MAX_BACKOFF", "PAYMENT_PROVIDER", "CURRENCY",
+	"PAYMENT_WEBHOOK_SECRET", "STRIPE_SECRET_KEY", "STRIPE_API_BASE",
+	"UNPAID_ORDER_TTL", "CART_RESERVATION_TTL", "LOW_STOCK_THRESHOLD",
+}
+
+// load runs Load with the environment set to env and, unless yaml is empty,
+// a config file holding yaml
+func load(t *testing.T, yaml string, env map[string]string) (*Config, error) {
+	t.Helper()
+
+	for _, key := range envKeys {
+		t.Setenv(key, "")
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	path := ""
+	if yaml != "" {
+		path = filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return Load(path)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	const layered = `
+server:
+  port: "9000"
+profiles:
+  development:
+    server:
+      port: "9100"
+  test:
+    server:
+      port: "9300"
+`
+	tests := []struct {
+		name  string
+		yaml  string
+		env   map[string]string
+		check func(*Config) interface{}
+		want  interface{}
+	}{
+		{"default", "", nil, port, "8080"},
+		{"file over default", "server:\n  port: \"9000\"\n", nil, port, "9000"},
+		{"profile over file", layered, nil, port, "9100"},
+		{"env over profile", layered, map[string]string{"PORT": "9200"}, port, "9200"},
+		{"empty env is unset", layered, map[string]string{"PORT": ""}, port, "9100"},
+		{"APP_ENV picks the profile", layered, map[string]string{"APP_ENV": Test}, port, "9300"},
+		{"file env picks the profile", "env: test\n" + layered, nil, port, "9300"},
+		{"APP_ENV over file env", "env: test\n" + layered, map[string]string{"APP_ENV": Development}, port, "9100"},
+		{"profile defaults", "", map[string]string{"APP_ENV": Test}, func(c *Config) interface{} { return c.Mail.Driver }, "memory"},
+		{"file over profile defaults", "mail:\n  driver: file\n", map[string]string{"APP_ENV": Test}, func(c *Config) interface{} { return c.Mail.Driver }, "file"},
+		{"profile cannot switch env", "profiles:\n  development:\n    env: production\n", nil, func(c *Config) interface{} { return c.Env }, Development},
+		{"env duration", "", map[string]string{"QUERY_TIMEOUT": "750ms"}, func(c *Config) interface{} { return c.Database.QueryTimeout }, 750 * time.Millisecond},
+		{"env integer", "", map[string]string{"OUTBOX_BATCH_SIZE": "50"}, func(c *Config) interface{} { return c.Outbox.BatchSize }, 50},
+		{"env boolean", "", map[string]string{"MIGRATE_ON_START": "false"}, func(c *Config) interface{} { return c.Database.MigrateOnStart }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"DATABASE_URL": "postgres://localhost/market"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			cfg, err := load(t, tt.yaml, env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.check(cfg); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func port(c *Config) interface{} { return c.Server.Port }
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		env  map[string]string
+		want string
+	}{
+		{"unknown key", "sever:\n  port: \"9000\"\n", nil, "field sever not found"},
+		{"unknown nested key", "server:\n  prot: \"9000\"\n", nil, "field prot not found"},
+		{"unknown profile key", "profiles:\n  development:\n    mail:\n      drvier: smtp\n", nil, "profiles.development: yaml: unmarshal errors"},
+		{"wrong type", "outbox:\n  batch_size: lots\n", nil, "cannot unmarshal"},
+		{"bad duration", "", map[string]string{"SESSION_TTL": "a day"}, `invalid SESSION_TTL "a day"`},
+		{"bad integer", "", map[string]string{"SMTP_PORT": "smtp"}, `invalid SMTP_PORT "smtp"`},
+		{"bad boolean", "", map[string]string{"COOKIE_SECURE": "yes please"}, `invalid COOKIE_SECURE "yes please"`},
+		{"invalid result", "", map[string]string{"OUTBOX_LEASE": "-1s"}, "outbox.lease (OUTBOX_LEASE) must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"DATABASE_URL": "postgres://localhost/market"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			_, err := load(t, tt.yaml, env)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// valid returns settings that pass Validate for env
+func valid(env string) *Config {
+	cfg := Defaults(env)
+	cfg.Database.URL = "postgres://localhost/market"
+	if env == Production {
+		cfg.Server.BaseURL = "https://market.example.com"
+		cfg.SMTP.Host = "smtp.example.com"
+		cfg.Payments.StripeSecretKey = "sk_test_123"
+		cfg.Payments.WebhookSecret = "whsec_123"
+	}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	for _, env := range []string{Development, Test, Production} {
+		if err := valid(env).Validate(); err != nil {
+			t.Fatalf("%s settings: %v", env, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		env    string
+		change func(*Config)
+		want   string
+	}{
+		{"env", Development, func(c *Config) { c.Env = "staging" }, "env must be"},
+		{"base url", Development, func(c *Config) { c.Server.BaseURL = "localhost:8080" }, "server.base_url (BASE_URL) must be an absolute"},
+		{"base url query", Development, func(c *Config) { c.Server.BaseURL = "http://localhost?x=1" }, "server.base_url (BASE_URL) must be an absolute"},
+		{"port", Development, func(c *Config) { c.Server.Port = "70000" }, "server.port (PORT)"},
+		{"read timeout", Development, func(c *Config) { c.Server.ReadTimeout = 0 }, "server.read_timeout"},
+		{"write timeout", Development, func(c *Config) { c.Server.WriteTimeout = 0 }, "server.write_timeout"},
+		{"idle timeout", Development, func(c *Config) { c.Server.IdleTimeout = 0 }, "server.idle_timeout"},
+		{"max header bytes", Development, func(c *Config) { c.Server.MaxHeaderBytes = 0 }, "server.max_header_bytes"},
+		{"shutdown timeout", Development, func(c *Config) { c.Server.ShutdownTimeout = 0 }, "server.shutdown_timeout"},
+		{"database url", Development, func(c *Config) { c.Database.URL = "" }, "database.url (DATABASE_URL) is required"},
+		{"query timeout", Development, func(c *Config) { c.Database.QueryTimeout = -time.Second }, "database.query_timeout"},
+		{"session ttl", Development, func(c *Config) { c.Session.TTL = 0 }, "session.ttl"},
+		{"same site none", Development, func(c *Config) { c.Session.CookieSecure = false }, "none needs session.cookie_secure"},
+		{"same site", Development, func(c *Config) { c.Session.CookieSameSite = "sometimes" }, "must be lax, strict or none"},
+		{"mail from", Development, func(c *Config) { c.Mail.From = "" }, "mail.from (MAIL_FROM) is required"},
+		{"default locale", Development, func(c *Config) { c.Mail.DefaultLocale = "EN" }, "mail.default_locale"},
+		{"smtp host", Development, func(c *Config) { c.Mail.Driver = "smtp" }, "smtp.host (SMTP_HOST) is required"},
+		{"smtp port", Development, func(c *Config) { c.Mail.Driver, c.SMTP.Host, c.SMTP.Port = "smtp", "smtp.example.com", 0 }, "smtp.port (SMTP_PORT)"},
+		{"drop dir", Development, func(c *Config) { c.Mail.DropDir = "" }, "mail.drop_dir (MAIL_DROP_DIR) is required"},
+		{"mail driver", Development, func(c *Config) { c.Mail.Driver = "pigeon" }, "mail.driver (MAIL_DRIVER) must be"},
+		{"poll interval", Development, func(c *Config) { c.Outbox.PollInterval = 0 }, "outbox.poll_interval"},
+		{"batch size", Development, func(c *Config) { c.Outbox.BatchSize = 0 }, "outbox.batch_size"},
+		{"lease", Development, func(c *Config) { c.Outbox.Lease = 0 }, "outbox.lease"},
+		{"max attempts", Development, func(c *Config) { c.Outbox.MaxAttempts = 0 }, "outbox.max_attempts"},
+		{"base backoff", Development, func(c *Config) { c.Outbox.BaseBackoff = 0 }, "outbox.base_backoff"},
+		{"max backoff", Development, func(c *Config) { c.Outbox.MaxBackoff = time.Second }, "outbox.max_backoff"},
+		{"stripe key", Development, func(c *Config) { c.Payments.Provider = "stripe" }, "payments.stripe_secret_key (STRIPE_SECRET_KEY) is required"},
+		{"provider", Development, func(c *Config) { c.Payments.Provider = "cash" }, "payments.provider (PAYMENT_PROVIDER) must be"},
+		{"currency", Development, func(c *Config) { c.Payments.Currency = "" }, "payments.currency (CURRENCY) is required"},
+		{"unpaid order ttl", Development, func(c *Config) { c.Orders.UnpaidOrderTTL = 0 }, "orders.unpaid_order_ttl"},
+		{"reservation ttl", Development, func(c *Config) { c.Orders.ReservationTTL = -time.Minute }, "orders.reservation_ttl"},
+		{"low stock threshold", Development, func(c *Config) { c.Inventory.LowStockThreshold = -1 }, "inventory.low_stock_threshold"},
+		{"fake payments in production", Production, func(c *Config) { c.Payments.Provider = "fake" }, "cannot be fake in production"},
+		{"webhook secret in production", Production, func(c *Config) { c.Payments.WebhookSecret = "" }, "payments.webhook_secret (PAYMENT_WEBHOOK_SECRET) is required in production"},
+		{"mail driver in production", Production, func(c *Config) { c.Mail.Driver = "file" }, "must be smtp in production"},
+		{"insecure cookies in production", Production, func(c *Config) { c.Session.CookieSameSite, c.Session.CookieSecure = "lax", false }, "must be on in production"},
+		{"http base url in production", Production, func(c *Config) { c.Server.BaseURL = "http://market.example.com" }, "must be an https URL in production"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid(tt.env)
+			tt.change(cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := valid(Development)
+	cfg.Database.URL = ""
+	cfg.Outbox.BatchSize = 0
+	cfg.Payments.Currency = ""
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if got := strings.Count(err.Error(), "\n  "); got != 3 {
+		t.Errorf("%d problems reported, want 3:\n%v", got, err)
+	}
+}
@@ -0,0 +1,58 @@
+// Package email sends the emails the server writes to farmers and buyers.
+// The Mailer is picked at startup: SMTP in production, a directory of .eml
+// files in development and an in-memory outbox in tests.
+package email
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
+	"gopkg.in/gomail.v2"
+)
+
+// Message is a plain-text email with an optional HTML alternative. From is
+// filled in by the Mailer when empty.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+	HTML    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New builds the Mailer named by settings.Driver; the configuration has
+// already been validated
+func New(settings config.Mail, smtp config.SMTP) (Mailer, error) {
+	switch settings.Driver {
+	case "smtp":
+		return NewSMTP(smtp, settings.From), nil
+	case "file":
+		return NewFileDrop(settings.DropDir, settings.From)
+	case "memory":
+		return NewMemory(settings.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", settings.Driver)
+	}
+}
+
+// compose fills in the sender and renders msg as a MIME message
+func compose(msg Message, from string) (Message, *gomail.Message) {
+	if msg.From == "" {
+		msg.From = from
+	}
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", msg.From)
+	m.SetHeader("To", msg.To)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.Body)
+	if msg.HTML != "" {
+		m.AddAlternative("text/html", msg.HTML)
+	}
+	return msg, m
+}
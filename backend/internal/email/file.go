@@ -0,0 +1,56 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileDrop writes each message to its own .eml file in a directory, so
+// development mail can be opened in any mail client instead of being sent
+type FileDrop struct {
+	dir  string
+	from string
+	seq  atomic.Uint64
+}
+
+// NewFileDrop creates dir if it does not exist yet
+func NewFileDrop(dir, from string) (*FileDrop, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating mail drop directory: %w", err)
+	}
+	return &FileDrop{dir: dir, from: from}, nil
+}
+
+func (f *FileDrop) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, m := compose(msg, f.from)
+
+	// Write to a temp file and rename it, so a watcher never sees half a message
+	tmp, err := os.CreateTemp(f.dir, ".mail-*")
+	if err != nil {
+		return err
+	}
+	if _, err := m.WriteTo(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%06d.eml", time.Now().UTC().Format("20060102T150405.000Z"), f.seq.Add(1))
+	if err := os.Rename(tmp.Name(), filepath.Join(f.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
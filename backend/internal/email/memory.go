@@ -0,0 +1,45 @@
+package email
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory keeps every message it is given, so tests can assert on sent mail
+type Memory struct {
+	from string
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewMemory(from string) *Memory {
+	return &Memory{from: from}
+}
+
+func (m *Memory) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	msg, _ = compose(msg, m.from)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Sent returns the messages sent so far, oldest first
+func (m *Memory) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
+
+// Reset forgets the messages sent so far
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = nil
+}
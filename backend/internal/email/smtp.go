@@ -0,0 +1,31 @@
+package email
+
+import (
+	"context"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
+	"gopkg.in/gomail.v2"
+)
+
+// SMTP delivers each message over a new connection to the configured server
+type SMTP struct {
+	dialer *gomail.Dialer
+	from   string
+}
+
+func NewSMTP(settings config.SMTP, from string) *SMTP {
+	return &SMTP{
+		dialer: gomail.NewDialer(settings.Host, settings.Port, settings.Username, settings.Password),
+		from:   from,
+	}
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	// gomail cannot abort a dial in progress, so only check before starting
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, m := compose(msg, s.from)
+	return s.dialer.DialAndSend(m)
+}
@@ -0,0 +1,173 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates holds the email templates from one directory. Each email is a
+// set of files named <name>.<locale>.txt and, optionally, <name>.<locale>.html.
+// The text file defines a "subject" template and its body is the plain-text
+// message; the HTML file is the HTML alternative.
+type Templates struct {
+	defaultLocale string
+	text          map[string]*texttemplate.Template // keyed by "name.locale"
+	html          map[string]*htmltemplate.Template
+	locales       map[string][]string // template name -> locales it has
+}
+
+// Rendered is a rendered email, ready for a Message
+type Rendered struct {
+	Locale  string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// LoadTemplates parses every template in dir. Every email must have a text
+// variant in defaultLocale, which is used when the recipient's locale has none.
+func LoadTemplates(dir, defaultLocale string) (*Templates, error) {
+	t := &Templates{
+		defaultLocale: defaultLocale,
+		text:          make(map[string]*texttemplate.Template),
+		html:          make(map[string]*htmltemplate.Template),
+		locales:       make(map[string][]string),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading email templates: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		file := entry.Name()
+		ext := filepath.Ext(file)
+		if ext != ".txt" && ext != ".html" {
+			continue
+		}
+		name, locale, ok := strings.Cut(strings.TrimSuffix(file, ext), ".")
+		if !ok || NormalizeLocale(locale) != locale {
+			return nil, fmt.Errorf("email template %s: expected <name>.<locale>%s", file, ext)
+		}
+		key := name + "." + locale
+		path := filepath.Join(dir, file)
+
+		if ext == ".txt" {
+			tmpl, err := texttemplate.ParseFiles(path)
+			if err != nil {
+				return nil, fmt.Errorf("parsing email template %s: %w", file, err)
+			}
+			if tmpl.Lookup("subject") == nil {
+				return nil, fmt.Errorf("email template %s does not define a subject", file)
+			}
+			t.text[key] = tmpl
+			t.locales[name] = append(t.locales[name], locale)
+		} else {
+			tmpl, err := htmltemplate.ParseFiles(path)
+			if err != nil {
+				return nil, fmt.Errorf("parsing email template %s: %w", file, err)
+			}
+			t.html[key] = tmpl
+		}
+	}
+
+	for key := range t.html {
+		if _, ok := t.text[key]; !ok {
+			return nil, fmt.Errorf("email template %s.html has no matching .txt with the subject", key)
+		}
+	}
+	for name, locales := range t.locales {
+		if _, ok := t.text[name+"."+defaultLocale]; !ok {
+			return nil, fmt.Errorf("email template %s has no %s variant", name, defaultLocale)
+		}
+		sort.Strings(locales)
+	}
+	return t, nil
+}
+
+// Render fills in the named email for a recipient who prefers locale. It uses
+// the closest variant: the exact locale, then its language ("pt" for
+// "pt-br"), then the default locale.
+func (t *Templates) Render(name, locale string, data interface{}) (*Rendered, error) {
+	chosen, ok := t.resolve(name, NormalizeLocale(locale))
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+	key := name + "." + chosen
+	text := t.text[key]
+
+	var subject, body bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("rendering %s subject: %w", key, err)
+	}
+	if err := text.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("rendering %s: %w", key, err)
+	}
+
+	rendered := &Rendered{
+		Locale:  chosen,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    body.String(),
+	}
+	if html, ok := t.html[key]; ok {
+		var buf bytes.Buffer
+		if err := html.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("rendering %s.html: %w", key, err)
+		}
+		rendered.HTML = buf.String()
+	}
+	return rendered, nil
+}
+
+func (t *Templates) resolve(name, locale string) (string, bool) {
+	candidates := []string{locale}
+	if language, _, ok := strings.Cut(locale, "-"); ok {
+		candidates = append(candidates, language)
+	}
+	candidates = append(candidates, t.defaultLocale)
+
+	for _, candidate := range candidates {
+		if _, ok := t.text[name+"."+candidate]; ok && candidate != "" {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// Names lists the email templates with the locales each one has
+func (t *Templates) Names() map[string][]string {
+	names := make(map[string][]string, len(t.locales))
+	for name, locales := range t.locales {
+		names[name] = append([]string(nil), locales...)
+	}
+	return names
+}
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// MaxLocaleLength is the longest locale stored for a buyer or farmer, the
+// size of their locale columns
+const MaxLocaleLength = 16
+
+// NormalizeLocale turns a language tag ("pt_BR", "ru-RU") or an
+// Accept-Language header ("ru-RU,ru;q=0.9,en;q=0.8") into the lower-case form
+// the template files use, taking the first choice. It returns "" when value
+// is not a language tag or is longer than MaxLocaleLength.
+func NormalizeLocale(value string) string {
+	value, _, _ = strings.Cut(value, ",")
+	value, _, _ = strings.Cut(value, ";")
+	value = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(value), "_", "-"))
+	if len(value) > MaxLocaleLength || !localePattern.MatchString(value) {
+		return ""
+	}
+	return value
+}
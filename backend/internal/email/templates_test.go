@@ -0,0 +1,28 @@
+package email
+
+import "testing"
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"en", "en"},
+		{"pt_BR", "pt-br"},
+		{" ru-RU ", "ru-ru"},
+		{"ru-RU,ru;q=0.9,en;q=0.8", "ru-ru"},
+		{"kk;q=0.8", "kk"},
+		{"de-ch-1901-abcde", "de-ch-1901-abcde"},
+		{"de-ch-1901-abcdef", ""},
+		{"de-CH-1901-ABCDEF,de;q=0.5", ""},
+		{"*", ""},
+		{"english", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := NormalizeLocale(tt.value); got != tt.want {
+				t.Errorf("NormalizeLocale(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Package events pushes notification, order and stock changes to connected
+// clients. Database triggers publish each change with NOTIFY; every server
+// instance LISTENs and hands the events to its own Hub, which fans them out
+// to the subscribers of the affected farmer or buyer.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+const (
+	TypeNotification = "notification"
+	TypeOrder        = "order"
+	TypeStock        = "stock"
+)
+
+// Event is one change for one farmer or buyer. ID is the notification ID for
+// notification events, which clients can resume from; other events are not
+// stored and have no ID.
+type Event struct {
+	ID            int             `json:"id,omitempty"`
+	Type          string          `json:"type"`
+	RecipientType string          `json:"recipient_type"`
+	RecipientID   int             `json:"recipient_id"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// subscriptionBuffer is how many events a subscriber may fall behind by
+// before it is dropped
+const subscriptionBuffer = 32
+
+// Subscription receives the events of one recipient on C. C is closed when
+// the subscriber falls too far behind or the Hub shuts down; a client that
+// reconnects catches up on notifications from the notifications table.
+type Subscription struct {
+	C   <-chan Event
+	c   chan Event
+	key string
+	hub *Hub
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Hub fans events out to the subscriptions in this process
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[*Subscription]struct{}
+	closed      bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[string]map[*Subscription]struct{})}
+}
+
+func recipientKey(recipientType string, recipientID int) string {
+	return fmt.Sprintf("%s:%d", recipientType, recipientID)
+}
+
+// Subscribe starts receiving the events of a recipient. On a closed Hub the
+// subscription's channel is already closed.
+func (h *Hub) Subscribe(recipientType string, recipientID int) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, key: recipientKey(recipientType, recipientID), hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(c)
+		return sub
+	}
+	if h.subscribers[sub.key] == nil {
+		h.subscribers[sub.key] = make(map[*Subscription]struct{})
+	}
+	h.subscribers[sub.key][sub] = struct{}{}
+	return sub
+}
+
+// Publish hands an event to the recipient's subscribers without blocking. A
+// subscriber whose buffer is full is dropped.
+func (h *Hub) Publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers[recipientKey(event.RecipientType, event.RecipientID)] {
+		select {
+		case sub.c <- event:
+		default:
+			h.removeLocked(sub)
+		}
+	}
+}
+
+// Close ends every subscription, so streaming handlers return and the
+// server can shut down
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, subs := range h.subscribers {
+		for sub := range subs {
+			h.removeLocked(sub)
+		}
+	}
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(sub)
+}
+
+func (h *Hub) removeLocked(sub *Subscription) {
+	subs, ok := h.subscribers[sub.key]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.key)
+	}
+	close(sub.c)
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Channel is the NOTIFY channel the database triggers publish on
+const Channel = "events"
+
+// Listen relays the events published on Channel to hub until ctx is
+// cancelled. It holds its own connection to the database at dsn and
+// reconnects when that connection drops; events published while it is down
+// are lost, but notifications are replayed when clients reconnect.
+func Listen(ctx context.Context, dsn string, hub *Hub) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Printf("Events: lost the LISTEN connection: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Println("Events: LISTEN connection restored")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("Events: could not reconnect: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		return fmt.Errorf("listening on %s: %w", Channel, err)
+	}
+	log.Printf("Events: listening on %s", Channel)
+
+	// Pinging now and then notices a dead connection that has gone quiet
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ping.C:
+			if err := listener.Ping(); err != nil {
+				log.Printf("Events: LISTEN connection ping failed: %v", err)
+			}
+		case n := <-listener.Notify:
+			if n == nil {
+				// Sent after a reconnect
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+				log.Printf("Events: ignoring malformed payload: %v", err)
+				continue
+			}
+			hub.Publish(event)
+		}
+	}
+}
@@ -2,25 +2,45 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/email"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/middleware"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/utils"
 )
 
 type AdminHandler struct {
-	DB        *sql.DB
+	Admins    store.AdminStore
+	Farmers   store.FarmerStore
+	Buyers    store.BuyerStore
+	Refunds   store.RefundStore
+	Sessions  store.SessionStore
+	Outbox    store.OutboxStore
 	Templates map[string]*template.Template
+	Emails    *email.Templates
+	Config    *config.Config
 }
 
-func NewAdminHandler(db *sql.DB, templates map[string]*template.Template) *AdminHandler {
+func NewAdminHandler(stores *store.Store, templates map[string]*template.Template, emails *email.Templates, cfg *config.Config) *AdminHandler {
 	return &AdminHandler{
-		DB:        db,
+		Admins:    stores.Admins,
+		Farmers:   stores.Farmers,
+		Buyers:    stores.Buyers,
+		Refunds:   stores.Refunds,
+		Sessions:  stores.Sessions,
+		Outbox:    stores.Outbox,
 		Templates: templates,
+		Emails:    emails,
+		Config:    cfg,
 	}
 }
 
@@ -28,148 +48,66 @@ func (h *AdminHandler) Root(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
 }
 
-func (h *AdminHandler) Register(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		csrfToken, err := utils.SetCSRFToken(w)
-		if err != nil {
-			log.Printf("Error setting CSRF token: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		err = h.Templates["register"].Execute(w, map[string]string{"CSRFToken": csrfToken})
-		if err != nil {
-			log.Printf("Error rendering template: %v", err)
-			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-			return
-		}
+// LoginForm handles GET /admin/login
+func (h *AdminHandler) LoginForm(w http.ResponseWriter, r *http.Request) {
+	csrfToken, err := utils.SetCSRFToken(w, h.Config.Session)
+	if err != nil {
+		log.Printf("Error setting CSRF token: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-
-	if r.Method == http.MethodPost {
-		err := utils.ValidateCSRFToken(r)
-		if err != nil {
-			log.Printf("Invalid CSRF token: %v", err)
-			http.Error(w, "Invalid CSRF Token", http.StatusForbidden)
-			return
-		}
-
-		err = r.ParseForm()
-		if err != nil {
-			log.Printf("Error parsing form: %v", err)
-			http.Error(w, "Invalid form data", http.StatusBadRequest)
-			return
-		}
-
-		email := r.FormValue("email")
-		password := r.FormValue("password")
-		confirmPassword := r.FormValue("confirm_password")
-
-		if email == "" || password == "" || confirmPassword == "" {
-			http.Error(w, "Email and Password are required", http.StatusBadRequest)
-			return
-		}
-
-		if password != confirmPassword {
-			http.Error(w, "Passwords do not match", http.StatusBadRequest)
-			return
-		}
-
-		exists, err := models.CheckAdminExists(h.DB, email)
-		if err != nil {
-			log.Printf("Error checking admin existence: %v", err)
-			http.Error(w, "Internal Server Error: CheckAdminExists", http.StatusInternalServerError)
-			return
-		}
-		if exists {
-			http.Error(w, "An admin with this email already exists", http.StatusConflict)
-			return
-		}
-
-		hashedPassword, err := utils.HashPassword(password)
-		if err != nil {
-			log.Printf("Error hashing password: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		admin := &models.Admin{
-			Email:        email,
-			PasswordHash: hashedPassword,
-			IsActive:     true,
-		}
-
-		err = models.CreateAdmin(h.DB, admin)
-		if err != nil {
-			log.Printf("Error creating admin: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+	err = h.Templates["login"].Execute(w, map[string]string{"CSRFToken": csrfToken})
+	if err != nil {
+		log.Printf("Error rendering template: %v", err)
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		return
 	}
 }
 
+// Login handles POST /admin/login
 func (h *AdminHandler) Login(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		csrfToken, err := utils.SetCSRFToken(w)
-		if err != nil {
-			log.Printf("Error setting CSRF token: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-		err = h.Templates["login"].Execute(w, map[string]string{"CSRFToken": csrfToken})
-		if err != nil {
-			log.Printf("Error rendering template: %v", err)
-			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-			return
-		}
+	err := utils.ValidateCSRFToken(r)
+	if err != nil {
+		log.Printf("Invalid CSRF token: %v", err)
+		http.Error(w, "Invalid CSRF Token", http.StatusForbidden)
 		return
 	}
 
-	if r.Method == http.MethodPost {
-		err := utils.ValidateCSRFToken(r)
-		if err != nil {
-			log.Printf("Invalid CSRF token: %v", err)
-			http.Error(w, "Invalid CSRF Token", http.StatusForbidden)
-			return
-		}
-
-		err = r.ParseForm()
-		if err != nil {
-			log.Printf("Error parsing form: %v", err)
-			http.Error(w, "Invalid form data", http.StatusBadRequest)
-			return
-		}
+	err = r.ParseForm()
+	if err != nil {
+		log.Printf("Error parsing form: %v", err)
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
 
-		email := r.FormValue("email")
-		password := r.FormValue("password")
+	email := r.FormValue("email")
+	password := r.FormValue("password")
 
-		if email == "" || password == "" {
-			http.Error(w, "Email and Password are required", http.StatusBadRequest)
-			return
-		}
-
-		admin, err := models.AuthenticateAdmin(h.DB, email, password)
-		if err != nil {
-			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
-			return
-		}
+	if email == "" || password == "" {
+		http.Error(w, "Email and Password are required", http.StatusBadRequest)
+		return
+	}
 
-		_, err = utils.CreateSession(w, h.DB, admin.ID, "admin")
-		if err != nil {
-			log.Printf("Error creating session: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
+	admin, err := h.Admins.GetByEmail(r.Context(), email)
+	if err != nil || !utils.CheckPasswordHash(password, admin.PasswordHash) {
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
 
-		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+	err = startSession(r.Context(), w, h.Sessions, h.Config.Session, admin.ID, "admin")
+	if err != nil {
+		log.Printf("Error creating session: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
+
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 }
 
 func (h *AdminHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	sessionID, err := utils.GetSessionID(r)
 	if err == nil {
-		err = utils.DestroySession(h.DB, sessionID)
+		err = h.Sessions.Delete(r.Context(), sessionID)
 		if err != nil {
 			log.Printf("Error destroying session: %v", err)
 		}
@@ -195,29 +133,90 @@ func (h *AdminHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Every form on the dashboard posts this token back
+	csrfToken, err := utils.SetCSRFToken(w, h.Config.Session)
+	if err != nil {
+		log.Printf("Error setting CSRF token: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Each section is only shown, and only loaded, for roles that can act on it
 	data := map[string]interface{}{
-		"Email": admin.Email,
+		"CSRFToken":           csrfToken,
+		"Email":               admin.Email,
+		"Role":                admin.Role.Label(),
+		"CanReviewFarmers":    admin.Can(models.PermReviewFarmers),
+		"CanViewUsers":        admin.Can(models.PermViewUsers),
+		"CanManageRefunds":    admin.Can(models.PermManageRefunds),
+		"CanManageDeliveries": admin.Can(models.PermManageDeliveries),
+		"CanManageAdmins":     admin.Can(models.PermManageAdmins),
 	}
 
-	pendingFarmers, err := models.GetPendingFarmers(h.DB)
-	if err != nil {
-		log.Printf("Error fetching pending farmers: %v", err)
-		http.Error(w, "Could not retrieve pending farmers", http.StatusInternalServerError)
-		return
+	if admin.Can(models.PermReviewFarmers) {
+		pendingFarmers, err := h.Farmers.GetPending(r.Context())
+		if err != nil {
+			log.Printf("Error fetching pending farmers: %v", err)
+			http.Error(w, "Could not retrieve pending farmers", http.StatusInternalServerError)
+			return
+		}
+
+		var displayFarmers []map[string]interface{}
+		for _, farmer := range pendingFarmers {
+			displayFarmer := map[string]interface{}{
+				"ID":       farmer.ID,
+				"Name":     farmer.FirstName + " " + farmer.LastName,
+				"Email":    farmer.Email,
+				"FarmSize": farmer.FarmSize,
+				"Location": farmer.Location,
+			}
+			displayFarmers = append(displayFarmers, displayFarmer)
+		}
+		data["PendingFarmers"] = displayFarmers
 	}
 
-	var displayFarmers []map[string]interface{}
-	for _, farmer := range pendingFarmers {
-		displayFarmer := map[string]interface{}{
-			"ID":       farmer.ID,
-			"Name":     farmer.FirstName + " " + farmer.LastName,
-			"Email":    farmer.Email,
-			"FarmSize": farmer.FarmSize,
-			"Location": farmer.Location,
+	if admin.Can(models.PermManageRefunds) {
+		pendingRefunds, err := h.Refunds.GetPending(r.Context())
+		if err != nil {
+			log.Printf("Error fetching pending refunds: %v", err)
+			http.Error(w, "Could not retrieve pending refunds", http.StatusInternalServerError)
+			return
+		}
+		data["PendingRefunds"] = pendingRefunds
+	}
+
+	if admin.Can(models.PermManageDeliveries) {
+		deadEntries, err := h.Outbox.GetDead(r.Context())
+		if err != nil {
+			log.Printf("Error fetching failed deliveries: %v", err)
+			http.Error(w, "Could not retrieve failed deliveries", http.StatusInternalServerError)
+			return
+		}
+
+		var failedDeliveries []map[string]interface{}
+		for _, entry := range deadEntries {
+			recipient, summary := describeOutboxEntry(entry)
+			failedDeliveries = append(failedDeliveries, map[string]interface{}{
+				"ID":        entry.ID,
+				"Kind":      entry.Kind,
+				"Recipient": recipient,
+				"Summary":   summary,
+				"Attempts":  entry.Attempts,
+				"LastError": entry.LastError,
+				"CreatedAt": entry.CreatedAt,
+			})
+		}
+		data["FailedDeliveries"] = failedDeliveries
+	}
+
+	if admin.Can(models.PermManageAdmins) {
+		err := h.addAdminSection(r.Context(), data, admin)
+		if err != nil {
+			log.Printf("Error fetching admins: %v", err)
+			http.Error(w, "Could not retrieve admins", http.StatusInternalServerError)
+			return
 		}
-		displayFarmers = append(displayFarmers, displayFarmer)
 	}
-	data["PendingFarmers"] = displayFarmers
 
 	err = h.Templates["dashboard"].Execute(w, data)
 	if err != nil {
@@ -228,14 +227,14 @@ func (h *AdminHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	farmers, err := models.GetAllFarmers(h.DB)
+	farmers, err := h.Farmers.GetAll(r.Context())
 	if err != nil {
 		http.Error(w, "Could not retrieve farmers", http.StatusInternalServerError)
 		log.Printf("Error retrieving farmers: %v", err)
 		return
 	}
 
-	buyers, err := models.GetAllBuyers(h.DB)
+	buyers, err := h.Buyers.GetAll(r.Context())
 	if err != nil {
 		http.Error(w, "Could not retrieve buyers", http.StatusInternalServerError)
 		log.Printf("Error retrieving buyers: %v", err)
@@ -254,3 +253,50 @@ func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// RetryDelivery handles POST /admin/outbox/retry, putting a dead-lettered
+// email or notification back in the queue
+func (h *AdminHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	err := utils.ValidateCSRFToken(r)
+	if err != nil {
+		log.Printf("Invalid CSRF token: %v", err)
+		http.Error(w, "Invalid CSRF Token", http.StatusForbidden)
+		return
+	}
+
+	entryID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Bad Request: Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Outbox.Retry(r.Context(), entryID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No failed delivery with that ID", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error retrying outbox entry %d: %v", entryID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Outbox entry %d requeued", entryID)
+
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// describeOutboxEntry gives the recipient and a one-line summary of an entry for the dashboard
+func describeOutboxEntry(entry models.OutboxEntry) (string, string) {
+	switch entry.Kind {
+	case models.OutboxEmail:
+		var payload models.EmailPayload
+		if json.Unmarshal(entry.Payload, &payload) == nil {
+			return payload.To, payload.Subject
+		}
+	case models.OutboxNotification:
+		var payload models.NotificationPayload
+		if json.Unmarshal(entry.Payload, &payload) == nil {
+			return fmt.Sprintf("Farmer #%d", payload.RecipientID), payload.Message
+		}
+	}
+	return "", string(entry.Payload)
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/middleware"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/utils"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/validation"
+)
+
+// invitationTTL is how long an invitation link can be used
+const invitationTTL = 7 * 24 * time.Hour
+
+// InviteAdminRequest is the form a super admin fills in on the dashboard
+type InviteAdminRequest struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Role  string `json:"role" validate:"required,oneof=super_admin moderator support finance"`
+}
+
+// AcceptInvitationRequest is the form an invited admin sets their password with
+type AcceptInvitationRequest struct {
+	Password        string `json:"password" validate:"required,password"`
+	ConfirmPassword string `json:"confirm_password" validate:"required"`
+}
+
+// addAdminSection adds the admins, their roles and the open invitations to
+// the dashboard data
+func (h *AdminHandler) addAdminSection(ctx context.Context, data map[string]interface{}, current *models.Admin) error {
+	admins, err := h.Admins.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	var displayAdmins []map[string]interface{}
+	for _, admin := range admins {
+		displayAdmins = append(displayAdmins, map[string]interface{}{
+			"ID":        admin.ID,
+			"Email":     admin.Email,
+			"Role":      string(admin.Role),
+			"RoleLabel": admin.Role.Label(),
+			"IsSelf":    admin.ID == current.ID,
+		})
+	}
+	data["Admins"] = displayAdmins
+
+	invitations, err := h.Admins.PendingInvitations(ctx)
+	if err != nil {
+		return err
+	}
+	var displayInvitations []map[string]interface{}
+	for _, invitation := range invitations {
+		displayInvitations = append(displayInvitations, map[string]interface{}{
+			"ID":        invitation.ID,
+			"Email":     invitation.Email,
+			"RoleLabel": invitation.Role.Label(),
+			"ExpiresAt": invitation.ExpiresAt,
+		})
+	}
+	data["Invitations"] = displayInvitations
+
+	var roles []map[string]interface{}
+	for _, role := range models.Roles {
+		var permissions []string
+		for _, permission := range role.Permissions() {
+			permissions = append(permissions, string(permission))
+		}
+		roles = append(roles, map[string]interface{}{
+			"Value":       string(role),
+			"Label":       role.Label(),
+			"Permissions": strings.Join(permissions, ", "),
+		})
+	}
+	data["Roles"] = roles
+	return nil
+}
+
+// InviteAdmin handles POST /admin/admins/invite. The invitation email with
+// the link is queued with the invitation and sent by the outbox worker.
+func (h *AdminHandler) InviteAdmin(w http.ResponseWriter, r *http.Request) {
+	err := utils.ValidateCSRFToken(r)
+	if err != nil {
+		log.Printf("Invalid CSRF token: %v", err)
+		http.Error(w, "Invalid CSRF Token", http.StatusForbidden)
+		return
+	}
+
+	inviter, ok := r.Context().Value(middleware.AdminContextKey).(*models.Admin)
+	if !ok {
+		http.Error(w, "Access denied: Admin privileges required", http.StatusForbidden)
+		return
+	}
+
+	req := InviteAdminRequest{
+		Email: strings.TrimSpace(r.FormValue("email")),
+		Role:  r.FormValue("role"),
+	}
+	if errs := validation.Struct(&req); errs != nil {
+		http.Error(w, "Invalid invitation: "+errs.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exists, err := h.Admins.Exists(r.Context(), req.Email)
+	if err != nil {
+		log.Printf("Error checking admin existence: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		http.Error(w, "An admin with this email already exists", http.StatusConflict)
+		return
+	}
+
+	role := models.Role(req.Role)
+	invitation, token, err := models.NewAdminInvitation(req.Email, role, inviter.ID, invitationTTL)
+	if err != nil {
+		log.Printf("Error creating invitation: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	message, err := h.Emails.Render("admin_invitation", "", map[string]interface{}{
+		"InvitedBy": inviter.Email,
+		"Role":      role.Label(),
+		"Link":      strings.TrimSuffix(h.Config.Server.BaseURL, "/") + "/admin/invitations/accept?token=" + url.QueryEscape(token),
+		"ExpiresAt": invitation.ExpiresAt.UTC().Format("2006-01-02 15:04 MST"),
+	})
+	if err != nil {
+		log.Printf("Error rendering invitation email: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.Admins.Invite(r.Context(), invitation, models.EmailEntry(req.Email, message.Subject, message.Text, message.HTML))
+	if err != nil {
+		log.Printf("Error saving invitation: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Admin %d invited %s as %s", inviter.ID, req.Email, role)
+
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// RevokeInvitation handles POST /admin/invitations/revoke
+func (h *AdminHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	err := utils.ValidateCSRFToken(r)
+	if err != nil {
+		log.Printf("Invalid CSRF token: %v", err)
+		http.Error(w, "Invalid CSRF Token", http.StatusForbidden)
+		return
+	}
+
+	invitationID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Bad Request: Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Admins.RevokeInvitation(r.Context(), invitationID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No open invitation with that ID", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error revoking invitation %d: %v", invitationID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Invitation %d revoked", invitationID)
+
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// SetAdminRole handles POST /admin/admins/role. Admins cannot change their
+// own role, and the last super admin cannot be demoted.
+func (h *AdminHandler) SetAdminRole(w http.ResponseWriter, r *http.Request) {
+	err := utils.ValidateCSRFToken(r)
+	if err != nil {
+		log.Printf("Invalid CSRF token: %v", err)
+		http.Error(w, "Invalid CSRF Token", http.StatusForbidden)
+		return
+	}
+
+	current, ok := r.Context().Value(middleware.AdminContextKey).(*models.Admin)
+	if !ok {
+		http.Error(w, "Access denied: Admin privileges required", http.StatusForbidden)
+		return
+	}
+
+	adminID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Bad Request: Invalid admin ID", http.StatusBadRequest)
+		return
+	}
+	role := models.Role(r.FormValue("role"))
+	if !role.Valid() {
+		http.Error(w, "Bad Request: Unknown role", http.StatusBadRequest)
+		return
+	}
+	if adminID == current.ID {
+		http.Error(w, "You cannot change your own role", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Admins.SetRole(r.Context(), adminID, role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Admin not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, models.ErrLastSuperAdmin) {
+		http.Error(w, "At least one super admin must remain", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error setting role of admin %d: %v", adminID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Admin %d set the role of admin %d to %s", current.ID, adminID, role)
+
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// AcceptInvitationForm handles GET /admin/invitations/accept?token=..
+func (h *AdminHandler) AcceptInvitationForm(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	invitation, ok := h.usableInvitation(w, r, token)
+	if !ok {
+		return
+	}
+
+	csrfToken, err := utils.SetCSRFToken(w, h.Config.Session)
+	if err != nil {
+		log.Printf("Error setting CSRF token: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	err = h.Templates["accept_invitation"].Execute(w, map[string]interface{}{
+		"CSRFToken": csrfToken,
+		"Token":     token,
+		"Email":     invitation.Email,
+		"Role":      invitation.Role.Label(),
+	})
+	if err != nil {
+		log.Printf("Error rendering template: %v", err)
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		return
+	}
+}
+
+// AcceptInvitation handles POST /admin/invitations/accept, creating the
+// invited admin and signing them in
+func (h *AdminHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	err := utils.ValidateCSRFToken(r)
+	if err != nil {
+		log.Printf("Invalid CSRF token: %v", err)
+		http.Error(w, "Invalid CSRF Token", http.StatusForbidden)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		log.Printf("Error parsing form: %v", err)
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	invitation, ok := h.usableInvitation(w, r, r.FormValue("token"))
+	if !ok {
+		return
+	}
+
+	req := AcceptInvitationRequest{
+		Password:        r.FormValue("password"),
+		ConfirmPassword: r.FormValue("confirm_password"),
+	}
+	if errs := validation.Struct(&req); errs != nil {
+		http.Error(w, "Invalid password: "+errs.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Password != req.ConfirmPassword {
+		http.Error(w, "Passwords do not match", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	admin := &models.Admin{PasswordHash: hashedPassword, IsActive: true}
+	err = h.Admins.AcceptInvitation(r.Context(), invitation.ID, admin)
+	if err == sql.ErrNoRows {
+		http.Error(w, "This invitation is no longer valid", http.StatusGone)
+		return
+	} else if errors.Is(err, models.ErrAdminExists) {
+		http.Error(w, "An admin with this email already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error accepting invitation %d: %v", invitation.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Invitation %d accepted by new admin %d (%s)", invitation.ID, admin.ID, admin.Role)
+
+	err = startSession(r.Context(), w, h.Sessions, h.Config.Session, admin.ID, "admin")
+	if err != nil {
+		log.Printf("Error creating session: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// usableInvitation looks up the invitation for token, answering the request
+// itself when there is none that can still be accepted
+func (h *AdminHandler) usableInvitation(w http.ResponseWriter, r *http.Request, token string) (*models.AdminInvitation, bool) {
+	if token == "" {
+		http.Error(w, "Bad Request: Missing invitation token", http.StatusBadRequest)
+		return nil, false
+	}
+
+	invitation, err := h.Admins.GetInvitation(r.Context(), models.HashInvitationToken(token))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("Error looking up invitation: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !invitation.Usable() {
+		http.Error(w, "This invitation is no longer valid", http.StatusGone)
+		return nil, false
+	}
+	return invitation, true
+}
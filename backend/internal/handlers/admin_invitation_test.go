@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/email"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+)
+
+func newTestAdminHandler(t *testing.T) (*AdminHandler, *fakeAdmins, *fakeOutbox) {
+	t.Helper()
+
+	cfg := config.Defaults(config.Test)
+	emails, err := email.LoadTemplates("../../../web/templates/email", cfg.Mail.DefaultLocale)
+	if err != nil {
+		t.Fatalf("loading email templates: %v", err)
+	}
+	admins := &fakeAdmins{byEmail: map[string]*models.Admin{
+		"root@example.com": {ID: 1, Email: "root@example.com", Role: models.RoleSuperAdmin},
+	}}
+	outbox := &fakeOutbox{dead: map[int]bool{4: true}}
+	return &AdminHandler{Admins: admins, Outbox: outbox, Emails: emails, Config: cfg}, admins, outbox
+}
+
+// adminForm posts form as admin, with a CSRF token matching the cookie
+// unless csrf is false
+func adminForm(path string, form url.Values, admin *models.Admin, csrf bool) *http.Request {
+	if csrf {
+		form.Set("csrf_token", "page-token")
+	}
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "csrf_token", Value: "page-token"})
+	return signedInAs(req, admin)
+}
+
+func TestInviteAdmin(t *testing.T) {
+	root := &models.Admin{ID: 1, Email: "root@example.com", Role: models.RoleSuperAdmin}
+
+	tests := []struct {
+		name  string
+		form  url.Values
+		csrf  bool
+		want  int
+		queue bool
+	}{
+		{"invited", url.Values{"email": {"finn@example.com"}, "role": {"finance"}}, true, http.StatusSeeOther, true},
+		{"without a CSRF token", url.Values{"email": {"finn@example.com"}, "role": {"finance"}}, false, http.StatusForbidden, false},
+		{"existing admin", url.Values{"email": {"root@example.com"}, "role": {"support"}}, true, http.StatusConflict, false},
+		{"unknown role", url.Values{"email": {"finn@example.com"}, "role": {"owner"}}, true, http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, admins, _ := newTestAdminHandler(t)
+
+			rec := httptest.NewRecorder()
+			h.InviteAdmin(rec, adminForm("/admin/admins/invite", tt.form, root, tt.csrf))
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if queued := len(admins.invited) == 1 && len(admins.outbox) == 1; queued != tt.queue {
+				t.Errorf("invitations %d, outbox entries %d", len(admins.invited), len(admins.outbox))
+			}
+		})
+	}
+}
+
+func TestSetAdminRole(t *testing.T) {
+	root := &models.Admin{ID: 1, Role: models.RoleSuperAdmin}
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		roleErr error
+		want    int
+	}{
+		{"changed", url.Values{"id": {"2"}, "role": {"moderator"}}, nil, http.StatusSeeOther},
+		{"own role", url.Values{"id": {"1"}, "role": {"support"}}, nil, http.StatusBadRequest},
+		{"unknown role", url.Values{"id": {"2"}, "role": {"owner"}}, nil, http.StatusBadRequest},
+		{"last super admin", url.Values{"id": {"2"}, "role": {"support"}}, models.ErrLastSuperAdmin, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, admins, _ := newTestAdminHandler(t)
+			admins.roleErr = tt.roleErr
+
+			rec := httptest.NewRecorder()
+			h.SetAdminRole(rec, adminForm("/admin/admins/role", tt.form, root, true))
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRetryDelivery(t *testing.T) {
+	support := &models.Admin{ID: 2, Role: models.RoleSupport}
+	h, _, outbox := newTestAdminHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.RetryDelivery(rec, adminForm("/admin/outbox/retry", url.Values{"id": {"4"}}, support, true))
+	if rec.Code != http.StatusSeeOther || len(outbox.retried) != 1 {
+		t.Fatalf("retrying a dead entry: status %d, retried %v", rec.Code, outbox.retried)
+	}
+
+	rec = httptest.NewRecorder()
+	h.RetryDelivery(rec, adminForm("/admin/outbox/retry", url.Values{"id": {"4"}}, support, true))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("retrying an entry that is no longer dead: status %d", rec.Code)
+	}
+}
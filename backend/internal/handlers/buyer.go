@@ -7,32 +7,38 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"time"
 
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/api"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/middleware"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/utils"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/validation"
 )
 
 type BuyerHandler struct {
-	DB        *sql.DB
-	Templates map[string]*template.Template
+	Buyers        store.BuyerStore
+	Products      store.ProductStore
+	Sessions      store.SessionStore
+	Notifications store.NotificationStore
+	Templates     map[string]*template.Template
+	Config        *config.Config
 }
 
-func NewBuyerHandler(db *sql.DB, templates map[string]*template.Template) *BuyerHandler {
+func NewBuyerHandler(stores *store.Store, templates map[string]*template.Template, cfg *config.Config) *BuyerHandler {
 	return &BuyerHandler{
-		DB:        db,
-		Templates: templates,
+		Buyers:        stores.Buyers,
+		Products:      stores.Products,
+		Sessions:      stores.Sessions,
+		Notifications: stores.Notifications,
+		Templates:     templates,
+		Config:        cfg,
 	}
 }
 
 // admin-only funcs
 func (h *BuyerHandler) ToggleBuyerStatus(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	buyerIDStr := r.FormValue("id")
 	buyerID, err := strconv.Atoi(buyerIDStr)
 	if err != nil {
@@ -40,7 +46,7 @@ func (h *BuyerHandler) ToggleBuyerStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	buyer, err := models.GetBuyerByID(h.DB, buyerID)
+	buyer, err := h.Buyers.GetByID(r.Context(), buyerID)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Buyer not found", http.StatusNotFound)
 		return
@@ -52,7 +58,7 @@ func (h *BuyerHandler) ToggleBuyerStatus(w http.ResponseWriter, r *http.Request)
 	// Toggle the `is_active` status
 	newIsActive := !buyer.IsActive
 
-	_, err = h.DB.Exec("UPDATE buyers SET is_active = $1, updated_at = $2 WHERE id = $3", newIsActive, time.Now(), buyer.ID)
+	err = h.Buyers.SetActive(r.Context(), buyer.ID, newIsActive)
 	if err != nil {
 		http.Error(w, "Failed to update buyer active status", http.StatusInternalServerError)
 		return
@@ -61,62 +67,56 @@ func (h *BuyerHandler) ToggleBuyerStatus(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 }
 
-func (h *BuyerHandler) EditBuyer(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		buyerID, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil {
-			http.Error(w, "Invalid buyer ID", http.StatusBadRequest)
-			return
-		}
-
-		buyer, err := models.GetBuyerByID(h.DB, buyerID)
-		if err != nil {
-			http.Error(w, "Buyer not found", http.StatusNotFound)
-			return
-		}
-
-		data := map[string]interface{}{"Buyer": buyer}
-		err = h.Templates["edit_buyer"].Execute(w, data)
-		if err != nil {
-			log.Printf("Template rendering error: %v", err)
-			http.Error(w, "Error rendering edit page", http.StatusInternalServerError)
-		}
+// EditBuyerForm handles GET /admin/users/edit-buyer
+func (h *BuyerHandler) EditBuyerForm(w http.ResponseWriter, r *http.Request) {
+	buyerID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid buyer ID", http.StatusBadRequest)
 		return
 	}
 
-	if r.Method == http.MethodPost {
-		buyerID, err := strconv.Atoi(r.FormValue("id"))
-		if err != nil {
-			http.Error(w, "Invalid buyer ID", http.StatusBadRequest)
-			return
-		}
+	buyer, err := h.Buyers.GetByID(r.Context(), buyerID)
+	if err != nil {
+		http.Error(w, "Buyer not found", http.StatusNotFound)
+		return
+	}
 
-		updatedBuyer := models.Buyer{
-			ID:              buyerID,
-			Email:           r.FormValue("email"),
-			FirstName:       r.FormValue("first_name"),
-			LastName:        r.FormValue("last_name"),
-			DeliveryAddress: r.FormValue("delivery_address"),
-			IsActive:        r.FormValue("is_active") == "on", // Set to true if checkbox is checked
-		}
+	data := map[string]interface{}{"Buyer": buyer}
+	err = h.Templates["edit_buyer"].Execute(w, data)
+	if err != nil {
+		log.Printf("Template rendering error: %v", err)
+		http.Error(w, "Error rendering edit page", http.StatusInternalServerError)
+	}
+}
 
-		err = models.UpdateBuyer(h.DB, updatedBuyer)
-		if err != nil {
-			log.Printf("Error updating buyer: %v", err)
-			http.Error(w, "Error updating buyer", http.StatusInternalServerError)
-			return
-		}
+// EditBuyer handles POST /admin/users/edit-buyer
+func (h *BuyerHandler) EditBuyer(w http.ResponseWriter, r *http.Request) {
+	buyerID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid buyer ID", http.StatusBadRequest)
+		return
+	}
 
-		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+	updatedBuyer := models.Buyer{
+		ID:              buyerID,
+		Email:           r.FormValue("email"),
+		FirstName:       r.FormValue("first_name"),
+		LastName:        r.FormValue("last_name"),
+		DeliveryAddress: r.FormValue("delivery_address"),
+		IsActive:        r.FormValue("is_active") == "on", // Set to true if checkbox is checked
 	}
-}
 
-func (h *BuyerHandler) DeleteBuyer(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	err = h.Buyers.Update(r.Context(), updatedBuyer)
+	if err != nil {
+		log.Printf("Error updating buyer: %v", err)
+		http.Error(w, "Error updating buyer", http.StatusInternalServerError)
 		return
 	}
 
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (h *BuyerHandler) DeleteBuyer(w http.ResponseWriter, r *http.Request) {
 	buyerIDStr := r.FormValue("id")
 	buyerID, err := strconv.Atoi(buyerIDStr)
 	if err != nil {
@@ -124,8 +124,11 @@ func (h *BuyerHandler) DeleteBuyer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.DB.Exec("DELETE FROM buyers WHERE id = $1", buyerID)
-	if err != nil {
+	err = h.Buyers.Delete(r.Context(), buyerID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Buyer not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, "Failed to delete buyer", http.StatusInternalServerError)
 		return
 	}
@@ -134,50 +137,50 @@ func (h *BuyerHandler) DeleteBuyer(w http.ResponseWriter, r *http.Request) {
 }
 
 // buyer-specific funcs
-func (h *BuyerHandler) Register(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
 
-	var req struct {
-		Email               string                 `json:"email"`
-		Password            string                 `json:"password"`
-		FirstName           string                 `json:"first_name"`
-		LastName            string                 `json:"last_name"`
-		DeliveryAddress     string                 `json:"delivery_address"`
-		DeliveryPreferences map[string]interface{} `json:"delivery_preferences"`
-	}
+// BuyerRegisterRequest is the body of POST /buyer/register
+type BuyerRegisterRequest struct {
+	Email               string                 `json:"email" validate:"required,email,max=255"`
+	Password            string                 `json:"password" validate:"required,password"`
+	FirstName           string                 `json:"first_name" validate:"required,max=100"`
+	LastName            string                 `json:"last_name" validate:"required,max=100"`
+	DeliveryAddress     string                 `json:"delivery_address" validate:"max=500"`
+	DeliveryPreferences map[string]interface{} `json:"delivery_preferences"`
+	Locale              string                 `json:"locale" validate:"max=16"`
+}
+
+func (h *BuyerHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req BuyerRegisterRequest
 
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 	if err := decoder.Decode(&req); err != nil {
 		log.Printf("Error decoding JSON: %v", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 	defer r.Body.Close()
 
-	if req.Email == "" || req.Password == "" || req.FirstName == "" || req.LastName == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	if errs := validation.Struct(req); errs != nil {
+		writeValidationError(w, r, errs)
 		return
 	}
 
-	existingBuyer, err := models.GetBuyerByEmail(h.DB, req.Email)
+	existingBuyer, err := h.Buyers.GetByEmail(r.Context(), req.Email)
 	if err != nil && err != sql.ErrNoRows {
 		log.Printf("Error checking existing buyer: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 	if existingBuyer != nil {
-		http.Error(w, "Buyer with this email already exists", http.StatusConflict)
+		writeJSONError(w, r, http.StatusConflict, "Buyer with this email already exists")
 		return
 	}
 
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
 		log.Printf("Error hashing password: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
 
@@ -189,11 +192,12 @@ func (h *BuyerHandler) Register(w http.ResponseWriter, r *http.Request) {
 		DeliveryAddress:     req.DeliveryAddress,
 		DeliveryPreferences: req.DeliveryPreferences,
 		IsActive:            true,
+		Locale:              preferredLocale(r, req.Locale),
 	}
 
-	err = models.CreateBuyer(h.DB, buyer)
+	err = h.Buyers.Create(r.Context(), buyer)
 	if err != nil {
-		http.Error(w, "Failed to register buyer", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to register buyer")
 		return
 	}
 
@@ -205,92 +209,65 @@ func (h *BuyerHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Email: buyer.Email,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding response JSON: %v", err)
-		http.Error(w, "Failed to send response", http.StatusInternalServerError)
-		return
-	}
-
+	api.WriteJSON(w, r, http.StatusCreated, response)
 	log.Printf("Successfully registered buyer with ID: %d", buyer.ID)
 }
 
-func (h *BuyerHandler) Login(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed buyer login", http.StatusMethodNotAllowed)
-		return
-	}
+// LoginRequest is the body of the buyer and farmer login endpoints
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
 
-	var loginData struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+func (h *BuyerHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var loginData LoginRequest
 	err := json.NewDecoder(r.Body).Decode(&loginData)
 	if err != nil {
 		log.Printf("Error decoding login data: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if loginData.Email == "" || loginData.Password == "" {
-		http.Error(w, "Email and Password are required", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Email and Password are required")
 		return
 	}
 
 	// log.Printf("Attempting to fetch buyer with email: %s", loginData.Email)
-	buyer, err := models.GetBuyerByEmail(h.DB, loginData.Email)
+	buyer, err := h.Buyers.GetByEmail(r.Context(), loginData.Email)
 	if err != nil {
 		log.Printf("Error fetching buyer: %v", err)
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		writeJSONError(w, r, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
 
 	// log.Printf("Checking password: %s against hash: %s", loginData.Password, buyer.PasswordHash)
 	if !utils.CheckPasswordHash(loginData.Password, buyer.PasswordHash) {
 		log.Println("Password validation failed")
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		writeJSONError(w, r, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
 
-	_, err = utils.CreateSession(w, h.DB, buyer.ID, "buyer")
+	err = startSession(r.Context(), w, h.Sessions, h.Config.Session, buyer.ID, "buyer")
 	if err != nil {
 		log.Printf("Error creating session: %v", err)
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to create session")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"message": "Login successful",
 	})
 }
 
 func (h *BuyerHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Invalidate the user's session or token (implementation depends on your session/token management strategy)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message": "Successfully logged out"}`))
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{"message": "Successfully logged out"})
 }
 
 func (h *BuyerHandler) Home(w http.ResponseWriter, r *http.Request) {
-	buyer, ok := r.Context().Value(middleware.BuyerContextKey).(*models.Buyer)
-	if !ok || buyer == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Unauthorized: Buyer not found in context",
-		})
-		return
-	}
+	buyer := middleware.CurrentBuyer(r)
 
 	// Parse query parameters
 	queryValues := r.URL.Query()
@@ -327,16 +304,20 @@ func (h *BuyerHandler) Home(w http.ResponseWriter, r *http.Request) {
 	}
 	offset := (page - 1) * limit
 
-	products, err := models.GetProductsWithFilters(h.DB, filters, limit, offset)
+	products, err := h.Products.Search(r.Context(), filters, limit, offset)
 	if err != nil {
-		http.Error(w, "Internal Server Error: Unable to retrieve products", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Internal Server Error: Unable to retrieve products")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(products); err != nil {
-		http.Error(w, "Internal Server Error: Unable to encode products", http.StatusInternalServerError)
+	unread, err := h.Notifications.CountUnread(r.Context(), models.RecipientBuyer, buyer.ID)
+	if err != nil {
+		log.Printf("Error counting unread notifications: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Internal Server Error: Unable to retrieve notifications")
 		return
 	}
+
+	// The body is the product list, so the unread count travels in a header
+	w.Header().Set("X-Unread-Notifications", strconv.Itoa(unread))
+	api.WriteJSON(w, r, http.StatusOK, products)
 }
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+)
+
+func TestBuyerRegister(t *testing.T) {
+	valid := map[string]interface{}{
+		"email":      "bea@example.com",
+		"password":   "basket-2024",
+		"first_name": "Bea",
+		"last_name":  "Market",
+	}
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		want int
+	}{
+		{"registered", valid, http.StatusCreated},
+		{"taken email", map[string]interface{}{"email": "taken@example.com", "password": "basket-2024", "first_name": "Bea", "last_name": "Market"}, http.StatusConflict},
+		{"weak password", map[string]interface{}{"email": "bea@example.com", "password": "basket", "first_name": "Bea", "last_name": "Market"}, http.StatusUnprocessableEntity},
+		{"unknown field", map[string]interface{}{"email": "bea@example.com", "password": "basket-2024", "first_name": "Bea", "last_name": "Market", "is_active": false}, http.StatusBadRequest},
+		{"longest locale", map[string]interface{}{"email": "bea@example.com", "password": "basket-2024", "first_name": "Bea", "last_name": "Market", "locale": "de-ch-1901-abcde"}, http.StatusCreated},
+		{"locale too long", map[string]interface{}{"email": "bea@example.com", "password": "basket-2024", "first_name": "Bea", "last_name": "Market", "locale": "de-ch-1901-abcdef"}, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buyers := &fakeBuyers{byEmail: map[string]*models.Buyer{"taken@example.com": {ID: 9}}}
+			h := &BuyerHandler{Buyers: buyers}
+
+			rec := httptest.NewRecorder()
+			h.Register(rec, jsonRequest(t, http.MethodPost, "/buyer/register", tt.body, nil))
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if created := len(buyers.created) == 1; created != (tt.want == http.StatusCreated) {
+				t.Fatalf("%d buyers created", len(buyers.created))
+			}
+			if tt.want == http.StatusCreated && (!buyers.created[0].IsActive || buyers.created[0].PasswordHash == "basket-2024") {
+				t.Errorf("created buyer %+v", buyers.created[0])
+			}
+			if locale, _ := tt.body["locale"].(string); tt.want == http.StatusCreated && buyers.created[0].Locale != locale {
+				t.Errorf("created buyer locale %q, want %q", buyers.created[0].Locale, locale)
+			}
+		})
+	}
+}
@@ -4,41 +4,50 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
-	"strconv"
-	"strings"
+	"time"
 
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/api"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/middleware"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/router"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/validation"
 )
 
 type CartHandler struct {
-	DB *sql.DB
+	Carts    store.CartStore
+	Payments payments.PaymentProvider
+	Currency string
+
+	// ReservationTTL is how long cart items hold stock; zero disables holds
+	ReservationTTL time.Duration
 }
 
-func NewCartHandler(db *sql.DB) *CartHandler {
-	return &CartHandler{DB: db}
+func NewCartHandler(stores *store.Store, provider payments.PaymentProvider, cfg *config.Config) *CartHandler {
+	return &CartHandler{
+		Carts:          stores.Carts,
+		Payments:       provider,
+		Currency:       cfg.Payments.Currency,
+		ReservationTTL: cfg.Orders.ReservationTTL,
+	}
 }
 
 // GetCart handles GET /cart
 func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
 	// Retrieve buyer from context
-	buyer, ok := r.Context().Value(middleware.BuyerContextKey).(*models.Buyer)
-	if !ok || buyer == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Unauthorized: Buyer not found in context",
-		})
-		return
-	}
+	buyer := middleware.CurrentBuyer(r)
 
 	// Fetch cart items from the database using the correct function
-	cartItems, err := models.GetCartByBuyerID(h.DB, buyer.ID)
+	cartItems, err := h.Carts.Get(r.Context(), buyer.ID)
 	if err != nil {
 		// Log the error for backend debugging
-		http.Error(w, "Failed to retrieve cart", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve cart")
 		return
 	}
 
@@ -49,47 +58,44 @@ func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send the response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	api.WriteJSON(w, r, http.StatusOK, response)
+}
+
+// AddToCartRequest is the body of POST /cart/add
+type AddToCartRequest struct {
+	ProductID int `json:"productId" validate:"required,min=1"`
+	Quantity  int `json:"quantity" validate:"required,min=1,max=1000"`
 }
 
 // AddToCart handles POST /cart/add
 func (h *CartHandler) AddToCart(w http.ResponseWriter, r *http.Request) {
 	// Retrieve buyer from context
-	buyer, ok := r.Context().Value(middleware.BuyerContextKey).(*models.Buyer)
-	if !ok || buyer == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Unauthorized: Buyer not found in context",
-		})
-		return
-	}
+	buyer := middleware.CurrentBuyer(r)
 
 	// Parse the request body
-	var request struct {
-		ProductID int `json:"productId"`
-		Quantity  int `json:"quantity"`
-	}
+	var request AddToCartRequest
 
 	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil || request.ProductID == 0 || request.Quantity < 1 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Invalid request payload",
-		})
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if errs := validation.Struct(request); errs != nil {
+		writeValidationError(w, r, errs)
 		return
 	}
 
 	// Add the product to the cart using the correct function
-	err = models.AddProductToCart(h.DB, buyer.ID, request.ProductID, request.Quantity)
-	if err != nil {
+	err = h.Carts.Add(r.Context(), buyer.ID, request.ProductID, request.Quantity, h.ReservationTTL)
+	if errors.Is(err, models.ErrInsufficientStock) {
+		writeJSONErrorCode(w, r, http.StatusConflict, api.CodeInsufficientStock, "Not enough stock available for this product")
+		return
+	} else if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, r, http.StatusNotFound, "Product not found")
+		return
+	} else if err != nil {
 		// Log the error for backend debugging
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, "Failed to add product to cart", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to add product to cart")
 		return
 	}
 
@@ -100,46 +106,25 @@ func (h *CartHandler) AddToCart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send the response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	api.WriteJSON(w, r, http.StatusOK, response)
 }
 
 // RemoveFromCart handles DELETE /cart/remove/{productId}
 func (h *CartHandler) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 	// Retrieve buyer from context
-	buyer, ok := r.Context().Value(middleware.BuyerContextKey).(*models.Buyer)
-	if !ok || buyer == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Unauthorized: Buyer not found in context",
-		})
-		return
-	}
+	buyer := middleware.CurrentBuyer(r)
 
-	// Extract productId from the URL path
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 4 {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, "Product ID is required", http.StatusBadRequest)
-		return
-	}
-
-	productIDStr := pathParts[3]
-	productID, err := strconv.Atoi(productIDStr)
+	productID, err := router.PathInt(r, "productId")
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, "Invalid Product ID", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid Product ID")
 		return
 	}
 
 	// Remove the product from the cart using the correct function
-	err = models.RemoveProductFromCart(h.DB, buyer.ID, productID)
+	err = h.Carts.Remove(r.Context(), buyer.ID, productID)
 	if err != nil {
 		// Log the error for backend debugging
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, "Failed to remove product from cart", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to remove product from cart")
 		return
 	}
 
@@ -150,43 +135,45 @@ func (h *CartHandler) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send the response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	api.WriteJSON(w, r, http.StatusOK, response)
+}
+
+// UpdateCartRequest is the body of POST /cart/update; a quantity of 0
+// removes the product
+type UpdateCartRequest struct {
+	ProductID int `json:"productId" validate:"required,min=1"`
+	Quantity  int `json:"quantity" validate:"min=0,max=1000"`
 }
 
 // UpdateCart handles POST /cart/update
 func (h *CartHandler) UpdateCart(w http.ResponseWriter, r *http.Request) {
 	// Retrieve buyer from context
-	buyer, ok := r.Context().Value(middleware.BuyerContextKey).(*models.Buyer)
-	if !ok || buyer == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Unauthorized: Buyer not found in context",
-		})
-		return
-	}
+	buyer := middleware.CurrentBuyer(r)
 
 	// Parse the request body
-	var request struct {
-		ProductID int `json:"productId"`
-		Quantity  int `json:"quantity"`
-	}
+	var request UpdateCartRequest
 
 	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil || request.ProductID == 0 || request.Quantity < 0 {
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if errs := validation.Struct(request); errs != nil {
+		writeValidationError(w, r, errs)
 		return
 	}
 
 	// Update the cart item using the correct function
-	err = models.UpdateCartItem(h.DB, buyer.ID, request.ProductID, request.Quantity)
-	if err != nil {
+	err = h.Carts.Update(r.Context(), buyer.ID, request.ProductID, request.Quantity, h.ReservationTTL)
+	if errors.Is(err, models.ErrInsufficientStock) {
+		writeJSONErrorCode(w, r, http.StatusConflict, api.CodeInsufficientStock, "Not enough stock available for this product")
+		return
+	} else if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, r, http.StatusNotFound, "Product not found")
+		return
+	} else if err != nil {
 		// Log the error for backend debugging
-		w.Header().Set("Content-Type", "application/json")
-		http.Error(w, "Failed to update cart item", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to update cart item")
 		return
 	}
 
@@ -197,43 +184,86 @@ func (h *CartHandler) UpdateCart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send the response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	api.WriteJSON(w, r, http.StatusOK, response)
+}
+
+// CheckoutRequest is the optional body of POST /checkout
+type CheckoutRequest struct {
+	// DeliveryMethods maps a farmer ID to how that farmer's items arrive
+	DeliveryMethods map[int]string `json:"delivery_methods" validate:"dive,oneof=delivery pickup"`
+	PaymentMethod   string         `json:"payment_method" validate:"oneof=card cash_on_delivery pay_at_pickup"`
+	PaymentToken    string         `json:"payment_token" validate:"max=255"`
 }
 
 func (h *CartHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 	// Retrieve buyer from context
-	buyer, ok := r.Context().Value(middleware.BuyerContextKey).(*models.Buyer)
-	if !ok || buyer == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Unauthorized: Buyer not found in context",
-		})
+	buyer := middleware.CurrentBuyer(r)
+
+	// Parse the optional request body
+	var request CheckoutRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil && err != io.EOF {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	errs := validation.Struct(request)
+	if request.PaymentMethod == "" {
+		request.PaymentMethod = models.PaymentMethodCard
+	}
+	if request.PaymentMethod == models.PaymentMethodCard && request.PaymentToken == "" {
+		if errs == nil {
+			errs = make(validation.Errors)
+		}
+		errs.Add("payment_token", "is required for card payments")
+	}
+	if errs != nil {
+		writeValidationError(w, r, errs)
 		return
 	}
 
 	// Perform checkout
-	err := models.Checkout(h.DB, buyer.ID)
+	orderID, err := h.Carts.Checkout(r.Context(), buyer.ID, models.CheckoutOptions{
+		DeliveryMethods: request.DeliveryMethods,
+		PaymentMethod:   request.PaymentMethod,
+		Payments:        h.Payments,
+		PaymentToken:    request.PaymentToken,
+		Currency:        h.Currency,
+	})
+	if errors.Is(err, models.ErrEmptyCart) {
+		writeJSONErrorCode(w, r, http.StatusBadRequest, api.CodeEmptyCart, "Your cart is empty")
+		return
+	}
+	if errors.Is(err, models.ErrInsufficientStock) {
+		writeJSONErrorCode(w, r, http.StatusConflict, api.CodeInsufficientStock, err.Error())
+		return
+	}
+	if errors.Is(err, models.ErrPaymentMethodMismatch) {
+		writeJSONErrorCode(w, r, http.StatusBadRequest, api.CodePaymentMethodMismatch, err.Error())
+		return
+	}
+	if errors.Is(err, payments.ErrDeclined) {
+		writeJSONErrorCode(w, r, http.StatusPaymentRequired, api.CodePaymentDeclined, err.Error())
+		return
+	}
+	if errors.Is(err, models.ErrCartChanged) {
+		writeJSONErrorCode(w, r, http.StatusConflict, api.CodeCartChanged, "Your cart changed during checkout, please review it and try again")
+		return
+	}
 	if err != nil {
-		// Log the error for backend debugging
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": err.Error(),
-		})
+		log.Printf("Error checking out cart of buyer %d: %v", buyer.ID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to place the order")
 		return
 	}
 
 	// Prepare the response
 	response := map[string]interface{}{
-		"success": true,
-		"message": "Checkout completed successfully",
+		"success":  true,
+		"message":  "Checkout completed successfully",
+		"order_id": orderID,
 	}
 
 	// Send the response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	api.WriteJSON(w, r, http.StatusOK, response)
 }
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/api"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+)
+
+func TestCheckoutErrors(t *testing.T) {
+	card := map[string]interface{}{"payment_method": "card", "payment_token": "tok_visa"}
+
+	tests := []struct {
+		name     string
+		body     map[string]interface{}
+		err      error
+		want     int
+		wantCode string
+	}{
+		{"empty cart", card, models.ErrEmptyCart, http.StatusBadRequest, "empty_cart"},
+		{"short stock", card, models.ErrInsufficientStock, http.StatusConflict, "insufficient_stock"},
+		{"cash for a pickup", map[string]interface{}{"payment_method": "cash_on_delivery"}, models.ErrPaymentMethodMismatch, http.StatusBadRequest, "payment_method_mismatch"},
+		{"declined card", card, payments.ErrDeclined, http.StatusPaymentRequired, "payment_declined"},
+		{"cart changed", card, models.ErrCartChanged, http.StatusConflict, "cart_changed"},
+		{"card without a token", map[string]interface{}{"payment_method": "card"}, nil, http.StatusUnprocessableEntity, "validation_failed"},
+		{"unknown payment method", map[string]interface{}{"payment_method": "barter"}, nil, http.StatusUnprocessableEntity, "validation_failed"},
+		{"store failure", card, errors.New("connection reset"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			carts := &fakeCarts{checkoutErr: tt.err}
+			h := &CartHandler{Carts: carts, Currency: "usd"}
+
+			rec := httptest.NewRecorder()
+			h.Checkout(rec, jsonRequest(t, http.MethodPost, "/checkout", tt.body, &models.Buyer{ID: 1}))
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if code, _ := decodeBody(t, rec)["error"].(string); code != tt.wantCode {
+				t.Errorf("error code %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCheckoutDefaultsToCard(t *testing.T) {
+	carts := &fakeCarts{}
+	h := &CartHandler{Carts: carts, Currency: "usd"}
+
+	rec := httptest.NewRecorder()
+	h.Checkout(rec, jsonRequest(t, http.MethodPost, "/checkout", map[string]interface{}{"payment_token": "tok_visa"}, &models.Buyer{ID: 1}))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(carts.checkouts) != 1 {
+		t.Fatalf("got %d checkouts, want 1", len(carts.checkouts))
+	}
+	opts := carts.checkouts[0]
+	if opts.PaymentMethod != models.PaymentMethodCard || opts.PaymentToken != "tok_visa" || opts.Currency != "usd" {
+		t.Errorf("checkout options %+v", opts)
+	}
+}
+
+func TestCartErrorsAreJSON(t *testing.T) {
+	h := &CartHandler{Carts: &fakeCarts{}}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		path    string
+		body    string
+		message string
+	}{
+		{"remove with a bad ID", h.RemoveFromCart, http.MethodDelete, "/cart/remove/abc", "", "Invalid Product ID"},
+		{"update with a bad body", h.UpdateCart, http.MethodPost, "/cart/update", "{", "Invalid request payload"},
+	}
+	for _, tt := range tests {
+		for _, prefix := range []string{"", api.Prefix} {
+			t.Run(tt.name+" "+prefix, func(t *testing.T) {
+				req := signedInAs(httptest.NewRequest(tt.method, prefix+tt.path, strings.NewReader(tt.body)), &models.Buyer{ID: 1})
+				req.SetPathValue("productId", "abc")
+				rec := httptest.NewRecorder()
+				api.Envelope(api.Prefix)(tt.handler).ServeHTTP(rec, req)
+
+				if rec.Code != http.StatusBadRequest {
+					t.Fatalf("status %d, want 400", rec.Code)
+				}
+				if got := rec.Header().Get("Content-Type"); got != "application/json" {
+					t.Errorf("Content-Type %q", got)
+				}
+				body := decodeBody(t, rec)
+				if prefix != "" {
+					body, _ = body["error"].(map[string]interface{})
+				}
+				if body["message"] != tt.message {
+					t.Errorf("body %v, want the message %q", body, tt.message)
+				}
+			})
+		}
+	}
+}
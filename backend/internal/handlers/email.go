@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/email"
+)
+
+// emailSamples is the data each email template is previewed with. A query
+// parameter with the same name replaces the sample value.
+var emailSamples = map[string]map[string]interface{}{
+	"admin_invitation": {
+		"InvitedBy": "admin@example.com",
+		"Role":      "Moderator",
+		"Link":      "https://example.com/admin/invitations/accept?token=sample",
+		"ExpiresAt": "2024-06-01 12:00 UTC",
+	},
+	"farmer_approved": {
+		"FirstName": "Alex",
+	},
+	"farmer_rejected": {
+		"FirstName": "Alex",
+		"Reason":    "The farm location could not be verified.",
+	},
+}
+
+type EmailHandler struct {
+	Emails *email.Templates
+}
+
+func NewEmailHandler(emails *email.Templates) *EmailHandler {
+	return &EmailHandler{Emails: emails}
+}
+
+// Preview handles GET /admin/email/preview?template=..&locale=..&format=html|text.
+// Without a template it lists the templates and their locales. The locale
+// that was actually rendered is returned in the X-Email-Locale header.
+func (h *EmailHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := query.Get("template")
+	if name == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"templates": h.Emails.Names(),
+		})
+		return
+	}
+
+	data := make(map[string]interface{})
+	for key, value := range emailSamples[name] {
+		data[key] = value
+		if override := query.Get(key); override != "" {
+			data[key] = override
+		}
+	}
+
+	rendered, err := h.Emails.Render(name, query.Get("locale"), data)
+	if err != nil {
+		if _, known := h.Emails.Names()[name]; !known {
+			http.Error(w, "Unknown email template", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error rendering email preview %s: %v", name, err)
+		http.Error(w, "Error rendering email", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Email-Locale", rendered.Locale)
+
+	switch query.Get("format") {
+	case "", "html":
+		if rendered.HTML == "" {
+			http.Error(w, "This email has no HTML variant", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, rendered.HTML)
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Subject: %s\n\n%s", rendered.Subject, rendered.Text)
+	default:
+		http.Error(w, "Bad Request: format must be html or text", http.StatusBadRequest)
+	}
+}
+
+// preferredLocale is the email language for a new account: the locale given
+// at registration, else the browser's Accept-Language. It is empty when
+// neither names a language, which means the default locale.
+func preferredLocale(r *http.Request, requested string) string {
+	if locale := email.NormalizeLocale(requested); locale != "" {
+		return locale
+	}
+	return email.NormalizeLocale(r.Header.Get("Accept-Language"))
+}
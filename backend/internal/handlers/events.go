@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/events"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
+)
+
+const (
+	// heartbeatInterval keeps proxies from closing a quiet stream
+	heartbeatInterval = 25 * time.Second
+	// replayBatch is how many missed notifications are read at a time on reconnect
+	replayBatch = 100
+)
+
+// EventsHandler streams the signed-in farmer's or buyer's events as
+// Server-Sent Events
+type EventsHandler struct {
+	Notifications store.NotificationStore
+	Hub           *events.Hub
+	Config        *config.Config
+}
+
+func NewEventsHandler(stores *store.Store, hub *events.Hub, cfg *config.Config) *EventsHandler {
+	return &EventsHandler{
+		Notifications: stores.Notifications,
+		Hub:           hub,
+		Config:        cfg,
+	}
+}
+
+// Stream handles GET /events. Notification events carry the notification ID
+// as the event ID; a client that reconnects with Last-Event-ID (or the
+// last_event_id query parameter, for the first connection of a page) first
+// receives the notifications it missed. Order and stock events are only sent
+// live.
+func (h *EventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	recipientType, recipientID, ok := notificationRecipient(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusForbidden, "Unauthorized: Farmer or buyer not found in context")
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	lastID := 0
+	if lastEventID != "" {
+		parsed, err := strconv.Atoi(lastEventID)
+		if err != nil || parsed < 0 {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		lastID = parsed
+	}
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Events: could not clear the write deadline: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	// Subscribe before replaying, so nothing published in between is missed
+	sub := h.Hub.Subscribe(recipientType, recipientID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+
+	if lastEventID != "" {
+		for {
+			missed, err := h.Notifications.Since(r.Context(), recipientType, recipientID, lastID, replayBatch)
+			if err != nil {
+				log.Printf("Events: error replaying notifications for %s %d: %v", recipientType, recipientID, err)
+				return
+			}
+			for _, notification := range missed {
+				data, _ := json.Marshal(notification)
+				writeEvent(w, notification.ID, events.TypeNotification, data)
+				lastID = notification.ID
+			}
+			if len(missed) < replayBatch {
+				break
+			}
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind, or the server is shutting down;
+				// the client reconnects and catches up
+				return
+			}
+			if event.Type == events.TypeNotification {
+				if event.ID <= lastID {
+					continue // already replayed
+				}
+				lastID = event.ID
+			}
+			writeEvent(w, event.ID, event.Type, h.eventData(event))
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// eventData is the data line of an event. Stock events say whether the
+// product is now at or below the low-stock threshold.
+func (h *EventsHandler) eventData(event events.Event) []byte {
+	if event.Type != events.TypeStock {
+		return event.Data
+	}
+	var stock map[string]interface{}
+	if err := json.Unmarshal(event.Data, &stock); err != nil {
+		return event.Data
+	}
+	if quantity, ok := stock["quantity"].(float64); ok {
+		stock["low_stock"] = int(quantity) <= h.Config.Inventory.LowStockThreshold
+	}
+	data, err := json.Marshal(stock)
+	if err != nil {
+		return event.Data
+	}
+	return data
+}
+
+// writeEvent writes one Server-Sent Event; id 0 leaves the client's last event ID unchanged
+func writeEvent(w http.ResponseWriter, id int, eventType string, data []byte) {
+	if id > 0 {
+		fmt.Fprintf(w, "id: %d\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data)
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/middleware"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
+)
+
+// The fakes below hold just the records and canned errors a test sets up.
+// Each embeds its store interface, so a handler that calls a method the test
+// did not plan for panics instead of quietly passing.
+
+type fakeAdmins struct {
+	store.AdminStore
+	byEmail map[string]*models.Admin
+	roleErr error
+	roles   map[int]models.Role
+	invited []*models.AdminInvitation
+	outbox  []models.OutboxEntry
+}
+
+func (f *fakeAdmins) Exists(ctx context.Context, email string) (bool, error) {
+	_, ok := f.byEmail[email]
+	return ok, nil
+}
+
+func (f *fakeAdmins) SetRole(ctx context.Context, id int, role models.Role) error {
+	if f.roleErr != nil {
+		return f.roleErr
+	}
+	if f.roles == nil {
+		f.roles = make(map[int]models.Role)
+	}
+	f.roles[id] = role
+	return nil
+}
+
+func (f *fakeAdmins) Invite(ctx context.Context, invitation *models.AdminInvitation, outbox ...models.OutboxEntry) error {
+	f.invited = append(f.invited, invitation)
+	f.outbox = append(f.outbox, outbox...)
+	return nil
+}
+
+type fakeFarmers struct {
+	store.FarmerStore
+	byEmail map[string]*models.Farmer
+}
+
+func (f *fakeFarmers) GetByEmail(ctx context.Context, email string) (*models.Farmer, error) {
+	farmer, ok := f.byEmail[email]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return farmer, nil
+}
+
+type fakeBuyers struct {
+	store.BuyerStore
+	byEmail map[string]*models.Buyer
+	created []*models.Buyer
+}
+
+func (f *fakeBuyers) GetByEmail(ctx context.Context, email string) (*models.Buyer, error) {
+	buyer, ok := f.byEmail[email]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return buyer, nil
+}
+
+func (f *fakeBuyers) Create(ctx context.Context, buyer *models.Buyer) error {
+	buyer.ID = len(f.created) + 1
+	f.created = append(f.created, buyer)
+	return nil
+}
+
+type fakeProducts struct {
+	store.ProductStore
+	owners    map[int]int // product ID to farmer ID
+	movements map[int][]models.InventoryMovement
+}
+
+func (f *fakeProducts) GetFarmerID(ctx context.Context, productID int) (int, error) {
+	farmerID, ok := f.owners[productID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return farmerID, nil
+}
+
+func (f *fakeProducts) GetStockHistory(ctx context.Context, productID, limit, offset int) ([]models.InventoryMovement, int, error) {
+	movements := f.movements[productID]
+	total := len(movements)
+	if offset > total {
+		offset = total
+	}
+	movements = movements[offset:]
+	if len(movements) > limit {
+		movements = movements[:limit]
+	}
+	return movements, total, nil
+}
+
+type fakeCarts struct {
+	store.CartStore
+	checkoutErr error
+	checkouts   []models.CheckoutOptions
+}
+
+func (f *fakeCarts) Checkout(ctx context.Context, buyerID int, opts models.CheckoutOptions) (int, error) {
+	if f.checkoutErr != nil {
+		return 0, f.checkoutErr
+	}
+	f.checkouts = append(f.checkouts, opts)
+	return len(f.checkouts), nil
+}
+
+type fakeOrders struct {
+	store.OrderStore
+	orders    map[int]*models.Order
+	statusErr error
+	updates   []string
+}
+
+func (f *fakeOrders) GetByID(ctx context.Context, id int) (*models.Order, error) {
+	order, ok := f.orders[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return order, nil
+}
+
+func (f *fakeOrders) FarmerSubtotals(ctx context.Context, orderID int) ([]models.FarmerSubtotal, error) {
+	return nil, nil
+}
+
+func (f *fakeOrders) UpdateStatus(ctx context.Context, orderID, farmerID int, status, note string) (*models.SubOrder, error) {
+	if f.statusErr != nil {
+		return nil, f.statusErr
+	}
+	f.updates = append(f.updates, status)
+	return &models.SubOrder{OrderID: orderID, FarmerID: farmerID, Status: status}, nil
+}
+
+type fakeRefunds struct {
+	store.RefundStore
+	requests []models.RefundRequest
+}
+
+func (f *fakeRefunds) Request(ctx context.Context, req models.RefundRequest) (*models.Refund, error) {
+	f.requests = append(f.requests, req)
+	return &models.Refund{ID: len(f.requests), OrderID: req.OrderID, Reason: req.Reason}, nil
+}
+
+func (f *fakeRefunds) GetByOrder(ctx context.Context, orderID int) ([]models.Refund, error) {
+	return nil, nil
+}
+
+type fakePayments struct {
+	store.PaymentStore
+	events []*payments.WebhookEvent
+}
+
+func (f *fakePayments) ApplyWebhook(ctx context.Context, event *payments.WebhookEvent) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+type fakeSessions struct {
+	store.SessionStore
+	sessions map[string]*models.Session
+}
+
+func (f *fakeSessions) Create(ctx context.Context, session *models.Session) error {
+	if f.sessions == nil {
+		f.sessions = make(map[string]*models.Session)
+	}
+	f.sessions[session.ID] = session
+	return nil
+}
+
+type fakeNotifications struct {
+	store.NotificationStore
+	notifications map[int]*models.Notification
+}
+
+func (f *fakeNotifications) MarkRead(ctx context.Context, recipientType string, recipientID, notificationID int) error {
+	notification, ok := f.notifications[notificationID]
+	if !ok || notification.RecipientType != recipientType || notification.RecipientID != recipientID {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	notification.IsRead = true
+	notification.ReadAt = &now
+	return nil
+}
+
+type fakeOutbox struct {
+	store.OutboxStore
+	dead    map[int]bool
+	retried []int
+}
+
+func (f *fakeOutbox) Retry(ctx context.Context, id int) error {
+	if !f.dead[id] {
+		return sql.ErrNoRows
+	}
+	delete(f.dead, id)
+	f.retried = append(f.retried, id)
+	return nil
+}
+
+// jsonRequest builds a request with body encoded as JSON, signed in as user:
+// a *models.Farmer, *models.Buyer or *models.Admin, or nil for nobody
+func jsonRequest(t *testing.T, method, path string, body interface{}, user interface{}) *http.Request {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	return signedInAs(req, user)
+}
+
+func signedInAs(req *http.Request, user interface{}) *http.Request {
+	var key middleware.ContextKey
+	switch user.(type) {
+	case *models.Farmer:
+		key = middleware.FarmerContextKey
+	case *models.Buyer:
+		key = middleware.BuyerContextKey
+	case *models.Admin:
+		key = middleware.AdminContextKey
+	default:
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), key, user))
+}
+
+// decodeBody decodes a JSON response body into a map
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return body
+}
@@ -11,26 +11,42 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/api"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/email"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/middleware"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/router"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/utils"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/validation"
 )
 
 type FarmerHandler struct {
-	DB        *sql.DB
-	Templates map[string]*template.Template
+	Farmers       store.FarmerStore
+	Products      store.ProductStore
+	Sessions      store.SessionStore
+	Notifications store.NotificationStore
+	Templates     map[string]*template.Template
+	Emails        *email.Templates
+	Config        *config.Config
 }
 
-func NewFarmerHandler(db *sql.DB, templates map[string]*template.Template) *FarmerHandler {
+func NewFarmerHandler(stores *store.Store, templates map[string]*template.Template, emails *email.Templates, cfg *config.Config) *FarmerHandler {
 	return &FarmerHandler{
-		DB:        db,
-		Templates: templates,
+		Farmers:       stores.Farmers,
+		Products:      stores.Products,
+		Sessions:      stores.Sessions,
+		Notifications: stores.Notifications,
+		Templates:     templates,
+		Emails:        emails,
+		Config:        cfg,
 	}
 }
 
 // admin-only funcs
 func (h *FarmerHandler) ListPendingFarmers(w http.ResponseWriter, r *http.Request) {
-	farmers, err := models.GetPendingFarmers(h.DB)
+	farmers, err := h.Farmers.GetPending(r.Context())
 	if err != nil {
 		http.Error(w, "Failed to retrieve pending farmers", http.StatusInternalServerError)
 		log.Printf("Error retrieving pending farmers: %v", err)
@@ -63,7 +79,7 @@ func (h *FarmerHandler) ViewFarmerProfile(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	farmer, err := models.GetFarmerByID(h.DB, farmerID)
+	farmer, err := h.Farmers.GetByID(r.Context(), farmerID)
 	if err != nil {
 		http.Error(w, "Farmer not found", http.StatusNotFound)
 		log.Printf("Farmer with ID %d not found: %v", farmerID, err)
@@ -84,11 +100,6 @@ func (h *FarmerHandler) ViewFarmerProfile(w http.ResponseWriter, r *http.Request
 }
 
 func (h *FarmerHandler) ApproveFarmer(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	// Get farmer ID from form data.
 	farmerIDStr := r.FormValue("id")
 	if farmerIDStr == "" {
@@ -102,64 +113,49 @@ func (h *FarmerHandler) ApproveFarmer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.DB.Exec("UPDATE farmers SET status = $1, approved_at = $2, updated_at = $3 WHERE id = $4", "approved", time.Now(), time.Now(), farmerID)
-	if err != nil {
+	farmer, err := h.Farmers.GetByID(r.Context(), farmerID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Farmer not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		log.Printf("Error updating farmer status: %v", err)
+		log.Printf("Error retrieving farmer details: %v", err)
 		return
 	}
 
-	var email, firstName string
-	selectQuery := `
-			SELECT email, first_name 
-			FROM farmers 
-			WHERE id = $1
-		`
-	err = h.DB.QueryRow(selectQuery, farmerID).Scan(&email, &firstName)
+	message, err := h.Emails.Render("farmer_approved", farmer.Locale, map[string]interface{}{
+		"FirstName": farmer.FirstName,
+	})
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		log.Printf("Error retrieving farmer details: %v", err)
+		log.Printf("Error rendering approval email: %v", err)
 		return
 	}
 
-	log.Printf("email %s; name %s", email, firstName)
-
-	// Compose the approval email
-	subject := "Your Farmer Account Has Been Approved"
-	body := fmt.Sprintf(
-		"Dear %s,\n\nCongratulations! Your farmer account has been approved. You can now access your dashboard and start managing your farm.\n\nBest regards,\nFarmers Market System Team",
-		firstName,
+	// The email and notification are queued with the approval and sent by the outbox worker
+	approvalEmail := models.EmailEntry(farmer.Email, message.Subject, message.Text, message.HTML)
+	notification := models.NotificationEntry(
+		models.RecipientFarmer,
+		farmerID,
+		"account_approved",
+		"Your farmer account has been approved. You can now access your dashboard.",
 	)
 
-	log.Printf("Preparing to send email to: %s with subject: %s", email, subject)
-	err = utils.SendEmail(email, subject, body)
-	if err != nil {
-		log.Printf("Error sending email: %v", err)
-		http.Error(w, "Internal Server Error: Failed to send email", http.StatusInternalServerError)
+	err = h.Farmers.Approve(r.Context(), farmerID, approvalEmail, notification)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Farmer not found", http.StatusNotFound)
 		return
-	}
-	log.Println("Email sent successfully")
-
-	// Create a notification for the farmer
-	notificationType := "account_approved"
-	notificationMessage := "Your farmer account has been approved. You can now access your dashboard."
-
-	err = models.CreateNotification(h.DB, farmerID, notificationType, notificationMessage) // Pass the database connection instead of the transaction
-	if err != nil {
-		log.Printf("Error creating notification for farmer ID %d: %v", farmerID, err)
-		http.Error(w, "Internal Server Error: Failed to create notification", http.StatusInternalServerError)
+	} else if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		log.Printf("Error updating farmer status: %v", err)
 		return
 	}
+	log.Printf("Farmer ID %d approved", farmerID)
 
 	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 }
 
 func (h *FarmerHandler) RejectFarmer(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	farmerIDStr := r.FormValue("id")
 	reason := r.FormValue("reason")
 	if farmerIDStr == "" || reason == "" {
@@ -173,63 +169,50 @@ func (h *FarmerHandler) RejectFarmer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.DB.Exec("UPDATE farmers SET status = $1, rejection_reason = $2, updated_at = $3 WHERE id = $4", "rejected", reason, time.Now(), farmerID)
-	if err != nil {
+	farmer, err := h.Farmers.GetByID(r.Context(), farmerID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Farmer not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		log.Printf("Error updating farmer rejection status: %v", err)
+		log.Printf("Error retrieving farmer details: %v", err)
 		return
 	}
 
-	// Retrieve farmer's email and first name for the email
-	var email, firstName string
-	selectQuery := `
-			SELECT email, first_name 
-			FROM farmers 
-			WHERE id = $1
-		`
-	err = h.DB.QueryRow(selectQuery, farmerID).Scan(&email, &firstName)
+	message, err := h.Emails.Render("farmer_rejected", farmer.Locale, map[string]interface{}{
+		"FirstName": farmer.FirstName,
+		"Reason":    reason,
+	})
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		log.Printf("Error retrieving farmer details: %v", err)
+		log.Printf("Error rendering rejection email: %v", err)
 		return
 	}
 
-	// Compose the rejection email
-	subject := "Your Farmer Account Has Been Rejected"
-	body := fmt.Sprintf(
-		"Dear %s,\n\nWe regret to inform you that your farmer account has been rejected for the following reason:\n\n%s\n\nIf you have any questions or need further assistance, please contact support.\n\nBest regards,\nFarmers Market System Team",
-		firstName, reason,
+	// The email and notification are queued with the rejection and sent by the outbox worker
+	rejectionEmail := models.EmailEntry(farmer.Email, message.Subject, message.Text, message.HTML)
+	notification := models.NotificationEntry(
+		models.RecipientFarmer,
+		farmerID,
+		"account_rejected",
+		fmt.Sprintf("Your farmer account has been rejected. Reason: %s", reason),
 	)
 
-	// Send the rejection email
-	err = utils.SendEmail(email, subject, body)
-	if err != nil {
-		http.Error(w, "Internal Server Error: Failed to send email", http.StatusInternalServerError)
-		log.Printf("Error sending rejection email to farmer ID %d (%s): %v", farmerID, email, err)
+	err = h.Farmers.Reject(r.Context(), farmerID, reason, rejectionEmail, notification)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Farmer not found", http.StatusNotFound)
 		return
-	}
-	log.Printf("Farmer ID %d rejected for reason: %s", farmerID, reason)
-
-	// Create a notification for the farmer
-	notificationType := "account_rejected"
-	notificationMessage := fmt.Sprintf("Your farmer account has been rejected. Reason: %s", reason)
-
-	err = models.CreateNotification(h.DB, farmerID, notificationType, notificationMessage) // Pass the database connection instead of the transaction
-	if err != nil {
-		log.Printf("Error creating notification for farmer ID %d: %v", farmerID, err)
-		http.Error(w, "Internal Server Error: Failed to create notification", http.StatusInternalServerError)
+	} else if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		log.Printf("Error updating farmer rejection status: %v", err)
 		return
 	}
+	log.Printf("Farmer ID %d rejected for reason: %s", farmerID, reason)
 
 	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 }
 
 func (h *FarmerHandler) ToggleFarmerStatus(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	farmerIDStr := r.FormValue("id")
 	farmerID, err := strconv.Atoi(farmerIDStr)
 	if err != nil {
@@ -237,7 +220,7 @@ func (h *FarmerHandler) ToggleFarmerStatus(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	farmer, err := models.GetFarmerByID(h.DB, farmerID)
+	farmer, err := h.Farmers.GetByID(r.Context(), farmerID)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Farmer not found", http.StatusNotFound)
 		return
@@ -247,7 +230,7 @@ func (h *FarmerHandler) ToggleFarmerStatus(w http.ResponseWriter, r *http.Reques
 	}
 
 	newIsActive := !farmer.IsActive
-	_, err = h.DB.Exec("UPDATE farmers SET is_active = $1, updated_at = $2 WHERE id = $3", newIsActive, time.Now(), farmer.ID)
+	err = h.Farmers.SetActive(r.Context(), farmer.ID, newIsActive)
 	if err != nil {
 		http.Error(w, "Failed to update farmer active status", http.StatusInternalServerError)
 		return
@@ -256,68 +239,62 @@ func (h *FarmerHandler) ToggleFarmerStatus(w http.ResponseWriter, r *http.Reques
 	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 }
 
-func (h *FarmerHandler) EditFarmer(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		// Retrieve farmer ID from query parameters
-		farmerID, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil {
-			http.Error(w, "Invalid farmer ID", http.StatusBadRequest)
-			return
-		}
-
-		farmer, err := models.GetFarmerByID(h.DB, farmerID)
-		if err != nil {
-			http.Error(w, "Farmer not found", http.StatusNotFound)
-			return
-		}
-
-		data := map[string]interface{}{"Farmer": farmer}
+// EditFarmerForm handles GET /admin/users/edit-farmer
+func (h *FarmerHandler) EditFarmerForm(w http.ResponseWriter, r *http.Request) {
+	// Retrieve farmer ID from query parameters
+	farmerID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid farmer ID", http.StatusBadRequest)
+		return
+	}
 
-		err = h.Templates["edit_farmer"].Execute(w, data)
-		if err != nil {
-			log.Printf("Template rendering error: %v", err)
-			http.Error(w, "Error rendering edit page", http.StatusInternalServerError)
-		}
+	farmer, err := h.Farmers.GetByID(r.Context(), farmerID)
+	if err != nil {
+		http.Error(w, "Farmer not found", http.StatusNotFound)
 		return
 	}
 
-	if r.Method == http.MethodPost {
-		// Retrieve and parse farmer ID from form
-		farmerID, err := strconv.Atoi(r.FormValue("id"))
-		if err != nil {
-			http.Error(w, "Invalid farmer ID", http.StatusBadRequest)
-			return
-		}
+	data := map[string]interface{}{"Farmer": farmer}
 
-		updatedFarmer := models.Farmer{
-			ID:        farmerID,
-			Email:     r.FormValue("email"),
-			FirstName: r.FormValue("first_name"),
-			LastName:  r.FormValue("last_name"),
-			FarmName:  r.FormValue("farm_name"),
-			FarmSize:  r.FormValue("farm_size"),
-			Location:  r.FormValue("location"),
-			Status:    r.FormValue("status"),
-			IsActive:  r.FormValue("is_active") == "on",
-		}
+	err = h.Templates["edit_farmer"].Execute(w, data)
+	if err != nil {
+		log.Printf("Template rendering error: %v", err)
+		http.Error(w, "Error rendering edit page", http.StatusInternalServerError)
+	}
+}
 
-		err = models.UpdateFarmer(h.DB, updatedFarmer)
-		if err != nil {
-			log.Printf("Error updating farmer: %v", err)
-			http.Error(w, "Error updating farmer", http.StatusInternalServerError)
-			return
-		}
+// EditFarmer handles POST /admin/users/edit-farmer
+func (h *FarmerHandler) EditFarmer(w http.ResponseWriter, r *http.Request) {
+	// Retrieve and parse farmer ID from form
+	farmerID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid farmer ID", http.StatusBadRequest)
+		return
+	}
 
-		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+	updatedFarmer := models.Farmer{
+		ID:        farmerID,
+		Email:     r.FormValue("email"),
+		FirstName: r.FormValue("first_name"),
+		LastName:  r.FormValue("last_name"),
+		FarmName:  r.FormValue("farm_name"),
+		FarmSize:  r.FormValue("farm_size"),
+		Location:  r.FormValue("location"),
+		Status:    r.FormValue("status"),
+		IsActive:  r.FormValue("is_active") == "on",
 	}
-}
 
-func (h *FarmerHandler) DeleteFarmer(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	err = h.Farmers.Update(r.Context(), updatedFarmer)
+	if err != nil {
+		log.Printf("Error updating farmer: %v", err)
+		http.Error(w, "Error updating farmer", http.StatusInternalServerError)
 		return
 	}
 
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (h *FarmerHandler) DeleteFarmer(w http.ResponseWriter, r *http.Request) {
 	farmerIDStr := r.FormValue("id")
 	farmerID, err := strconv.Atoi(farmerIDStr)
 	if err != nil {
@@ -325,8 +302,11 @@ func (h *FarmerHandler) DeleteFarmer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.DB.Exec("DELETE FROM farmers WHERE id = $1", farmerID)
-	if err != nil {
+	err = h.Farmers.Delete(r.Context(), farmerID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Farmer not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, "Failed to delete farmer", http.StatusInternalServerError)
 		return
 	}
@@ -335,46 +315,41 @@ func (h *FarmerHandler) DeleteFarmer(w http.ResponseWriter, r *http.Request) {
 }
 
 // farmer-specific funcs
-func (h *FarmerHandler) Register(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
 
-	var req struct {
-		FirstName string `json:"first_name"`
-		LastName  string `json:"last_name"`
-		Email     string `json:"email"`
-		Password  string `json:"password"`
-		FarmName  string `json:"farm_name"`
-		FarmSize  string `json:"farm_size"`
-		Location  string `json:"location"`
-	}
+// FarmerRegisterRequest is the body of POST /farmer/register
+type FarmerRegisterRequest struct {
+	FirstName string `json:"first_name" validate:"required,max=100"`
+	LastName  string `json:"last_name" validate:"required,max=100"`
+	Email     string `json:"email" validate:"required,email,max=255"`
+	Password  string `json:"password" validate:"required,password"`
+	FarmName  string `json:"farm_name" validate:"required,max=255"`
+	FarmSize  string `json:"farm_size" validate:"required,max=100"`
+	Location  string `json:"location" validate:"required,max=255"`
+	Locale    string `json:"locale" validate:"max=16"`
+}
+
+func (h *FarmerHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req FarmerRegisterRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
-	if req.FirstName == "" || req.LastName == "" || req.Email == "" || req.Password == "" || req.FarmName == "" || req.FarmSize == "" || req.Location == "" {
-		http.Error(w, "All fields are required", http.StatusBadRequest)
+	if errs := validation.Struct(req); errs != nil {
+		writeValidationError(w, r, errs)
 		return
 	}
 
-	existingFarmer, err := models.GetFarmerByEmail(h.DB, req.Email)
+	existingFarmer, err := h.Farmers.GetByEmail(r.Context(), req.Email)
 	if err == nil && existingFarmer != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Farmer with this email already exists",
-		})
+		writeJSONError(w, r, http.StatusConflict, "Farmer with this email already exists")
 		return
 	}
 
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to hash password")
 		return
 	}
 
@@ -388,99 +363,73 @@ func (h *FarmerHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Location:     req.Location,
 		Status:       "pending",
 		IsActive:     false,
+		Locale:       preferredLocale(r, req.Locale),
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 
-	if err := models.CreateFarmer(h.DB, newFarmer); err != nil {
-		http.Error(w, "Failed to create farmer", http.StatusInternalServerError)
+	if err := h.Farmers.Create(r.Context(), newFarmer); err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to create farmer")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	api.WriteJSON(w, r, http.StatusCreated, map[string]interface{}{
 		"success": true,
 		"message": "Farmer registered successfully. Awaiting approval.",
 	})
 }
 
 func (h *FarmerHandler) Login(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var req LoginRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid JSON payload")
 		return
 	}
 
 	if req.Email == "" || req.Password == "" {
-		http.Error(w, "Email and Password are required", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Email and Password are required")
 		return
 	}
 
-	farmer, err := models.GetFarmerByEmail(h.DB, req.Email)
+	farmer, err := h.Farmers.GetByEmail(r.Context(), req.Email)
 	if err != nil || farmer == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Incorrect email or password",
-		})
+		writeJSONError(w, r, http.StatusForbidden, "Incorrect email or password")
 		return
 	}
 
 	if farmer.Status != "approved" || !farmer.IsActive {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Account not active or pending approval",
-		})
+		writeJSONError(w, r, http.StatusForbidden, "Account not active or pending approval")
 		return
 	}
 
 	if !utils.CheckPasswordHash(req.Password, farmer.PasswordHash) {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		writeJSONError(w, r, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
 
-	_, err = utils.CreateSession(w, h.DB, farmer.ID, "farmer")
+	err = startSession(r.Context(), w, h.Sessions, h.Config.Session, farmer.ID, "farmer")
 	if err != nil {
 		log.Printf("Error creating session: %v", err)
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to create session")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"message": "Login successful",
 	})
 }
 
 func (h *FarmerHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	sessionID, err := utils.GetSessionID(r)
 	if err != nil {
-		http.Error(w, "Session not found", http.StatusUnauthorized)
+		writeJSONError(w, r, http.StatusUnauthorized, "Session not found")
 		return
 	}
 
-	if err := utils.DestroySession(h.DB, sessionID); err != nil {
-		http.Error(w, "Failed to destroy session", http.StatusInternalServerError)
+	if err := h.Sessions.Delete(r.Context(), sessionID); err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to destroy session")
 		return
 	}
 
@@ -492,50 +441,47 @@ func (h *FarmerHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 	})
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"message": "Logged out successfully",
 	})
 }
 
+// FarmerDashboardResponse is the body of GET /farmer/dashboard
+type FarmerDashboardResponse struct {
+	ID               int              `json:"id"`
+	Email            string           `json:"email"`
+	FirstName        string           `json:"first_name"`
+	LastName         string           `json:"last_name"`
+	FarmName         string           `json:"farm_name"`
+	FarmSize         string           `json:"farm_size"`
+	Location         string           `json:"location"`
+	Status           string           `json:"status"`
+	IsActive         bool             `json:"is_active"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	LowStockProducts []models.Product `json:"low_stock_products"`
+	UnreadCount      int              `json:"unread_notifications"`
+}
+
 func (h *FarmerHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
-	farmer, ok := r.Context().Value(middleware.FarmerContextKey).(*models.Farmer)
-	if !ok || farmer == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "Unauthorized: Farmer not found in context",
-		})
-		return
-	}
+	farmer := middleware.CurrentFarmer(r)
 
-	lowStockThreshold := 5
-	lowStockProducts, err := models.GetFarmerLowStockProducts(h.DB, farmer.ID, lowStockThreshold)
+	lowStockProducts, err := h.Products.GetLowStock(r.Context(), farmer.ID, h.Config.Inventory.LowStockThreshold)
 	if err != nil {
 		log.Printf("Error retrieving low-stock products: %v", err)
-		http.Error(w, "Failed to retrieve low-stock products", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve low-stock products")
 		return
 	}
 
-	type FarmerResponse struct {
-		ID               int              `json:"id"`
-		Email            string           `json:"email"`
-		FirstName        string           `json:"first_name"`
-		LastName         string           `json:"last_name"`
-		FarmName         string           `json:"farm_name"`
-		FarmSize         string           `json:"farm_size"`
-		Location         string           `json:"location"`
-		Status           string           `json:"status"`
-		IsActive         bool             `json:"is_active"`
-		CreatedAt        time.Time        `json:"created_at"`
-		UpdatedAt        time.Time        `json:"updated_at"`
-		LowStockProducts []models.Product `json:"low_stock_products"`
+	unreadNotifications, err := h.Notifications.CountUnread(r.Context(), models.RecipientFarmer, farmer.ID)
+	if err != nil {
+		log.Printf("Error counting unread notifications: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve notifications")
+		return
 	}
 
-	response := FarmerResponse{
+	response := FarmerDashboardResponse{
 		ID:               farmer.ID,
 		Email:            farmer.Email,
 		FirstName:        farmer.FirstName,
@@ -548,47 +494,37 @@ func (h *FarmerHandler) Dashboard(w http.ResponseWriter, r *http.Request) {
 		CreatedAt:        farmer.CreatedAt,
 		UpdatedAt:        farmer.UpdatedAt,
 		LowStockProducts: lowStockProducts,
+		UnreadCount:      unreadNotifications,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
-	}
+	api.WriteJSON(w, r, http.StatusOK, response)
 }
 
-func (h *FarmerHandler) AddProduct(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// AddProductRequest is the body of POST /farmer/product/add-product
+type AddProductRequest struct {
+	Name        string   `json:"name" validate:"required,max=255"`
+	CategoryID  int      `json:"category_id" validate:"required,min=1"`
+	Price       float64  `json:"price" validate:"required,min=0.01,max=99999999.99"`
+	Quantity    int      `json:"quantity" validate:"min=0,max=1000000"`
+	Description string   `json:"description" validate:"max=5000"`
+	Images      []string `json:"images" validate:"max=10,dive,url,max=1024"`
+}
 
-	farmer, ok := r.Context().Value(middleware.FarmerContextKey).(*models.Farmer)
-	if !ok || farmer == nil {
-		http.Error(w, "Unauthorized: Farmer not found in context", http.StatusUnauthorized)
-		return
-	}
+func (h *FarmerHandler) AddProduct(w http.ResponseWriter, r *http.Request) {
+	farmer := middleware.CurrentFarmer(r)
 
-	var req struct {
-		Name        string   `json:"name"`
-		CategoryID  int      `json:"category_id"`
-		Price       float64  `json:"price"`
-		Quantity    int      `json:"quantity"`
-		Description string   `json:"description"`
-		Images      []string `json:"images"`
-	}
+	var req AddProductRequest
 
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 	if err := decoder.Decode(&req); err != nil {
 		log.Printf("Error decoding AddProduct request: %v", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	if req.Name == "" || req.CategoryID == 0 || req.Price <= 0 || req.Quantity < 0 {
-		http.Error(w, "Missing or invalid required fields", http.StatusBadRequest)
+	if errs := validation.Struct(req); errs != nil {
+		writeValidationError(w, r, errs)
 		return
 	}
 
@@ -605,80 +541,63 @@ func (h *FarmerHandler) AddProduct(w http.ResponseWriter, r *http.Request) {
 		Images:      req.Images,
 	}
 
-	err := models.CreateProduct(h.DB, &newProduct)
+	err := h.Products.Create(r.Context(), &newProduct)
 	if err != nil {
 		log.Printf("Error creating product: %v", err)
-		http.Error(w, "Failed to add product", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to add product")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	api.WriteJSON(w, r, http.StatusCreated, map[string]interface{}{
 		"success": true,
 		"product": newProduct,
 	})
 }
 
 func (h *FarmerHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	farmer, ok := r.Context().Value(middleware.FarmerContextKey).(*models.Farmer)
-	if !ok || farmer == nil {
-		http.Error(w, "Unauthorized: Farmer not found in context", http.StatusUnauthorized)
-		return
-	}
+	farmer := middleware.CurrentFarmer(r)
 
-	products, err := models.GetActiveProducts(h.DB, farmer.ID)
+	products, err := h.Products.GetActiveByFarmer(r.Context(), farmer.ID)
 	if err != nil {
 		log.Printf("Error fetching products: %v", err)
-		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to fetch products")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
 		"success":  true,
 		"products": products,
 	})
 }
 
-func (h *FarmerHandler) EditProduct(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// EditProductRequest is the body of POST /farmer/product/edit-product
+type EditProductRequest struct {
+	ID          int      `json:"id" validate:"required,min=1"`
+	Name        string   `json:"name" validate:"required,max=255"`
+	CategoryID  int      `json:"category_id" validate:"required,min=1"`
+	Price       float64  `json:"price" validate:"required,min=0.01,max=99999999.99"`
+	Quantity    int      `json:"quantity" validate:"min=0,max=1000000"`
+	Description string   `json:"description" validate:"max=5000"`
+	IsActive    bool     `json:"is_active"`
+	Images      []string `json:"images" validate:"max=10,dive,url,max=1024"`
+	StockReason string   `json:"stock_reason" validate:"max=255"`
+}
 
-	farmer, ok := r.Context().Value(middleware.FarmerContextKey).(*models.Farmer)
-	if !ok || farmer == nil {
-		http.Error(w, "Unauthorized: Farmer not found in context", http.StatusUnauthorized)
-		return
-	}
+func (h *FarmerHandler) EditProduct(w http.ResponseWriter, r *http.Request) {
+	farmer := middleware.CurrentFarmer(r)
 
-	var req struct {
-		ID          int      `json:"id"`
-		Name        string   `json:"name"`
-		CategoryID  int      `json:"category_id"`
-		Price       float64  `json:"price"`
-		Quantity    int      `json:"quantity"`
-		Description string   `json:"description"`
-		IsActive    bool     `json:"is_active"`
-		Images      []string `json:"images"`
-	}
+	var req EditProductRequest
 
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 	if err := decoder.Decode(&req); err != nil {
 		log.Printf("Error decoding EditProduct request: %v", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	if req.ID == 0 || req.Name == "" || req.CategoryID == 0 || req.Price <= 0 || req.Quantity < 0 {
-		http.Error(w, "Missing or invalid required fields", http.StatusBadRequest)
+	if errs := validation.Struct(req); errs != nil {
+		writeValidationError(w, r, errs)
 		return
 	}
 
@@ -695,57 +614,101 @@ func (h *FarmerHandler) EditProduct(w http.ResponseWriter, r *http.Request) {
 		Images:      req.Images,
 	}
 
-	err := models.UpdateProduct(h.DB, &updatedProduct)
-	if err != nil {
+	err := h.Products.Update(r.Context(), &updatedProduct, req.StockReason)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, r, http.StatusNotFound, "Not Found: Product does not exist")
+		return
+	} else if err != nil {
 		log.Printf("Error updating product: %v", err)
-		http.Error(w, "Failed to update product", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to update product")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"product": updatedProduct,
 	})
 }
 
-func (h *FarmerHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// DeleteProductRequest is the body of DELETE /farmer/product/delete-product
+type DeleteProductRequest struct {
+	ID int `json:"id"`
+}
 
-	var req struct {
-		ID int `json:"id"`
-	}
+func (h *FarmerHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	var req DeleteProductRequest
 
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil || req.ID == 0 {
-		http.Error(w, "Bad Request: Invalid product ID", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Bad Request: Invalid product ID")
 		return
 	}
 
-	farmer, ok := r.Context().Value(middleware.FarmerContextKey).(*models.Farmer)
-	if !ok || farmer == nil {
-		http.Error(w, "Unauthorized: Farmer not authenticated", http.StatusUnauthorized)
-		return
-	}
+	farmer := middleware.CurrentFarmer(r)
 
-	err = models.DeleteProduct(h.DB, req.ID, farmer.ID)
+	err = h.Products.Delete(r.Context(), req.ID, farmer.ID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, "Not Found: Product does not exist", http.StatusNotFound)
+			writeJSONError(w, r, http.StatusNotFound, "Not Found: Product does not exist")
 			return
 		}
 		log.Printf("Error deleting product: %v", err)
-		http.Error(w, "Internal Server Error: Unable to delete product", http.StatusInternalServerError)
+		writeJSONError(w, r, http.StatusInternalServerError, "Internal Server Error: Unable to delete product")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"message": "Product deleted successfully",
 	})
 }
+
+// StockHistory handles GET /farmer/product/{id}/stock-history
+func (h *FarmerHandler) StockHistory(w http.ResponseWriter, r *http.Request) {
+	farmer := middleware.CurrentFarmer(r)
+
+	productID, err := router.PathInt(r, "id")
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid Product ID")
+		return
+	}
+
+	ownerID, err := h.Products.GetFarmerID(r.Context(), productID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && ownerID != farmer.ID) {
+		writeJSONError(w, r, http.StatusNotFound, "Not Found: Product does not exist")
+		return
+	} else if err != nil {
+		log.Printf("Error fetching product %d: %v", productID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve stock history")
+		return
+	}
+
+	// Pagination parameters
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= 200 {
+			limit = parsedLimit
+		}
+	}
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		if parsedPage, err := strconv.Atoi(p); err == nil && parsedPage > 0 {
+			page = parsedPage
+		}
+	}
+
+	movements, total, err := h.Products.GetStockHistory(r.Context(), productID, limit, (page-1)*limit)
+	if err != nil {
+		log.Printf("Error fetching stock history for product %d: %v", productID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve stock history")
+		return
+	}
+
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"movements": movements,
+		"page":      page,
+		"limit":     limit,
+		"total":     total,
+	})
+}
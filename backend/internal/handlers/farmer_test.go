@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/utils"
+)
+
+func TestFarmerLogin(t *testing.T) {
+	hash, err := utils.HashPassword("harvest-2024")
+	if err != nil {
+		t.Fatalf("hashing password: %v", err)
+	}
+	farmers := &fakeFarmers{byEmail: map[string]*models.Farmer{
+		"ada@example.com":  {ID: 1, Email: "ada@example.com", PasswordHash: hash, Status: "approved", IsActive: true},
+		"gus@example.com":  {ID: 2, Email: "gus@example.com", PasswordHash: hash, Status: "pending", IsActive: true},
+		"vera@example.com": {ID: 3, Email: "vera@example.com", PasswordHash: hash, Status: "approved", IsActive: false},
+	}}
+
+	tests := []struct {
+		name, email, password string
+		want                  int
+	}{
+		{"approved", "ada@example.com", "harvest-2024", http.StatusOK},
+		{"wrong password", "ada@example.com", "harvest-2025", http.StatusUnauthorized},
+		{"pending approval", "gus@example.com", "harvest-2024", http.StatusForbidden},
+		{"deactivated", "vera@example.com", "harvest-2024", http.StatusForbidden},
+		{"unknown email", "eve@example.com", "harvest-2024", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := &fakeSessions{}
+			h := &FarmerHandler{Farmers: farmers, Sessions: sessions, Config: config.Defaults(config.Test)}
+
+			rec := httptest.NewRecorder()
+			h.Login(rec, jsonRequest(t, http.MethodPost, "/farmer/login", LoginRequest{Email: tt.email, Password: tt.password}, nil))
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if signedIn := len(sessions.sessions) == 1; signedIn != (tt.want == http.StatusOK) {
+				t.Fatalf("%d sessions saved", len(sessions.sessions))
+			}
+			for _, session := range sessions.sessions {
+				if session.UserID != 1 || session.UserType != "farmer" {
+					t.Errorf("session %+v", session)
+				}
+			}
+		})
+	}
+}
+
+func TestStockHistoryOnlyForOwnProducts(t *testing.T) {
+	products := &fakeProducts{
+		owners: map[int]int{5: 1, 6: 2},
+		movements: map[int][]models.InventoryMovement{
+			5: {{ID: 1, ProductID: 5, MovementType: models.MovementRestock, QuantityChange: 10, Balance: 10}},
+		},
+	}
+	h := &FarmerHandler{Products: products}
+
+	tests := []struct {
+		name, id string
+		want     int
+	}{
+		{"own product", "5", http.StatusOK},
+		{"another farmer's product", "6", http.StatusNotFound},
+		{"missing product", "7", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := jsonRequest(t, http.MethodGet, "/farmer/product/"+tt.id+"/stock-history", nil, &models.Farmer{ID: 1})
+			req.SetPathValue("id", tt.id)
+			rec := httptest.NewRecorder()
+			h.StockHistory(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want == http.StatusOK {
+				if total := decodeBody(t, rec)["total"]; total != float64(1) {
+					t.Errorf("total %v, want 1", total)
+				}
+			}
+		})
+	}
+}
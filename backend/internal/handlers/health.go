@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// readyTimeout bounds the database ping behind /readyz
+const readyTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	DB *sql.DB
+}
+
+func NewHealthHandler(db *sql.DB) *HealthHandler {
+	return &HealthHandler{DB: db}
+}
+
+// Healthz handles GET /healthz. It only reports that the process is serving requests.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+	})
+}
+
+// Readyz handles GET /readyz. It fails with 503 while the database cannot be reached.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.DB != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+
+		if err := h.DB.PingContext(ctx); err != nil {
+			log.Printf("Readiness check failed: %v", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": "unavailable",
+				"error":  "database unreachable",
+			})
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+	})
+}
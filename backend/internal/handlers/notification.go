@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/api"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/middleware"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/router"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
+)
+
+// NotificationHandler serves the in-app inbox of the signed-in farmer or buyer
+type NotificationHandler struct {
+	Notifications store.NotificationStore
+}
+
+func NewNotificationHandler(stores *store.Store) *NotificationHandler {
+	return &NotificationHandler{Notifications: stores.Notifications}
+}
+
+// List handles GET /notifications?unread=true&page=..&limit=..
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	recipientType, recipientID, ok := notificationRecipient(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusForbidden, "Unauthorized: Farmer or buyer not found in context")
+		return
+	}
+
+	queryValues := r.URL.Query()
+	filter := models.NotificationFilter{UnreadOnly: queryValues.Get("unread") == "true"}
+
+	// Pagination parameters
+	limit := 20 // default limit
+	if l := queryValues.Get("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+			limit = parsedLimit
+		}
+	}
+
+	page := 1 // default page
+	if p := queryValues.Get("page"); p != "" {
+		if parsedPage, err := strconv.Atoi(p); err == nil && parsedPage > 0 {
+			page = parsedPage
+		}
+	}
+	filter.Limit = limit
+	filter.Offset = (page - 1) * limit
+
+	notifications, total, err := h.Notifications.List(r.Context(), recipientType, recipientID, filter)
+	if err != nil {
+		log.Printf("Error fetching notifications for %s %d: %v", recipientType, recipientID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve notifications")
+		return
+	}
+
+	unread, err := h.Notifications.CountUnread(r.Context(), recipientType, recipientID)
+	if err != nil {
+		log.Printf("Error counting unread notifications for %s %d: %v", recipientType, recipientID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve notifications")
+		return
+	}
+
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"notifications": notifications,
+		"unread_count":  unread,
+		"page":          page,
+		"limit":         limit,
+		"total":         total,
+	})
+}
+
+// MarkAllRead handles POST /notifications/read-all
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	recipientType, recipientID, ok := notificationRecipient(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusForbidden, "Unauthorized: Farmer or buyer not found in context")
+		return
+	}
+
+	marked, err := h.Notifications.MarkAllRead(r.Context(), recipientType, recipientID)
+	if err != nil {
+		log.Printf("Error marking notifications read for %s %d: %v", recipientType, recipientID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to update notifications")
+		return
+	}
+
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"marked":  marked,
+	})
+}
+
+// MarkRead handles POST /notifications/{id}/read
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	h.updateNotification(w, r, h.Notifications.MarkRead, "Notification marked as read")
+}
+
+// Delete handles DELETE /notifications/{id}
+func (h *NotificationHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	h.updateNotification(w, r, h.Notifications.Delete, "Notification deleted")
+}
+
+// updateNotification applies update to the {id} notification of the signed-in user
+func (h *NotificationHandler) updateNotification(w http.ResponseWriter, r *http.Request, update func(context.Context, string, int, int) error, message string) {
+	recipientType, recipientID, ok := notificationRecipient(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusForbidden, "Unauthorized: Farmer or buyer not found in context")
+		return
+	}
+
+	notificationID, err := router.PathInt(r, "id")
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid Notification ID")
+		return
+	}
+
+	err = update(r.Context(), recipientType, recipientID, notificationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, r, http.StatusNotFound, "Notification not found")
+		return
+	} else if err != nil {
+		log.Printf("Error updating notification %d: %v", notificationID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to update notification")
+		return
+	}
+
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": message,
+	})
+}
+
+// notificationRecipient is the signed-in farmer or buyer whose inbox the request is for
+func notificationRecipient(r *http.Request) (string, int, bool) {
+	if farmer := middleware.CurrentFarmer(r); farmer != nil {
+		return models.RecipientFarmer, farmer.ID, true
+	}
+	if buyer := middleware.CurrentBuyer(r); buyer != nil {
+		return models.RecipientBuyer, buyer.ID, true
+	}
+	return "", 0, false
+}
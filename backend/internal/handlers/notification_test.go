@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+)
+
+func TestMarkReadOnlyTouchesOwnNotifications(t *testing.T) {
+	notifications := &fakeNotifications{notifications: map[int]*models.Notification{
+		1: {ID: 1, RecipientType: models.RecipientFarmer, RecipientID: 3},
+		2: {ID: 2, RecipientType: models.RecipientBuyer, RecipientID: 3},
+	}}
+	h := &NotificationHandler{Notifications: notifications}
+
+	tests := []struct {
+		name string
+		user interface{}
+		id   string
+		want int
+	}{
+		{"farmer's own", &models.Farmer{ID: 3}, "1", http.StatusOK},
+		{"buyer with the same ID", &models.Buyer{ID: 3}, "1", http.StatusNotFound},
+		{"another farmer", &models.Farmer{ID: 4}, "2", http.StatusNotFound},
+		{"missing", &models.Buyer{ID: 3}, "9", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := jsonRequest(t, http.MethodPost, "/notifications/"+tt.id+"/read", nil, tt.user)
+			req.SetPathValue("id", tt.id)
+			rec := httptest.NewRecorder()
+			h.MarkRead(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	if !notifications.notifications[1].IsRead || notifications.notifications[2].IsRead {
+		t.Errorf("read flags: 1=%v 2=%v", notifications.notifications[1].IsRead, notifications.notifications[2].IsRead)
+	}
+}
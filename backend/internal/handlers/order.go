@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/api"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/middleware"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/router"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/validation"
+)
+
+type OrderHandler struct {
+	Orders   store.OrderStore
+	Refunds  store.RefundStore
+	Payments payments.PaymentProvider
+}
+
+func NewOrderHandler(stores *store.Store, provider payments.PaymentProvider) *OrderHandler {
+	return &OrderHandler{
+		Orders:   stores.Orders,
+		Refunds:  stores.Refunds,
+		Payments: provider,
+	}
+}
+
+// ListBuyerOrders handles GET /buyer/orders
+func (h *OrderHandler) ListBuyerOrders(w http.ResponseWriter, r *http.Request) {
+	// Retrieve buyer from context
+	buyer := middleware.CurrentBuyer(r)
+
+	filter, page, err := parseOrderFilter(r)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	orders, total, err := h.Orders.GetByBuyer(r.Context(), buyer.ID, filter)
+	if err != nil {
+		log.Printf("Error fetching orders for buyer %d: %v", buyer.ID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve orders")
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"orders":  orders,
+		"page":    page,
+		"limit":   filter.Limit,
+		"total":   total,
+	}
+
+	api.WriteJSON(w, r, http.StatusOK, response)
+}
+
+// GetBuyerOrder handles GET /buyer/orders/{id}
+func (h *OrderHandler) GetBuyerOrder(w http.ResponseWriter, r *http.Request) {
+	h.withBuyerOrder(w, r, h.getBuyerOrder)
+}
+
+// RequestBuyerRefund handles POST /buyer/orders/{id}/refund-request
+func (h *OrderHandler) RequestBuyerRefund(w http.ResponseWriter, r *http.Request) {
+	h.withBuyerOrder(w, r, h.requestBuyerRefund)
+}
+
+// withBuyerOrder calls next with the signed-in buyer and the {id} path parameter
+func (h *OrderHandler) withBuyerOrder(w http.ResponseWriter, r *http.Request, next func(http.ResponseWriter, *http.Request, *models.Buyer, int)) {
+	// Retrieve buyer from context
+	buyer := middleware.CurrentBuyer(r)
+
+	orderID, err := router.PathInt(r, "id")
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid Order ID")
+		return
+	}
+
+	next(w, r, buyer, orderID)
+}
+
+func (h *OrderHandler) getBuyerOrder(w http.ResponseWriter, r *http.Request, buyer *models.Buyer, orderID int) {
+	order, err := h.Orders.GetByID(r.Context(), orderID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && order.BuyerID != buyer.ID) {
+		writeJSONError(w, r, http.StatusNotFound, "Order not found")
+		return
+	} else if err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve order")
+		return
+	}
+
+	subtotals, err := h.Orders.FarmerSubtotals(r.Context(), order.ID)
+	if err != nil {
+		log.Printf("Error fetching farmer subtotals for order %d: %v", order.ID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve order")
+		return
+	}
+
+	refunds, err := h.Refunds.GetByOrder(r.Context(), order.ID)
+	if err != nil {
+		log.Printf("Error fetching refunds for order %d: %v", order.ID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve order")
+		return
+	}
+
+	response := map[string]interface{}{
+		"success":          true,
+		"order":            order,
+		"farmer_subtotals": subtotals,
+		"refunds":          refunds,
+	}
+
+	api.WriteJSON(w, r, http.StatusOK, response)
+}
+
+// requestBuyerRefund records a refund request for an admin to approve. The
+// body is optional; without items the whole delivered order is requested.
+func (h *OrderHandler) requestBuyerRefund(w http.ResponseWriter, r *http.Request, buyer *models.Buyer, orderID int) {
+	request, ok := decodeRefundPayload(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := h.Orders.GetByID(r.Context(), orderID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && order.BuyerID != buyer.ID) {
+		writeJSONError(w, r, http.StatusNotFound, "Order not found")
+		return
+	} else if err != nil {
+		log.Printf("Error fetching order %d: %v", orderID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve order")
+		return
+	}
+
+	refund, err := h.Refunds.Request(r.Context(), models.RefundRequest{
+		OrderID:         orderID,
+		Lines:           request.Items,
+		Reason:          request.Reason,
+		RequestedByType: "buyer",
+		RequestedByID:   buyer.ID,
+	})
+	if err != nil {
+		writeRefundError(w, r, err)
+		return
+	}
+
+	api.WriteJSON(w, r, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"message": "Refund requested",
+		"refund":  refund,
+	})
+}
+
+// ListFarmerOrders handles GET /farmer/orders
+func (h *OrderHandler) ListFarmerOrders(w http.ResponseWriter, r *http.Request) {
+	farmer := middleware.CurrentFarmer(r)
+
+	filter, page, err := parseOrderFilter(r)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	subOrders, total, err := h.Orders.GetByFarmer(r.Context(), farmer.ID, filter)
+	if err != nil {
+		log.Printf("Error fetching orders for farmer %d: %v", farmer.ID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve orders")
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"orders":  subOrders,
+		"page":    page,
+		"limit":   filter.Limit,
+		"total":   total,
+	}
+
+	api.WriteJSON(w, r, http.StatusOK, response)
+}
+
+// GetFarmerOrder handles GET /farmer/orders/{id}
+func (h *OrderHandler) GetFarmerOrder(w http.ResponseWriter, r *http.Request) {
+	h.withFarmerOrder(w, r, h.getFarmerOrder)
+}
+
+// UpdateFarmerOrderStatus handles POST /farmer/orders/{id}/status
+func (h *OrderHandler) UpdateFarmerOrderStatus(w http.ResponseWriter, r *http.Request) {
+	h.withFarmerOrder(w, r, h.updateFarmerOrderStatus)
+}
+
+// MarkFarmerOrderPaid handles POST /farmer/orders/{id}/mark-paid
+func (h *OrderHandler) MarkFarmerOrderPaid(w http.ResponseWriter, r *http.Request) {
+	h.withFarmerOrder(w, r, h.markFarmerOrderPaid)
+}
+
+// IssueFarmerRefund handles POST /farmer/orders/{id}/refund
+func (h *OrderHandler) IssueFarmerRefund(w http.ResponseWriter, r *http.Request) {
+	h.withFarmerOrder(w, r, h.issueFarmerRefund)
+}
+
+// withFarmerOrder calls next with the signed-in farmer and the {id} path parameter
+func (h *OrderHandler) withFarmerOrder(w http.ResponseWriter, r *http.Request, next func(http.ResponseWriter, *http.Request, *models.Farmer, int)) {
+	farmer := middleware.CurrentFarmer(r)
+
+	orderID, err := router.PathInt(r, "id")
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid Order ID")
+		return
+	}
+
+	next(w, r, farmer, orderID)
+}
+
+func (h *OrderHandler) getFarmerOrder(w http.ResponseWriter, r *http.Request, farmer *models.Farmer, orderID int) {
+	subOrder, err := h.Orders.GetForFarmer(r.Context(), orderID, farmer.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, r, http.StatusNotFound, "Order not found")
+		return
+	} else if err != nil {
+		log.Printf("Error fetching order %d for farmer %d: %v", orderID, farmer.ID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve order")
+		return
+	}
+
+	history, err := h.Orders.History(r.Context(), orderID)
+	if err != nil {
+		log.Printf("Error fetching status history for order %d: %v", orderID, err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to retrieve order")
+		return
+	}
+
+	// Farmers only see the history of their own sub-order
+	subOrderHistory := []models.OrderStatusChange{}
+	for _, change := range history {
+		if change.SubOrderID == subOrder.ID || (change.SubOrderID == 0 && change.FromStatus == "") {
+			subOrderHistory = append(subOrderHistory, change)
+		}
+	}
+
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"order":   subOrder,
+		"history": subOrderHistory,
+	})
+}
+
+// OrderStatusRequest is the body of POST /farmer/orders/{id}/status
+type OrderStatusRequest struct {
+	Status string `json:"status" validate:"required,max=20"`
+	Note   string `json:"note" validate:"max=1000"`
+}
+
+func (h *OrderHandler) updateFarmerOrderStatus(w http.ResponseWriter, r *http.Request, farmer *models.Farmer, orderID int) {
+	var request OrderStatusRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if errs := validation.Struct(request); errs != nil {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	subOrder, err := h.Orders.UpdateStatus(r.Context(), orderID, farmer.ID, request.Status, request.Note)
+	if err != nil {
+		writeOrderStatusError(w, r, err)
+		return
+	}
+
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Order status updated",
+		"order":   subOrder,
+	})
+}
+
+func (h *OrderHandler) markFarmerOrderPaid(w http.ResponseWriter, r *http.Request, farmer *models.Farmer, orderID int) {
+	subOrder, err := h.Orders.MarkPaid(r.Context(), orderID, farmer.ID)
+	if err != nil {
+		writeOrderStatusError(w, r, err)
+		return
+	}
+
+	api.WriteJSON(w, r, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Order marked as paid",
+		"order":   subOrder,
+	})
+}
+
+// issueFarmerRefund refunds some or all of the farmer's items in an order straight away
+func (h *OrderHandler) issueFarmerRefund(w http.ResponseWriter, r *http.Request, farmer *models.Farmer, orderID int) {
+	request, ok := decodeRefundPayload(w, r)
+	if !ok {
+		return
+	}
+
+	refund, err := h.Refunds.Issue(r.Context(), h.Payments, models.RefundRequest{
+		OrderID:         orderID,
+		FarmerID:        farmer.ID,
+		Lines:           request.Items,
+		Reason:          request.Reason,
+		Restock:         request.Restock,
+		RequestedByType: "farmer",
+		RequestedByID:   farmer.ID,
+	})
+	if err != nil {
+		writeRefundError(w, r, err)
+		return
+	}
+
+	api.WriteJSON(w, r, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"message": "Refund issued",
+		"refund":  refund,
+	})
+}
+
+// RefundPayload is the JSON body of the refund endpoints. Items may be
+// omitted to refund everything that is still refundable.
+type RefundPayload struct {
+	Items   []models.RefundLine `json:"items" validate:"max=100,dive"`
+	Reason  string              `json:"reason" validate:"required,max=1000"`
+	Restock bool                `json:"restock"`
+}
+
+// decodeRefundPayload decodes and validates a refund body, answering 400 or
+// 422 itself when it is not usable
+func decodeRefundPayload(w http.ResponseWriter, r *http.Request) (RefundPayload, bool) {
+	var request RefundPayload
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return request, false
+	}
+	if errs := validation.Struct(request); errs != nil {
+		writeValidationError(w, r, errs)
+		return request, false
+	}
+	return request, true
+}
+
+// writeRefundError maps refund failures to responses with a machine-readable error code
+func writeRefundError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotDelivered):
+		writeJSONErrorCode(w, r, http.StatusConflict, api.CodeNotDelivered, err.Error())
+	case errors.Is(err, models.ErrNothingToRefund):
+		writeJSONErrorCode(w, r, http.StatusConflict, api.CodeNothingToRefund, err.Error())
+	case errors.Is(err, models.ErrRefundQuantity):
+		writeJSONErrorCode(w, r, http.StatusBadRequest, api.CodeInvalidRefundQuantity, err.Error())
+	case errors.Is(err, models.ErrRefundNotPending):
+		writeJSONErrorCode(w, r, http.StatusConflict, api.CodeRefundNotPending, err.Error())
+	case errors.Is(err, models.ErrPaymentNotCaptured):
+		writeJSONErrorCode(w, r, http.StatusConflict, api.CodePaymentNotCaptured, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSONError(w, r, http.StatusNotFound, "Order not found")
+	default:
+		log.Printf("Error processing refund: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to process refund")
+	}
+}
+
+// writeOrderStatusError maps status-change failures to responses with a machine-readable error code
+func writeOrderStatusError(w http.ResponseWriter, r *http.Request, err error) {
+	var transitionErr *models.TransitionError
+
+	switch {
+	case errors.As(err, &transitionErr):
+		api.WriteError(w, r, http.StatusConflict, api.Error{
+			Code:    api.CodeInvalidTransition,
+			Message: transitionErr.Error(),
+			Details: map[string]interface{}{"from": transitionErr.From, "to": transitionErr.To},
+		})
+	case errors.Is(err, models.ErrAlreadyPaid):
+		writeJSONErrorCode(w, r, http.StatusConflict, api.CodeAlreadyPaid, err.Error())
+	case errors.Is(err, models.ErrNotCashPayment):
+		writeJSONErrorCode(w, r, http.StatusConflict, api.CodeNotCashPayment, err.Error())
+	case errors.Is(err, models.ErrOrderClosed):
+		writeJSONErrorCode(w, r, http.StatusConflict, api.CodeOrderClosed, err.Error())
+	case errors.Is(err, models.ErrUnknownStatus):
+		writeJSONErrorCode(w, r, http.StatusBadRequest, api.CodeUnknownStatus, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSONError(w, r, http.StatusNotFound, "Order not found")
+	default:
+		log.Printf("Error updating order status: %v", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to update order status")
+	}
+}
+
+// parseOrderFilter reads status, from/to dates and page/limit from the query string.
+// Dates accept YYYY-MM-DD or RFC3339; a bare "to" date includes that whole day.
+func parseOrderFilter(r *http.Request) (models.OrderFilter, int, error) {
+	queryValues := r.URL.Query()
+	filter := models.OrderFilter{
+		Status: queryValues.Get("status"),
+	}
+
+	if filter.Status != "" && !models.IsValidOrderStatus(filter.Status) {
+		return filter, 0, errors.New("Invalid 'status' filter")
+	}
+
+	if from := queryValues.Get("from"); from != "" {
+		t, _, err := parseDateParam(from)
+		if err != nil {
+			return filter, 0, errors.New("Invalid 'from' date")
+		}
+		filter.From = t
+	}
+	if to := queryValues.Get("to"); to != "" {
+		t, dateOnly, err := parseDateParam(to)
+		if err != nil {
+			return filter, 0, errors.New("Invalid 'to' date")
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.To = t
+	}
+
+	// Pagination parameters
+	limit := 20 // default limit
+	if l := queryValues.Get("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+			limit = parsedLimit
+		}
+	}
+
+	page := 1 // default page
+	if p := queryValues.Get("page"); p != "" {
+		if parsedPage, err := strconv.Atoi(p); err == nil && parsedPage > 0 {
+			page = parsedPage
+		}
+	}
+	filter.Limit = limit
+	filter.Offset = (page - 1) * limit
+
+	return filter, page, nil
+}
+
+// writeJSONError sends the error body of the JSON endpoints, or the
+// envelope's error under /api/v1
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	api.WriteError(w, r, status, api.Error{Message: message})
+}
+
+// writeJSONErrorCode is writeJSONError with a machine-readable "error" code
+func writeJSONErrorCode(w http.ResponseWriter, r *http.Request, status int, code api.Code, message string) {
+	api.WriteError(w, r, status, api.Error{Code: code, Message: message})
+}
+
+// writeValidationError answers 422 with what is wrong with each field of the request
+func writeValidationError(w http.ResponseWriter, r *http.Request, errs validation.Errors) {
+	api.WriteError(w, r, http.StatusUnprocessableEntity, api.Error{
+		Code:    api.CodeValidation,
+		Message: "Invalid request: " + errs.Error(),
+		Fields:  errs,
+	})
+}
+
+// parseDateParam accepts either YYYY-MM-DD or an RFC3339 timestamp and
+// reports whether the value was a bare date
+func parseDateParam(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
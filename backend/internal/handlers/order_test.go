@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/api"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+)
+
+func newTestOrderHandler() (*OrderHandler, *fakeOrders, *fakeRefunds) {
+	orders := &fakeOrders{orders: map[int]*models.Order{
+		7: {ID: 7, BuyerID: 1, Status: models.OrderStatusDelivered},
+	}}
+	refunds := &fakeRefunds{}
+	return &OrderHandler{Orders: orders, Refunds: refunds}, orders, refunds
+}
+
+func TestGetBuyerOrderHidesOtherBuyersOrders(t *testing.T) {
+	h, _, _ := newTestOrderHandler()
+
+	tests := []struct {
+		name  string
+		buyer *models.Buyer
+		id    string
+		want  int
+	}{
+		{"own order", &models.Buyer{ID: 1}, "7", http.StatusOK},
+		{"another buyer's order", &models.Buyer{ID: 2}, "7", http.StatusNotFound},
+		{"missing order", &models.Buyer{ID: 1}, "8", http.StatusNotFound},
+		{"malformed ID", &models.Buyer{ID: 1}, "seven", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := jsonRequest(t, http.MethodGet, "/buyer/orders/"+tt.id, nil, tt.buyer)
+			req.SetPathValue("id", tt.id)
+			rec := httptest.NewRecorder()
+			h.GetBuyerOrder(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequestBuyerRefundRecordsTheBuyer(t *testing.T) {
+	h, _, refunds := newTestOrderHandler()
+
+	req := jsonRequest(t, http.MethodPost, "/buyer/orders/7/refund-request", map[string]interface{}{"reason": "Bruised"}, &models.Buyer{ID: 1})
+	req.SetPathValue("id", "7")
+	rec := httptest.NewRecorder()
+	h.RequestBuyerRefund(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(refunds.requests) != 1 {
+		t.Fatalf("got %d refund requests, want 1", len(refunds.requests))
+	}
+	got := refunds.requests[0]
+	if got.OrderID != 7 || got.RequestedByType != "buyer" || got.RequestedByID != 1 || got.Reason != "Bruised" {
+		t.Errorf("refund request %+v", got)
+	}
+}
+
+func TestUpdateFarmerOrderStatusErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		want     int
+		wantCode api.Code
+	}{
+		{"invalid transition", &models.TransitionError{From: models.OrderStatusShipped, To: models.OrderStatusReadyForPickup}, http.StatusConflict, api.CodeInvalidTransition},
+		{"unknown status", models.ErrUnknownStatus, http.StatusBadRequest, api.CodeUnknownStatus},
+		{"not the farmer's order", sql.ErrNoRows, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, orders, _ := newTestOrderHandler()
+			orders.statusErr = tt.err
+
+			req := jsonRequest(t, http.MethodPost, "/farmer/orders/7/status", map[string]interface{}{"status": "ready_for_pickup"}, &models.Farmer{ID: 3})
+			req.SetPathValue("id", "7")
+			rec := httptest.NewRecorder()
+			h.UpdateFarmerOrderStatus(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			body := decodeBody(t, rec)
+			if code, _ := body["error"].(string); api.Code(code) != tt.wantCode {
+				t.Errorf("error code %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestUpdateFarmerOrderStatus(t *testing.T) {
+	h, orders, _ := newTestOrderHandler()
+
+	req := jsonRequest(t, http.MethodPost, "/farmer/orders/7/status", map[string]interface{}{"status": "delivered"}, &models.Farmer{ID: 3})
+	req.SetPathValue("id", "7")
+	rec := httptest.NewRecorder()
+	h.UpdateFarmerOrderStatus(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(orders.updates) != 1 || orders.updates[0] != models.OrderStatusDelivered {
+		t.Errorf("status updates %v", orders.updates)
+	}
+}
+
+func TestRefundPayloadValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   map[string]interface{}
+		fields []string
+	}{
+		{"missing reason", map[string]interface{}{"items": []map[string]int{{"order_item_id": 1, "quantity": 1}}}, []string{"reason"}},
+		{"blank reason", map[string]interface{}{"reason": "   "}, []string{"reason"}},
+		{"bad lines", map[string]interface{}{"reason": "Bruised", "items": []map[string]int{{"order_item_id": 1, "quantity": 0}, {"quantity": 2}}}, []string{"items[0].quantity", "items[1].order_item_id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, refunds := newTestOrderHandler()
+
+			req := jsonRequest(t, http.MethodPost, "/buyer/orders/7/refund-request", tt.body, &models.Buyer{ID: 1})
+			req.SetPathValue("id", "7")
+			rec := httptest.NewRecorder()
+			h.RequestBuyerRefund(rec, req)
+
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status %d, want 422: %s", rec.Code, rec.Body.String())
+			}
+			fields, _ := decodeBody(t, rec)["fields"].(map[string]interface{})
+			if len(fields) != len(tt.fields) {
+				t.Errorf("fields %v, want %v", fields, tt.fields)
+			}
+			for _, field := range tt.fields {
+				if _, ok := fields[field]; !ok {
+					t.Errorf("no error for %s in %v", field, fields)
+				}
+			}
+			if len(refunds.requests) != 0 {
+				t.Errorf("refund requested from an invalid body")
+			}
+		})
+	}
+}
+
+func TestUpdateFarmerOrderStatusValidation(t *testing.T) {
+	h, orders, _ := newTestOrderHandler()
+
+	req := jsonRequest(t, http.MethodPost, "/farmer/orders/7/status", map[string]interface{}{"note": "No status"}, &models.Farmer{ID: 3})
+	req.SetPathValue("id", "7")
+	rec := httptest.NewRecorder()
+	h.UpdateFarmerOrderStatus(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422: %s", rec.Code, rec.Body.String())
+	}
+	if code := decodeBody(t, rec)["error"]; code != string(api.CodeValidation) {
+		t.Errorf("error code %v, want %s", code, api.CodeValidation)
+	}
+	if len(orders.updates) != 0 {
+		t.Errorf("status updated from an invalid body: %v", orders.updates)
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
+)
+
+// maxWebhookBody caps the size of provider webhook payloads
+const maxWebhookBody = 1 << 20
+
+type PaymentHandler struct {
+	PaymentRecords store.PaymentStore
+	Payments       payments.PaymentProvider
+}
+
+func NewPaymentHandler(stores *store.Store, provider payments.PaymentProvider) *PaymentHandler {
+	return &PaymentHandler{
+		PaymentRecords: stores.Payments,
+		Payments:       provider,
+	}
+}
+
+// Webhook handles POST /payments/webhook
+func (h *PaymentHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	event, err := h.Payments.VerifyWebhook(payload, r.Header)
+	if errors.Is(err, payments.ErrInvalidSignature) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("Error verifying payment webhook: %v", err)
+		http.Error(w, "Invalid webhook payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.PaymentRecords.ApplyWebhook(r.Context(), event); err != nil {
+		log.Printf("Error applying payment webhook %s (%s): %v", event.ID, event.Type, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+	})
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+)
+
+func TestWebhookChecksTheSignature(t *testing.T) {
+	provider := payments.NewFakeProvider("test-secret")
+	payload := `{"id":"evt_1","type":"payment.captured","payment_id":"pay_1","amount":1250}`
+
+	tests := []struct {
+		name      string
+		signature string
+		want      int
+		applied   bool
+	}{
+		{"signed", provider.SignWebhook([]byte(payload)), http.StatusOK, true},
+		{"forged", "0000", http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := &fakePayments{}
+			h := &PaymentHandler{PaymentRecords: records, Payments: provider}
+
+			req := httptest.NewRequest(http.MethodPost, "/payments/webhook", strings.NewReader(payload))
+			req.Header.Set(payments.FakeSignatureHeader, tt.signature)
+			rec := httptest.NewRecorder()
+			h.Webhook(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if applied := len(records.events) == 1; applied != tt.applied {
+				t.Fatalf("%d events applied", len(records.events))
+			}
+			if tt.applied && (records.events[0].Type != payments.EventPaymentCaptured || records.events[0].Amount != 1250) {
+				t.Errorf("applied event %+v", records.events[0])
+			}
+		})
+	}
+}
@@ -1,24 +1,22 @@
 package handlers
 
 import (
-	"database/sql"
-	"encoding/json"
-	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/api"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/router"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
 	"html/template"
 	"log"
 	"net/http"
-	"strconv"
-	"strings"
 )
 
 type ProductHandler struct {
-	DB        *sql.DB
+	Products  store.ProductStore
 	Templates map[string]*template.Template
 }
 
-func NewProductHandler(db *sql.DB, templates map[string]*template.Template) *ProductHandler {
+func NewProductHandler(stores *store.Store, templates map[string]*template.Template) *ProductHandler {
 	return &ProductHandler{
-		DB:        db,
+		Products:  stores.Products,
 		Templates: templates,
 	}
 }
@@ -26,37 +24,19 @@ func NewProductHandler(db *sql.DB, templates map[string]*template.Template) *Pro
 func (h *ProductHandler) GetProductDetails(w http.ResponseWriter, r *http.Request) {
 	log.Println("Handling /buyer/product/{id} request")
 
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Extract the product ID from the URL
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) != 4 {
-		http.Error(w, "Invalid URL path", http.StatusBadRequest)
-		return
-	}
-
-	idStr := pathParts[3]
-	id, err := strconv.Atoi(idStr)
+	id, err := router.PathInt(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid product ID")
 		return
 	}
 
-	product, err := models.GetProductByID(h.DB, id)
+	product, err := h.Products.GetByID(r.Context(), id)
 	if err != nil {
 		log.Printf("Error fetching product: %v", err)
-		http.Error(w, "Product not found", http.StatusNotFound)
+		writeJSONError(w, r, http.StatusNotFound, "Product not found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(product); err != nil {
-		log.Printf("Error encoding product to JSON: %v", err)
-		http.Error(w, "Failed to encode product", http.StatusInternalServerError)
-	}
+	api.WriteJSON(w, r, http.StatusOK, product)
 }
 
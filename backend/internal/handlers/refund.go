@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/middleware"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/utils"
+)
+
+// AdminIssueRefund handles POST /admin/orders/refund. Without order_item_id
+// fields the whole order is refunded; otherwise each order_item_id is paired
+// with the quantity field at the same position.
+func (h *OrderHandler) AdminIssueRefund(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(middleware.AdminContextKey).(*models.Admin)
+	if !ok || admin == nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	orderID, err := strconv.Atoi(r.FormValue("order_id"))
+	if err != nil {
+		http.Error(w, "Bad Request: Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	reason := r.FormValue("reason")
+	if reason == "" {
+		http.Error(w, "Bad Request: Missing reason", http.StatusBadRequest)
+		return
+	}
+
+	itemIDs := r.Form["order_item_id"]
+	quantities := r.Form["quantity"]
+	if len(itemIDs) != len(quantities) {
+		http.Error(w, "Bad Request: Each item needs a quantity", http.StatusBadRequest)
+		return
+	}
+
+	var lines []models.RefundLine
+	for i := range itemIDs {
+		itemID, err := strconv.Atoi(itemIDs[i])
+		if err != nil {
+			http.Error(w, "Bad Request: Invalid order item ID", http.StatusBadRequest)
+			return
+		}
+		quantity, err := strconv.Atoi(quantities[i])
+		if err != nil {
+			http.Error(w, "Bad Request: Invalid quantity", http.StatusBadRequest)
+			return
+		}
+		lines = append(lines, models.RefundLine{OrderItemID: itemID, Quantity: quantity})
+	}
+
+	refund, err := h.Refunds.Issue(r.Context(), h.Payments, models.RefundRequest{
+		OrderID:         orderID,
+		Lines:           lines,
+		Reason:          reason,
+		Restock:         r.FormValue("restock") != "",
+		RequestedByType: "admin",
+		RequestedByID:   admin.ID,
+	})
+	if err != nil {
+		writeAdminRefundError(w, r, err)
+		return
+	}
+	log.Printf("Admin %d refunded %.2f on order %d", admin.ID, refund.Amount, orderID)
+
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// ApproveRefund handles POST /admin/refunds/approve
+func (h *OrderHandler) ApproveRefund(w http.ResponseWriter, r *http.Request) {
+	err := utils.ValidateCSRFToken(r)
+	if err != nil {
+		log.Printf("Invalid CSRF token: %v", err)
+		http.Error(w, "Invalid CSRF Token", http.StatusForbidden)
+		return
+	}
+
+	admin, ok := r.Context().Value(middleware.AdminContextKey).(*models.Admin)
+	if !ok || admin == nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	refundID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Bad Request: Invalid refund ID", http.StatusBadRequest)
+		return
+	}
+
+	refund, err := h.Refunds.Approve(r.Context(), h.Payments, refundID, r.FormValue("restock") != "", "admin", admin.ID, r.FormValue("note"))
+	if err != nil {
+		writeAdminRefundError(w, r, err)
+		return
+	}
+	log.Printf("Admin %d approved refund %d on order %d", admin.ID, refund.ID, refund.OrderID)
+
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// RejectRefund handles POST /admin/refunds/reject
+func (h *OrderHandler) RejectRefund(w http.ResponseWriter, r *http.Request) {
+	err := utils.ValidateCSRFToken(r)
+	if err != nil {
+		log.Printf("Invalid CSRF token: %v", err)
+		http.Error(w, "Invalid CSRF Token", http.StatusForbidden)
+		return
+	}
+
+	admin, ok := r.Context().Value(middleware.AdminContextKey).(*models.Admin)
+	if !ok || admin == nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	refundID, err := strconv.Atoi(r.FormValue("id"))
+	note := r.FormValue("note")
+	if err != nil || note == "" {
+		http.Error(w, "Bad Request: Missing refund ID or note", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Refunds.Reject(r.Context(), refundID, "admin", admin.ID, note)
+	if err != nil {
+		writeAdminRefundError(w, r, err)
+		return
+	}
+	log.Printf("Admin %d rejected refund %d", admin.ID, refundID)
+
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// writeAdminRefundError reports refund failures as plain text for the admin pages
+func writeAdminRefundError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotDelivered), errors.Is(err, models.ErrNothingToRefund),
+		errors.Is(err, models.ErrRefundNotPending), errors.Is(err, models.ErrPaymentNotCaptured):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, models.ErrRefundQuantity):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Not found", http.StatusNotFound)
+	default:
+		log.Printf("Error processing refund: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/utils"
+)
+
+// startSession saves a new session for the user and sets its cookie
+func startSession(ctx context.Context, w http.ResponseWriter, sessions store.SessionStore, settings config.Session, userID int, userType string) error {
+	session, err := models.NewSession(userID, userType, settings.TTL)
+	if err != nil {
+		return err
+	}
+	if err := sessions.Create(ctx, session); err != nil {
+		return err
+	}
+
+	utils.SetSessionCookie(w, session.ID, session.ExpiresAt, settings)
+	return nil
+}
@@ -0,0 +1,27 @@
+// Package jobs runs the server's periodic background tasks.
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunPeriodic calls fn with ctx every interval until ctx is cancelled. Errors
+// are logged and the job keeps running.
+func RunPeriodic(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Job %s stopped", name)
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil {
+				log.Printf("Job %s failed: %v", name, err)
+			}
+		}
+	}
+}
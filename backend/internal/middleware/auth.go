@@ -2,11 +2,12 @@ package middleware
 
 import (
 	"context"
-	"database/sql"
 	"log"
 	"net/http"
 
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/api"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/utils"
 )
 
@@ -18,26 +19,39 @@ const (
 	FarmerContextKey ContextKey = "farmer"
 )
 
-func Authenticate(db *sql.DB, next http.Handler) http.Handler {
+func Authenticate(s *store.Store, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		sessionID, err := utils.GetSessionID(r)
 		if err != nil {
 			log.Println("Auth Middleware: couldn't retrieve sessionID")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		log.Println(sessionID)
-		userID, userType, err := utils.GetUserIDFromSession(db, sessionID)
+		session, err := s.Sessions.Get(r.Context(), sessionID)
 		if err != nil {
 			log.Println("Auth Middleware: couldn't retrieve userID")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
+		// Check and delete the expired session
+		if session.Expired() {
+			if err := s.Sessions.Delete(r.Context(), sessionID); err != nil {
+				log.Printf("Auth Middleware: couldn't delete expired session: %v", err)
+			}
+			log.Println("Auth Middleware: session expired")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		userID, userType := session.UserID, session.UserType
+
 		// Fetch user information store in context with specific key
 		var ctx context.Context
 		switch userType {
 		case "admin":
-			admin, err := models.GetAdminByID(db, userID)
+			admin, err := s.Admins.GetByID(r.Context(), userID)
 			if err != nil {
 				log.Println("Auth Middleware: couldn't retrieve AdminID")
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -46,7 +60,7 @@ func Authenticate(db *sql.DB, next http.Handler) http.Handler {
 			ctx = context.WithValue(r.Context(), AdminContextKey, admin)
 
 		case "buyer":
-			buyer, err := models.GetBuyerByID(db, userID)
+			buyer, err := s.Buyers.GetByID(r.Context(), userID)
 			if err != nil {
 				log.Println("Auth Middleware: couldn't retrieve BuyerByID")
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -55,7 +69,7 @@ func Authenticate(db *sql.DB, next http.Handler) http.Handler {
 			ctx = context.WithValue(r.Context(), BuyerContextKey, buyer)
 
 		case "farmer":
-			farmer, err := models.GetFarmerByID(db, userID)
+			farmer, err := s.Farmers.GetByID(r.Context(), userID)
 			if err != nil {
 				log.Println("Auth Middleware: couldn't retrieve FarmerByID")
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -65,6 +79,7 @@ func Authenticate(db *sql.DB, next http.Handler) http.Handler {
 
 		default:
 			log.Println("Auth Middleware: couldn't handle userType")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
@@ -74,14 +89,67 @@ func Authenticate(db *sql.DB, next http.Handler) http.Handler {
 	})
 }
 
-func AdminOnly(next http.Handler) http.Handler {
+// RequirePermission lets through admins whose role grants permission and
+// refuses everyone else, farmers and buyers included, with 403. It goes
+// after Authenticate.
+func RequirePermission(permission models.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			admin, ok := r.Context().Value(AdminContextKey).(*models.Admin)
+			if !ok {
+				http.Error(w, "Access denied: Admin privileges required", http.StatusForbidden)
+				return
+			}
+			if !admin.Can(permission) {
+				log.Printf("Admin %d (%s) denied %s %s: needs %s", admin.ID, admin.Role, r.Method, r.URL.Path, permission)
+				http.Error(w, "Access denied: your role does not allow this", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BuyerOnly lets through signed-in buyers and refuses everyone else with 403.
+// It goes after Authenticate; handlers behind it read the buyer with
+// CurrentBuyer.
+func BuyerOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, ok := r.Context().Value(AdminContextKey).(*models.Admin)
-		if !ok {
-			http.Error(w, "Access denied: Admin privileges required", http.StatusForbidden)
+		if CurrentBuyer(r) == nil {
+			writeForbidden(w, r, "Access denied: Buyer account required")
 			return
 		}
+		next.ServeHTTP(w, r)
+	})
+}
 
+// FarmerOnly lets through signed-in farmers and refuses everyone else with
+// 403. It goes after Authenticate; handlers behind it read the farmer with
+// CurrentFarmer.
+func FarmerOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if CurrentFarmer(r) == nil {
+			writeForbidden(w, r, "Access denied: Farmer account required")
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// CurrentBuyer is the buyer Authenticate signed the request in as, or nil
+func CurrentBuyer(r *http.Request) *models.Buyer {
+	buyer, _ := r.Context().Value(BuyerContextKey).(*models.Buyer)
+	return buyer
+}
+
+// CurrentFarmer is the farmer Authenticate signed the request in as, or nil
+func CurrentFarmer(r *http.Request) *models.Farmer {
+	farmer, _ := r.Context().Value(FarmerContextKey).(*models.Farmer)
+	return farmer
+}
+
+// writeForbidden answers 403 in the JSON shape of the API handlers
+func writeForbidden(w http.ResponseWriter, r *http.Request, message string) {
+	api.WriteError(w, r, http.StatusForbidden, api.Error{Message: message})
+}
@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "init", Checksum: "aaa"},
+		{Version: 2, Name: "orders", Checksum: "bbb"},
+	}
+
+	tests := []struct {
+		name      string
+		applied   map[int]appliedMigration
+		wantNewer []int
+		wantErr   bool
+	}{
+		{"nothing applied", map[int]appliedMigration{}, nil, false},
+		{"all applied", map[int]appliedMigration{1: {checksum: "aaa"}, 2: {checksum: "bbb"}}, nil, false},
+		{"some pending", map[int]appliedMigration{1: {checksum: "aaa"}}, nil, false},
+		// A newer release running next to this one migrated further
+		{"newer versions applied", map[int]appliedMigration{1: {checksum: "aaa"}, 2: {checksum: "bbb"}, 4: {checksum: "ddd"}, 3: {checksum: "ccc"}}, []int{3, 4}, false},
+		{"edited migration", map[int]appliedMigration{1: {checksum: "aaa"}, 2: {checksum: "edited"}}, nil, true},
+		{"edited migration under a newer one", map[int]appliedMigration{1: {checksum: "edited"}, 3: {checksum: "ccc"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newer, err := verify(migrations, tt.applied)
+			if tt.wantErr {
+				if !errors.Is(err, ErrChecksumMismatch) {
+					t.Fatalf("got %v, want ErrChecksumMismatch", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if !reflect.DeepEqual(newer, tt.wantNewer) {
+				t.Errorf("newer versions = %v, want %v", newer, tt.wantNewer)
+			}
+		})
+	}
+}
+
+// A version below the latest one the binary knows was removed from it, which
+// is not a rolling deploy
+func TestVerifyRejectsRemovedMigration(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "init", Checksum: "aaa"},
+		{Version: 3, Name: "payments", Checksum: "ccc"},
+	}
+	applied := map[int]appliedMigration{1: {checksum: "aaa"}, 2: {checksum: "bbb"}}
+
+	if _, err := verify(migrations, applied); err == nil {
+		t.Fatal("verify accepted an applied migration missing from the binary")
+	}
+}
@@ -0,0 +1,106 @@
+-- Tables the application was originally written against. IF NOT EXISTS keeps
+-- this a no-op on databases that were set up by hand before migrations existed.
+
+CREATE TABLE IF NOT EXISTS admins (
+    id            SERIAL PRIMARY KEY,
+    email         VARCHAR(255) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    is_active     BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS farmers (
+    id               SERIAL PRIMARY KEY,
+    email            VARCHAR(255) NOT NULL UNIQUE,
+    password_hash    VARCHAR(255) NOT NULL,
+    first_name       VARCHAR(100) NOT NULL,
+    last_name        VARCHAR(100) NOT NULL,
+    farm_name        VARCHAR(255) NOT NULL,
+    farm_size        VARCHAR(100) NOT NULL DEFAULT '',
+    location         VARCHAR(255) NOT NULL DEFAULT '',
+    status           VARCHAR(20) NOT NULL DEFAULT 'pending',
+    rejection_reason TEXT,
+    approved_at      TIMESTAMPTZ,
+    is_active        BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS buyers (
+    id                   SERIAL PRIMARY KEY,
+    email                VARCHAR(255) NOT NULL UNIQUE,
+    password_hash        VARCHAR(255) NOT NULL,
+    first_name           VARCHAR(100) NOT NULL,
+    last_name            VARCHAR(100) NOT NULL,
+    delivery_address     TEXT NOT NULL DEFAULT '',
+    delivery_preferences JSONB,
+    is_active            BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at           TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- user_id points at admins, farmers or buyers depending on user_type
+CREATE TABLE IF NOT EXISTS sessions (
+    session_id VARCHAR(128) PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    user_type  VARCHAR(20) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id   SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE
+);
+
+-- Product search maps these names to fixed IDs
+INSERT INTO categories (id, name) VALUES (1, 'vegetables'), (2, 'fruits'), (3, 'seeds')
+ON CONFLICT DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('categories', 'id'), GREATEST((SELECT MAX(id) FROM categories), 1));
+
+CREATE TABLE IF NOT EXISTS products (
+    id          SERIAL PRIMARY KEY,
+    farmer_id   INTEGER NOT NULL REFERENCES farmers (id) ON DELETE CASCADE,
+    name        VARCHAR(255) NOT NULL,
+    category_id INTEGER NOT NULL REFERENCES categories (id),
+    price       NUMERIC(10, 2) NOT NULL CHECK (price >= 0),
+    quantity    INTEGER NOT NULL DEFAULT 0,
+    description TEXT NOT NULL DEFAULT '',
+    is_active   BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_products_farmer_id ON products (farmer_id);
+
+CREATE TABLE IF NOT EXISTS product_images (
+    id          SERIAL PRIMARY KEY,
+    product_id  INTEGER NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    image_url   VARCHAR(1024) NOT NULL,
+    image_order INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_images_product_id ON product_images (product_id);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+    id         SERIAL PRIMARY KEY,
+    buyer_id   INTEGER NOT NULL REFERENCES buyers (id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    quantity   INTEGER NOT NULL CHECK (quantity > 0),
+    UNIQUE (buyer_id, product_id)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id                SERIAL PRIMARY KEY,
+    recipient_id      INTEGER NOT NULL,
+    notification_type VARCHAR(50) NOT NULL,
+    message           TEXT NOT NULL,
+    is_sent           BOOLEAN NOT NULL DEFAULT FALSE,
+    sent_at           TIMESTAMPTZ,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_recipient_id ON notifications (recipient_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS order_status_history;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS sub_orders;
+DROP TABLE IF EXISTS orders;
@@ -0,0 +1,62 @@
+-- Orders keep a snapshot of what was bought, so they reference buyers, farmers
+-- and products without foreign keys and survive account or product deletion.
+
+CREATE TABLE orders (
+    id             SERIAL PRIMARY KEY,
+    buyer_id       INTEGER NOT NULL,
+    status         VARCHAR(20) NOT NULL,
+    payment_method VARCHAR(20) NOT NULL DEFAULT 'card',
+    total_amount   NUMERIC(12, 2) NOT NULL,
+    item_count     INTEGER NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_orders_buyer_id_created_at ON orders (buyer_id, created_at DESC);
+
+CREATE TABLE sub_orders (
+    id              SERIAL PRIMARY KEY,
+    order_id        INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    farmer_id       INTEGER NOT NULL,
+    status          VARCHAR(20) NOT NULL,
+    delivery_method VARCHAR(20) NOT NULL,
+    payment_status  VARCHAR(20) NOT NULL,
+    paid_at         TIMESTAMPTZ,
+    subtotal        NUMERIC(12, 2) NOT NULL,
+    item_count      INTEGER NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (order_id, farmer_id)
+);
+
+CREATE INDEX idx_sub_orders_farmer_id_created_at ON sub_orders (farmer_id, created_at DESC);
+CREATE INDEX idx_sub_orders_unpaid ON sub_orders (created_at) WHERE payment_status = 'unpaid';
+
+CREATE TABLE order_items (
+    id           SERIAL PRIMARY KEY,
+    order_id     INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    sub_order_id INTEGER NOT NULL REFERENCES sub_orders (id) ON DELETE CASCADE,
+    product_id   INTEGER NOT NULL,
+    farmer_id    INTEGER NOT NULL,
+    product_name VARCHAR(255) NOT NULL,
+    unit_price   NUMERIC(10, 2) NOT NULL,
+    quantity     INTEGER NOT NULL CHECK (quantity > 0),
+    subtotal     NUMERIC(12, 2) NOT NULL
+);
+
+CREATE INDEX idx_order_items_order_id ON order_items (order_id);
+CREATE INDEX idx_order_items_sub_order_id ON order_items (sub_order_id);
+
+CREATE TABLE order_status_history (
+    id              SERIAL PRIMARY KEY,
+    order_id        INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    sub_order_id    INTEGER REFERENCES sub_orders (id) ON DELETE CASCADE,
+    from_status     VARCHAR(20),
+    to_status       VARCHAR(20) NOT NULL,
+    changed_by_type VARCHAR(20) NOT NULL,
+    changed_by_id   INTEGER NOT NULL,
+    note            TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_order_status_history_order_id ON order_status_history (order_id, created_at);
@@ -0,0 +1,13 @@
+CREATE TABLE payments (
+    id              SERIAL PRIMARY KEY,
+    order_id        INTEGER NOT NULL UNIQUE REFERENCES orders (id) ON DELETE CASCADE,
+    provider        VARCHAR(50) NOT NULL,
+    provider_ref    VARCHAR(255) NOT NULL UNIQUE,
+    amount          NUMERIC(12, 2) NOT NULL,
+    captured_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    refunded_amount NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    currency        VARCHAR(3) NOT NULL,
+    status          VARCHAR(20) NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
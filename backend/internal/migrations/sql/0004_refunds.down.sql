@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS refund_items;
+DROP TABLE IF EXISTS refunds;
+ALTER TABLE order_items DROP COLUMN IF EXISTS refunded_quantity;
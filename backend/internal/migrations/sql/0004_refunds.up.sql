@@ -0,0 +1,33 @@
+ALTER TABLE order_items ADD COLUMN refunded_quantity INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD CONSTRAINT order_items_refunded_quantity_check
+    CHECK (refunded_quantity >= 0 AND refunded_quantity <= quantity);
+
+CREATE TABLE refunds (
+    id                 SERIAL PRIMARY KEY,
+    order_id           INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    status             VARCHAR(20) NOT NULL,
+    reason             TEXT NOT NULL,
+    amount             NUMERIC(12, 2) NOT NULL,
+    restock            BOOLEAN NOT NULL DEFAULT FALSE,
+    requested_by_type  VARCHAR(20) NOT NULL,
+    requested_by_id    INTEGER NOT NULL,
+    processed_by_type  VARCHAR(20),
+    processed_by_id    INTEGER,
+    provider_refund_id VARCHAR(255),
+    decision_note      TEXT,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    processed_at       TIMESTAMPTZ
+);
+
+CREATE INDEX idx_refunds_order_id ON refunds (order_id);
+CREATE INDEX idx_refunds_requested ON refunds (created_at) WHERE status = 'requested';
+
+CREATE TABLE refund_items (
+    id            SERIAL PRIMARY KEY,
+    refund_id     INTEGER NOT NULL REFERENCES refunds (id) ON DELETE CASCADE,
+    order_item_id INTEGER NOT NULL REFERENCES order_items (id) ON DELETE CASCADE,
+    quantity      INTEGER NOT NULL CHECK (quantity > 0),
+    amount        NUMERIC(12, 2) NOT NULL
+);
+
+CREATE INDEX idx_refund_items_refund_id ON refund_items (refund_id);
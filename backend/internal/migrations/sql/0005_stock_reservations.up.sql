@@ -0,0 +1,12 @@
+CREATE TABLE stock_reservations (
+    id         SERIAL PRIMARY KEY,
+    buyer_id   INTEGER NOT NULL REFERENCES buyers (id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    quantity   INTEGER NOT NULL CHECK (quantity > 0),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (buyer_id, product_id)
+);
+
+CREATE INDEX idx_stock_reservations_product_id ON stock_reservations (product_id, expires_at);
+CREATE INDEX idx_stock_reservations_expires_at ON stock_reservations (expires_at);
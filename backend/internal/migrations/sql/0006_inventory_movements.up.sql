@@ -0,0 +1,14 @@
+CREATE TABLE inventory_movements (
+    id              SERIAL PRIMARY KEY,
+    product_id      INTEGER NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    movement_type   VARCHAR(30) NOT NULL,
+    quantity_change INTEGER NOT NULL,
+    balance         INTEGER NOT NULL,
+    actor_type      VARCHAR(20) NOT NULL,
+    actor_id        INTEGER NOT NULL,
+    reason          TEXT,
+    order_id        INTEGER,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_inventory_movements_product_id ON inventory_movements (product_id, created_at DESC);
@@ -0,0 +1,14 @@
+CREATE TABLE outbox (
+    id              SERIAL PRIMARY KEY,
+    kind            VARCHAR(20) NOT NULL,
+    payload         JSONB NOT NULL,
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at    TIMESTAMPTZ
+);
+
+CREATE INDEX idx_outbox_due ON outbox (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_outbox_dead ON outbox (created_at DESC) WHERE status = 'dead';
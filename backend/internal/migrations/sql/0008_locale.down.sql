@@ -0,0 +1,2 @@
+ALTER TABLE buyers DROP COLUMN IF EXISTS locale;
+ALTER TABLE farmers DROP COLUMN IF EXISTS locale;
@@ -0,0 +1,4 @@
+-- Preferred language for emails, as a lower-case tag such as "en" or "ru-kz".
+-- NULL means the server's default locale.
+ALTER TABLE farmers ADD COLUMN locale VARCHAR(16);
+ALTER TABLE buyers ADD COLUMN locale VARCHAR(16);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_notifications_unread;
+DROP INDEX IF EXISTS idx_notifications_recipient;
+DELETE FROM notifications WHERE recipient_type <> 'farmer';
+ALTER TABLE notifications DROP COLUMN IF EXISTS read_at;
+ALTER TABLE notifications DROP COLUMN IF EXISTS recipient_type;
+CREATE INDEX IF NOT EXISTS idx_notifications_recipient_id ON notifications (recipient_id);
@@ -0,0 +1,9 @@
+-- Notifications can go to buyers as well as farmers; existing rows are all
+-- farmer notifications. read_at is NULL until the recipient reads one.
+ALTER TABLE notifications ADD COLUMN recipient_type VARCHAR(10) NOT NULL DEFAULT 'farmer'
+    CHECK (recipient_type IN ('farmer', 'buyer'));
+ALTER TABLE notifications ADD COLUMN read_at TIMESTAMPTZ;
+
+DROP INDEX IF EXISTS idx_notifications_recipient_id;
+CREATE INDEX idx_notifications_recipient ON notifications (recipient_type, recipient_id, created_at DESC);
+CREATE INDEX idx_notifications_unread ON notifications (recipient_type, recipient_id) WHERE read_at IS NULL;
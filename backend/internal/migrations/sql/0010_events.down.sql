@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS products_stock_event ON products;
+DROP TRIGGER IF EXISTS orders_event ON orders;
+DROP TRIGGER IF EXISTS sub_orders_event ON sub_orders;
+DROP TRIGGER IF EXISTS notifications_event ON notifications;
+DROP FUNCTION IF EXISTS notify_stock_event();
+DROP FUNCTION IF EXISTS notify_order_event();
+DROP FUNCTION IF EXISTS notify_sub_order_event();
+DROP FUNCTION IF EXISTS notify_notification_event();
@@ -0,0 +1,101 @@
+-- Triggers publish changes on the "events" channel so every server instance
+-- can push them to connected clients. NOTIFY is delivered on commit, and a
+-- payload must stay under 8000 bytes, so messages are truncated.
+
+CREATE FUNCTION notify_notification_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('events', json_build_object(
+        'id', NEW.id,
+        'type', 'notification',
+        'recipient_type', NEW.recipient_type,
+        'recipient_id', NEW.recipient_id,
+        'data', json_build_object(
+            'id', NEW.id,
+            'recipient_type', NEW.recipient_type,
+            'recipient_id', NEW.recipient_id,
+            'notification_type', NEW.notification_type,
+            'message', LEFT(NEW.message, 4000),
+            'is_sent', NEW.is_sent,
+            'sent_at', COALESCE(NEW.sent_at, NEW.created_at),
+            'is_read', NEW.read_at IS NOT NULL,
+            'created_at', NEW.created_at
+        )
+    )::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notifications_event AFTER INSERT ON notifications
+    FOR EACH ROW EXECUTE FUNCTION notify_notification_event();
+
+-- Farmers hear about new sub-orders and every status or payment change
+CREATE FUNCTION notify_sub_order_event() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.status = OLD.status AND NEW.payment_status = OLD.payment_status THEN
+        RETURN NEW;
+    END IF;
+    PERFORM pg_notify('events', json_build_object(
+        'type', 'order',
+        'recipient_type', 'farmer',
+        'recipient_id', NEW.farmer_id,
+        'data', json_build_object(
+            'order_id', NEW.order_id,
+            'sub_order_id', NEW.id,
+            'status', NEW.status,
+            'payment_status', NEW.payment_status,
+            'updated_at', NEW.updated_at
+        )
+    )::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER sub_orders_event AFTER INSERT OR UPDATE ON sub_orders
+    FOR EACH ROW EXECUTE FUNCTION notify_sub_order_event();
+
+-- Buyers hear about status changes of their orders
+CREATE FUNCTION notify_order_event() RETURNS trigger AS $$
+BEGIN
+    IF NEW.status = OLD.status THEN
+        RETURN NEW;
+    END IF;
+    PERFORM pg_notify('events', json_build_object(
+        'type', 'order',
+        'recipient_type', 'buyer',
+        'recipient_id', NEW.buyer_id,
+        'data', json_build_object(
+            'order_id', NEW.id,
+            'status', NEW.status,
+            'updated_at', NEW.updated_at
+        )
+    )::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER orders_event AFTER UPDATE ON orders
+    FOR EACH ROW EXECUTE FUNCTION notify_order_event();
+
+-- Farmers hear about stock changes of their products
+CREATE FUNCTION notify_stock_event() RETURNS trigger AS $$
+BEGIN
+    IF NEW.quantity = OLD.quantity THEN
+        RETURN NEW;
+    END IF;
+    PERFORM pg_notify('events', json_build_object(
+        'type', 'stock',
+        'recipient_type', 'farmer',
+        'recipient_id', NEW.farmer_id,
+        'data', json_build_object(
+            'product_id', NEW.id,
+            'name', NEW.name,
+            'quantity', NEW.quantity,
+            'updated_at', NEW.updated_at
+        )
+    )::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER products_stock_event AFTER UPDATE ON products
+    FOR EACH ROW EXECUTE FUNCTION notify_stock_event();
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS admin_invitations;
+ALTER TABLE admins DROP COLUMN IF EXISTS role;
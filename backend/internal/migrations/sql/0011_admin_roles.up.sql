@@ -0,0 +1,21 @@
+-- Admins have one role, which decides what they may do. Existing admins had
+-- full access and keep it as super admins.
+ALTER TABLE admins ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'super_admin'
+    CHECK (role IN ('super_admin', 'moderator', 'support', 'finance'));
+ALTER TABLE admins ALTER COLUMN role DROP DEFAULT;
+
+-- New admins join through an invitation from a super admin. Only a SHA-256
+-- hash of the token is kept; the token itself is in the emailed link.
+CREATE TABLE admin_invitations (
+    id          SERIAL PRIMARY KEY,
+    email       VARCHAR(255) NOT NULL,
+    role        VARCHAR(20) NOT NULL
+        CHECK (role IN ('super_admin', 'moderator', 'support', 'finance')),
+    token_hash  CHAR(64) NOT NULL UNIQUE,
+    invited_by  INTEGER REFERENCES admins (id) ON DELETE SET NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_admin_invitations_pending ON admin_invitations (email) WHERE accepted_at IS NULL;
@@ -0,0 +1,24 @@
+CREATE OR REPLACE FUNCTION notify_notification_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('events', json_build_object(
+        'id', NEW.id,
+        'type', 'notification',
+        'recipient_type', NEW.recipient_type,
+        'recipient_id', NEW.recipient_id,
+        'data', json_build_object(
+            'id', NEW.id,
+            'recipient_type', NEW.recipient_type,
+            'recipient_id', NEW.recipient_id,
+            'notification_type', NEW.notification_type,
+            'message', LEFT(NEW.message, 4000),
+            'is_sent', NEW.is_sent,
+            'sent_at', COALESCE(NEW.sent_at, NEW.created_at),
+            'is_read', NEW.read_at IS NOT NULL,
+            'created_at', NEW.created_at
+        )
+    )::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS truncate_bytes(text, integer);
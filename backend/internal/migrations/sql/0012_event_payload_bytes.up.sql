@@ -0,0 +1,51 @@
+-- 0010 cut notification messages to 4000 characters to keep the NOTIFY
+-- payload under 8000 bytes, but a character is up to 4 bytes of UTF-8 and
+-- JSON escaping grows control characters further. An oversized payload makes
+-- pg_notify raise, which rolled back the transaction that wrote the
+-- notification. Messages are now cut by bytes, and cut shorter until the
+-- whole payload fits.
+
+-- truncate_bytes shortens value to at most max_bytes bytes without splitting a character
+CREATE FUNCTION truncate_bytes(value text, max_bytes integer) RETURNS text AS $$
+DECLARE
+    result text := LEFT(value, max_bytes);
+BEGIN
+    -- A character is at most 4 bytes, so each pass drops no more than it has to
+    WHILE octet_length(result) > max_bytes LOOP
+        result := LEFT(result, length(result) - (octet_length(result) - max_bytes + 3) / 4);
+    END LOOP;
+    RETURN result;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION notify_notification_event() RETURNS trigger AS $$
+DECLARE
+    payload text;
+    message_bytes integer := 4000;
+BEGIN
+    LOOP
+        payload := json_build_object(
+            'id', NEW.id,
+            'type', 'notification',
+            'recipient_type', NEW.recipient_type,
+            'recipient_id', NEW.recipient_id,
+            'data', json_build_object(
+                'id', NEW.id,
+                'recipient_type', NEW.recipient_type,
+                'recipient_id', NEW.recipient_id,
+                'notification_type', NEW.notification_type,
+                'message', truncate_bytes(NEW.message, message_bytes),
+                'is_sent', NEW.is_sent,
+                'sent_at', COALESCE(NEW.sent_at, NEW.created_at),
+                'is_read', NEW.read_at IS NOT NULL,
+                'created_at', NEW.created_at
+            )
+        )::text;
+        -- An escaped byte takes at most 6, so halving always ends under the limit
+        EXIT WHEN octet_length(payload) < 8000 OR message_bytes = 0;
+        message_bytes := message_bytes / 2;
+    END LOOP;
+    PERFORM pg_notify('events', payload);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,11 @@
+-- Movements of products that no longer exist cannot point at them again.
+-- Soft-deleted products stay behind as inactive ones.
+DELETE FROM inventory_movements WHERE product_id IS NULL;
+
+ALTER TABLE inventory_movements DROP CONSTRAINT inventory_movements_product_id_fkey;
+ALTER TABLE inventory_movements ADD CONSTRAINT inventory_movements_product_id_fkey
+    FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE;
+ALTER TABLE inventory_movements ALTER COLUMN product_id SET NOT NULL;
+ALTER TABLE inventory_movements DROP COLUMN product_name;
+
+ALTER TABLE products DROP COLUMN deleted_at;
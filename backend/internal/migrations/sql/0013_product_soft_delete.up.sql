@@ -0,0 +1,14 @@
+-- Deleting a product cascaded to its inventory_movements, so the stock ledger
+-- lost every sale and adjustment of the product. Products are now
+-- soft-deleted: deleted_at is set and the row stays. Deleting a farmer still
+-- removes their products, so movements keep the product's name and lose only
+-- the link to it.
+ALTER TABLE products ADD COLUMN deleted_at TIMESTAMPTZ;
+
+ALTER TABLE inventory_movements ADD COLUMN product_name VARCHAR(255);
+UPDATE inventory_movements m SET product_name = p.name FROM products p WHERE p.id = m.product_id;
+
+ALTER TABLE inventory_movements ALTER COLUMN product_id DROP NOT NULL;
+ALTER TABLE inventory_movements DROP CONSTRAINT inventory_movements_product_id_fkey;
+ALTER TABLE inventory_movements ADD CONSTRAINT inventory_movements_product_id_fkey
+    FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE SET NULL;
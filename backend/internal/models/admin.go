@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"github.com/Neroframe/FarmerMarketSystem/backend/internal/utils"
@@ -12,35 +13,90 @@ type Admin struct {
 	Email        string
 	PasswordHash string
 	IsActive     bool
+	Role         Role
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
 
-func CheckAdminExists(db *sql.DB, email string) (bool, error) {
+// ErrAdminSetupDone is returned by CreateFirstAdmin once an admin exists
+var ErrAdminSetupDone = errors.New("an admin already exists")
+
+// ErrLastSuperAdmin is returned by SetAdminRole for a change that would leave
+// no super admin
+var ErrLastSuperAdmin = errors.New("the last super admin cannot be given another role")
+
+// Can reports whether the admin's role grants permission p
+func (a *Admin) Can(p Permission) bool {
+	return a.Role.Can(p)
+}
+
+func CheckAdminExists(ctx context.Context, db *sql.DB, email string) (bool, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM admins WHERE email=$1)`
-	err := db.QueryRow(query, email).Scan(&exists)
+	err := db.QueryRowContext(ctx, query, email).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
 
-func CreateAdmin(db *sql.DB, admin *Admin) error {
+func CreateAdmin(ctx context.Context, db *sql.DB, admin *Admin) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	return insertAdmin(ctx, db, admin)
+}
+
+func insertAdmin(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}, admin *Admin) error {
 	query := `
-        INSERT INTO admins (email, password_hash, is_active, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5)
+        INSERT INTO admins (email, password_hash, is_active, role, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
         RETURNING id
     `
-	err := db.QueryRow(query, admin.Email, admin.PasswordHash, admin.IsActive, time.Now(), time.Now()).Scan(&admin.ID)
+	err := q.QueryRowContext(ctx, query, admin.Email, admin.PasswordHash, admin.IsActive, admin.Role, time.Now(), time.Now()).Scan(&admin.ID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func AuthenticateAdmin(db *sql.DB, email, password string) (*Admin, error) {
-	admin, err := GetAdminByEmail(db, email)
+// CreateFirstAdmin creates admin only while there are no admins at all. The
+// table is locked so two concurrent setups cannot both succeed.
+func CreateFirstAdmin(ctx context.Context, db *sql.DB, admin *Admin) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `LOCK TABLE admins IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		return err
+	}
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM admins)`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrAdminSetupDone
+	}
+	if err := insertAdmin(ctx, tx, admin); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func AuthenticateAdmin(ctx context.Context, db *sql.DB, email, password string) (*Admin, error) {
+	admin, err := GetAdminByEmail(ctx, db, email)
 	if err != nil {
 		return nil, errors.New("invalid email")
 	}
@@ -50,14 +106,17 @@ func AuthenticateAdmin(db *sql.DB, email, password string) (*Admin, error) {
 	return admin, nil
 }
 
-func GetAdminByEmail(db *sql.DB, email string) (*Admin, error) {
+func GetAdminByEmail(ctx context.Context, db *sql.DB, email string) (*Admin, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	admin := &Admin{}
 	query := `
-        SELECT id, email, password_hash, is_active, created_at, updated_at
+        SELECT id, email, password_hash, is_active, role, created_at, updated_at
         FROM admins
         WHERE email = $1
     `
-	err := db.QueryRow(query, email).Scan(&admin.ID, &admin.Email, &admin.PasswordHash, &admin.IsActive, &admin.CreatedAt, &admin.UpdatedAt)
+	err := db.QueryRowContext(ctx, query, email).Scan(&admin.ID, &admin.Email, &admin.PasswordHash, &admin.IsActive, &admin.Role, &admin.CreatedAt, &admin.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("admin not found")
@@ -67,14 +126,17 @@ func GetAdminByEmail(db *sql.DB, email string) (*Admin, error) {
 	return admin, nil
 }
 
-func GetAdminByID(db *sql.DB, id int) (*Admin, error) {
+func GetAdminByID(ctx context.Context, db *sql.DB, id int) (*Admin, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	admin := &Admin{}
 	query := `
-        SELECT id, email, password_hash, is_active, created_at, updated_at
+        SELECT id, email, password_hash, is_active, role, created_at, updated_at
         FROM admins
         WHERE id = $1
     `
-	err := db.QueryRow(query, id).Scan(&admin.ID, &admin.Email, &admin.PasswordHash, &admin.IsActive, &admin.CreatedAt, &admin.UpdatedAt)
+	err := db.QueryRowContext(ctx, query, id).Scan(&admin.ID, &admin.Email, &admin.PasswordHash, &admin.IsActive, &admin.Role, &admin.CreatedAt, &admin.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("admin not found")
@@ -84,21 +146,109 @@ func GetAdminByID(db *sql.DB, id int) (*Admin, error) {
 	return admin, nil
 }
 
-func UpdateAdmin(db *sql.DB, admin *Admin) error {
+// GetAllAdmins lists the admins by email, without their password hashes
+func GetAllAdmins(ctx context.Context, db *sql.DB) ([]Admin, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, email, is_active, role, created_at, updated_at
+		FROM admins
+		ORDER BY email
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var admins []Admin
+	for rows.Next() {
+		var admin Admin
+		err := rows.Scan(&admin.ID, &admin.Email, &admin.IsActive, &admin.Role, &admin.CreatedAt, &admin.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		admins = append(admins, admin)
+	}
+	return admins, rows.Err()
+}
+
+// SetAdminRole changes an admin's role; it returns sql.ErrNoRows for an
+// unknown admin and ErrLastSuperAdmin if no super admin would be left. The
+// admins are locked, so two super admins demoting each other at the same time
+// cannot both succeed.
+func SetAdminRole(ctx context.Context, db *sql.DB, id int, role Role) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, role FROM admins ORDER BY id FOR UPDATE`)
+	if err != nil {
+		return err
+	}
+	found := false
+	superAdmins := 0
+	for rows.Next() {
+		var adminID int
+		var current Role
+		if err := rows.Scan(&adminID, &current); err != nil {
+			rows.Close()
+			return err
+		}
+		if adminID == id {
+			found = true
+			current = role
+		}
+		if current == RoleSuperAdmin {
+			superAdmins++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return sql.ErrNoRows
+	}
+	if superAdmins == 0 {
+		return ErrLastSuperAdmin
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE admins SET role = $1, updated_at = NOW() WHERE id = $2
+	`, role, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func UpdateAdmin(ctx context.Context, db *sql.DB, admin *Admin) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
         UPDATE admins
         SET email = $1, password_hash = $2, is_active = $3, updated_at = $4
         WHERE id = $5
     `
-	_, err := db.Exec(query, admin.Email, admin.PasswordHash, admin.IsActive, time.Now(), admin.ID)
+	_, err := db.ExecContext(ctx, query, admin.Email, admin.PasswordHash, admin.IsActive, time.Now(), admin.ID)
 	return err
 }
 
-func DeleteAdmin(db *sql.DB, id int) error {
+func DeleteAdmin(ctx context.Context, db *sql.DB, id int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
         DELETE FROM admins
         WHERE id = $1
     `
-	_, err := db.Exec(query, id)
+	_, err := db.ExecContext(ctx, query, id)
 	return err
 }
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrAdminExists is returned when an invitation is accepted for an email that
+// already belongs to an admin, such as one created after the invitation went out
+var ErrAdminExists = errors.New("an admin with this email already exists")
+
+// AdminInvitation lets the holder of its token create an admin account with
+// Email and Role. Only the hash of the token is saved.
+type AdminInvitation struct {
+	ID         int
+	Email      string
+	Role       Role
+	TokenHash  string
+	InvitedBy  int
+	ExpiresAt  time.Time
+	AcceptedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// NewAdminInvitation creates an invitation that is valid for ttl and returns
+// it with its token, which goes in the invitation link; it still has to be saved
+func NewAdminInvitation(email string, role Role, invitedBy int, ttl time.Duration) (*AdminInvitation, string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, "", err
+	}
+	token := hex.EncodeToString(bytes)
+
+	return &AdminInvitation{
+		Email:     email,
+		Role:      role,
+		TokenHash: HashInvitationToken(token),
+		InvitedBy: invitedBy,
+		ExpiresAt: time.Now().Add(ttl),
+	}, token, nil
+}
+
+// HashInvitationToken is how an invitation token is looked up
+func HashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Usable reports whether the invitation can still be accepted
+func (i *AdminInvitation) Usable() bool {
+	return i.AcceptedAt == nil && time.Now().Before(i.ExpiresAt)
+}
+
+// CreateAdminInvitation saves the invitation and queues the outbox entries in
+// the same transaction. Earlier invitations to the same email that were not
+// accepted are withdrawn, so only the newest link works.
+func CreateAdminInvitation(ctx context.Context, db *sql.DB, invitation *AdminInvitation, outbox ...OutboxEntry) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM admin_invitations WHERE email = $1 AND accepted_at IS NULL
+	`, invitation.Email)
+	if err != nil {
+		return err
+	}
+
+	invitation.CreatedAt = time.Now()
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO admin_invitations (email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, invitation.Email, invitation.Role, invitation.TokenHash, invitation.InvitedBy, invitation.ExpiresAt, invitation.CreatedAt).Scan(&invitation.ID)
+	if err != nil {
+		return err
+	}
+	if err := enqueueOutbox(ctx, tx, outbox); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAdminInvitationByToken looks up an invitation by the hash of its token,
+// whether or not it can still be used
+func GetAdminInvitationByToken(ctx context.Context, db *sql.DB, tokenHash string) (*AdminInvitation, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var invitation AdminInvitation
+	var invitedBy sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+		SELECT id, email, role, token_hash, invited_by, expires_at, accepted_at, created_at
+		FROM admin_invitations
+		WHERE token_hash = $1
+	`, tokenHash).Scan(&invitation.ID, &invitation.Email, &invitation.Role, &invitation.TokenHash, &invitedBy,
+		&invitation.ExpiresAt, &invitation.AcceptedAt, &invitation.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	invitation.InvitedBy = int(invitedBy.Int64)
+	return &invitation, nil
+}
+
+// GetPendingAdminInvitations lists the invitations that can still be accepted, newest first
+func GetPendingAdminInvitations(ctx context.Context, db *sql.DB) ([]AdminInvitation, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, email, role, token_hash, invited_by, expires_at, created_at
+		FROM admin_invitations
+		WHERE accepted_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []AdminInvitation
+	for rows.Next() {
+		var invitation AdminInvitation
+		var invitedBy sql.NullInt64
+		err := rows.Scan(&invitation.ID, &invitation.Email, &invitation.Role, &invitation.TokenHash, &invitedBy,
+			&invitation.ExpiresAt, &invitation.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		invitation.InvitedBy = int(invitedBy.Int64)
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+// AcceptAdminInvitation marks the invitation accepted and creates admin with
+// the invitation's email and role in one transaction. It returns
+// sql.ErrNoRows when the invitation was already used, withdrawn or expired.
+func AcceptAdminInvitation(ctx context.Context, db *sql.DB, invitationID int, admin *Admin) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE admin_invitations SET accepted_at = NOW()
+		WHERE id = $1 AND accepted_at IS NULL AND expires_at > NOW()
+		RETURNING email, role
+	`, invitationID).Scan(&admin.Email, &admin.Role)
+	if err != nil {
+		return err
+	}
+	if err := insertAdmin(ctx, tx, admin); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrAdminExists
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteAdminInvitation withdraws an invitation that was not accepted yet
+func DeleteAdminInvitation(ctx context.Context, db *sql.DB, id int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM admin_invitations WHERE id = $1 AND accepted_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
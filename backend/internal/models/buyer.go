@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"time"
@@ -15,12 +16,16 @@ type Buyer struct {
 	DeliveryAddress     string                 `json:"delivery_address"`
 	DeliveryPreferences map[string]interface{} `json:"delivery_preferences"`
 	IsActive            bool                   `json:"is_active"`
+	Locale              string                 `json:"locale,omitempty"`
 	CreatedAt           time.Time              `json:"created_at"`
 	UpdatedAt           time.Time              `json:"updated_at"`
 }
 
-func GetAllBuyers(db *sql.DB) ([]Buyer, error) {
-	rows, err := db.Query(`
+func GetAllBuyers(ctx context.Context, db *sql.DB) ([]Buyer, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
 		SELECT id, email, first_name, last_name, delivery_address, delivery_preferences, is_active, created_at, updated_at
 		FROM buyers
 	`)
@@ -67,12 +72,15 @@ func GetAllBuyers(db *sql.DB) ([]Buyer, error) {
 	return buyers, nil
 }
 
-func GetBuyerByID(db *sql.DB, buyerID int) (*Buyer, error) {
+func GetBuyerByID(ctx context.Context, db *sql.DB, buyerID int) (*Buyer, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var buyer Buyer
 	var deliveryPreferencesJSON []byte
 
-	err := db.QueryRow(`
-		SELECT id, email, first_name, last_name, delivery_address, delivery_preferences, is_active, created_at, updated_at
+	err := db.QueryRowContext(ctx, `
+		SELECT id, email, first_name, last_name, delivery_address, delivery_preferences, is_active, COALESCE(locale, ''), created_at, updated_at
 		FROM buyers
 		WHERE id = $1`, buyerID).
 		Scan(
@@ -83,6 +91,7 @@ func GetBuyerByID(db *sql.DB, buyerID int) (*Buyer, error) {
 			&buyer.DeliveryAddress,
 			&deliveryPreferencesJSON,
 			&buyer.IsActive,
+			&buyer.Locale,
 			&buyer.CreatedAt,
 			&buyer.UpdatedAt,
 		)
@@ -101,8 +110,11 @@ func GetBuyerByID(db *sql.DB, buyerID int) (*Buyer, error) {
 	return &buyer, nil
 }
 
-func UpdateBuyer(db *sql.DB, buyer Buyer) error {
-	_, err := db.Exec(`
+func UpdateBuyer(ctx context.Context, db *sql.DB, buyer Buyer) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
         UPDATE buyers
         SET email = $1, first_name = $2, last_name = $3, delivery_address = $4, is_active = $5, updated_at = $6
         WHERE id = $7`,
@@ -111,12 +123,15 @@ func UpdateBuyer(db *sql.DB, buyer Buyer) error {
 	return err
 }
 
-func GetBuyerByEmail(db *sql.DB, email string) (*Buyer, error) {
+func GetBuyerByEmail(ctx context.Context, db *sql.DB, email string) (*Buyer, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var buyer Buyer
 	var deliveryPreferencesJSON []byte
 
-	err := db.QueryRow(`
-		SELECT id, email, password_hash, first_name, last_name, delivery_address, delivery_preferences, is_active, created_at, updated_at
+	err := db.QueryRowContext(ctx, `
+		SELECT id, email, password_hash, first_name, last_name, delivery_address, delivery_preferences, is_active, COALESCE(locale, ''), created_at, updated_at
 		FROM buyers
 		WHERE email = $1`, email).
 		Scan(
@@ -128,6 +143,7 @@ func GetBuyerByEmail(db *sql.DB, email string) (*Buyer, error) {
 			&buyer.DeliveryAddress,
 			&deliveryPreferencesJSON,
 			&buyer.IsActive,
+			&buyer.Locale,
 			&buyer.CreatedAt,
 			&buyer.UpdatedAt,
 		)
@@ -146,7 +162,10 @@ func GetBuyerByEmail(db *sql.DB, email string) (*Buyer, error) {
 	return &buyer, nil
 }
 
-func CreateBuyer(db *sql.DB, buyer *Buyer) error {
+func CreateBuyer(ctx context.Context, db *sql.DB, buyer *Buyer) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	deliveryPreferencesJSON, err := json.Marshal(buyer.DeliveryPreferences)
 	if err != nil {
 		return err
@@ -161,14 +180,15 @@ func CreateBuyer(db *sql.DB, buyer *Buyer) error {
 			delivery_address, 
 			delivery_preferences, 
 			is_active, 
+			locale,
 			created_at, 
 			updated_at
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9
+			$1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10
 		) RETURNING id
 	`
 
-	err = db.QueryRow(query,
+	err = db.QueryRowContext(ctx, query,
 		buyer.Email,
 		buyer.PasswordHash,
 		buyer.FirstName,
@@ -176,6 +196,7 @@ func CreateBuyer(db *sql.DB, buyer *Buyer) error {
 		buyer.DeliveryAddress,
 		deliveryPreferencesJSON,
 		buyer.IsActive,
+		buyer.Locale,
 		time.Now(),
 		time.Now(),
 	).Scan(&buyer.ID)
@@ -188,3 +209,24 @@ func CreateBuyer(db *sql.DB, buyer *Buyer) error {
 }
 
 
+func SetBuyerActive(ctx context.Context, db *sql.DB, buyerID int, isActive bool) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `UPDATE buyers SET is_active = $1, updated_at = $2 WHERE id = $3`, isActive, time.Now(), buyerID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func DeleteBuyer(ctx context.Context, db *sql.DB, buyerID int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `DELETE FROM buyers WHERE id = $1`, buyerID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
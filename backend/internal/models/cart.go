@@ -2,13 +2,25 @@
 package models
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"errors"
-	"strconv"
+	"fmt"
+	"time"
 
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
 	"github.com/lib/pq"
 )
 
+// ErrEmptyCart is returned when a buyer checks out with nothing in their cart
+var ErrEmptyCart = errors.New("cart is empty")
+
+// ErrCartChanged is returned by Checkout when the cart's total changed while
+// the card payment was being authorized
+var ErrCartChanged = errors.New("cart changed during checkout")
+
 // CartItem represents an individual item in the cart
 type CartItem struct {
 	Product  Product `json:"product"`
@@ -16,7 +28,10 @@ type CartItem struct {
 }
 
 // GetCartByBuyerID retrieves all cart items for a specific buyer
-func GetCartByBuyerID(db *sql.DB, buyerID int) ([]CartItem, error) {
+func GetCartByBuyerID(ctx context.Context, db *sql.DB, buyerID int) ([]CartItem, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT 
 			p.id, 
@@ -25,6 +40,7 @@ func GetCartByBuyerID(db *sql.DB, buyerID int) ([]CartItem, error) {
 			p.category_id, 
 			p.price, 
 			p.quantity, 
+			` + availableQuantityColumn("p") + `,
 			p.description, 
 			p.is_active, 
 			p.created_at, 
@@ -38,7 +54,7 @@ func GetCartByBuyerID(db *sql.DB, buyerID int) ([]CartItem, error) {
 		GROUP BY p.id, p.farmer_id, p.name, p.category_id, p.price, p.quantity, p.description, p.is_active, p.created_at, p.updated_at, ci.quantity
 	`
 
-	rows, err := db.Query(query, buyerID)
+	rows, err := db.QueryContext(ctx, query, buyerID)
 	if err != nil {
 		return nil, err
 	}
@@ -57,6 +73,7 @@ func GetCartByBuyerID(db *sql.DB, buyerID int) ([]CartItem, error) {
 			&product.CategoryID,
 			&product.Price,
 			&product.Quantity,
+			&product.Available,
 			&product.Description,
 			&product.IsActive,
 			&product.CreatedAt,
@@ -83,44 +100,62 @@ func GetCartByBuyerID(db *sql.DB, buyerID int) ([]CartItem, error) {
 	return cartItems, nil
 }
 
-// AddProductToCart adds a product to the buyer's cart or updates the quantity if it already exists
-func AddProductToCart(db *sql.DB, buyerID, productID, quantity int) error {
+// AddProductToCart adds a product to the buyer's cart or updates the quantity if it already exists.
+// The new cart quantity must fit in the stock not held by other buyers; with a
+// positive reserveFor the buyer's own hold is extended to cover it.
+func AddProductToCart(ctx context.Context, db *sql.DB, buyerID, productID, quantity int, reserveFor time.Duration) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	if quantity < 1 {
 		return errors.New("quantity must be at least 1")
 	}
 
 	// Start a transaction
-	tx, err := db.Begin()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	available, err := lockAvailableStock(ctx, tx, productID, buyerID)
+	if err != nil {
+		return err
+	}
+
 	// Check if the product is already in the cart
 	var existingQuantity int
 	checkQuery := `SELECT quantity FROM cart_items WHERE buyer_id = $1 AND product_id = $2`
-	err = tx.QueryRow(checkQuery, buyerID, productID).Scan(&existingQuantity)
+	err = tx.QueryRowContext(ctx, checkQuery, buyerID, productID).Scan(&existingQuantity)
 
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
 
+	if existingQuantity+quantity > available {
+		return ErrInsufficientStock
+	}
+
 	if err == sql.ErrNoRows {
 		// Insert new cart item
 		insertQuery := `INSERT INTO cart_items (buyer_id, product_id, quantity) VALUES ($1, $2, $3)`
-		_, err := tx.Exec(insertQuery, buyerID, productID, quantity)
+		_, err := tx.ExecContext(ctx, insertQuery, buyerID, productID, quantity)
 		if err != nil {
 			return err
 		}
 	} else {
 		// Update existing cart item
 		updateQuery := `UPDATE cart_items SET quantity = quantity + $1 WHERE buyer_id = $2 AND product_id = $3`
-		_, err := tx.Exec(updateQuery, quantity, buyerID, productID)
+		_, err := tx.ExecContext(ctx, updateQuery, quantity, buyerID, productID)
 		if err != nil {
 			return err
 		}
 	}
 
+	if err := reserveStock(ctx, tx, buyerID, productID, existingQuantity+quantity, reserveFor); err != nil {
+		return err
+	}
+
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
 		return err
@@ -129,10 +164,19 @@ func AddProductToCart(db *sql.DB, buyerID, productID, quantity int) error {
 	return nil
 }
 
-// RemoveProductFromCart removes a product from the buyer's cart
-func RemoveProductFromCart(db *sql.DB, buyerID, productID int) error {
+// RemoveProductFromCart removes a product from the buyer's cart and releases its hold
+func RemoveProductFromCart(ctx context.Context, db *sql.DB, buyerID, productID int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `DELETE FROM cart_items WHERE buyer_id = $1 AND product_id = $2`
-	res, err := db.Exec(query, buyerID, productID)
+	res, err := tx.ExecContext(ctx, query, buyerID, productID)
 	if err != nil {
 		return err
 	}
@@ -145,23 +189,45 @@ func RemoveProductFromCart(db *sql.DB, buyerID, productID int) error {
 		return errors.New("product not found in cart")
 	}
 
-	return nil
+	if err := releaseReservation(ctx, tx, buyerID, productID, "removed from cart"); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// UpdateCartItem updates the quantity of a product in the buyer's cart
-func UpdateCartItem(db *sql.DB, buyerID, productID, quantity int) error {
+// UpdateCartItem updates the quantity of a product in the buyer's cart, subject
+// to the same stock check and hold as AddProductToCart
+func UpdateCartItem(ctx context.Context, db *sql.DB, buyerID, productID, quantity int, reserveFor time.Duration) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	if quantity < 0 {
 		return errors.New("quantity cannot be negative")
 	}
 
 	if quantity == 0 {
 		// Remove the item from the cart
-		return RemoveProductFromCart(db, buyerID, productID)
+		return RemoveProductFromCart(ctx, db, buyerID, productID)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	available, err := lockAvailableStock(ctx, tx, productID, buyerID)
+	if err != nil {
+		return err
+	}
+	if quantity > available {
+		return ErrInsufficientStock
 	}
 
 	// Update the quantity
 	query := `UPDATE cart_items SET quantity = $1 WHERE buyer_id = $2 AND product_id = $3`
-	res, err := db.Exec(query, quantity, buyerID, productID)
+	res, err := tx.ExecContext(ctx, query, quantity, buyerID, productID)
 	if err != nil {
 		return err
 	}
@@ -174,27 +240,125 @@ func UpdateCartItem(db *sql.DB, buyerID, productID, quantity int) error {
 		return errors.New("product not found in cart")
 	}
 
-	return nil
+	if err := reserveStock(ctx, tx, buyerID, productID, quantity, reserveFor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CheckoutOptions carries the buyer's choices made at checkout
+type CheckoutOptions struct {
+	// DeliveryMethods maps farmer ID to "delivery" or "pickup"; missing farmers
+	// default to pickup for pay_at_pickup orders and delivery otherwise
+	DeliveryMethods map[int]string
+
+	// PaymentMethod is "card" (the default), "cash_on_delivery" or "pay_at_pickup".
+	// Only card payments go through the provider.
+	PaymentMethod string
+	Payments      payments.PaymentProvider
+	PaymentToken  string
+	Currency      string
+}
+
+// Checkout converts the buyer's cart into an order split into one sub-order per
+// farmer, deducting stock and clearing the cart in the same transaction.
+// Card payments are authorized before any row is locked, for the cart's total
+// at that moment; if the order then cannot be placed, or the total changed in
+// between, the authorization is voided. Cash orders are placed unpaid and
+// settled by the farmer. Returns the new order ID.
+func Checkout(ctx context.Context, db *sql.DB, buyerID int, opts CheckoutOptions) (int, error) {
+	if opts.PaymentMethod == "" {
+		opts.PaymentMethod = PaymentMethodCard
+	}
+	if !IsValidPaymentMethod(opts.PaymentMethod) {
+		return 0, fmt.Errorf("invalid payment method %q", opts.PaymentMethod)
+	}
+
+	var payment *Payment
+	if opts.PaymentMethod == PaymentMethodCard {
+		var err error
+		payment, err = authorizeCart(ctx, db, buyerID, opts)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	orderID, err := placeCart(ctx, db, buyerID, opts, payment)
+	if err != nil && payment != nil {
+		voidAuthorization(ctx, db, opts.Payments, payment.ProviderRef)
+	}
+	return orderID, err
 }
 
-func Checkout(db *sql.DB, buyerID int) error {
+// authorizeCart holds the current total of the buyer's cart on their card. It
+// reads the cart without locking it; placeCart checks the total again.
+func authorizeCart(ctx context.Context, db *sql.DB, buyerID int, opts CheckoutOptions) (*Payment, error) {
+	var total float64
+	var items int
+	queryCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	err := db.QueryRowContext(queryCtx, `
+		SELECT COALESCE(SUM(p.price * ci.quantity), 0), COUNT(*)
+		FROM cart_items ci
+		JOIN products p ON p.id = ci.product_id
+		WHERE ci.buyer_id = $1 AND p.deleted_at IS NULL
+	`, buyerID).Scan(&total, &items)
+	if err != nil {
+		return nil, err
+	}
+	if items == 0 {
+		return nil, ErrEmptyCart
+	}
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	auth, err := opts.Payments.Authorize(ctx, payments.AuthorizeRequest{
+		Amount:         payments.ToMinorUnits(total),
+		Currency:       opts.Currency,
+		Token:          opts.PaymentToken,
+		IdempotencyKey: "checkout-" + hex.EncodeToString(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Payment{
+		Provider:    opts.Payments.Name(),
+		ProviderRef: auth.ID,
+		Amount:      payments.FromMinorUnits(payments.ToMinorUnits(total)),
+		Currency:    opts.Currency,
+		Status:      PaymentStatusAuthorized,
+	}, nil
+}
+
+// placeCart records the order in one transaction. payment is the card
+// authorization for it, nil for cash orders.
+func placeCart(ctx context.Context, db *sql.DB, buyerID int, opts CheckoutOptions, payment *Payment) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	// Start a transaction
-	tx, err := db.Begin()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
-	// Lock the cart items for update
+	// Lock the cart items for update, in product order so the product rows
+	// below are locked in the same order as by any other checkout
 	queryCart := `
         SELECT ci.product_id, ci.quantity
         FROM cart_items ci
         WHERE ci.buyer_id = $1
+        ORDER BY ci.product_id
         FOR UPDATE
     `
-	rows, err := tx.Query(queryCart, buyerID)
+	rows, err := tx.QueryContext(ctx, queryCart, buyerID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer rows.Close()
 
@@ -207,64 +371,112 @@ func Checkout(db *sql.DB, buyerID int) error {
 	for rows.Next() {
 		var cp CartProduct
 		if err := rows.Scan(&cp.ProductID, &cp.Quantity); err != nil {
-			return err
+			return 0, err
 		}
 		cartProducts = append(cartProducts, cp)
 	}
 
 	if err = rows.Err(); err != nil {
-		return err
+		return 0, err
 	}
 
 	if len(cartProducts) == 0 {
-		return errors.New("cart is empty")
+		return 0, ErrEmptyCart
+	}
+
+	order := &Order{
+		BuyerID:       buyerID,
+		Status:        OrderStatusPendingPayment,
+		PaymentMethod: opts.PaymentMethod,
 	}
 
 	// Process each cart item
 	for _, cp := range cartProducts {
-		// Check product availability
-		var availableQuantity int
+		// Check product availability and snapshot its current details
+		var farmerID int
+		var name string
+		var price float64
 		checkProductQuery := `
-            SELECT quantity
+            SELECT farmer_id, name, price
             FROM products
             WHERE id = $1
-            FOR UPDATE
         `
-		err := tx.QueryRow(checkProductQuery, cp.ProductID).Scan(&availableQuantity)
+		availableQuantity, err := lockAvailableStock(ctx, tx, cp.ProductID, buyerID)
 		if err != nil {
-			return err
+			return 0, err
+		}
+		err = tx.QueryRowContext(ctx, checkProductQuery, cp.ProductID).Scan(&farmerID, &name, &price)
+		if err != nil {
+			return 0, err
 		}
 
 		if availableQuantity < cp.Quantity {
-			return errors.New("insufficient quantity for product ID " + strconv.Itoa(cp.ProductID))
+			return 0, fmt.Errorf("%w for product ID %d", ErrInsufficientStock, cp.ProductID)
 		}
 
-		// Deduct the quantity from the product
-		updateProductQuery := `
-            UPDATE products
-            SET quantity = quantity - $1
-            WHERE id = $2
-        `
-		_, err = tx.Exec(updateProductQuery, cp.Quantity, cp.ProductID)
+		order.Items = append(order.Items, OrderItem{
+			ProductID:   cp.ProductID,
+			FarmerID:    farmerID,
+			ProductName: name,
+			UnitPrice:   price,
+			Quantity:    cp.Quantity,
+		})
+	}
+
+	// Record the order and its line items
+	if err := createOrder(ctx, tx, order, opts.DeliveryMethods); err != nil {
+		return 0, err
+	}
+
+	// Deduct the quantities, recording each sale against the new order
+	for _, item := range order.Items {
+		err := adjustStock(ctx, tx, item.ProductID, -item.Quantity, InventoryMovement{
+			MovementType: MovementSale,
+			ActorType:    "buyer",
+			ActorID:      buyerID,
+			OrderID:      order.ID,
+		})
 		if err != nil {
-			return err
+			return 0, err
+		}
+	}
+
+	if payment != nil {
+		// The cart was read unlocked for the authorization and may have changed since
+		if payments.ToMinorUnits(order.TotalAmount) != payments.ToMinorUnits(payment.Amount) {
+			return 0, ErrCartChanged
+		}
+		payment.OrderID = order.ID
+		if err := createPayment(ctx, tx, payment); err != nil {
+			return 0, err
 		}
 	}
 
+	if err := placeOrder(ctx, tx, order); err != nil {
+		return 0, err
+	}
+
 	// Clear the cart
+	if err := clearCart(ctx, tx, buyerID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return order.ID, nil
+}
+
+// clearCart empties the buyer's cart after checkout and drops their holds; the
+// stock itself was already deducted
+func clearCart(ctx context.Context, tx *sql.Tx, buyerID int) error {
 	clearCartQuery := `
         DELETE FROM cart_items
         WHERE buyer_id = $1
     `
-	_, err = tx.Exec(clearCartQuery, buyerID)
+	_, err := tx.ExecContext(ctx, clearCartQuery, buyerID)
 	if err != nil {
 		return err
 	}
-
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
+	return releaseReservation(ctx, tx, buyerID, 0, "checked out")
 }
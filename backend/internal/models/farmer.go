@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"time"
 )
@@ -16,12 +17,16 @@ type Farmer struct {
 	Location     string
 	Status       string // "pending", "approved", or "rejected"
 	IsActive     bool   // Active or inactive status
+	Locale       string // Preferred email language; empty for the default
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
 
-func GetPendingFarmers(db *sql.DB) ([]Farmer, error) {
-	rows, err := db.Query(`
+func GetPendingFarmers(ctx context.Context, db *sql.DB) ([]Farmer, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
 		SELECT id, email, first_name, last_name, farm_name, farm_size, location, status, created_at
 		FROM farmers
 		WHERE status = 'pending'
@@ -58,13 +63,16 @@ func GetPendingFarmers(db *sql.DB) ([]Farmer, error) {
 	return farmers, nil
 }
 
-func GetFarmerByID(db *sql.DB, farmerID int) (*Farmer, error) {
+func GetFarmerByID(ctx context.Context, db *sql.DB, farmerID int) (*Farmer, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var farmer Farmer
-	err := db.QueryRow(`
-        SELECT id, email, first_name, last_name, farm_name, farm_size, location, status, is_active, created_at, updated_at
+	err := db.QueryRowContext(ctx, `
+        SELECT id, email, first_name, last_name, farm_name, farm_size, location, status, is_active, COALESCE(locale, ''), created_at, updated_at
         FROM farmers
         WHERE id = $1`, farmerID).
-		Scan(&farmer.ID, &farmer.Email, &farmer.FirstName, &farmer.LastName, &farmer.FarmName, &farmer.FarmSize, &farmer.Location, &farmer.Status, &farmer.IsActive, &farmer.CreatedAt, &farmer.UpdatedAt)
+		Scan(&farmer.ID, &farmer.Email, &farmer.FirstName, &farmer.LastName, &farmer.FarmName, &farmer.FarmSize, &farmer.Location, &farmer.Status, &farmer.IsActive, &farmer.Locale, &farmer.CreatedAt, &farmer.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -72,8 +80,11 @@ func GetFarmerByID(db *sql.DB, farmerID int) (*Farmer, error) {
 	return &farmer, nil
 }
 
-func GetAllFarmers(db *sql.DB) ([]Farmer, error) {
-	rows, err := db.Query(`
+func GetAllFarmers(ctx context.Context, db *sql.DB) ([]Farmer, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
 		SELECT id, email, first_name, last_name, farm_name, farm_size, location, status, is_active, created_at
 		FROM farmers
 	`)
@@ -105,8 +116,11 @@ func GetAllFarmers(db *sql.DB) ([]Farmer, error) {
 	return farmers, nil
 }
 
-func UpdateFarmer(db *sql.DB, farmer Farmer) error {
-	_, err := db.Exec(`
+func UpdateFarmer(ctx context.Context, db *sql.DB, farmer Farmer) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
         UPDATE farmers
         SET email = $1, first_name = $2, last_name = $3, farm_name = $4, farm_size = $5, location = $6, status = $7, is_active = $8, updated_at = $9
         WHERE id = $10`,
@@ -115,39 +129,48 @@ func UpdateFarmer(db *sql.DB, farmer Farmer) error {
 	return err
 }
 
-func CheckFarmerExists(db *sql.DB, email string) (bool, error) {
+func CheckFarmerExists(ctx context.Context, db *sql.DB, email string) (bool, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM farmers WHERE email=$1)`
-	err := db.QueryRow(query, email).Scan(&exists)
+	err := db.QueryRowContext(ctx, query, email).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
 
-func CreateFarmer(db *sql.DB, farmer *Farmer) error {
+func CreateFarmer(ctx context.Context, db *sql.DB, farmer *Farmer) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
-		INSERT INTO farmers (email, password_hash, first_name, last_name, farm_name, farm_size, location, status, is_active, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO farmers (email, password_hash, first_name, last_name, farm_name, farm_size, location, status, is_active, locale, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12)
 		RETURNING id
 	`
-	err := db.QueryRow(query, farmer.Email, farmer.PasswordHash, farmer.FirstName, farmer.LastName, farmer.FarmName, farmer.FarmSize, farmer.Location, "pending", false, time.Now(), time.Now()).Scan(&farmer.ID)
+	err := db.QueryRowContext(ctx, query, farmer.Email, farmer.PasswordHash, farmer.FirstName, farmer.LastName, farmer.FarmName, farmer.FarmSize, farmer.Location, "pending", false, farmer.Locale, time.Now(), time.Now()).Scan(&farmer.ID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetFarmerByEmail(db *sql.DB, email string) (*Farmer, error) {
+func GetFarmerByEmail(ctx context.Context, db *sql.DB, email string) (*Farmer, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var farmer Farmer
-	err := db.QueryRow(`
-		SELECT id, email, password_hash, first_name, last_name, farm_name, farm_size, location, status, is_active, created_at, updated_at
+	err := db.QueryRowContext(ctx, `
+		SELECT id, email, password_hash, first_name, last_name, farm_name, farm_size, location, status, is_active, COALESCE(locale, ''), created_at, updated_at
 		FROM farmers
 		WHERE email = $1
 	`, email).Scan(
 		&farmer.ID, &farmer.Email, &farmer.PasswordHash, &farmer.FirstName, &farmer.LastName,
 		&farmer.FarmName, &farmer.FarmSize, &farmer.Location, &farmer.Status,
-		&farmer.IsActive, &farmer.CreatedAt, &farmer.UpdatedAt,
+		&farmer.IsActive, &farmer.Locale, &farmer.CreatedAt, &farmer.UpdatedAt,
 	)
 
 	if err != nil {
@@ -156,3 +179,76 @@ func GetFarmerByEmail(db *sql.DB, email string) (*Farmer, error) {
 
 	return &farmer, nil
 }
+
+// ApproveFarmer marks a pending farmer as approved and queues the outbox
+// entries (the approval email and notification) in the same transaction
+func ApproveFarmer(ctx context.Context, db *sql.DB, farmerID int, outbox ...OutboxEntry) error {
+	return updateFarmerWithOutbox(ctx, db, outbox, `
+		UPDATE farmers SET status = $1, approved_at = $2, updated_at = $2 WHERE id = $3
+	`, "approved", time.Now(), farmerID)
+}
+
+// RejectFarmer marks a farmer as rejected with the reason shown to them and
+// queues the outbox entries in the same transaction
+func RejectFarmer(ctx context.Context, db *sql.DB, farmerID int, reason string, outbox ...OutboxEntry) error {
+	return updateFarmerWithOutbox(ctx, db, outbox, `
+		UPDATE farmers SET status = $1, rejection_reason = $2, updated_at = $3 WHERE id = $4
+	`, "rejected", reason, time.Now(), farmerID)
+}
+
+func updateFarmerWithOutbox(ctx context.Context, db *sql.DB, outbox []OutboxEntry, query string, args ...interface{}) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if err := requireRow(res); err != nil {
+		return err
+	}
+	if err := enqueueOutbox(ctx, tx, outbox); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func SetFarmerActive(ctx context.Context, db *sql.DB, farmerID int, isActive bool) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `UPDATE farmers SET is_active = $1, updated_at = $2 WHERE id = $3`, isActive, time.Now(), farmerID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func DeleteFarmer(ctx context.Context, db *sql.DB, farmerID int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `DELETE FROM farmers WHERE id = $1`, farmerID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+// requireRow turns an update or delete that matched nothing into sql.ErrNoRows
+func requireRow(res sql.Result) error {
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
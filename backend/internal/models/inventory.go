@@ -0,0 +1,137 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	MovementSale               = "sale"
+	MovementRestock            = "restock"
+	MovementAdjustment         = "adjustment"
+	MovementRefundReturn       = "refund_return"
+	MovementCancellationReturn = "cancellation_return"
+	MovementReservation        = "reservation"
+	MovementReservationRelease = "reservation_release"
+)
+
+// InventoryMovement is one row of a product's stock ledger. QuantityChange is
+// the signed change to products.quantity and Balance the quantity afterwards.
+// Reservation rows record units held or released in carts: their
+// QuantityChange is the change in held units and Balance is left as is.
+type InventoryMovement struct {
+	ID             int       `json:"id"`
+	ProductID      int       `json:"product_id"`
+	MovementType   string    `json:"movement_type"`
+	QuantityChange int       `json:"quantity_change"`
+	Balance        int       `json:"balance"`
+	ActorType      string    `json:"actor_type"`
+	ActorID        int       `json:"actor_id"`
+	Reason         string    `json:"reason,omitempty"`
+	OrderID        int       `json:"order_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// adjustStock changes a product's quantity by delta and records the movement
+// with the resulting balance. The product row should already be locked when
+// the change depends on its current quantity. A deleted product is left
+// alone and sql.ErrNoRows returned.
+func adjustStock(ctx context.Context, tx *sql.Tx, productID, delta int, m InventoryMovement) error {
+	var balance int
+	err := tx.QueryRowContext(ctx, `
+		UPDATE products SET quantity = quantity + $1, updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL
+		RETURNING quantity
+	`, delta, productID).Scan(&balance)
+	if err != nil {
+		return err
+	}
+
+	m.ProductID = productID
+	m.QuantityChange = delta
+	m.Balance = balance
+	return recordInventoryMovement(ctx, tx, m)
+}
+
+func recordInventoryMovement(ctx context.Context, tx *sql.Tx, m InventoryMovement) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO inventory_movements (product_id, product_name, movement_type, quantity_change, balance, actor_type, actor_id, reason, order_id, created_at)
+		VALUES ($1, (SELECT name FROM products WHERE id = $1), $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, 0), $9)
+	`, m.ProductID, m.MovementType, m.QuantityChange, m.Balance, m.ActorType, m.ActorID, m.Reason, m.OrderID, time.Now())
+	return err
+}
+
+// recordReservationMovement logs a change in the units held in carts for a product
+func recordReservationMovement(ctx context.Context, tx *sql.Tx, productID, heldChange int, movementType, actorType string, actorID int, reason string) error {
+	if heldChange == 0 {
+		return nil
+	}
+
+	var balance int
+	if err := tx.QueryRowContext(ctx, `SELECT quantity FROM products WHERE id = $1`, productID).Scan(&balance); err != nil {
+		return err
+	}
+
+	return recordInventoryMovement(ctx, tx, InventoryMovement{
+		ProductID:      productID,
+		MovementType:   movementType,
+		QuantityChange: heldChange,
+		Balance:        balance,
+		ActorType:      actorType,
+		ActorID:        actorID,
+		Reason:         reason,
+	})
+}
+
+// GetProductFarmerID returns the owner of a product, including inactive and
+// deleted ones, so the stock ledger of a deleted product stays readable
+func GetProductFarmerID(ctx context.Context, db *sql.DB, productID int) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var farmerID int
+	err := db.QueryRowContext(ctx, `SELECT farmer_id FROM products WHERE id = $1`, productID).Scan(&farmerID)
+	return farmerID, err
+}
+
+// GetInventoryMovements returns a product's stock ledger, newest first
+func GetInventoryMovements(ctx context.Context, db *sql.DB, productID, limit, offset int) ([]InventoryMovement, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var total int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM inventory_movements WHERE product_id = $1`, productID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("GetInventoryMovements: error counting rows: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, product_id, movement_type, quantity_change, balance, actor_type, actor_id,
+			COALESCE(reason, ''), COALESCE(order_id, 0), created_at
+		FROM inventory_movements
+		WHERE product_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, productID, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("GetInventoryMovements: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	movements := []InventoryMovement{}
+	for rows.Next() {
+		var m InventoryMovement
+		err := rows.Scan(&m.ID, &m.ProductID, &m.MovementType, &m.QuantityChange, &m.Balance, &m.ActorType, &m.ActorID, &m.Reason, &m.OrderID, &m.CreatedAt)
+		if err != nil {
+			return nil, 0, fmt.Errorf("GetInventoryMovements: error scanning row: %w", err)
+		}
+		movements = append(movements, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("GetInventoryMovements: rows error: %w", err)
+	}
+
+	return movements, total, nil
+}
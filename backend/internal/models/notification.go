@@ -1,46 +1,230 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
 )
 
+const (
+	RecipientFarmer = "farmer"
+	RecipientBuyer  = "buyer"
+)
+
 type Notification struct {
-	ID               int       `json:"id"`
-	RecipientID      int       `json:"recipient_id"`
-	NotificationType string    `json:"notification_type"`
-	Message          string    `json:"message"`
-	IsSent           bool      `json:"is_sent"`
-	SentAt           time.Time `json:"sent_at"`
-	CreatedAt        time.Time `json:"created_at"`
+	ID               int        `json:"id"`
+	RecipientType    string     `json:"recipient_type"`
+	RecipientID      int        `json:"recipient_id"`
+	NotificationType string     `json:"notification_type"`
+	Message          string     `json:"message"`
+	IsSent           bool       `json:"is_sent"`
+	SentAt           time.Time  `json:"sent_at"`
+	IsRead           bool       `json:"is_read"`
+	ReadAt           *time.Time `json:"read_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type NotificationFilter struct {
+	UnreadOnly bool
+	Limit      int
+	Offset     int
 }
 
-func CreateNotification(db *sql.DB, recipientID int, notificationType string, message string) error {
-	// Verify that the recipient_id exists in the farmers table
+// recipientTable is the table a recipient of the given type lives in
+func recipientTable(recipientType string) (string, error) {
+	switch recipientType {
+	case RecipientFarmer:
+		return "farmers", nil
+	case RecipientBuyer:
+		return "buyers", nil
+	default:
+		return "", fmt.Errorf("unknown recipient type %q", recipientType)
+	}
+}
+
+func CreateNotification(ctx context.Context, db *sql.DB, recipientType string, recipientID int, notificationType string, message string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	table, err := recipientTable(recipientType)
+	if err != nil {
+		return fmt.Errorf("CreateNotification: %w", err)
+	}
+
+	// Verify that the recipient exists
 	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM farmers WHERE id = $1)", recipientID).Scan(&exists)
+	err = db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM "+table+" WHERE id = $1)", recipientID).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("CreateNotification: error verifying recipient existence: %w", err)
 	}
 
 	if !exists {
-		return fmt.Errorf("CreateNotification: recipient_id %d does not exist in farmers table", recipientID)
+		return fmt.Errorf("CreateNotification: recipient_id %d does not exist in %s table", recipientID, table)
 	}
 
-	stmt, err := db.Prepare(`
-        INSERT INTO notifications (recipient_id, notification_type, message, is_sent, sent_at, created_at)
-        VALUES ($1, $2, $3, TRUE, NOW(), NOW())
-    `)
+	_, err = db.ExecContext(ctx, `
+        INSERT INTO notifications (recipient_type, recipient_id, notification_type, message, is_sent, sent_at, created_at)
+        VALUES ($1, $2, $3, $4, TRUE, NOW(), NOW())
+    `, recipientType, recipientID, notificationType, message)
 	if err != nil {
-		return fmt.Errorf("CreateNotification: error preparing statement: %w", err)
+		return fmt.Errorf("CreateNotification: error executing statement: %w", err)
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(recipientID, notificationType, message)
+	return nil
+}
+
+// GetNotifications returns a page of a recipient's notifications, newest
+// first, with the total number that match the filter
+func GetNotifications(ctx context.Context, db *sql.DB, recipientType string, recipientID int, filter NotificationFilter) ([]Notification, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	where := " WHERE recipient_type = $1 AND recipient_id = $2"
+	if filter.UnreadOnly {
+		where += " AND read_at IS NULL"
+	}
+
+	var total int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notifications"+where, recipientType, recipientID).Scan(&total)
 	if err != nil {
-		return fmt.Errorf("CreateNotification: error executing statement: %w", err)
+		return nil, 0, fmt.Errorf("GetNotifications: error counting notifications: %w", err)
 	}
 
-	return nil
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, recipient_type, recipient_id, notification_type, message, is_sent, COALESCE(sent_at, created_at), read_at, created_at
+		FROM notifications`+where+`
+		ORDER BY created_at DESC, id DESC LIMIT $3 OFFSET $4`,
+		recipientType, recipientID, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("GetNotifications: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	notifications, err := scanNotifications(rows)
+	if err != nil {
+		return nil, 0, fmt.Errorf("GetNotifications: %w", err)
+	}
+	return notifications, total, nil
+}
+
+// GetNotificationsSince returns up to limit of a recipient's notifications
+// with an ID above afterID, oldest first. Clients that reconnect to the event
+// stream use it to catch up.
+func GetNotificationsSince(ctx context.Context, db *sql.DB, recipientType string, recipientID, afterID, limit int) ([]Notification, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, recipient_type, recipient_id, notification_type, message, is_sent, COALESCE(sent_at, created_at), read_at, created_at
+		FROM notifications
+		WHERE recipient_type = $1 AND recipient_id = $2 AND id > $3
+		ORDER BY id LIMIT $4`,
+		recipientType, recipientID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetNotificationsSince: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	notifications, err := scanNotifications(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetNotificationsSince: %w", err)
+	}
+	return notifications, nil
+}
+
+func scanNotifications(rows *sql.Rows) ([]Notification, error) {
+	notifications := []Notification{}
+	for rows.Next() {
+		var notification Notification
+		var readAt sql.NullTime
+		err := rows.Scan(
+			&notification.ID,
+			&notification.RecipientType,
+			&notification.RecipientID,
+			&notification.NotificationType,
+			&notification.Message,
+			&notification.IsSent,
+			&notification.SentAt,
+			&readAt,
+			&notification.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if readAt.Valid {
+			notification.IsRead = true
+			notification.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func CountUnreadNotifications(ctx context.Context, db *sql.DB, recipientType string, recipientID int) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM notifications
+		WHERE recipient_type = $1 AND recipient_id = $2 AND read_at IS NULL
+	`, recipientType, recipientID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("CountUnreadNotifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkNotificationRead marks one of the recipient's notifications as read.
+// It returns sql.ErrNoRows when the recipient has no such notification.
+func MarkNotificationRead(ctx context.Context, db *sql.DB, recipientType string, recipientID, notificationID int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	// A notification that is already read keeps its first read_at
+	res, err := db.ExecContext(ctx, `
+		UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND recipient_type = $2 AND recipient_id = $3
+	`, notificationID, recipientType, recipientID)
+	if err != nil {
+		return fmt.Errorf("MarkNotificationRead: %w", err)
+	}
+	return requireRow(res)
+}
+
+// MarkAllNotificationsRead marks every unread notification of the recipient
+// as read and returns how many there were
+func MarkAllNotificationsRead(ctx context.Context, db *sql.DB, recipientType string, recipientID int) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE notifications SET read_at = NOW()
+		WHERE recipient_type = $1 AND recipient_id = $2 AND read_at IS NULL
+	`, recipientType, recipientID)
+	if err != nil {
+		return 0, fmt.Errorf("MarkAllNotificationsRead: %w", err)
+	}
+	marked, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("MarkAllNotificationsRead: %w", err)
+	}
+	return int(marked), nil
+}
+
+// DeleteNotification removes one of the recipient's notifications. It
+// returns sql.ErrNoRows when the recipient has no such notification.
+func DeleteNotification(ctx context.Context, db *sql.DB, recipientType string, recipientID, notificationID int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM notifications
+		WHERE id = $1 AND recipient_type = $2 AND recipient_id = $3
+	`, notificationID, recipientType, recipientID)
+	if err != nil {
+		return fmt.Errorf("DeleteNotification: %w", err)
+	}
+	return requireRow(res)
 }
@@ -0,0 +1,412 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Order is the header of a completed checkout. Its status is rolled up from
+// the per-farmer sub-orders it is split into.
+type Order struct {
+	ID            int         `json:"id"`
+	BuyerID       int         `json:"buyer_id"`
+	Status        string      `json:"status"`
+	PaymentMethod string      `json:"payment_method"`
+	TotalAmount   float64     `json:"total_amount"`
+	ItemCount     int         `json:"item_count"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+	SubOrders     []SubOrder  `json:"sub_orders,omitempty"`
+	Items         []OrderItem `json:"items,omitempty"`
+}
+
+// OrderItem is a single purchased line. Product name, unit price and farmer
+// are copied from the product at purchase time so later edits don't rewrite history.
+type OrderItem struct {
+	ID          int      `json:"id"`
+	OrderID     int      `json:"order_id"`
+	SubOrderID  int      `json:"sub_order_id"`
+	ProductID   int      `json:"product_id"`
+	FarmerID    int      `json:"farmer_id"`
+	ProductName string   `json:"product_name"`
+	UnitPrice   float64  `json:"unit_price"`
+	Quantity    int      `json:"quantity"`
+	Subtotal    float64  `json:"subtotal"`
+	Images      []string `json:"images,omitempty"`
+}
+
+// Split groups the order's items into one sub-order per farmer, in the order
+// each farmer first appears, and totals the order and its sub-orders.
+// deliveryMethods maps farmer ID to delivery method; farmers without an entry
+// get the default for the order's payment method. IDs are left to the caller.
+func (order *Order) Split(deliveryMethods map[int]string) error {
+	if len(order.Items) == 0 {
+		return errors.New("order has no items")
+	}
+
+	order.TotalAmount = 0
+	order.ItemCount = 0
+	order.SubOrders = nil
+
+	subOrderIndex := make(map[int]int)
+	for i := range order.Items {
+		item := &order.Items[i]
+		item.Subtotal = item.UnitPrice * float64(item.Quantity)
+		order.TotalAmount += item.Subtotal
+		order.ItemCount += item.Quantity
+
+		idx, ok := subOrderIndex[item.FarmerID]
+		if !ok {
+			method := deliveryMethods[item.FarmerID]
+			if method == "" {
+				method = defaultDeliveryMethod(order.PaymentMethod)
+			}
+			if !IsValidDeliveryMethod(method) {
+				return fmt.Errorf("invalid delivery method %q", method)
+			}
+			if !deliveryMethodAllowed(order.PaymentMethod, method) {
+				return fmt.Errorf("%w: %s cannot be used with %s", ErrPaymentMethodMismatch, order.PaymentMethod, method)
+			}
+			paymentStatus := SubOrderPaymentUnpaid
+			if order.PaymentMethod == PaymentMethodCard {
+				paymentStatus = SubOrderPaymentCard
+			}
+			order.SubOrders = append(order.SubOrders, SubOrder{
+				FarmerID:       item.FarmerID,
+				Status:         order.Status,
+				DeliveryMethod: method,
+				PaymentStatus:  paymentStatus,
+			})
+			idx = len(order.SubOrders) - 1
+			subOrderIndex[item.FarmerID] = idx
+		}
+		order.SubOrders[idx].Subtotal += item.Subtotal
+		order.SubOrders[idx].ItemCount += item.Quantity
+	}
+	return nil
+}
+
+// createOrder splits the order and inserts the header, the sub-orders and the
+// line items inside tx
+func createOrder(ctx context.Context, tx *sql.Tx, order *Order, deliveryMethods map[int]string) error {
+	if err := order.Split(deliveryMethods); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	query := `
+		INSERT INTO orders (buyer_id, status, payment_method, total_amount, item_count, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+	err := tx.QueryRowContext(ctx, query, order.BuyerID, order.Status, order.PaymentMethod, order.TotalAmount, order.ItemCount, now, now).Scan(&order.ID)
+	if err != nil {
+		return err
+	}
+	order.CreatedAt = now
+	order.UpdatedAt = now
+
+	subOrderQuery := `
+		INSERT INTO sub_orders (order_id, farmer_id, status, delivery_method, payment_status, subtotal, item_count, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+	subOrderIDs := make(map[int]int)
+	for i := range order.SubOrders {
+		so := &order.SubOrders[i]
+		so.OrderID = order.ID
+		so.CreatedAt = now
+		so.UpdatedAt = now
+		err := tx.QueryRowContext(ctx, subOrderQuery,
+			so.OrderID,
+			so.FarmerID,
+			so.Status,
+			so.DeliveryMethod,
+			so.PaymentStatus,
+			so.Subtotal,
+			so.ItemCount,
+			now,
+			now,
+		).Scan(&so.ID)
+		if err != nil {
+			return err
+		}
+		subOrderIDs[so.FarmerID] = so.ID
+	}
+
+	itemQuery := `
+		INSERT INTO order_items (order_id, sub_order_id, product_id, farmer_id, product_name, unit_price, quantity, subtotal)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+	for i := range order.Items {
+		item := &order.Items[i]
+		item.OrderID = order.ID
+		item.SubOrderID = subOrderIDs[item.FarmerID]
+		err := tx.QueryRowContext(ctx, itemQuery,
+			item.OrderID,
+			item.SubOrderID,
+			item.ProductID,
+			item.FarmerID,
+			item.ProductName,
+			item.UnitPrice,
+			item.Quantity,
+			item.Subtotal,
+		).Scan(&item.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return recordOrderStatusChange(ctx, tx, order.ID, 0, "", order.Status, "buyer", order.BuyerID, "")
+}
+
+// placeOrder moves a pending_payment order and its sub-orders to placed
+func placeOrder(ctx context.Context, tx *sql.Tx, order *Order) error {
+	now := time.Now()
+	_, err := tx.ExecContext(ctx, `UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3`, OrderStatusPlaced, now, order.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE sub_orders SET status = $1, updated_at = $2 WHERE order_id = $3`, OrderStatusPlaced, now, order.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := recordOrderStatusChange(ctx, tx, order.ID, 0, order.Status, OrderStatusPlaced, "buyer", order.BuyerID, ""); err != nil {
+		return err
+	}
+
+	order.Status = OrderStatusPlaced
+	order.UpdatedAt = now
+	for i := range order.SubOrders {
+		order.SubOrders[i].Status = OrderStatusPlaced
+		order.SubOrders[i].UpdatedAt = now
+	}
+	return nil
+}
+
+// OrderFilter narrows an order listing
+type OrderFilter struct {
+	Status string
+	From   time.Time // inclusive, zero means no lower bound
+	To     time.Time // exclusive, zero means no upper bound
+	Limit  int
+	Offset int
+}
+
+// FarmerSubtotal is the share of an order that belongs to a single farmer
+type FarmerSubtotal struct {
+	FarmerID  int     `json:"farmer_id"`
+	FarmName  string  `json:"farm_name"`
+	ItemCount int     `json:"item_count"`
+	Subtotal  float64 `json:"subtotal"`
+}
+
+// GetOrdersByBuyerID returns one page of the buyer's orders (newest first)
+// together with the total number of orders matching the filter
+func GetOrdersByBuyerID(ctx context.Context, db *sql.DB, buyerID int, filter OrderFilter) ([]Order, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	conditions := []string{"buyer_id = $1"}
+	params := []interface{}{buyerID}
+	paramCounter := 2
+
+	if filter.Status != "" {
+		conditions = append(conditions, fmt.Sprintf("status = $%d", paramCounter))
+		params = append(params, filter.Status)
+		paramCounter++
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", paramCounter))
+		params = append(params, filter.From)
+		paramCounter++
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", paramCounter))
+		params = append(params, filter.To)
+		paramCounter++
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders"+where, params...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("GetOrdersByBuyerID: error counting orders: %w", err)
+	}
+
+	query := `
+		SELECT id, buyer_id, status, payment_method, total_amount, item_count, created_at, updated_at
+		FROM orders` + where +
+		fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", paramCounter, paramCounter+1)
+	params = append(params, filter.Limit, filter.Offset)
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("GetOrdersByBuyerID: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		var order Order
+		err := rows.Scan(
+			&order.ID,
+			&order.BuyerID,
+			&order.Status,
+			&order.PaymentMethod,
+			&order.TotalAmount,
+			&order.ItemCount,
+			&order.CreatedAt,
+			&order.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("GetOrdersByBuyerID: error scanning row: %w", err)
+		}
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("GetOrdersByBuyerID: rows error: %w", err)
+	}
+
+	return orders, total, nil
+}
+
+// GetOrderByID returns the order header with its sub-orders, line items and their current product images
+func GetOrderByID(ctx context.Context, db *sql.DB, orderID int) (*Order, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var order Order
+	err := db.QueryRowContext(ctx, `
+		SELECT id, buyer_id, status, payment_method, total_amount, item_count, created_at, updated_at
+		FROM orders
+		WHERE id = $1
+	`, orderID).Scan(
+		&order.ID,
+		&order.BuyerID,
+		&order.Status,
+		&order.PaymentMethod,
+		&order.TotalAmount,
+		&order.ItemCount,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	subOrders, err := GetSubOrdersByOrderID(ctx, db, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	order.SubOrders = subOrders
+
+	items, err := GetOrderItems(ctx, db, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	order.Items = items
+
+	return &order, nil
+}
+
+// GetOrderItems returns the line items of an order. Images come from the
+// product's current gallery and are empty if the product has since been deleted.
+func GetOrderItems(ctx context.Context, db *sql.DB, orderID int) ([]OrderItem, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT
+			oi.id,
+			oi.order_id,
+			oi.sub_order_id,
+			oi.product_id,
+			oi.farmer_id,
+			oi.product_name,
+			oi.unit_price,
+			oi.quantity,
+			oi.subtotal,
+			COALESCE(array_agg(pi.image_url ORDER BY pi.image_order) FILTER (WHERE pi.image_url IS NOT NULL), ARRAY[]::VARCHAR[]) AS images
+		FROM order_items oi
+		LEFT JOIN product_images pi ON pi.product_id = oi.product_id
+		WHERE oi.order_id = $1
+		GROUP BY oi.id
+		ORDER BY oi.id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("GetOrderItems: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	var items []OrderItem
+	for rows.Next() {
+		var item OrderItem
+		var images pq.StringArray
+		err := rows.Scan(
+			&item.ID,
+			&item.OrderID,
+			&item.SubOrderID,
+			&item.ProductID,
+			&item.FarmerID,
+			&item.ProductName,
+			&item.UnitPrice,
+			&item.Quantity,
+			&item.Subtotal,
+			&images,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("GetOrderItems: error scanning row: %w", err)
+		}
+		item.Images = images
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetOrderItems: rows error: %w", err)
+	}
+
+	return items, nil
+}
+
+// GetOrderFarmerSubtotals returns the subtotal of each farmer's sub-order
+func GetOrderFarmerSubtotals(ctx context.Context, db *sql.DB, orderID int) ([]FarmerSubtotal, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT so.farmer_id, COALESCE(f.farm_name, ''), so.item_count, so.subtotal
+		FROM sub_orders so
+		LEFT JOIN farmers f ON f.id = so.farmer_id
+		WHERE so.order_id = $1
+		ORDER BY so.id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("GetOrderFarmerSubtotals: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	var subtotals []FarmerSubtotal
+	for rows.Next() {
+		var s FarmerSubtotal
+		if err := rows.Scan(&s.FarmerID, &s.FarmName, &s.ItemCount, &s.Subtotal); err != nil {
+			return nil, fmt.Errorf("GetOrderFarmerSubtotals: error scanning row: %w", err)
+		}
+		subtotals = append(subtotals, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetOrderFarmerSubtotals: rows error: %w", err)
+	}
+
+	return subtotals, nil
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	OrderStatusPendingPayment = "pending_payment"
+	OrderStatusPlaced         = "placed"
+	OrderStatusConfirmed      = "confirmed"
+	OrderStatusPacked         = "packed"
+	OrderStatusShipped        = "shipped"
+	OrderStatusReadyForPickup = "ready_for_pickup"
+	OrderStatusDelivered      = "delivered"
+	OrderStatusCancelled      = "cancelled"
+	OrderStatusRefunded       = "refunded"
+)
+
+const (
+	DeliveryMethodDelivery = "delivery"
+	DeliveryMethodPickup   = "pickup"
+)
+
+// orderTransitions lists the statuses an order or sub-order may move to from
+// each status. Terminal statuses have no entry.
+var orderTransitions = map[string][]string{
+	OrderStatusPendingPayment: {OrderStatusPlaced, OrderStatusCancelled},
+	OrderStatusPlaced:         {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed:      {OrderStatusPacked, OrderStatusCancelled},
+	OrderStatusPacked:         {OrderStatusShipped, OrderStatusReadyForPickup, OrderStatusCancelled},
+	OrderStatusShipped:        {OrderStatusDelivered},
+	OrderStatusReadyForPickup: {OrderStatusDelivered, OrderStatusCancelled},
+	OrderStatusDelivered:      {OrderStatusRefunded},
+}
+
+// farmerSettableStatuses are the statuses a farmer may move their sub-orders to.
+// Refunds go through their own flow.
+var farmerSettableStatuses = map[string]bool{
+	OrderStatusConfirmed:      true,
+	OrderStatusPacked:         true,
+	OrderStatusShipped:        true,
+	OrderStatusReadyForPickup: true,
+	OrderStatusDelivered:      true,
+	OrderStatusCancelled:      true,
+}
+
+var (
+	ErrInvalidTransition = errors.New("invalid order status transition")
+	ErrUnknownStatus     = errors.New("unknown order status")
+)
+
+// TransitionError describes a rejected status change. It matches ErrInvalidTransition with errors.Is.
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot change order status from %q to %q", e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// OrderStatusChange is a row of the order status history. SubOrderID is zero
+// for changes to the parent order.
+type OrderStatusChange struct {
+	ID            int       `json:"id"`
+	OrderID       int       `json:"order_id"`
+	SubOrderID    int       `json:"sub_order_id,omitempty"`
+	FromStatus    string    `json:"from_status"`
+	ToStatus      string    `json:"to_status"`
+	ChangedByType string    `json:"changed_by_type"`
+	ChangedByID   int       `json:"changed_by_id"`
+	Note          string    `json:"note"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func IsValidOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusPendingPayment, OrderStatusPlaced, OrderStatusConfirmed, OrderStatusPacked, OrderStatusShipped,
+		OrderStatusReadyForPickup, OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func IsValidDeliveryMethod(method string) bool {
+	return method == DeliveryMethodDelivery || method == DeliveryMethodPickup
+}
+
+// CanTransition reports whether an order may move directly from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckFarmerTransition returns a *TransitionError unless a farmer may move a
+// sub-order with the given delivery method from one status to another.
+// Shipping is only for deliveries and ready_for_pickup only for pickups.
+func CheckFarmerTransition(from, to, deliveryMethod string) error {
+	if !farmerSettableStatuses[to] || !CanTransition(from, to) ||
+		(to == OrderStatusShipped && deliveryMethod != DeliveryMethodDelivery) ||
+		(to == OrderStatusReadyForPickup && deliveryMethod != DeliveryMethodPickup) {
+		return &TransitionError{From: from, To: to}
+	}
+	return nil
+}
+
+// GetOrderStatusHistory returns the status changes of an order, oldest first
+func GetOrderStatusHistory(ctx context.Context, db *sql.DB, orderID int) ([]OrderStatusChange, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, order_id, COALESCE(sub_order_id, 0), COALESCE(from_status, ''), to_status, changed_by_type, changed_by_id, COALESCE(note, ''), created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY created_at ASC, id ASC
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("GetOrderStatusHistory: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	var history []OrderStatusChange
+	for rows.Next() {
+		var c OrderStatusChange
+		err := rows.Scan(&c.ID, &c.OrderID, &c.SubOrderID, &c.FromStatus, &c.ToStatus, &c.ChangedByType, &c.ChangedByID, &c.Note, &c.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("GetOrderStatusHistory: error scanning row: %w", err)
+		}
+		history = append(history, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetOrderStatusHistory: rows error: %w", err)
+	}
+
+	return history, nil
+}
+
+// recordOrderStatusChange appends a history row. Pass subOrderID 0 for the parent order.
+func recordOrderStatusChange(ctx context.Context, tx *sql.Tx, orderID, subOrderID int, from, to, actorType string, actorID int, note string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO order_status_history (order_id, sub_order_id, from_status, to_status, changed_by_type, changed_by_id, note, created_at)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4, $5, $6, NULLIF($7, ''), $8)
+	`, orderID, subOrderID, from, to, actorType, actorID, note, time.Now())
+	return err
+}
+
+// statusRank orders the fulfillment statuses; shipped and ready_for_pickup are the same stage
+var statusRank = map[string]int{
+	OrderStatusPendingPayment: -1,
+	OrderStatusPlaced:         0,
+	OrderStatusConfirmed:      1,
+	OrderStatusPacked:         2,
+	OrderStatusShipped:        3,
+	OrderStatusReadyForPickup: 3,
+	OrderStatusDelivered:      4,
+}
+
+// RollUpOrderStatus derives the parent order status from its sub-orders: the
+// least advanced of the sub-orders still being fulfilled, or cancelled/refunded
+// once none are.
+func RollUpOrderStatus(subOrderStatuses []string) string {
+	rolled := ""
+	refunded := false
+	for _, status := range subOrderStatuses {
+		switch status {
+		case OrderStatusCancelled:
+			continue
+		case OrderStatusRefunded:
+			refunded = true
+			continue
+		}
+		if rolled == "" || statusRank[status] < statusRank[rolled] ||
+			(status == OrderStatusShipped && rolled == OrderStatusReadyForPickup) {
+			rolled = status
+		}
+	}
+
+	if rolled != "" {
+		return rolled
+	}
+	if refunded {
+		return OrderStatusRefunded
+	}
+	return OrderStatusCancelled
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{OrderStatusPendingPayment, OrderStatusPlaced, true},
+		{OrderStatusPendingPayment, OrderStatusCancelled, true},
+		{OrderStatusPendingPayment, OrderStatusConfirmed, false},
+		{OrderStatusPlaced, OrderStatusConfirmed, true},
+		{OrderStatusPlaced, OrderStatusPacked, false},
+		{OrderStatusConfirmed, OrderStatusPacked, true},
+		{OrderStatusConfirmed, OrderStatusPlaced, false},
+		{OrderStatusPacked, OrderStatusShipped, true},
+		{OrderStatusPacked, OrderStatusReadyForPickup, true},
+		{OrderStatusPacked, OrderStatusDelivered, false},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		// Once shipped the goods are out of the farmer's hands
+		{OrderStatusShipped, OrderStatusCancelled, false},
+		{OrderStatusReadyForPickup, OrderStatusDelivered, true},
+		{OrderStatusReadyForPickup, OrderStatusCancelled, true},
+		{OrderStatusDelivered, OrderStatusRefunded, true},
+		{OrderStatusDelivered, OrderStatusCancelled, false},
+		{OrderStatusPlaced, OrderStatusPlaced, false},
+		// Terminal statuses go nowhere
+		{OrderStatusCancelled, OrderStatusPlaced, false},
+		{OrderStatusCancelled, OrderStatusRefunded, false},
+		{OrderStatusRefunded, OrderStatusDelivered, false},
+		{OrderStatusRefunded, OrderStatusCancelled, false},
+		{"lost", OrderStatusPlaced, false},
+		{OrderStatusPlaced, "lost", false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestCheckFarmerTransition(t *testing.T) {
+	tests := []struct {
+		name           string
+		from, to       string
+		deliveryMethod string
+		allowed        bool
+	}{
+		{"confirm", OrderStatusPlaced, OrderStatusConfirmed, DeliveryMethodDelivery, true},
+		{"ship a delivery", OrderStatusPacked, OrderStatusShipped, DeliveryMethodDelivery, true},
+		{"ship a pickup", OrderStatusPacked, OrderStatusShipped, DeliveryMethodPickup, false},
+		{"pickup ready", OrderStatusPacked, OrderStatusReadyForPickup, DeliveryMethodPickup, true},
+		{"delivery ready for pickup", OrderStatusPacked, OrderStatusReadyForPickup, DeliveryMethodDelivery, false},
+		{"cancel before shipping", OrderStatusConfirmed, OrderStatusCancelled, DeliveryMethodDelivery, true},
+		{"skip a step", OrderStatusPlaced, OrderStatusShipped, DeliveryMethodDelivery, false},
+		{"go back", OrderStatusPacked, OrderStatusConfirmed, DeliveryMethodDelivery, false},
+		// Payment and refunds have their own flows
+		{"place an unpaid order", OrderStatusPendingPayment, OrderStatusPlaced, DeliveryMethodDelivery, false},
+		{"refund", OrderStatusDelivered, OrderStatusRefunded, DeliveryMethodDelivery, false},
+		{"reopen a cancelled order", OrderStatusCancelled, OrderStatusConfirmed, DeliveryMethodDelivery, false},
+		{"reopen a refunded order", OrderStatusRefunded, OrderStatusDelivered, DeliveryMethodPickup, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckFarmerTransition(tt.from, tt.to, tt.deliveryMethod)
+			if tt.allowed {
+				if err != nil {
+					t.Fatalf("got %v, want nil", err)
+				}
+				return
+			}
+
+			var transitionErr *TransitionError
+			if !errors.As(err, &transitionErr) {
+				t.Fatalf("got %v, want a *TransitionError", err)
+			}
+			if transitionErr.From != tt.from || transitionErr.To != tt.to {
+				t.Errorf("got a transition from %q to %q, want %q to %q", transitionErr.From, transitionErr.To, tt.from, tt.to)
+			}
+			if !errors.Is(err, ErrInvalidTransition) {
+				t.Errorf("%v does not match ErrInvalidTransition", err)
+			}
+		})
+	}
+}
+
+func TestRollUpOrderStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		subOrders []string
+		want      string
+	}{
+		{"single sub-order", []string{OrderStatusPacked}, OrderStatusPacked},
+		{"least advanced wins", []string{OrderStatusDelivered, OrderStatusConfirmed, OrderStatusPacked}, OrderStatusConfirmed},
+		{"all delivered", []string{OrderStatusDelivered, OrderStatusDelivered}, OrderStatusDelivered},
+		{"unpaid sub-order holds the order back", []string{OrderStatusPendingPayment, OrderStatusPlaced}, OrderStatusPendingPayment},
+		// Shipped and ready_for_pickup are the same stage; shipped is reported
+		{"shipped and ready for pickup", []string{OrderStatusReadyForPickup, OrderStatusShipped}, OrderStatusShipped},
+		{"ready for pickup and delivered", []string{OrderStatusReadyForPickup, OrderStatusDelivered}, OrderStatusReadyForPickup},
+		// Cancelled and refunded sub-orders no longer count toward progress
+		{"partly cancelled", []string{OrderStatusCancelled, OrderStatusPacked}, OrderStatusPacked},
+		{"partly cancelled, rest delivered", []string{OrderStatusDelivered, OrderStatusCancelled}, OrderStatusDelivered},
+		{"partly refunded, rest shipped", []string{OrderStatusRefunded, OrderStatusShipped}, OrderStatusShipped},
+		{"partly refunded, rest delivered", []string{OrderStatusDelivered, OrderStatusRefunded}, OrderStatusDelivered},
+		{"all cancelled", []string{OrderStatusCancelled, OrderStatusCancelled}, OrderStatusCancelled},
+		{"all refunded", []string{OrderStatusRefunded, OrderStatusRefunded}, OrderStatusRefunded},
+		{"refunded and cancelled", []string{OrderStatusCancelled, OrderStatusRefunded}, OrderStatusRefunded},
+		{"no sub-orders", nil, OrderStatusCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RollUpOrderStatus(tt.subOrders); got != tt.want {
+				t.Errorf("RollUpOrderStatus(%v) = %q, want %q", tt.subOrders, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	OutboxEmail        = "email"
+	OutboxNotification = "notification"
+	OutboxSettlement   = "settlement"
+	OutboxVoid         = "payment_void"
+
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxDead      = "dead"
+)
+
+// OutboxEntry is a side effect (an email, a notification or a payment
+// settlement) saved in the same transaction as the change that caused it and
+// delivered later by the outbox worker. Payload holds an EmailPayload, a
+// NotificationPayload, a SettlementPayload or a VoidPayload as JSON.
+type OutboxEntry struct {
+	ID            int             `json:"id"`
+	Kind          string          `json:"kind"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
+
+type EmailPayload struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	HTML    string `json:"html,omitempty"`
+}
+
+type NotificationPayload struct {
+	RecipientType string `json:"recipient_type,omitempty"` // entries queued before buyers had notifications omit it
+	RecipientID   int    `json:"recipient_id"`
+	Type          string `json:"type"`
+	Message       string `json:"message"`
+}
+
+type SettlementPayload struct {
+	OrderID int `json:"order_id"`
+}
+
+// VoidPayload names a card authorization whose order was never placed
+type VoidPayload struct {
+	Provider    string `json:"provider"`
+	ProviderRef string `json:"provider_ref"`
+}
+
+// EmailEntry builds an outbox entry that sends an email; html may be empty
+func EmailEntry(to, subject, body, html string) OutboxEntry {
+	payload, _ := json.Marshal(EmailPayload{To: to, Subject: subject, Body: body, HTML: html})
+	return OutboxEntry{Kind: OutboxEmail, Payload: payload}
+}
+
+// NotificationEntry builds an outbox entry that creates a notification for a
+// farmer or a buyer
+func NotificationEntry(recipientType string, recipientID int, notificationType, message string) OutboxEntry {
+	payload, _ := json.Marshal(NotificationPayload{RecipientType: recipientType, RecipientID: recipientID, Type: notificationType, Message: message})
+	return OutboxEntry{Kind: OutboxNotification, Payload: payload}
+}
+
+// SettlementEntry builds an outbox entry that captures or voids the order's
+// payment
+func SettlementEntry(orderID int) OutboxEntry {
+	payload, _ := json.Marshal(SettlementPayload{OrderID: orderID})
+	return OutboxEntry{Kind: OutboxSettlement, Payload: payload}
+}
+
+// VoidEntry builds an outbox entry that voids a card authorization at provider
+func VoidEntry(provider, providerRef string) OutboxEntry {
+	payload, _ := json.Marshal(VoidPayload{Provider: provider, ProviderRef: providerRef})
+	return OutboxEntry{Kind: OutboxVoid, Payload: payload}
+}
+
+// execer is a *sql.Tx or, for entries with no change to go with, a *sql.DB
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// enqueueOutbox saves entries as part of tx
+func enqueueOutbox(ctx context.Context, tx execer, entries []OutboxEntry) error {
+	for _, entry := range entries {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO outbox (kind, payload, status, next_attempt_at, created_at)
+			VALUES ($1, $2, $3, NOW(), NOW())
+		`, entry.Kind, []byte(entry.Payload), OutboxPending)
+		if err != nil {
+			return fmt.Errorf("enqueueOutbox: %w", err)
+		}
+	}
+	return nil
+}
+
+// ClaimOutbox returns up to limit pending entries that are due and pushes
+// their next attempt back by lease, so another worker does not pick them up
+// while they are being delivered. An entry whose worker dies is retried once
+// the lease runs out.
+func ClaimOutbox(ctx context.Context, db *sql.DB, limit int, lease time.Duration) ([]OutboxEntry, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		UPDATE outbox SET next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE status = $3 AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, status, attempts, next_attempt_at, COALESCE(last_error, ''), created_at, delivered_at
+	`, limit, lease.Seconds(), OutboxPending)
+	if err != nil {
+		return nil, fmt.Errorf("ClaimOutbox: %w", err)
+	}
+	defer rows.Close()
+
+	entries, err := scanOutboxEntries(rows)
+	if err != nil {
+		return nil, fmt.Errorf("ClaimOutbox: %w", err)
+	}
+	return entries, nil
+}
+
+// MarkOutboxDelivered records a successful delivery
+func MarkOutboxDelivered(ctx context.Context, db *sql.DB, id int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE outbox SET status = $1, attempts = attempts + 1, last_error = NULL, delivered_at = NOW()
+		WHERE id = $2
+	`, OutboxDelivered, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+// MarkOutboxFailed records a failed attempt. The entry is tried again at
+// retryAt, or moved to the dead letters when dead is set.
+func MarkOutboxFailed(ctx context.Context, db *sql.DB, id int, deliveryErr string, retryAt time.Time, dead bool) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	status := OutboxPending
+	if dead {
+		status = OutboxDead
+	}
+	res, err := db.ExecContext(ctx, `
+		UPDATE outbox SET status = $1, attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+		WHERE id = $4
+	`, status, deliveryErr, retryAt, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+// GetDeadOutbox returns the entries that ran out of attempts, newest first
+func GetDeadOutbox(ctx context.Context, db *sql.DB) ([]OutboxEntry, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, kind, payload, status, attempts, next_attempt_at, COALESCE(last_error, ''), created_at, delivered_at
+		FROM outbox
+		WHERE status = $1
+		ORDER BY created_at DESC, id DESC
+	`, OutboxDead)
+	if err != nil {
+		return nil, fmt.Errorf("GetDeadOutbox: %w", err)
+	}
+	defer rows.Close()
+
+	entries, err := scanOutboxEntries(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetDeadOutbox: %w", err)
+	}
+	return entries, nil
+}
+
+// RetryOutbox puts a dead entry back in the queue with a fresh set of attempts
+func RetryOutbox(ctx context.Context, db *sql.DB, id int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE outbox SET status = $1, attempts = 0, next_attempt_at = NOW()
+		WHERE id = $2 AND status = $3
+	`, OutboxPending, id, OutboxDead)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func scanOutboxEntries(rows *sql.Rows) ([]OutboxEntry, error) {
+	var entries []OutboxEntry
+	for rows.Next() {
+		var entry OutboxEntry
+		var payload []byte
+		var deliveredAt sql.NullTime
+		err := rows.Scan(&entry.ID, &entry.Kind, &payload, &entry.Status, &entry.Attempts,
+			&entry.NextAttemptAt, &entry.LastError, &entry.CreatedAt, &deliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.Payload = payload
+		if deliveredAt.Valid {
+			entry.DeliveredAt = &deliveredAt.Time
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
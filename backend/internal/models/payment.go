@@ -0,0 +1,250 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+)
+
+const (
+	PaymentMethodCard           = "card"
+	PaymentMethodCashOnDelivery = "cash_on_delivery"
+	PaymentMethodPayAtPickup    = "pay_at_pickup"
+)
+
+// Payment status of a sub-order. Card orders are covered by the order's
+// provider payment; cash orders start unpaid until the farmer collects.
+const (
+	SubOrderPaymentCard   = "card"
+	SubOrderPaymentUnpaid = "unpaid"
+	SubOrderPaymentPaid   = "paid"
+)
+
+var (
+	ErrPaymentMethodMismatch = errors.New("payment method not available for delivery method")
+	ErrNotCashPayment        = errors.New("order is not paid in cash")
+	ErrAlreadyPaid           = errors.New("order is already marked paid")
+	ErrOrderClosed           = errors.New("order is cancelled or refunded")
+)
+
+const (
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCaptured   = "captured"
+	PaymentStatusVoided     = "voided"
+	PaymentStatusRefunded   = "refunded"
+	PaymentStatusFailed     = "failed"
+)
+
+// Payment records the provider transaction backing an order
+type Payment struct {
+	ID             int       `json:"id"`
+	OrderID        int       `json:"order_id"`
+	Provider       string    `json:"provider"`
+	ProviderRef    string    `json:"provider_ref"`
+	Amount         float64   `json:"amount"`
+	CapturedAmount float64   `json:"captured_amount"`
+	RefundedAmount float64   `json:"refunded_amount"`
+	Currency       string    `json:"currency"`
+	Status         string    `json:"status"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+const paymentColumns = `id, order_id, provider, provider_ref, amount, captured_amount, refunded_amount, currency, status, created_at, updated_at`
+
+func scanPayment(row interface{ Scan(...interface{}) error }, p *Payment) error {
+	return row.Scan(
+		&p.ID,
+		&p.OrderID,
+		&p.Provider,
+		&p.ProviderRef,
+		&p.Amount,
+		&p.CapturedAmount,
+		&p.RefundedAmount,
+		&p.Currency,
+		&p.Status,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+}
+
+func IsValidPaymentMethod(method string) bool {
+	switch method {
+	case PaymentMethodCard, PaymentMethodCashOnDelivery, PaymentMethodPayAtPickup:
+		return true
+	}
+	return false
+}
+
+// defaultDeliveryMethod is used for farmers the buyer didn't pick a delivery method for
+func defaultDeliveryMethod(paymentMethod string) string {
+	if paymentMethod == PaymentMethodPayAtPickup {
+		return DeliveryMethodPickup
+	}
+	return DeliveryMethodDelivery
+}
+
+// deliveryMethodAllowed rejects paying cash on delivery for pickups and vice versa
+func deliveryMethodAllowed(paymentMethod, deliveryMethod string) bool {
+	switch paymentMethod {
+	case PaymentMethodCashOnDelivery:
+		return deliveryMethod == DeliveryMethodDelivery
+	case PaymentMethodPayAtPickup:
+		return deliveryMethod == DeliveryMethodPickup
+	}
+	return true
+}
+
+func createPayment(ctx context.Context, tx *sql.Tx, payment *Payment) error {
+	now := time.Now()
+	payment.CreatedAt = now
+	payment.UpdatedAt = now
+	return tx.QueryRowContext(ctx, `
+		INSERT INTO payments (order_id, provider, provider_ref, amount, captured_amount, refunded_amount, currency, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 0, 0, $5, $6, $7, $8)
+		RETURNING id
+	`, payment.OrderID, payment.Provider, payment.ProviderRef, payment.Amount, payment.Currency, payment.Status, now, now).Scan(&payment.ID)
+}
+
+// voidAuthorization releases a card hold whose order was not placed. It runs
+// even when ctx is what failed. A void the provider does not confirm is queued
+// in the outbox, which retries it.
+func voidAuthorization(ctx context.Context, db *sql.DB, provider payments.PaymentProvider, providerRef string) {
+	ctx = context.WithoutCancel(ctx)
+	err := provider.Void(ctx, providerRef)
+	if err == nil {
+		return
+	}
+	log.Printf("Voiding payment %s failed, queueing a retry: %v", providerRef, err)
+
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	if err := enqueueOutbox(ctx, db, []OutboxEntry{VoidEntry(provider.Name(), providerRef)}); err != nil {
+		log.Printf("CRITICAL: payment %s is authorized for an order that was not placed and its void could not be queued: %v", providerRef, err)
+	}
+}
+
+// GetPaymentByOrderID returns sql.ErrNoRows if the order has no payment
+func GetPaymentByOrderID(ctx context.Context, db *sql.DB, orderID int) (*Payment, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var payment Payment
+	row := db.QueryRowContext(ctx, `SELECT `+paymentColumns+` FROM payments WHERE order_id = $1`, orderID)
+	if err := scanPayment(row, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// SettleOrderPayment captures or voids an authorized payment once its order
+// has finished fulfillment. Delivered orders are captured for the value of the
+// delivered sub-orders; fully cancelled orders release the hold. Other states
+// are left alone, so it is safe to run more than once. The order and payment
+// rows stay locked until the result is recorded, so two settlements of the
+// same order cannot both reach the provider.
+func SettleOrderPayment(ctx context.Context, db *sql.DB, provider payments.PaymentProvider, orderID int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the order before the payment, in the same order as refunds
+	var orderStatus string
+	err = tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&orderStatus)
+	if err != nil {
+		return err
+	}
+
+	var paymentID int
+	var providerRef, paymentStatus string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, provider_ref, status FROM payments WHERE order_id = $1 FOR UPDATE
+	`, orderID).Scan(&paymentID, &providerRef, &paymentStatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if paymentStatus != PaymentStatusAuthorized {
+		return nil
+	}
+
+	switch orderStatus {
+	case OrderStatusDelivered:
+		var deliveredTotal float64
+		err := tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(subtotal), 0)
+			FROM sub_orders
+			WHERE order_id = $1 AND status = $2
+		`, orderID, OrderStatusDelivered).Scan(&deliveredTotal)
+		if err != nil {
+			return err
+		}
+
+		if err := provider.Capture(ctx, providerRef, payments.ToMinorUnits(deliveredTotal)); err != nil {
+			return fmt.Errorf("SettleOrderPayment: capture failed: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE payments SET status = $1, captured_amount = $2, updated_at = $3 WHERE id = $4
+		`, PaymentStatusCaptured, deliveredTotal, time.Now(), paymentID)
+		if err != nil {
+			return err
+		}
+
+	case OrderStatusCancelled:
+		if err := provider.Void(ctx, providerRef); err != nil {
+			return fmt.Errorf("SettleOrderPayment: void failed: %w", err)
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE payments SET status = $1, updated_at = $2 WHERE id = $3`, PaymentStatusVoided, time.Now(), paymentID)
+		if err != nil {
+			return err
+		}
+
+	default:
+		return nil
+	}
+
+	return tx.Commit()
+}
+
+// ApplyPaymentWebhook records a verified provider event against the matching payment.
+// Events for unknown payments are ignored.
+func ApplyPaymentWebhook(ctx context.Context, db *sql.DB, event *payments.WebhookEvent) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var query string
+	var args []interface{}
+
+	switch event.Type {
+	case payments.EventPaymentCaptured:
+		query = `UPDATE payments SET status = $1, captured_amount = $2, updated_at = $3 WHERE provider_ref = $4`
+		args = []interface{}{PaymentStatusCaptured, payments.FromMinorUnits(event.Amount), time.Now(), event.PaymentID}
+	case payments.EventPaymentVoided:
+		query = `UPDATE payments SET status = $1, updated_at = $2 WHERE provider_ref = $3`
+		args = []interface{}{PaymentStatusVoided, time.Now(), event.PaymentID}
+	case payments.EventPaymentFailed:
+		query = `UPDATE payments SET status = $1, updated_at = $2 WHERE provider_ref = $3`
+		args = []interface{}{PaymentStatusFailed, time.Now(), event.PaymentID}
+	case payments.EventPaymentRefunded:
+		query = `
+			UPDATE payments
+			SET refunded_amount = $1,
+				status = CASE WHEN $1 >= captured_amount THEN $2 ELSE status END,
+				updated_at = $3
+			WHERE provider_ref = $4`
+		args = []interface{}{payments.FromMinorUnits(event.Amount), PaymentStatusRefunded, time.Now(), event.PaymentID}
+	default:
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -14,6 +15,7 @@ type Product struct {
 	CategoryID  int       `json:"category_id"`
 	Price       float64   `json:"price"`
 	Quantity    int       `json:"quantity"`
+	Available   int       `json:"available"` // quantity minus stock held in carts
 	Description string    `json:"description"`
 	IsActive    bool      `json:"is_active"`
 	CreatedAt   time.Time `json:"created_at"`
@@ -21,8 +23,11 @@ type Product struct {
 	Images      []string  `json:"images"`
 }
 
-func CreateProduct(db *sql.DB, product *Product) error {
-	tx, err := db.Begin()
+func CreateProduct(ctx context.Context, db *sql.DB, product *Product) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -33,7 +38,7 @@ func CreateProduct(db *sql.DB, product *Product) error {
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id
 	`
-	err = tx.QueryRow(query,
+	err = tx.QueryRowContext(ctx, query,
 		product.FarmerID,
 		product.Name,
 		product.CategoryID,
@@ -48,13 +53,28 @@ func CreateProduct(db *sql.DB, product *Product) error {
 		return err
 	}
 
+	if product.Quantity != 0 {
+		err = recordInventoryMovement(ctx, tx, InventoryMovement{
+			ProductID:      product.ID,
+			MovementType:   MovementRestock,
+			QuantityChange: product.Quantity,
+			Balance:        product.Quantity,
+			ActorType:      "farmer",
+			ActorID:        product.FarmerID,
+			Reason:         "initial stock",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	// Insert images into product_images table
 	for i, img := range product.Images {
 		imgQuery := `
 			INSERT INTO product_images (product_id, image_url, image_order)
 			VALUES ($1, $2, $3)
 		`
-		_, err = tx.Exec(imgQuery, product.ID, img, i)
+		_, err = tx.ExecContext(ctx, imgQuery, product.ID, img, i)
 		if err != nil {
 			return err
 		}
@@ -63,10 +83,13 @@ func CreateProduct(db *sql.DB, product *Product) error {
 	return tx.Commit()
 }
 
-func GetProductByID(db *sql.DB, id int) (*Product, error) {
+func GetProductByID(ctx context.Context, db *sql.DB, id int) (*Product, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	var product Product
 
-	err := db.QueryRow(`
+	err := db.QueryRowContext(ctx, `
 		SELECT 
 			id, 
 			farmer_id, 
@@ -74,6 +97,7 @@ func GetProductByID(db *sql.DB, id int) (*Product, error) {
 			category_id, 
 			price, 
 			quantity, 
+			`+availableQuantityColumn("products")+`,
 			description, 
 			is_active, 
 			created_at, 
@@ -87,6 +111,7 @@ func GetProductByID(db *sql.DB, id int) (*Product, error) {
 		&product.CategoryID,
 		&product.Price,
 		&product.Quantity,
+		&product.Available,
 		&product.Description,
 		&product.IsActive,
 		&product.CreatedAt,
@@ -97,7 +122,7 @@ func GetProductByID(db *sql.DB, id int) (*Product, error) {
 	}
 
 	// Retrieve images
-	rows, err := db.Query(`
+	rows, err := db.QueryContext(ctx, `
 		SELECT image_url
 		FROM product_images
 		WHERE product_id = $1
@@ -121,9 +146,12 @@ func GetProductByID(db *sql.DB, id int) (*Product, error) {
 	return &product, nil
 }
 
-func GetActiveProducts(db *sql.DB, farmerID int) ([]Product, error) {
-	rows, err := db.Query(`
-		SELECT id, farmer_id, name, category_id, price, quantity, description, is_active, created_at, updated_at
+func GetActiveProducts(ctx context.Context, db *sql.DB, farmerID int) ([]Product, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, farmer_id, name, category_id, price, quantity, `+availableQuantityColumn("products")+`, description, is_active, created_at, updated_at
 		FROM products
 		WHERE farmer_id = $1 AND is_active = TRUE
 	`, farmerID)
@@ -143,6 +171,7 @@ func GetActiveProducts(db *sql.DB, farmerID int) ([]Product, error) {
 			&product.CategoryID,
 			&product.Price,
 			&product.Quantity,
+			&product.Available,
 			&product.Description,
 			&product.IsActive,
 			&product.CreatedAt,
@@ -153,7 +182,7 @@ func GetActiveProducts(db *sql.DB, farmerID int) ([]Product, error) {
 		}
 
 		// Retrieve images for the product
-		imgRows, err := db.Query(`
+		imgRows, err := db.QueryContext(ctx, `
 			SELECT image_url
 			FROM product_images
 			WHERE product_id = $1
@@ -185,19 +214,32 @@ func GetActiveProducts(db *sql.DB, farmerID int) ([]Product, error) {
 	return products, nil
 }
 
-func UpdateProduct(db *sql.DB, product *Product) error {
-	tx, err := db.Begin()
+// UpdateProduct saves the farmer's edits. A change of quantity is recorded in
+// the inventory ledger as a manual adjustment with the given reason.
+func UpdateProduct(ctx context.Context, db *sql.DB, product *Product, stockReason string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	var previousQuantity int
+	err = tx.QueryRowContext(ctx, `
+		SELECT quantity FROM products WHERE id = $1 AND farmer_id = $2 AND deleted_at IS NULL FOR UPDATE
+	`, product.ID, product.FarmerID).Scan(&previousQuantity)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE products
 		SET name = $1, category_id = $2, price = $3, quantity = $4, description = $5, is_active = $6, updated_at = $7
 		WHERE id = $8 AND farmer_id = $9
 	`
-	_, err = tx.Exec(query,
+	_, err = tx.ExecContext(ctx, query,
 		product.Name,
 		product.CategoryID,
 		product.Price,
@@ -212,8 +254,23 @@ func UpdateProduct(db *sql.DB, product *Product) error {
 		return err
 	}
 
+	if product.Quantity != previousQuantity {
+		err = recordInventoryMovement(ctx, tx, InventoryMovement{
+			ProductID:      product.ID,
+			MovementType:   MovementAdjustment,
+			QuantityChange: product.Quantity - previousQuantity,
+			Balance:        product.Quantity,
+			ActorType:      "farmer",
+			ActorID:        product.FarmerID,
+			Reason:         stockReason,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	// Delete existing images
-	_, err = tx.Exec(`
+	_, err = tx.ExecContext(ctx, `
 		DELETE FROM product_images
 		WHERE product_id = $1
 	`, product.ID)
@@ -223,7 +280,7 @@ func UpdateProduct(db *sql.DB, product *Product) error {
 
 	// Insert new images
 	for i, img := range product.Images {
-		_, err = tx.Exec(`
+		_, err = tx.ExecContext(ctx, `
 			INSERT INTO product_images (product_id, image_url, image_order)
 			VALUES ($1, $2, $3)
 		`, product.ID, img, i)
@@ -235,39 +292,72 @@ func UpdateProduct(db *sql.DB, product *Product) error {
 	return tx.Commit()
 }
 
-func DeleteProduct(db *sql.DB, id int, farmerID int) error {
-	result, err := db.Exec(`
-        DELETE FROM products
-        WHERE id = $1 AND farmer_id = $2
-    `, id, farmerID)
+// DeleteProduct soft-deletes a farmer's product: it is hidden everywhere and
+// can no longer be edited, bought or restocked, but its row and stock ledger
+// stay. Carts lose the product and its holds are released.
+func DeleteProduct(ctx context.Context, db *sql.DB, id int, farmerID int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	result, err := tx.ExecContext(ctx, `
+		UPDATE products SET is_active = FALSE, deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND farmer_id = $2 AND deleted_at IS NULL
+	`, id, farmerID)
 	if err != nil {
 		return err
 	}
-
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	if err := requireRow(result); err != nil {
+		return err
 	}
 
-	// Delete related images
-	_, err = db.Exec(`
-        DELETE FROM product_images
-        WHERE product_id = $1
-    `, id)
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM stock_reservations WHERE product_id = $1 RETURNING buyer_id, quantity
+	`, id)
 	if err != nil {
 		return err
 	}
+	released := make(map[int]int)
+	for rows.Next() {
+		var buyerID, quantity int
+		if err := rows.Scan(&buyerID, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		released[buyerID] = quantity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for buyerID, quantity := range released {
+		err := recordReservationMovement(ctx, tx, id, -quantity, MovementReservationRelease, "farmer", farmerID, fmt.Sprintf("product deleted (held by buyer %d)", buyerID))
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM cart_items WHERE product_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM product_images WHERE product_id = $1`, id); err != nil {
+		return err
+	}
 
-	return nil
+	return tx.Commit()
 }
 
-func GetProductsWithFilters(db *sql.DB, filters map[string]string, limit, offset int) ([]Product, error) {
+func GetProductsWithFilters(ctx context.Context, db *sql.DB, filters map[string]string, limit, offset int) ([]Product, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT id, farmer_id, name, category_id, price, quantity, description, is_active, created_at, updated_at
+		SELECT id, farmer_id, name, category_id, price, quantity, ` + availableQuantityColumn("products") + `, description, is_active, created_at, updated_at
 		FROM products
 		WHERE is_active = TRUE
 	`
@@ -279,7 +369,7 @@ func GetProductsWithFilters(db *sql.DB, filters map[string]string, limit, offset
 	// Filter by category
 	if category, ok := filters["category"]; ok && category != "" && strings.ToLower(category) != "all" {
 		conditions = append(conditions, fmt.Sprintf("category_id = $%d", paramCounter))
-		categoryID := getCategoryIDByName(category) // You'll need to implement this function
+		categoryID := CategoryIDByName(category)
 		params = append(params, categoryID)
 		paramCounter++
 	}
@@ -320,7 +410,7 @@ func GetProductsWithFilters(db *sql.DB, filters map[string]string, limit, offset
 	params = append(params, limit, offset)
 	paramCounter += 2
 
-	rows, err := db.Query(query, params...)
+	rows, err := db.QueryContext(ctx, query, params...)
 	if err != nil {
 		return nil, err
 	}
@@ -338,6 +428,7 @@ func GetProductsWithFilters(db *sql.DB, filters map[string]string, limit, offset
 			&product.CategoryID,
 			&product.Price,
 			&product.Quantity,
+			&product.Available,
 			&product.Description,
 			&product.IsActive,
 			&product.CreatedAt,
@@ -348,7 +439,7 @@ func GetProductsWithFilters(db *sql.DB, filters map[string]string, limit, offset
 		}
 
 		// Retrieve images for the product
-		imgRows, err := db.Query(`
+		imgRows, err := db.QueryContext(ctx, `
 			SELECT image_url
 			FROM product_images
 			WHERE product_id = $1
@@ -380,7 +471,8 @@ func GetProductsWithFilters(db *sql.DB, filters map[string]string, limit, offset
 	return products, nil
 }
 
-func getCategoryIDByName(categoryName string) int {
+// CategoryIDByName maps the category names used in search filters to their IDs
+func CategoryIDByName(categoryName string) int {
 	categoryName = strings.ToLower(categoryName)
 	switch categoryName {
 	case "vegetables":
@@ -394,14 +486,17 @@ func getCategoryIDByName(categoryName string) int {
 	}
 }
 
-func GetProductImages(db *sql.DB, productID int) ([]string, error) {
+func GetProductImages(ctx context.Context, db *sql.DB, productID int) ([]string, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	// log.Printf("GetProductImages: Fetching images for productID %d", productID)
 	query := `
         SELECT image_url
         FROM product_images
         WHERE product_id = $1
     `
-	rows, err := db.Query(query, productID)
+	rows, err := db.QueryContext(ctx, query, productID)
 	if err != nil {
 		return nil, fmt.Errorf("GetProductImages: error executing query: %w", err)
 	}
@@ -423,9 +518,12 @@ func GetProductImages(db *sql.DB, productID int) ([]string, error) {
 	return images, nil
 }
 
-func GetFarmerLowStockProducts(db *sql.DB, farmerID int, threshold int) ([]Product, error) {
-	rows, err := db.Query(`
-        SELECT id, farmer_id, name, category_id, price, quantity, description, is_active, created_at, updated_at
+func GetFarmerLowStockProducts(ctx context.Context, db *sql.DB, farmerID int, threshold int) ([]Product, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT id, farmer_id, name, category_id, price, quantity, `+availableQuantityColumn("products")+`, description, is_active, created_at, updated_at
         FROM products
         WHERE farmer_id = $1 AND quantity <= $2 AND is_active = TRUE
     `, farmerID, threshold)
@@ -445,6 +543,7 @@ func GetFarmerLowStockProducts(db *sql.DB, farmerID int, threshold int) ([]Produ
 			&product.CategoryID,
 			&product.Price,
 			&product.Quantity,
+			&product.Available,
 			&product.Description,
 			&product.IsActive,
 			&product.CreatedAt,
@@ -454,7 +553,7 @@ func GetFarmerLowStockProducts(db *sql.DB, farmerID int, threshold int) ([]Produ
 			return nil, fmt.Errorf("GetFarmerLowStockProducts: error scanning row: %w", err)
 		}
 
-		images, err := GetProductImages(db, product.ID)
+		images, err := GetProductImages(ctx, db, product.ID)
 		if err != nil {
 			return nil, fmt.Errorf("GetFarmerLowStockProducts: error getting images: %w", err)
 		}
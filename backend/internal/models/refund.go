@@ -0,0 +1,577 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+)
+
+const (
+	RefundStatusRequested = "requested"
+	RefundStatusCompleted = "completed"
+	RefundStatusRejected  = "rejected"
+)
+
+var (
+	ErrNothingToRefund    = errors.New("nothing left to refund")
+	ErrRefundQuantity     = errors.New("refund quantity exceeds the purchased quantity")
+	ErrNotDelivered       = errors.New("only delivered items can be refunded")
+	ErrRefundNotPending   = errors.New("refund is not pending")
+	ErrPaymentNotCaptured = errors.New("payment has not been captured yet")
+)
+
+// Refund returns money for some or all of an order's line items
+type Refund struct {
+	ID               int          `json:"id"`
+	OrderID          int          `json:"order_id"`
+	Status           string       `json:"status"`
+	Reason           string       `json:"reason"`
+	Amount           float64      `json:"amount"`
+	Restock          bool         `json:"restock"`
+	RequestedByType  string       `json:"requested_by_type"`
+	RequestedByID    int          `json:"requested_by_id"`
+	ProcessedByType  string       `json:"processed_by_type,omitempty"`
+	ProcessedByID    int          `json:"processed_by_id,omitempty"`
+	ProviderRefundID string       `json:"provider_refund_id,omitempty"`
+	DecisionNote     string       `json:"decision_note,omitempty"`
+	CreatedAt        time.Time    `json:"created_at"`
+	ProcessedAt      *time.Time   `json:"processed_at,omitempty"`
+	Items            []RefundItem `json:"items"`
+}
+
+type RefundItem struct {
+	ID          int     `json:"id"`
+	RefundID    int     `json:"refund_id"`
+	OrderItemID int     `json:"order_item_id"`
+	ProductID   int     `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Quantity    int     `json:"quantity"`
+	Amount      float64 `json:"amount"`
+}
+
+// RefundLine selects a quantity of one order item
+type RefundLine struct {
+	OrderItemID int `json:"order_item_id" validate:"required,min=1"`
+	Quantity    int `json:"quantity" validate:"required,min=1"`
+}
+
+// RefundRequest describes a new refund. An empty Lines refunds everything
+// still refundable; FarmerID, when set, limits the refund to that farmer's items.
+type RefundRequest struct {
+	OrderID         int
+	FarmerID        int
+	Lines           []RefundLine
+	Reason          string
+	Restock         bool
+	RequestedByType string
+	RequestedByID   int
+}
+
+// RequestRefund records a buyer's refund request for an admin to review
+func RequestRefund(ctx context.Context, db *sql.DB, req RefundRequest) (*Refund, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	refund, err := createRefund(ctx, tx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// IssueRefund creates and immediately processes a refund on behalf of a farmer or admin
+func IssueRefund(ctx context.Context, db *sql.DB, provider payments.PaymentProvider, req RefundRequest) (*Refund, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	refund, err := createRefund(ctx, tx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := processRefund(ctx, tx, provider, refund, req.RequestedByType, req.RequestedByID, ""); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logUncommittedRefund(refund, err)
+		return nil, err
+	}
+	return refund, nil
+}
+
+// ApproveRefund processes a pending refund request
+func ApproveRefund(ctx context.Context, db *sql.DB, provider payments.PaymentProvider, refundID int, restock bool, actorType string, actorID int, note string) (*Refund, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	refund, err := getRefundForUpdate(ctx, tx, refundID)
+	if err != nil {
+		return nil, err
+	}
+	if refund.Status != RefundStatusRequested {
+		return nil, ErrRefundNotPending
+	}
+	refund.Restock = restock
+
+	if err := processRefund(ctx, tx, provider, refund, actorType, actorID, note); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logUncommittedRefund(refund, err)
+		return nil, err
+	}
+	return refund, nil
+}
+
+// RejectRefund declines a pending refund request
+func RejectRefund(ctx context.Context, db *sql.DB, refundID int, actorType string, actorID int, note string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE refunds
+		SET status = $1, processed_by_type = $2, processed_by_id = $3, decision_note = NULLIF($4, ''), processed_at = $5
+		WHERE id = $6 AND status = $7
+	`, RefundStatusRejected, actorType, actorID, note, time.Now(), refundID, RefundStatusRequested)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRefundNotPending
+	}
+	return nil
+}
+
+// GetPendingRefunds returns refund requests awaiting review, oldest first
+func GetPendingRefunds(ctx context.Context, db *sql.DB) ([]Refund, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+refundColumns+`
+		FROM refunds
+		WHERE status = $1
+		ORDER BY created_at ASC, id ASC
+	`, RefundStatusRequested)
+	if err != nil {
+		return nil, fmt.Errorf("GetPendingRefunds: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	var refunds []Refund
+	for rows.Next() {
+		var refund Refund
+		if err := scanRefund(rows, &refund); err != nil {
+			return nil, fmt.Errorf("GetPendingRefunds: error scanning row: %w", err)
+		}
+		refunds = append(refunds, refund)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetPendingRefunds: rows error: %w", err)
+	}
+
+	for i := range refunds {
+		items, err := getRefundItems(ctx, db, refunds[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		refunds[i].Items = items
+	}
+
+	return refunds, nil
+}
+
+// GetRefundsByOrderID returns every refund of an order, oldest first
+func GetRefundsByOrderID(ctx context.Context, db *sql.DB, orderID int) ([]Refund, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+refundColumns+`
+		FROM refunds
+		WHERE order_id = $1
+		ORDER BY created_at ASC, id ASC
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("GetRefundsByOrderID: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	refunds := []Refund{}
+	for rows.Next() {
+		var refund Refund
+		if err := scanRefund(rows, &refund); err != nil {
+			return nil, fmt.Errorf("GetRefundsByOrderID: error scanning row: %w", err)
+		}
+		refunds = append(refunds, refund)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetRefundsByOrderID: rows error: %w", err)
+	}
+
+	for i := range refunds {
+		items, err := getRefundItems(ctx, db, refunds[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		refunds[i].Items = items
+	}
+
+	return refunds, nil
+}
+
+const refundColumns = `id, order_id, status, reason, amount, restock, requested_by_type, requested_by_id,
+	COALESCE(processed_by_type, ''), COALESCE(processed_by_id, 0), COALESCE(provider_refund_id, ''),
+	COALESCE(decision_note, ''), created_at, processed_at`
+
+func scanRefund(row interface{ Scan(...interface{}) error }, r *Refund) error {
+	return row.Scan(
+		&r.ID,
+		&r.OrderID,
+		&r.Status,
+		&r.Reason,
+		&r.Amount,
+		&r.Restock,
+		&r.RequestedByType,
+		&r.RequestedByID,
+		&r.ProcessedByType,
+		&r.ProcessedByID,
+		&r.ProviderRefundID,
+		&r.DecisionNote,
+		&r.CreatedAt,
+		&r.ProcessedAt,
+	)
+}
+
+func getRefundItems(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}, refundID int) ([]RefundItem, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT ri.id, ri.refund_id, ri.order_item_id, oi.product_id, oi.product_name, ri.quantity, ri.amount
+		FROM refund_items ri
+		JOIN order_items oi ON oi.id = ri.order_item_id
+		WHERE ri.refund_id = $1
+		ORDER BY ri.id
+	`, refundID)
+	if err != nil {
+		return nil, fmt.Errorf("getRefundItems: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	var items []RefundItem
+	for rows.Next() {
+		var item RefundItem
+		err := rows.Scan(&item.ID, &item.RefundID, &item.OrderItemID, &item.ProductID, &item.ProductName, &item.Quantity, &item.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("getRefundItems: error scanning row: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getRefundItems: rows error: %w", err)
+	}
+
+	return items, nil
+}
+
+func getRefundForUpdate(ctx context.Context, tx *sql.Tx, refundID int) (*Refund, error) {
+	var refund Refund
+	row := tx.QueryRowContext(ctx, `SELECT `+refundColumns+` FROM refunds WHERE id = $1 FOR UPDATE`, refundID)
+	if err := scanRefund(row, &refund); err != nil {
+		return nil, err
+	}
+
+	items, err := getRefundItems(ctx, tx, refund.ID)
+	if err != nil {
+		return nil, err
+	}
+	refund.Items = items
+
+	return &refund, nil
+}
+
+// refundableItem is an order line together with what is left to refund on it
+type refundableItem struct {
+	id             int
+	subOrderID     int
+	farmerID       int
+	productID      int
+	productName    string
+	unitPrice      float64
+	remaining      int
+	subOrderStatus string
+}
+
+// createRefund validates the requested lines against the order and inserts
+// the refund with status requested
+func createRefund(ctx context.Context, tx *sql.Tx, req RefundRequest) (*Refund, error) {
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM orders WHERE id = $1 FOR UPDATE`, req.OrderID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT oi.id, oi.sub_order_id, oi.farmer_id, oi.product_id, oi.product_name, oi.unit_price,
+			oi.quantity - oi.refunded_quantity, so.status
+		FROM order_items oi
+		JOIN sub_orders so ON so.id = oi.sub_order_id
+		WHERE oi.order_id = $1
+		ORDER BY oi.id
+	`, req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	available := make(map[int]refundableItem)
+	var order []int
+	for rows.Next() {
+		var item refundableItem
+		err := rows.Scan(&item.id, &item.subOrderID, &item.farmerID, &item.productID, &item.productName, &item.unitPrice, &item.remaining, &item.subOrderStatus)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if req.FarmerID != 0 && item.farmerID != req.FarmerID {
+			continue
+		}
+		available[item.id] = item
+		order = append(order, item.id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(order) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	lines := req.Lines
+	if len(lines) == 0 {
+		for _, id := range order {
+			if available[id].remaining > 0 && available[id].subOrderStatus == OrderStatusDelivered {
+				lines = append(lines, RefundLine{OrderItemID: id, Quantity: available[id].remaining})
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return nil, ErrNothingToRefund
+	}
+
+	refund := &Refund{
+		OrderID:         req.OrderID,
+		Status:          RefundStatusRequested,
+		Reason:          req.Reason,
+		Restock:         req.Restock,
+		RequestedByType: req.RequestedByType,
+		RequestedByID:   req.RequestedByID,
+		CreatedAt:       time.Now(),
+	}
+
+	requested := make(map[int]int)
+	for _, line := range lines {
+		item, ok := available[line.OrderItemID]
+		if !ok {
+			return nil, fmt.Errorf("%w: order item %d is not part of this order", ErrRefundQuantity, line.OrderItemID)
+		}
+		if item.subOrderStatus != OrderStatusDelivered {
+			return nil, ErrNotDelivered
+		}
+		requested[line.OrderItemID] += line.Quantity
+		if line.Quantity < 1 || requested[line.OrderItemID] > item.remaining {
+			return nil, ErrRefundQuantity
+		}
+
+		amount := item.unitPrice * float64(line.Quantity)
+		refund.Amount += amount
+		refund.Items = append(refund.Items, RefundItem{
+			OrderItemID: item.id,
+			ProductID:   item.productID,
+			ProductName: item.productName,
+			Quantity:    line.Quantity,
+			Amount:      amount,
+		})
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO refunds (order_id, status, reason, amount, restock, requested_by_type, requested_by_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, refund.OrderID, refund.Status, refund.Reason, refund.Amount, refund.Restock, refund.RequestedByType, refund.RequestedByID, refund.CreatedAt).Scan(&refund.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range refund.Items {
+		item := &refund.Items[i]
+		item.RefundID = refund.ID
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO refund_items (refund_id, order_item_id, quantity, amount)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, item.RefundID, item.OrderItemID, item.Quantity, item.Amount).Scan(&item.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return refund, nil
+}
+
+// processRefund marks the refunded quantities, optionally restocks them, returns
+// the money through the payment provider for card orders and rolls the order
+// status forward. The refund row must be locked by the caller.
+func processRefund(ctx context.Context, tx *sql.Tx, provider payments.PaymentProvider, refund *Refund, actorType string, actorID int, note string) error {
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM orders WHERE id = $1 FOR UPDATE`, refund.OrderID); err != nil {
+		return err
+	}
+
+	touchedSubOrders := make(map[int]bool)
+	for _, item := range refund.Items {
+		var subOrderID int
+		err := tx.QueryRowContext(ctx, `
+			UPDATE order_items
+			SET refunded_quantity = refunded_quantity + $1
+			WHERE id = $2 AND refunded_quantity + $1 <= quantity
+			RETURNING sub_order_id
+		`, item.Quantity, item.OrderItemID).Scan(&subOrderID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRefundQuantity
+		} else if err != nil {
+			return err
+		}
+		touchedSubOrders[subOrderID] = true
+
+		if refund.Restock {
+			err := adjustStock(ctx, tx, item.ProductID, item.Quantity, InventoryMovement{
+				MovementType: MovementRefundReturn,
+				ActorType:    actorType,
+				ActorID:      actorID,
+				Reason:       refund.Reason,
+				OrderID:      refund.OrderID,
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				continue // the product has since been deleted
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Card orders are refunded through the provider; cash is handed back in person
+	var paymentID int
+	var providerRef, paymentStatus string
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, provider_ref, status FROM payments WHERE order_id = $1 FOR UPDATE
+	`, refund.OrderID).Scan(&paymentID, &providerRef, &paymentStatus)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil {
+		if paymentStatus != PaymentStatusCaptured {
+			return ErrPaymentNotCaptured
+		}
+
+		providerRefund, err := provider.Refund(ctx, providerRef, payments.ToMinorUnits(refund.Amount), refund.Reason)
+		if err != nil {
+			return fmt.Errorf("provider refund failed: %w", err)
+		}
+		refund.ProviderRefundID = providerRefund.ID
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE payments
+			SET refunded_amount = refunded_amount + $1,
+				status = CASE WHEN refunded_amount + $1 >= captured_amount THEN $2 ELSE status END,
+				updated_at = $3
+			WHERE id = $4
+		`, refund.Amount, PaymentStatusRefunded, time.Now(), paymentID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Sub-orders whose every item has now been refunded move to refunded
+	for subOrderID := range touchedSubOrders {
+		var status string
+		var outstanding int
+		err := tx.QueryRowContext(ctx, `
+			SELECT so.status, COALESCE(SUM(oi.quantity - oi.refunded_quantity), 0)
+			FROM sub_orders so
+			JOIN order_items oi ON oi.sub_order_id = so.id
+			WHERE so.id = $1
+			GROUP BY so.status
+		`, subOrderID).Scan(&status, &outstanding)
+		if err != nil {
+			return err
+		}
+		if outstanding > 0 || !CanTransition(status, OrderStatusRefunded) {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE sub_orders SET status = $1, updated_at = $2 WHERE id = $3`, OrderStatusRefunded, time.Now(), subOrderID)
+		if err != nil {
+			return err
+		}
+		if err := recordOrderStatusChange(ctx, tx, refund.OrderID, subOrderID, status, OrderStatusRefunded, actorType, actorID, refund.Reason); err != nil {
+			return err
+		}
+	}
+
+	if _, err := syncOrderStatus(ctx, tx, refund.OrderID, actorType, actorID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refunds
+		SET status = $1, restock = $2, processed_by_type = $3, processed_by_id = $4,
+			provider_refund_id = NULLIF($5, ''), decision_note = NULLIF($6, ''), processed_at = $7
+		WHERE id = $8
+	`, RefundStatusCompleted, refund.Restock, actorType, actorID, refund.ProviderRefundID, note, now, refund.ID)
+	if err != nil {
+		return err
+	}
+
+	refund.Status = RefundStatusCompleted
+	refund.ProcessedByType = actorType
+	refund.ProcessedByID = actorID
+	refund.DecisionNote = note
+	refund.ProcessedAt = &now
+	return nil
+}
+
+// logUncommittedRefund flags money that left through the provider without a matching record
+func logUncommittedRefund(refund *Refund, err error) {
+	if refund.ProviderRefundID != "" {
+		log.Printf("CRITICAL: provider refund %s for order %d (%.2f) was issued but not recorded: %v",
+			refund.ProviderRefundID, refund.OrderID, refund.Amount, err)
+	}
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInsufficientStock is returned when a cart asks for more than is left once
+// other buyers' holds are taken into account
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// reservedQuantityExpr sums the live holds on a product; %s is the products table alias
+const reservedQuantityExpr = `COALESCE((SELECT SUM(sr.quantity) FROM stock_reservations sr WHERE sr.product_id = %s.id AND sr.expires_at > NOW()), 0)`
+
+// availableQuantityColumn selects quantity minus reserved stock for the given products alias
+func availableQuantityColumn(alias string) string {
+	return fmt.Sprintf("%s.quantity - "+reservedQuantityExpr, alias, alias)
+}
+
+// lockAvailableStock locks the product row and returns how many units the buyer
+// may hold: the stock minus what other buyers currently have reserved
+func lockAvailableStock(ctx context.Context, tx *sql.Tx, productID, buyerID int) (int, error) {
+	var quantity int
+	err := tx.QueryRowContext(ctx, `SELECT quantity FROM products WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, productID).Scan(&quantity)
+	if err != nil {
+		return 0, err
+	}
+
+	var reserved int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(quantity), 0)
+		FROM stock_reservations
+		WHERE product_id = $1 AND buyer_id <> $2 AND expires_at > NOW()
+	`, productID, buyerID).Scan(&reserved)
+	if err != nil {
+		return 0, err
+	}
+
+	return quantity - reserved, nil
+}
+
+// reserveStock creates or refreshes the buyer's hold on a product. A zero ttl
+// means reservations are turned off and nothing is held.
+func reserveStock(ctx context.Context, tx *sql.Tx, buyerID, productID, quantity int, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	// An expired hold the sweeper has not reached yet is released first, so
+	// the upsert below does not overwrite it without a trace
+	if _, err := releaseExpiredHolds(ctx, tx, buyerID, productID); err != nil {
+		return err
+	}
+
+	var previous int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(quantity), 0) FROM stock_reservations
+		WHERE buyer_id = $1 AND product_id = $2 AND expires_at > NOW()
+	`, buyerID, productID).Scan(&previous)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO stock_reservations (buyer_id, product_id, quantity, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (buyer_id, product_id)
+		DO UPDATE SET quantity = EXCLUDED.quantity, expires_at = EXCLUDED.expires_at
+	`, buyerID, productID, quantity, time.Now().Add(ttl))
+	if err != nil {
+		return err
+	}
+
+	return recordReservationMovement(ctx, tx, productID, quantity-previous, MovementReservation, "buyer", buyerID, "held in cart")
+}
+
+// releaseReservation drops the buyer's hold on one product, or on every product when productID is 0
+func releaseReservation(ctx context.Context, tx *sql.Tx, buyerID, productID int, reason string) error {
+	if _, err := releaseExpiredHolds(ctx, tx, buyerID, productID); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM stock_reservations
+		WHERE buyer_id = $1 AND ($2 = 0 OR product_id = $2)
+		RETURNING product_id, quantity
+	`, buyerID, productID)
+	if err != nil {
+		return err
+	}
+
+	released := make(map[int]int)
+	for rows.Next() {
+		var releasedProductID, quantity int
+		if err := rows.Scan(&releasedProductID, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		released[releasedProductID] = quantity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for releasedProductID, quantity := range released {
+		err := recordReservationMovement(ctx, tx, releasedProductID, -quantity, MovementReservationRelease, "buyer", buyerID, reason)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseExpiredReservations deletes holds whose time ran out. The items stay in
+// the buyers' carts but no longer count against other buyers.
+func ReleaseExpiredReservations(ctx context.Context, db *sql.DB) (int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	released, err := releaseExpiredHolds(ctx, tx, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return released, nil
+}
+
+// releaseExpiredHolds deletes the holds whose time ran out and records the
+// release of each. A zero buyerID or productID matches every buyer or product.
+func releaseExpiredHolds(ctx context.Context, tx *sql.Tx, buyerID, productID int) (int, error) {
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM stock_reservations
+		WHERE expires_at <= NOW() AND ($1 = 0 OR buyer_id = $1) AND ($2 = 0 OR product_id = $2)
+		RETURNING buyer_id, product_id, quantity
+	`, buyerID, productID)
+	if err != nil {
+		return 0, err
+	}
+
+	type expiredHold struct {
+		buyerID, productID, quantity int
+	}
+	var expired []expiredHold
+	for rows.Next() {
+		var hold expiredHold
+		if err := rows.Scan(&hold.buyerID, &hold.productID, &hold.quantity); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, hold)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, hold := range expired {
+		reason := fmt.Sprintf("cart hold of buyer %d expired", hold.buyerID)
+		err := recordReservationMovement(ctx, tx, hold.productID, -hold.quantity, MovementReservationRelease, "system", 0, reason)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
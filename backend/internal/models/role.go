@@ -0,0 +1,75 @@
+package models
+
+// Role is what an admin is allowed to do, as a set of permissions
+type Role string
+
+const (
+	RoleSuperAdmin Role = "super_admin"
+	RoleModerator  Role = "moderator"
+	RoleSupport    Role = "support"
+	RoleFinance    Role = "finance"
+)
+
+// Roles lists the roles in the order the dashboard offers them
+var Roles = []Role{RoleSuperAdmin, RoleModerator, RoleSupport, RoleFinance}
+
+// Permission guards a group of admin pages and actions
+type Permission string
+
+const (
+	// PermReviewFarmers covers the pending farmer list, profiles, approval and rejection
+	PermReviewFarmers Permission = "farmers.review"
+	// PermViewUsers covers the farmer and buyer list
+	PermViewUsers Permission = "users.view"
+	// PermManageUsers covers editing, deactivating and deleting farmers and buyers
+	PermManageUsers Permission = "users.manage"
+	// PermManageRefunds covers issuing refunds and deciding refund requests
+	PermManageRefunds Permission = "refunds.manage"
+	// PermManageDeliveries covers retrying failed emails and notifications and previewing emails
+	PermManageDeliveries Permission = "deliveries.manage"
+	// PermManageAdmins covers inviting admins and assigning roles
+	PermManageAdmins Permission = "admins.manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleSuperAdmin: {PermReviewFarmers, PermViewUsers, PermManageUsers, PermManageRefunds, PermManageDeliveries, PermManageAdmins},
+	RoleModerator:  {PermReviewFarmers, PermViewUsers, PermManageUsers},
+	RoleSupport:    {PermViewUsers, PermManageDeliveries},
+	RoleFinance:    {PermViewUsers, PermManageRefunds},
+}
+
+// Valid reports whether r is one of Roles
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants permission p
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Label is the role's name as the dashboard shows it
+func (r Role) Label() string {
+	switch r {
+	case RoleSuperAdmin:
+		return "Super admin"
+	case RoleModerator:
+		return "Moderator"
+	case RoleSupport:
+		return "Support"
+	case RoleFinance:
+		return "Finance"
+	}
+	return string(r)
+}
+
+// Permissions lists what the role grants
+func (r Role) Permissions() []Permission {
+	return append([]Permission(nil), rolePermissions[r]...)
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// Session ties a session cookie to an admin, farmer or buyer
+type Session struct {
+	ID        string
+	UserID    int
+	UserType  string // "admin", "farmer" or "buyer"
+	ExpiresAt time.Time
+}
+
+// NewSession creates a session with a random ID that is valid for ttl; it still has to be saved
+func NewSession(userID int, userType string, ttl time.Duration) (*Session, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		ID:        hex.EncodeToString(bytes),
+		UserID:    userID,
+		UserType:  userType,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+func (s *Session) Expired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+func CreateSession(ctx context.Context, db *sql.DB, session *Session) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO sessions (session_id, user_id, user_type, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, session.ID, session.UserID, session.UserType, session.ExpiresAt)
+	return err
+}
+
+func GetSession(ctx context.Context, db *sql.DB, sessionID string) (*Session, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	session := &Session{ID: sessionID}
+	err := db.QueryRowContext(ctx, `
+		SELECT user_id, user_type, expires_at FROM sessions WHERE session_id = $1
+	`, sessionID).Scan(&session.UserID, &session.UserType, &session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func DeleteSession(ctx context.Context, db *sql.DB, sessionID string) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM sessions WHERE session_id = $1`, sessionID)
+	return err
+}
@@ -0,0 +1,489 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SubOrder is the part of an order fulfilled by a single farmer
+type SubOrder struct {
+	ID             int         `json:"id"`
+	OrderID        int         `json:"order_id"`
+	FarmerID       int         `json:"farmer_id"`
+	Status         string      `json:"status"`
+	DeliveryMethod string      `json:"delivery_method"`
+	PaymentStatus  string      `json:"payment_status"`
+	PaidAt         *time.Time  `json:"paid_at,omitempty"`
+	Subtotal       float64     `json:"subtotal"`
+	ItemCount      int         `json:"item_count"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+	Items          []OrderItem `json:"items,omitempty"`
+}
+
+const subOrderColumns = `so.id, so.order_id, so.farmer_id, so.status, so.delivery_method, so.payment_status, so.paid_at, so.subtotal, so.item_count, so.created_at, so.updated_at`
+
+func scanSubOrder(row interface{ Scan(...interface{}) error }, so *SubOrder) error {
+	return row.Scan(
+		&so.ID,
+		&so.OrderID,
+		&so.FarmerID,
+		&so.Status,
+		&so.DeliveryMethod,
+		&so.PaymentStatus,
+		&so.PaidAt,
+		&so.Subtotal,
+		&so.ItemCount,
+		&so.CreatedAt,
+		&so.UpdatedAt,
+	)
+}
+
+// GetSubOrdersByOrderID returns the sub-orders of an order without their items
+func GetSubOrdersByOrderID(ctx context.Context, db *sql.DB, orderID int) ([]SubOrder, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+subOrderColumns+`
+		FROM sub_orders so
+		WHERE so.order_id = $1
+		ORDER BY so.id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("GetSubOrdersByOrderID: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	var subOrders []SubOrder
+	for rows.Next() {
+		var so SubOrder
+		if err := scanSubOrder(rows, &so); err != nil {
+			return nil, fmt.Errorf("GetSubOrdersByOrderID: error scanning row: %w", err)
+		}
+		subOrders = append(subOrders, so)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetSubOrdersByOrderID: rows error: %w", err)
+	}
+
+	return subOrders, nil
+}
+
+// GetSubOrdersByFarmerID returns one page of the farmer's sub-orders (newest
+// first) with their items, together with the total matching the filter
+func GetSubOrdersByFarmerID(ctx context.Context, db *sql.DB, farmerID int, filter OrderFilter) ([]SubOrder, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	conditions := []string{"so.farmer_id = $1"}
+	params := []interface{}{farmerID}
+	paramCounter := 2
+
+	if filter.Status != "" {
+		conditions = append(conditions, fmt.Sprintf("so.status = $%d", paramCounter))
+		params = append(params, filter.Status)
+		paramCounter++
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("so.created_at >= $%d", paramCounter))
+		params = append(params, filter.From)
+		paramCounter++
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("so.created_at < $%d", paramCounter))
+		params = append(params, filter.To)
+		paramCounter++
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sub_orders so"+where, params...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("GetSubOrdersByFarmerID: error counting sub-orders: %w", err)
+	}
+
+	query := `
+		SELECT ` + subOrderColumns + `
+		FROM sub_orders so` + where +
+		fmt.Sprintf(" ORDER BY so.created_at DESC, so.id DESC LIMIT $%d OFFSET $%d", paramCounter, paramCounter+1)
+	params = append(params, filter.Limit, filter.Offset)
+
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("GetSubOrdersByFarmerID: error executing query: %w", err)
+	}
+	defer rows.Close()
+
+	subOrders := []SubOrder{}
+	for rows.Next() {
+		var so SubOrder
+		if err := scanSubOrder(rows, &so); err != nil {
+			return nil, 0, fmt.Errorf("GetSubOrdersByFarmerID: error scanning row: %w", err)
+		}
+		subOrders = append(subOrders, so)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("GetSubOrdersByFarmerID: rows error: %w", err)
+	}
+
+	for i := range subOrders {
+		items, err := getSubOrderItems(ctx, db, subOrders[i].OrderID, subOrders[i].ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		subOrders[i].Items = items
+	}
+
+	return subOrders, total, nil
+}
+
+// GetSubOrderForFarmer returns the farmer's sub-order of an order with its items.
+// Returns sql.ErrNoRows if the order has none of the farmer's products.
+func GetSubOrderForFarmer(ctx context.Context, db *sql.DB, orderID, farmerID int) (*SubOrder, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	var so SubOrder
+	row := db.QueryRowContext(ctx, `
+		SELECT `+subOrderColumns+`
+		FROM sub_orders so
+		WHERE so.order_id = $1 AND so.farmer_id = $2
+	`, orderID, farmerID)
+	if err := scanSubOrder(row, &so); err != nil {
+		return nil, err
+	}
+
+	items, err := getSubOrderItems(ctx, db, so.OrderID, so.ID)
+	if err != nil {
+		return nil, err
+	}
+	so.Items = items
+
+	return &so, nil
+}
+
+// UpdateSubOrderStatus advances the farmer's sub-order of an order and rolls
+// the change up to the parent order. Cancelling returns the items to stock.
+// Returns sql.ErrNoRows if the order has none of the farmer's products.
+func UpdateSubOrderStatus(ctx context.Context, db *sql.DB, orderID, farmerID int, status, note string) (*SubOrder, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	if !IsValidOrderStatus(status) {
+		return nil, ErrUnknownStatus
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the parent first so concurrent farmers roll up one at a time
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM orders WHERE id = $1 FOR UPDATE`, orderID); err != nil {
+		return nil, err
+	}
+
+	var subOrderID int
+	var current, deliveryMethod string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, status, delivery_method
+		FROM sub_orders
+		WHERE order_id = $1 AND farmer_id = $2
+		FOR UPDATE
+	`, orderID, farmerID).Scan(&subOrderID, &current, &deliveryMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckFarmerTransition(current, status, deliveryMethod); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE sub_orders SET status = $1, updated_at = $2 WHERE id = $3`, status, time.Now(), subOrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == OrderStatusCancelled {
+		if err := restockSubOrderItems(ctx, tx, orderID, subOrderID, "farmer", farmerID, note); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := recordOrderStatusChange(ctx, tx, orderID, subOrderID, current, status, "farmer", farmerID, note); err != nil {
+		return nil, err
+	}
+
+	if _, err := syncOrderStatus(ctx, tx, orderID, "farmer", farmerID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetSubOrderForFarmer(ctx, db, orderID, farmerID)
+}
+
+// syncOrderStatus recomputes the parent order status from its sub-orders,
+// recording a history row when it changes and queueing the payment settlement
+// once the order is delivered or cancelled. Returns the resulting status.
+func syncOrderStatus(ctx context.Context, tx *sql.Tx, orderID int, actorType string, actorID int) (string, error) {
+	var current string
+	if err := tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE id = $1`, orderID).Scan(&current); err != nil {
+		return "", err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT status FROM sub_orders WHERE order_id = $1`, orderID)
+	if err != nil {
+		return "", err
+	}
+	var statuses []string
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			rows.Close()
+			return "", err
+		}
+		statuses = append(statuses, status)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	rolled := RollUpOrderStatus(statuses)
+	if rolled == current {
+		return current, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3`, rolled, time.Now(), orderID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := recordOrderStatusChange(ctx, tx, orderID, 0, current, rolled, actorType, actorID, ""); err != nil {
+		return "", err
+	}
+
+	// Fulfillment is over: the outbox worker captures or voids the payment,
+	// retrying until the provider answers
+	if rolled == OrderStatusDelivered || rolled == OrderStatusCancelled {
+		if err := enqueueOutbox(ctx, tx, []OutboxEntry{SettlementEntry(orderID)}); err != nil {
+			return "", err
+		}
+	}
+
+	return rolled, nil
+}
+
+// restockSubOrderItems returns the purchased quantities of a cancelled sub-order to product stock
+func restockSubOrderItems(ctx context.Context, tx *sql.Tx, orderID, subOrderID int, actorType string, actorID int, reason string) error {
+	rows, err := tx.QueryContext(ctx, `SELECT product_id, quantity FROM order_items WHERE sub_order_id = $1 ORDER BY id`, subOrderID)
+	if err != nil {
+		return err
+	}
+
+	var items []OrderItem
+	for rows.Next() {
+		var item OrderItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		err := adjustStock(ctx, tx, item.ProductID, item.Quantity, InventoryMovement{
+			MovementType: MovementCancellationReturn,
+			ActorType:    actorType,
+			ActorID:      actorID,
+			Reason:       reason,
+			OrderID:      orderID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // the product has since been deleted
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getSubOrderItems(ctx context.Context, db *sql.DB, orderID, subOrderID int) ([]OrderItem, error) {
+	items, err := GetOrderItems(ctx, db, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var subOrderItems []OrderItem
+	for _, item := range items {
+		if item.SubOrderID == subOrderID {
+			subOrderItems = append(subOrderItems, item)
+		}
+	}
+	return subOrderItems, nil
+}
+
+// MarkSubOrderPaid records that the farmer collected cash for their sub-order.
+// Returns sql.ErrNoRows if the order has none of the farmer's products.
+func MarkSubOrderPaid(ctx context.Context, db *sql.DB, orderID, farmerID int) (*SubOrder, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var subOrderID int
+	var status, paymentStatus string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, status, payment_status
+		FROM sub_orders
+		WHERE order_id = $1 AND farmer_id = $2
+		FOR UPDATE
+	`, orderID, farmerID).Scan(&subOrderID, &status, &paymentStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case paymentStatus == SubOrderPaymentPaid:
+		return nil, ErrAlreadyPaid
+	case paymentStatus != SubOrderPaymentUnpaid:
+		return nil, ErrNotCashPayment
+	case status == OrderStatusCancelled || status == OrderStatusRefunded:
+		return nil, ErrOrderClosed
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE sub_orders SET payment_status = $1, paid_at = $2, updated_at = $2 WHERE id = $3
+	`, SubOrderPaymentPaid, now, subOrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetSubOrderForFarmer(ctx, db, orderID, farmerID)
+}
+
+// CancelUnpaidSubOrders cancels cash sub-orders still unpaid after the payment
+// window (created before cutoff) and returns their items to stock. Sub-orders
+// already out for delivery are left for the farmer to settle. Returns the
+// number of sub-orders cancelled.
+func CancelUnpaidSubOrders(ctx context.Context, db *sql.DB, cutoff time.Time) (int, error) {
+	cancellable := []string{}
+	for from := range orderTransitions {
+		if CanTransition(from, OrderStatusCancelled) {
+			cancellable = append(cancellable, from)
+		}
+	}
+
+	// Each cancellation below gets its own timeout, so only the lookup is bounded here
+	listCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(listCtx, `
+		SELECT id, order_id
+		FROM sub_orders
+		WHERE payment_status = $1 AND created_at < $2 AND status = ANY($3)
+		ORDER BY id
+	`, SubOrderPaymentUnpaid, cutoff, pq.Array(cancellable))
+	if err != nil {
+		return 0, fmt.Errorf("CancelUnpaidSubOrders: error executing query: %w", err)
+	}
+
+	type expired struct{ subOrderID, orderID int }
+	var candidates []expired
+	for rows.Next() {
+		var e expired
+		if err := rows.Scan(&e.subOrderID, &e.orderID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("CancelUnpaidSubOrders: error scanning row: %w", err)
+		}
+		candidates = append(candidates, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("CancelUnpaidSubOrders: rows error: %w", err)
+	}
+
+	cancelled := 0
+	for _, e := range candidates {
+		ok, err := cancelUnpaidSubOrder(ctx, db, e.orderID, e.subOrderID, cutoff)
+		if err != nil {
+			return cancelled, fmt.Errorf("CancelUnpaidSubOrders: sub-order %d: %w", e.subOrderID, err)
+		}
+		if ok {
+			cancelled++
+		}
+	}
+
+	return cancelled, nil
+}
+
+// cancelUnpaidSubOrder re-checks the sub-order under lock, since the farmer may
+// have marked it paid or moved it on since it was selected
+func cancelUnpaidSubOrder(ctx context.Context, db *sql.DB, orderID, subOrderID int, cutoff time.Time) (bool, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM orders WHERE id = $1 FOR UPDATE`, orderID); err != nil {
+		return false, err
+	}
+
+	var status, paymentStatus string
+	var createdAt time.Time
+	err = tx.QueryRowContext(ctx, `
+		SELECT status, payment_status, created_at FROM sub_orders WHERE id = $1 FOR UPDATE
+	`, subOrderID).Scan(&status, &paymentStatus, &createdAt)
+	if err != nil {
+		return false, err
+	}
+	if paymentStatus != SubOrderPaymentUnpaid || !createdAt.Before(cutoff) || !CanTransition(status, OrderStatusCancelled) {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE sub_orders SET status = $1, updated_at = $2 WHERE id = $3`, OrderStatusCancelled, time.Now(), subOrderID)
+	if err != nil {
+		return false, err
+	}
+	if err := restockSubOrderItems(ctx, tx, orderID, subOrderID, "system", 0, "payment window expired"); err != nil {
+		return false, err
+	}
+	if err := recordOrderStatusChange(ctx, tx, orderID, subOrderID, status, OrderStatusCancelled, "system", 0, "payment window expired"); err != nil {
+		return false, err
+	}
+	if _, err := syncOrderStatus(ctx, tx, orderID, "system", 0); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
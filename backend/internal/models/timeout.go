@@ -0,0 +1,24 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// QueryTimeout bounds each exported function in this package that talks to
+// the database, on top of any deadline the caller's context already carries.
+// Zero disables it. Functions that call the payment provider in the middle of
+// a transaction (SettleOrderPayment, IssueRefund, ApproveRefund) are only
+// bounded by the caller's context, so a slow gateway is not cut off between
+// charging and recording the charge. Checkout authorizes before its
+// transaction and bounds the cart total query and the transaction but not the
+// authorization. CancelUnpaidSubOrders applies it to each sub-order it
+// cancels rather than to the whole batch.
+var QueryTimeout = 5 * time.Second
+
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, QueryTimeout)
+}
@@ -0,0 +1,181 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/validation"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// SchemaOf returns the schema of the JSON encoding of v. Named struct types
+// are added to the document's components and referenced by name; fields
+// follow their json tags like encoding/json does, and their validate tags
+// become required fields and constraints.
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	return d.schemaFor(reflect.TypeOf(v))
+}
+
+// Ref references a schema in the document's components
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (d *Document) schemaFor(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := d.schemaFor(t.Elem())
+		if schema.Ref != "" {
+			return schema
+		}
+		schema.Nullable = true
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: d.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			// Registered before the fields, so a type that refers to itself terminates
+			d.Components.Schemas[t.Name()] = &Schema{Type: "object"}
+			d.Components.Schemas[t.Name()] = d.structSchema(t)
+		}
+		return Ref(t.Name())
+	}
+	// interface{} and anything else JSON can hold
+	return &Schema{}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	d.addFields(schema, t)
+	return schema
+}
+
+func (d *Document) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				d.addFields(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := d.schemaFor(field.Type)
+		if tag, ok := field.Tag.Lookup("validate"); ok {
+			if constrain(property, validation.ParseTag(tag)) {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// constrain adds the rules of a validate tag to a field's schema and reports
+// whether the field is required
+func constrain(schema *Schema, rules []validation.Rule) bool {
+	required := false
+	for i, rule := range rules {
+		if rule.Name == "required" {
+			required = true
+			continue
+		}
+		if schema.Ref != "" {
+			// The constraints would change the shared component
+			continue
+		}
+		switch rule.Name {
+		case "dive":
+			target := schema.Items
+			if schema.Type == "object" {
+				target = schema.AdditionalProperties
+			}
+			if target != nil {
+				constrain(target, rules[i+1:])
+			}
+			return required
+		case "min", "max":
+			limit, err := strconv.ParseFloat(rule.Param, 64)
+			if err != nil {
+				continue
+			}
+			count := int(limit)
+			switch schema.Type {
+			case "string":
+				if rule.Name == "min" {
+					schema.MinLength = &count
+				} else {
+					schema.MaxLength = &count
+				}
+			case "array":
+				if rule.Name == "min" {
+					schema.MinItems = &count
+				} else {
+					schema.MaxItems = &count
+				}
+			case "integer", "number":
+				if rule.Name == "min" {
+					schema.Minimum = &limit
+				} else {
+					schema.Maximum = &limit
+				}
+			}
+		case "email":
+			schema.Format = "email"
+		case "password":
+			schema.Format = "password"
+			schema.Description = "At least 8 characters with a letter and a digit, and at most " + strconv.Itoa(validation.MaxPasswordBytes) + " bytes"
+		case "url":
+			schema.Format = "uri"
+		case "oneof":
+			schema.Enum = strings.Fields(rule.Param)
+		}
+	}
+	return required
+}
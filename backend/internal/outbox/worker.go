@@ -0,0 +1,144 @@
+// Package outbox delivers the emails, notifications, payment settlements and
+// voids that handlers queue in the outbox table alongside the change that caused them.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/email"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/store"
+)
+
+// Worker claims due outbox entries and delivers them. A failed delivery is
+// retried after a backoff that doubles with every attempt, up to MaxBackoff;
+// after MaxAttempts the entry is dead-lettered for an admin to retry.
+type Worker struct {
+	Outbox         store.OutboxStore
+	Notifications  store.NotificationStore
+	PaymentRecords store.PaymentStore
+	Mailer         email.Mailer
+	Payments       payments.PaymentProvider
+	Settings       config.Outbox
+}
+
+func NewWorker(stores *store.Store, mailer email.Mailer, provider payments.PaymentProvider, settings config.Outbox) *Worker {
+	return &Worker{
+		Outbox:         stores.Outbox,
+		Notifications:  stores.Notifications,
+		PaymentRecords: stores.Payments,
+		Mailer:         mailer,
+		Payments:       provider,
+		Settings:       settings,
+	}
+}
+
+// DeliverDue works through the due entries, a batch at a time, until none are
+// left or ctx is cancelled. Delivery failures are recorded on the entry rather
+// than returned.
+func (w *Worker) DeliverDue(ctx context.Context) error {
+	for {
+		entries, err := w.Outbox.Claim(ctx, w.Settings.BatchSize, w.Settings.Lease)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				// The rest of the batch is picked up again once its lease runs out
+				return err
+			}
+			if err := w.deliverOne(ctx, entry); err != nil {
+				return err
+			}
+		}
+
+		if len(entries) < w.Settings.BatchSize {
+			return nil
+		}
+	}
+}
+
+// deliverOne attempts one entry and records the outcome; it only returns an
+// error when the outcome could not be saved
+func (w *Worker) deliverOne(ctx context.Context, entry models.OutboxEntry) error {
+	deliveryErr := w.deliver(ctx, entry)
+	if deliveryErr != nil && ctx.Err() != nil {
+		// Cut off by shutdown: not the entry's fault, it is retried once the lease runs out
+		return ctx.Err()
+	}
+
+	// Record the outcome even if shutdown cancels ctx meanwhile, so a sent email is not sent again
+	ctx = context.WithoutCancel(ctx)
+	if deliveryErr == nil {
+		return w.Outbox.MarkDelivered(ctx, entry.ID)
+	}
+
+	attempts := entry.Attempts + 1
+	dead := attempts >= w.Settings.MaxAttempts
+	retryAt := time.Now().Add(w.backoff(attempts))
+	if dead {
+		log.Printf("Outbox entry %d (%s) failed %d times, moving it to the dead letters: %v", entry.ID, entry.Kind, attempts, deliveryErr)
+	} else {
+		log.Printf("Outbox entry %d (%s) failed, retrying at %s: %v", entry.ID, entry.Kind, retryAt.Format(time.RFC3339), deliveryErr)
+	}
+	return w.Outbox.MarkFailed(ctx, entry.ID, deliveryErr.Error(), retryAt, dead)
+}
+
+func (w *Worker) deliver(ctx context.Context, entry models.OutboxEntry) error {
+	switch entry.Kind {
+	case models.OutboxEmail:
+		var payload models.EmailPayload
+		if err := json.Unmarshal(entry.Payload, &payload); err != nil {
+			return fmt.Errorf("decoding email payload: %w", err)
+		}
+		return w.Mailer.Send(ctx, email.Message{To: payload.To, Subject: payload.Subject, Body: payload.Body, HTML: payload.HTML})
+	case models.OutboxNotification:
+		var payload models.NotificationPayload
+		if err := json.Unmarshal(entry.Payload, &payload); err != nil {
+			return fmt.Errorf("decoding notification payload: %w", err)
+		}
+		if payload.RecipientType == "" {
+			payload.RecipientType = models.RecipientFarmer
+		}
+		return w.Notifications.Create(ctx, payload.RecipientType, payload.RecipientID, payload.Type, payload.Message)
+	case models.OutboxSettlement:
+		var payload models.SettlementPayload
+		if err := json.Unmarshal(entry.Payload, &payload); err != nil {
+			return fmt.Errorf("decoding settlement payload: %w", err)
+		}
+		return w.PaymentRecords.Settle(ctx, w.Payments, payload.OrderID)
+	case models.OutboxVoid:
+		var payload models.VoidPayload
+		if err := json.Unmarshal(entry.Payload, &payload); err != nil {
+			return fmt.Errorf("decoding void payload: %w", err)
+		}
+		if payload.Provider != w.Payments.Name() {
+			return fmt.Errorf("payment %s belongs to provider %q, not %q", payload.ProviderRef, payload.Provider, w.Payments.Name())
+		}
+		return w.Payments.Void(ctx, payload.ProviderRef)
+	default:
+		return fmt.Errorf("unknown outbox kind %q", entry.Kind)
+	}
+}
+
+// backoff is how long to wait after the given number of failed attempts
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.Settings.BaseBackoff
+	for i := 1; i < attempts && delay < w.Settings.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > w.Settings.MaxBackoff {
+		delay = w.Settings.MaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,181 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Tokens with special meaning to the fake provider
+const (
+	FakeTokenDecline = "tok_decline"
+)
+
+// FakeSignatureHeader carries the hex HMAC-SHA256 of a fake webhook payload
+const FakeSignatureHeader = "X-Fake-Signature"
+
+type fakePayment struct {
+	amount   int64
+	captured int64
+	refunded int64
+	status   string
+}
+
+// FakeProvider is an in-process gateway for tests and local development.
+// Every token except FakeTokenDecline is authorized.
+type FakeProvider struct {
+	WebhookSecret string
+
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+}
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{
+		WebhookSecret: webhookSecret,
+		payments:      make(map[string]*fakePayment),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (*Authorization, error) {
+	if req.Token == "" || req.Token == FakeTokenDecline {
+		return nil, ErrDeclined
+	}
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("fake: invalid amount %d", req.Amount)
+	}
+
+	id, err := fakeID("fake_pay_")
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.payments[id] = &fakePayment{amount: req.Amount, status: "authorized"}
+
+	return &Authorization{ID: id, Amount: req.Amount, Status: "authorized"}, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, paymentID string, amount int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+	if payment.status != "authorized" {
+		return fmt.Errorf("fake: cannot capture payment in status %q", payment.status)
+	}
+	if amount <= 0 || amount > payment.amount {
+		return fmt.Errorf("fake: invalid capture amount %d", amount)
+	}
+
+	payment.captured = amount
+	payment.status = "captured"
+	return nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, paymentID string, amount int64, reason string) (*Refund, error) {
+	id, err := fakeID("fake_ref_")
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	if payment.status != "captured" && payment.status != "refunded" {
+		return nil, fmt.Errorf("fake: cannot refund payment in status %q", payment.status)
+	}
+	if amount <= 0 || payment.refunded+amount > payment.captured {
+		return nil, fmt.Errorf("fake: invalid refund amount %d", amount)
+	}
+
+	payment.refunded += amount
+	if payment.refunded == payment.captured {
+		payment.status = "refunded"
+	}
+
+	return &Refund{
+		ID:        id,
+		PaymentID: paymentID,
+		Amount:    amount,
+		Status:    "succeeded",
+	}, nil
+}
+
+func (p *FakeProvider) Void(ctx context.Context, paymentID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[paymentID]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+	if payment.status != "authorized" {
+		return fmt.Errorf("fake: cannot void payment in status %q", payment.status)
+	}
+
+	payment.status = "voided"
+	return nil
+}
+
+// fakeID returns prefix followed by random hex. IDs are random rather than
+// counted so they don't repeat after a restart, since payment references are
+// unique in the database.
+func fakeID(prefix string) (string, error) {
+	bytes := make([]byte, 12)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(bytes), nil
+}
+
+// VerifyWebhook accepts a JSON WebhookEvent signed with SignWebhook
+func (p *FakeProvider) VerifyWebhook(payload []byte, header http.Header) (*WebhookEvent, error) {
+	expected := p.SignWebhook(payload)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(FakeSignatureHeader))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event struct {
+		ID        string `json:"id"`
+		Type      string `json:"type"`
+		PaymentID string `json:"payment_id"`
+		Amount    int64  `json:"amount"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("fake: invalid webhook payload: %w", err)
+	}
+
+	return &WebhookEvent{
+		ID:        event.ID,
+		Type:      event.Type,
+		PaymentID: event.PaymentID,
+		Amount:    event.Amount,
+	}, nil
+}
+
+// SignWebhook returns the signature VerifyWebhook expects for payload
+func (p *FakeProvider) SignWebhook(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.WebhookSecret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,34 @@
+package payments
+
+import (
+	"context"
+	"testing"
+)
+
+// A restarted server gets a new provider; its references must not collide
+// with the ones already saved
+func TestFakeProviderIDsSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		provider := NewFakeProvider("secret")
+		auth, err := provider.Authorize(ctx, AuthorizeRequest{Amount: 500, Token: "tok_visa"})
+		if err != nil {
+			t.Fatalf("Authorize: %v", err)
+		}
+		if err := provider.Capture(ctx, auth.ID, 500); err != nil {
+			t.Fatalf("Capture: %v", err)
+		}
+		refund, err := provider.Refund(ctx, auth.ID, 200, "")
+		if err != nil {
+			t.Fatalf("Refund: %v", err)
+		}
+
+		for _, id := range []string{auth.ID, refund.ID} {
+			if seen[id] {
+				t.Fatalf("reference %s was handed out twice", id)
+			}
+			seen[id] = true
+		}
+	}
+}
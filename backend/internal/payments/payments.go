@@ -0,0 +1,79 @@
+// Package payments abstracts the card payment gateway used at checkout.
+package payments
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+)
+
+var (
+	// ErrDeclined is returned when the provider refuses to authorize the payment
+	ErrDeclined = errors.New("payment declined")
+	// ErrInvalidSignature is returned when a webhook payload fails verification
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrPaymentNotFound is returned for operations on unknown payment IDs
+	ErrPaymentNotFound = errors.New("payment not found")
+)
+
+// Normalized webhook event types
+const (
+	EventPaymentAuthorized = "payment.authorized"
+	EventPaymentCaptured   = "payment.captured"
+	EventPaymentVoided     = "payment.voided"
+	EventPaymentRefunded   = "payment.refunded"
+	EventPaymentFailed     = "payment.failed"
+)
+
+// AuthorizeRequest asks the provider to hold funds for an order.
+// Amounts are in minor units (cents).
+type AuthorizeRequest struct {
+	Amount         int64
+	Currency       string
+	Token          string // payment method token produced by the client
+	IdempotencyKey string
+}
+
+// Authorization is a successful hold on the buyer's funds
+type Authorization struct {
+	ID     string
+	Amount int64
+	Status string
+}
+
+// Refund is money returned to the buyer for a captured payment
+type Refund struct {
+	ID        string
+	PaymentID string
+	Amount    int64
+	Status    string
+}
+
+// WebhookEvent is a verified provider notification translated to our event types
+type WebhookEvent struct {
+	ID        string
+	Type      string
+	PaymentID string
+	Amount    int64
+}
+
+// PaymentProvider is implemented by every payment gateway adapter
+type PaymentProvider interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Authorization, error)
+	Capture(ctx context.Context, paymentID string, amount int64) error
+	Refund(ctx context.Context, paymentID string, amount int64, reason string) (*Refund, error)
+	Void(ctx context.Context, paymentID string) error
+	VerifyWebhook(payload []byte, header http.Header) (*WebhookEvent, error)
+}
+
+// ToMinorUnits converts a decimal amount (e.g. 12.34) to cents
+func ToMinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// FromMinorUnits converts cents back to a decimal amount
+func FromMinorUnits(amount int64) float64 {
+	return float64(amount) / 100
+}
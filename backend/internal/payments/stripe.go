@@ -0,0 +1,243 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stripeSignatureTolerance bounds the age of an accepted webhook timestamp
+const stripeSignatureTolerance = 5 * time.Minute
+
+// StripeProvider talks to the Stripe PaymentIntents API, or to any mock server
+// that speaks the same wire format when BaseURL points at it.
+type StripeProvider struct {
+	BaseURL       string
+	SecretKey     string
+	WebhookSecret string
+	Client        *http.Client
+}
+
+func NewStripeProvider(baseURL, secretKey, webhookSecret string) *StripeProvider {
+	if baseURL == "" {
+		baseURL = "https://api.stripe.com"
+	}
+	return &StripeProvider{
+		BaseURL:       strings.TrimRight(baseURL, "/"),
+		SecretKey:     secretKey,
+		WebhookSecret: webhookSecret,
+		Client:        &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (p *StripeProvider) Name() string {
+	return "stripe"
+}
+
+type stripePaymentIntent struct {
+	ID     string `json:"id"`
+	Amount int64  `json:"amount"`
+	Status string `json:"status"`
+}
+
+type stripeRefund struct {
+	ID            string `json:"id"`
+	PaymentIntent string `json:"payment_intent"`
+	Amount        int64  `json:"amount"`
+	Status        string `json:"status"`
+}
+
+type stripeError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Authorize creates and confirms a manual-capture PaymentIntent
+func (p *StripeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (*Authorization, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(req.Amount, 10))
+	form.Set("currency", strings.ToLower(req.Currency))
+	form.Set("payment_method", req.Token)
+	form.Set("capture_method", "manual")
+	form.Set("confirm", "true")
+
+	var intent stripePaymentIntent
+	if err := p.post(ctx, "/v1/payment_intents", form, req.IdempotencyKey, &intent); err != nil {
+		return nil, err
+	}
+	if intent.Status != "requires_capture" {
+		return nil, fmt.Errorf("%w: payment intent status %q", ErrDeclined, intent.Status)
+	}
+
+	return &Authorization{ID: intent.ID, Amount: intent.Amount, Status: "authorized"}, nil
+}
+
+func (p *StripeProvider) Capture(ctx context.Context, paymentID string, amount int64) error {
+	form := url.Values{}
+	form.Set("amount_to_capture", strconv.FormatInt(amount, 10))
+
+	var intent stripePaymentIntent
+	return p.post(ctx, "/v1/payment_intents/"+url.PathEscape(paymentID)+"/capture", form, "", &intent)
+}
+
+func (p *StripeProvider) Refund(ctx context.Context, paymentID string, amount int64, reason string) (*Refund, error) {
+	form := url.Values{}
+	form.Set("payment_intent", paymentID)
+	form.Set("amount", strconv.FormatInt(amount, 10))
+	if reason != "" {
+		form.Set("metadata[reason]", reason)
+	}
+
+	var refund stripeRefund
+	if err := p.post(ctx, "/v1/refunds", form, "", &refund); err != nil {
+		return nil, err
+	}
+
+	return &Refund{
+		ID:        refund.ID,
+		PaymentID: refund.PaymentIntent,
+		Amount:    refund.Amount,
+		Status:    refund.Status,
+	}, nil
+}
+
+func (p *StripeProvider) Void(ctx context.Context, paymentID string) error {
+	var intent stripePaymentIntent
+	return p.post(ctx, "/v1/payment_intents/"+url.PathEscape(paymentID)+"/cancel", url.Values{}, "", &intent)
+}
+
+// VerifyWebhook checks the Stripe-Signature header ("t=<unix>,v1=<hex hmac>")
+// and translates the event into our normalized types
+func (p *StripeProvider) VerifyWebhook(payload []byte, header http.Header) (*WebhookEvent, error) {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	if time.Since(time.Unix(ts, 0)).Abs() > stripeSignatureTolerance {
+		return nil, ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(p.WebhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	valid := false
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidSignature
+	}
+
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID             string `json:"id"`
+				PaymentIntent  string `json:"payment_intent"`
+				Amount         int64  `json:"amount"`
+				AmountReceived int64  `json:"amount_received"`
+				AmountRefunded int64  `json:"amount_refunded"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("stripe: invalid webhook payload: %w", err)
+	}
+
+	object := event.Data.Object
+	normalized := &WebhookEvent{ID: event.ID, PaymentID: object.ID, Amount: object.Amount}
+	switch event.Type {
+	case "payment_intent.amount_capturable_updated":
+		normalized.Type = EventPaymentAuthorized
+	case "payment_intent.succeeded":
+		// A partial capture succeeds with less than the authorized amount
+		normalized.Type = EventPaymentCaptured
+		normalized.Amount = object.AmountReceived
+	case "payment_intent.canceled":
+		normalized.Type = EventPaymentVoided
+	case "payment_intent.payment_failed":
+		normalized.Type = EventPaymentFailed
+	case "charge.refunded":
+		normalized.Type = EventPaymentRefunded
+		normalized.PaymentID = object.PaymentIntent
+		normalized.Amount = object.AmountRefunded
+	default:
+		normalized.Type = event.Type
+	}
+
+	return normalized, nil
+}
+
+func (p *StripeProvider) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(p.SecretKey, "")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("stripe: reading response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr stripeError
+		json.Unmarshal(body, &apiErr)
+		switch {
+		case apiErr.Error.Type == "card_error" || resp.StatusCode == http.StatusPaymentRequired:
+			return fmt.Errorf("%w: %s", ErrDeclined, apiErr.Error.Message)
+		case resp.StatusCode == http.StatusNotFound:
+			return ErrPaymentNotFound
+		default:
+			return fmt.Errorf("stripe: %s %s returned %d: %s", http.MethodPost, path, resp.StatusCode, apiErr.Error.Message)
+		}
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("stripe: decoding response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// stripeHeader signs payload the way Stripe does, at the given time
+func stripeHeader(payload string, at time.Time) http.Header {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(timestamp + "." + payload))
+
+	header := http.Header{}
+	header.Set("Stripe-Signature", "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func TestStripeVerifyWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    WebhookEvent
+	}{
+		{
+			name:    "partially captured payment reports the amount received",
+			payload: `{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount":1000,"amount_received":750}}}`,
+			want:    WebhookEvent{ID: "evt_1", Type: EventPaymentCaptured, PaymentID: "pi_1", Amount: 750},
+		},
+		{
+			name:    "fully captured payment",
+			payload: `{"id":"evt_2","type":"payment_intent.succeeded","data":{"object":{"id":"pi_2","amount":1000,"amount_received":1000}}}`,
+			want:    WebhookEvent{ID: "evt_2", Type: EventPaymentCaptured, PaymentID: "pi_2", Amount: 1000},
+		},
+		{
+			name:    "authorization reports the amount held",
+			payload: `{"id":"evt_3","type":"payment_intent.amount_capturable_updated","data":{"object":{"id":"pi_3","amount":1000,"amount_received":0}}}`,
+			want:    WebhookEvent{ID: "evt_3", Type: EventPaymentAuthorized, PaymentID: "pi_3", Amount: 1000},
+		},
+		{
+			name:    "refund belongs to the charge's payment intent",
+			payload: `{"id":"evt_4","type":"charge.refunded","data":{"object":{"id":"ch_4","payment_intent":"pi_4","amount":750,"amount_refunded":250}}}`,
+			want:    WebhookEvent{ID: "evt_4", Type: EventPaymentRefunded, PaymentID: "pi_4", Amount: 250},
+		},
+		{
+			name:    "cancelled payment",
+			payload: `{"id":"evt_5","type":"payment_intent.canceled","data":{"object":{"id":"pi_5","amount":1000}}}`,
+			want:    WebhookEvent{ID: "evt_5", Type: EventPaymentVoided, PaymentID: "pi_5", Amount: 1000},
+		},
+	}
+
+	provider := NewStripeProvider("", "sk_test", testWebhookSecret)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := provider.VerifyWebhook([]byte(tt.payload), stripeHeader(tt.payload, time.Now()))
+			if err != nil {
+				t.Fatalf("VerifyWebhook: %v", err)
+			}
+			if *event != tt.want {
+				t.Errorf("got %+v, want %+v", *event, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripeVerifyWebhookRejectsBadSignatures(t *testing.T) {
+	payload := `{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount_received":750}}}`
+	provider := NewStripeProvider("", "sk_test", testWebhookSecret)
+
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"missing header", http.Header{}},
+		{"stale timestamp", stripeHeader(payload, time.Now().Add(-time.Hour))},
+		{"other payload", stripeHeader(`{"id":"evt_2"}`, time.Now())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyWebhook([]byte(payload), tt.header)
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("got %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Package router registers routes on a Go 1.22 http.ServeMux using method and
+// path patterns such as "GET /buyer/orders/{id}". Routes are declared in
+// groups that share a path prefix and a middleware chain. A request for a
+// known path with the wrong method gets 405 with an Allow header from the mux.
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Middleware wraps a handler, like middleware.CORS
+type Middleware func(http.Handler) http.Handler
+
+// Route is a registered method and path pattern
+type Route struct {
+	Method string
+	Path   string
+}
+
+func (r Route) String() string {
+	return r.Method + " " + r.Path
+}
+
+// registry is shared by a Router and all of its groups
+type registry struct {
+	mux         *http.ServeMux
+	outer       []Middleware
+	routes      []Route
+	preflighted map[string]bool
+}
+
+// Router registers routes under its prefix, wrapped in its middleware
+type Router struct {
+	registry   *registry
+	prefix     string
+	middleware []Middleware
+	preflight  bool
+}
+
+func New() *Router {
+	return &Router{registry: &registry{
+		mux:         http.NewServeMux(),
+		preflighted: make(map[string]bool),
+	}}
+}
+
+// Group returns a router for the routes under prefix. Their handlers are
+// wrapped in the parent's middleware, then in middleware, outermost first.
+func (r *Router) Group(prefix string, middleware ...Middleware) *Router {
+	return &Router{
+		registry:   r.registry,
+		prefix:     r.prefix + prefix,
+		middleware: append(append([]Middleware(nil), r.middleware...), middleware...),
+		preflight:  r.preflight,
+	}
+}
+
+// Use wraps the whole router in middleware, outermost first. Unlike group
+// middleware it also sees the requests the mux answers itself with 404 or
+// 405.
+func (r *Router) Use(middleware ...Middleware) {
+	r.registry.outer = append(r.registry.outer, middleware...)
+}
+
+// Preflight makes every path in the group answer OPTIONS through the group's
+// middleware, so the CORS middleware can handle browser preflight requests
+func (r *Router) Preflight() *Router {
+	r.preflight = true
+	return r
+}
+
+// Handle registers handler for method and path, relative to the group's
+// prefix. Path parameters are written {name}; {$} matches only the path
+// itself. GET routes also answer HEAD. It panics if the route conflicts with
+// one already registered.
+func (r *Router) Handle(method, path string, handler http.Handler) {
+	full := r.prefix + path
+	r.registry.mux.Handle(method+" "+full, r.wrap(handler))
+	r.registry.routes = append(r.registry.routes, Route{Method: method, Path: full})
+
+	if r.preflight && !r.registry.preflighted[full] {
+		r.registry.preflighted[full] = true
+		r.registry.mux.Handle(http.MethodOptions+" "+full, r.wrap(http.HandlerFunc(noContent)))
+	}
+}
+
+func (r *Router) HandleFunc(method, path string, handler http.HandlerFunc) {
+	r.Handle(method, path, handler)
+}
+
+func (r *Router) Get(path string, handler http.HandlerFunc) {
+	r.Handle(http.MethodGet, path, handler)
+}
+
+func (r *Router) Post(path string, handler http.HandlerFunc) {
+	r.Handle(http.MethodPost, path, handler)
+}
+
+func (r *Router) Put(path string, handler http.HandlerFunc) {
+	r.Handle(http.MethodPut, path, handler)
+}
+
+func (r *Router) Delete(path string, handler http.HandlerFunc) {
+	r.Handle(http.MethodDelete, path, handler)
+}
+
+func (r *Router) wrap(handler http.Handler) http.Handler {
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+	return handler
+}
+
+// Routes lists every registered route in registration order, without the
+// OPTIONS routes added by Preflight
+func (r *Router) Routes() []Route {
+	return append([]Route(nil), r.registry.routes...)
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var handler http.Handler = r.registry.mux
+	for i := len(r.registry.outer) - 1; i >= 0; i-- {
+		handler = r.registry.outer[i](handler)
+	}
+	handler.ServeHTTP(w, req)
+}
+
+func noContent(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PathInt returns the named path parameter as a positive integer, such as
+// the {id} in "GET /buyer/orders/{id}"
+func PathInt(r *http.Request, name string) (int, error) {
+	value := r.PathValue(name)
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 || strings.HasPrefix(value, "+") {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,182 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// trace is middleware that appends name to the X-Trace header on the way in
+func trace(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// deny is middleware that answers 403 before the handler runs
+func deny(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("X-Trace", "handler")
+}
+
+func serve(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestGroupMiddlewareOrder(t *testing.T) {
+	r := New()
+	r.Use(trace("outer"))
+	api := r.Group("/api", trace("api"))
+	api.Get("/ping", ok)
+	api.Group("/buyer", trace("auth"), trace("buyer")).Get("/orders", ok)
+	api.Group("/farmer", deny).Get("/orders", ok)
+
+	tests := []struct {
+		path  string
+		want  int
+		trace []string
+	}{
+		{"/api/ping", http.StatusOK, []string{"outer", "api", "handler"}},
+		{"/api/buyer/orders", http.StatusOK, []string{"outer", "api", "auth", "buyer", "handler"}},
+		{"/api/farmer/orders", http.StatusForbidden, []string{"outer", "api"}},
+		{"/api/missing", http.StatusNotFound, []string{"outer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := serve(r, http.MethodGet, tt.path)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Values("X-Trace"); !reflect.DeepEqual(got, tt.trace) {
+				t.Errorf("middleware ran as %v, want %v", got, tt.trace)
+			}
+		})
+	}
+}
+
+func TestGroupDoesNotShareMiddlewareWithSiblings(t *testing.T) {
+	r := New()
+	parent := r.Group("", trace("parent"))
+	parent.Group("", trace("first")).Get("/first", ok)
+	parent.Group("", trace("second")).Get("/second", ok)
+
+	got := serve(r, http.MethodGet, "/second").Header().Values("X-Trace")
+	if want := []string{"parent", "second", "handler"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("middleware ran as %v, want %v", got, want)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := New()
+	r.Get("/cart", ok)
+	r.Post("/cart/add", ok)
+	r.Delete("/cart/remove/{productId}", ok)
+	r.Put("/cart/remove/{productId}", ok)
+
+	tests := []struct {
+		method, path string
+		allow        []string
+	}{
+		{http.MethodPost, "/cart", []string{"GET", "HEAD"}},
+		{http.MethodGet, "/cart/add", []string{"POST"}},
+		{http.MethodPatch, "/cart/remove/3", []string{"DELETE", "PUT"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := serve(r, tt.method, tt.path)
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status %d, want 405", rec.Code)
+			}
+			allow := strings.Split(rec.Header().Get("Allow"), ", ")
+			if !reflect.DeepEqual(allow, tt.allow) {
+				t.Errorf("Allow %v, want %v", allow, tt.allow)
+			}
+		})
+	}
+
+	if rec := serve(r, http.MethodHead, "/cart"); rec.Code != http.StatusOK {
+		t.Errorf("HEAD /cart: status %d, want 200", rec.Code)
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	r := New()
+	cors := r.Group("/api", trace("cors")).Preflight()
+	cors.Get("/orders/{id}", ok)
+	cors.Post("/orders/{id}", ok)
+	cors.Group("", trace("auth")).Delete("/orders/{id}/items", ok)
+	r.Get("/admin", ok)
+
+	tests := []struct {
+		path  string
+		want  int
+		trace []string
+	}{
+		{"/api/orders/5", http.StatusNoContent, []string{"cors"}},
+		{"/api/orders/5/items", http.StatusNoContent, []string{"cors", "auth"}},
+		{"/admin", http.StatusMethodNotAllowed, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := serve(r, http.MethodOptions, tt.path)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Values("X-Trace"); !reflect.DeepEqual(got, tt.trace) {
+				t.Errorf("middleware ran as %v, want %v", got, tt.trace)
+			}
+		})
+	}
+
+	// OPTIONS is answered once per path and left out of Routes
+	for _, route := range r.Routes() {
+		if route.Method == http.MethodOptions {
+			t.Errorf("Routes lists %s", route)
+		}
+	}
+	if got := len(r.Routes()); got != 4 {
+		t.Errorf("Routes lists %d routes, want 4", got)
+	}
+}
+
+func TestPathInt(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"7", 7, false},
+		{"007", 7, false},
+		{"0", 0, true},
+		{"-3", 0, true},
+		{"+3", 0, true},
+		{"seven", 0, true},
+		{"", 0, true},
+		{"99999999999999999999", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders/x", nil)
+			req.SetPathValue("id", tt.value)
+			got, err := PathInt(req, "id")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("PathInt(%q) = %d, %v; want %d, error %v", tt.value, got, err, tt.want, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "invalid id") {
+				t.Errorf("error %q does not name the parameter", err)
+			}
+		})
+	}
+}
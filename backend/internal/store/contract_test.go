@@ -0,0 +1,400 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/pgtest"
+)
+
+// The contract tests hold the in-memory stores to the behaviour of the
+// Postgres ones, so handler tests built on NewMemory exercise what production
+// does. Each test gets an empty store.
+
+func TestMemoryContract(t *testing.T) {
+	runContract(t, func(t *testing.T) *Store { return NewMemory() })
+}
+
+func TestPostgresContract(t *testing.T) {
+	runContract(t, func(t *testing.T) *Store { return NewPostgres(pgtest.Start(t)) })
+}
+
+func runContract(t *testing.T, newStore func(t *testing.T) *Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s *Store)
+	}{
+		{"farmers", testFarmers},
+		{"buyers", testBuyers},
+		{"products", testProducts},
+		{"product deletion", testProductDeletion},
+		{"carts", testCarts},
+		{"sessions", testSessions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { tt.run(t, newStore(t)) })
+	}
+}
+
+func wantNoRows(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("%s: got %v, want sql.ErrNoRows", what, err)
+	}
+}
+
+func mustCreateFarmer(t *testing.T, s *Store, email string) *models.Farmer {
+	t.Helper()
+	farmer := &models.Farmer{
+		Email:        email,
+		PasswordHash: "hash",
+		FirstName:    "Ana",
+		LastName:     "Field",
+		FarmName:     "Green Acres",
+		FarmSize:     "12 ha",
+		Location:     "Almaty",
+	}
+	if err := s.Farmers.Create(context.Background(), farmer); err != nil {
+		t.Fatalf("creating farmer: %v", err)
+	}
+	return farmer
+}
+
+func mustCreateBuyer(t *testing.T, s *Store, email string) *models.Buyer {
+	t.Helper()
+	buyer := &models.Buyer{
+		Email:           email,
+		PasswordHash:    "hash",
+		FirstName:       "Ben",
+		LastName:        "Market",
+		DeliveryAddress: "1 Main St",
+		IsActive:        true,
+	}
+	if err := s.Buyers.Create(context.Background(), buyer); err != nil {
+		t.Fatalf("creating buyer: %v", err)
+	}
+	return buyer
+}
+
+func mustCreateProduct(t *testing.T, s *Store, farmerID int, name string, quantity int) *models.Product {
+	t.Helper()
+	now := time.Now()
+	product := &models.Product{
+		FarmerID:    farmerID,
+		Name:        name,
+		CategoryID:  models.CategoryIDByName("vegetables"),
+		Price:       2.5,
+		Quantity:    quantity,
+		Description: "fresh",
+		IsActive:    true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.Products.Create(context.Background(), product); err != nil {
+		t.Fatalf("creating product: %v", err)
+	}
+	return product
+}
+
+func testFarmers(t *testing.T, s *Store) {
+	ctx := context.Background()
+
+	farmer := &models.Farmer{Email: "ana@example.com", PasswordHash: "hash", FirstName: "Ana", Status: "approved", IsActive: true}
+	if err := s.Farmers.Create(ctx, farmer); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if farmer.ID == 0 {
+		t.Fatal("Create did not set the ID")
+	}
+
+	// New farmers wait for an admin whatever the caller asked for
+	got, err := s.Farmers.GetByID(ctx, farmer.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Status != "pending" || got.IsActive {
+		t.Errorf("new farmer is %s, active %v; want pending and inactive", got.Status, got.IsActive)
+	}
+	if byEmail, err := s.Farmers.GetByEmail(ctx, farmer.Email); err != nil || byEmail.ID != farmer.ID || byEmail.PasswordHash != "hash" {
+		t.Errorf("GetByEmail = %+v, %v; want farmer %d with its password hash", byEmail, err, farmer.ID)
+	}
+	pending, err := s.Farmers.GetPending(ctx)
+	if err != nil || len(pending) != 1 || pending[0].ID != farmer.ID {
+		t.Errorf("GetPending = %+v, %v; want only farmer %d", pending, err, farmer.ID)
+	}
+
+	if err := s.Farmers.Approve(ctx, farmer.ID, models.EmailEntry(farmer.Email, "Approved", "Welcome", "")); err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if got, _ := s.Farmers.GetByID(ctx, farmer.ID); got == nil || got.Status != "approved" {
+		t.Errorf("approved farmer is %+v", got)
+	}
+	if pending, _ := s.Farmers.GetPending(ctx); len(pending) != 0 {
+		t.Errorf("GetPending still lists %+v", pending)
+	}
+	entries, err := s.Outbox.Claim(ctx, 10, time.Minute)
+	if err != nil || len(entries) != 1 || entries[0].Kind != models.OutboxEmail {
+		t.Errorf("outbox after Approve = %+v, %v; want one email", entries, err)
+	}
+
+	if err := s.Farmers.SetActive(ctx, farmer.ID, true); err != nil {
+		t.Fatalf("SetActive: %v", err)
+	}
+	if got, _ := s.Farmers.GetByID(ctx, farmer.ID); got == nil || !got.IsActive {
+		t.Errorf("farmer not active after SetActive: %+v", got)
+	}
+
+	if err := s.Farmers.Delete(ctx, farmer.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err = s.Farmers.GetByID(ctx, farmer.ID)
+	wantNoRows(t, "GetByID after Delete", err)
+	_, err = s.Farmers.GetByEmail(ctx, farmer.Email)
+	wantNoRows(t, "GetByEmail after Delete", err)
+	wantNoRows(t, "Approve missing", s.Farmers.Approve(ctx, farmer.ID))
+	wantNoRows(t, "Reject missing", s.Farmers.Reject(ctx, farmer.ID, "no"))
+	wantNoRows(t, "SetActive missing", s.Farmers.SetActive(ctx, farmer.ID, false))
+	wantNoRows(t, "Delete missing", s.Farmers.Delete(ctx, farmer.ID))
+}
+
+func testBuyers(t *testing.T, s *Store) {
+	ctx := context.Background()
+
+	buyer := mustCreateBuyer(t, s, "ben@example.com")
+	if buyer.ID == 0 {
+		t.Fatal("Create did not set the ID")
+	}
+	if err := s.Buyers.Create(ctx, &models.Buyer{Email: buyer.Email, PasswordHash: "hash"}); err == nil {
+		t.Error("Create accepted a second buyer with the same email")
+	}
+
+	got, err := s.Buyers.GetByID(ctx, buyer.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Email != buyer.Email || got.DeliveryAddress != buyer.DeliveryAddress || !got.IsActive {
+		t.Errorf("GetByID = %+v", got)
+	}
+	if got.PasswordHash != "" {
+		t.Error("GetByID returned the password hash")
+	}
+	if byEmail, err := s.Buyers.GetByEmail(ctx, buyer.Email); err != nil || byEmail.PasswordHash != "hash" {
+		t.Errorf("GetByEmail = %+v, %v; want the password hash", byEmail, err)
+	}
+
+	got.DeliveryAddress = "2 Side St"
+	if err := s.Buyers.Update(ctx, *got); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := s.Buyers.SetActive(ctx, buyer.ID, false); err != nil {
+		t.Fatalf("SetActive: %v", err)
+	}
+	if got, _ := s.Buyers.GetByID(ctx, buyer.ID); got == nil || got.DeliveryAddress != "2 Side St" || got.IsActive {
+		t.Errorf("after Update and SetActive: %+v", got)
+	}
+	if all, err := s.Buyers.GetAll(ctx); err != nil || len(all) != 1 {
+		t.Errorf("GetAll = %+v, %v; want one buyer", all, err)
+	}
+
+	if err := s.Buyers.Delete(ctx, buyer.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err = s.Buyers.GetByID(ctx, buyer.ID)
+	wantNoRows(t, "GetByID after Delete", err)
+	wantNoRows(t, "SetActive missing", s.Buyers.SetActive(ctx, buyer.ID, true))
+	wantNoRows(t, "Delete missing", s.Buyers.Delete(ctx, buyer.ID))
+}
+
+func testProducts(t *testing.T, s *Store) {
+	ctx := context.Background()
+
+	farmer := mustCreateFarmer(t, s, "ana@example.com")
+	other := mustCreateFarmer(t, s, "olga@example.com")
+	carrots := mustCreateProduct(t, s, farmer.ID, "Carrots", 10)
+	mustCreateProduct(t, s, farmer.ID, "Beets", 2)
+
+	got, err := s.Products.GetByID(ctx, carrots.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Quantity != 10 || got.Available != 10 || got.FarmerID != farmer.ID {
+		t.Errorf("GetByID = %+v", got)
+	}
+
+	found, err := s.Products.Search(ctx, map[string]string{"search": "carr", "category": "vegetables"}, 10, 0)
+	if err != nil || len(found) != 1 || found[0].ID != carrots.ID {
+		t.Errorf("Search = %+v, %v; want only the carrots", found, err)
+	}
+	low, err := s.Products.GetLowStock(ctx, farmer.ID, 5)
+	if err != nil || len(low) != 1 || low[0].Name != "Beets" {
+		t.Errorf("GetLowStock = %+v, %v; want only the beets", low, err)
+	}
+
+	// Only the owner can edit, and a quantity change lands in the ledger
+	update := *got
+	update.Quantity = 7
+	wrongOwner := update
+	wrongOwner.FarmerID = other.ID
+	wantNoRows(t, "Update by another farmer", s.Products.Update(ctx, &wrongOwner, "recount"))
+	if err := s.Products.Update(ctx, &update, "recount"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, _ := s.Products.GetByID(ctx, carrots.ID); got == nil || got.Quantity != 7 {
+		t.Errorf("quantity after Update: %+v", got)
+	}
+
+	history, total, err := s.Products.GetStockHistory(ctx, carrots.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("GetStockHistory: %v", err)
+	}
+	if total != 2 || len(history) != 2 {
+		t.Fatalf("GetStockHistory = %+v, total %d; want two movements", history, total)
+	}
+	latest, first := history[0], history[1]
+	if latest.MovementType != models.MovementAdjustment || latest.QuantityChange != -3 || latest.Balance != 7 || latest.Reason != "recount" {
+		t.Errorf("latest movement %+v, want an adjustment of -3 to 7", latest)
+	}
+	if first.MovementType != models.MovementRestock || first.QuantityChange != 10 || first.Balance != 10 {
+		t.Errorf("first movement %+v, want the initial stock of 10", first)
+	}
+
+	_, err = s.Products.GetByID(ctx, carrots.ID+100)
+	wantNoRows(t, "GetByID missing", err)
+	_, err = s.Products.GetFarmerID(ctx, carrots.ID+100)
+	wantNoRows(t, "GetFarmerID missing", err)
+}
+
+func testProductDeletion(t *testing.T, s *Store) {
+	ctx := context.Background()
+
+	farmer := mustCreateFarmer(t, s, "ana@example.com")
+	buyer := mustCreateBuyer(t, s, "ben@example.com")
+	carrots := mustCreateProduct(t, s, farmer.ID, "Carrots", 10)
+	if err := s.Carts.Add(ctx, buyer.ID, carrots.ID, 2, 0); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	wantNoRows(t, "Delete by another farmer", s.Products.Delete(ctx, carrots.ID, farmer.ID+100))
+	if err := s.Products.Delete(ctx, carrots.ID, farmer.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	wantNoRows(t, "Delete twice", s.Products.Delete(ctx, carrots.ID, farmer.ID))
+
+	// The product is gone for buyers but its owner and ledger remain
+	_, err := s.Products.GetByID(ctx, carrots.ID)
+	wantNoRows(t, "GetByID after Delete", err)
+	if active, _ := s.Products.GetActiveByFarmer(ctx, farmer.ID); len(active) != 0 {
+		t.Errorf("GetActiveByFarmer lists %+v", active)
+	}
+	if cart, _ := s.Carts.Get(ctx, buyer.ID); len(cart) != 0 {
+		t.Errorf("cart still holds %+v", cart)
+	}
+	if owner, err := s.Products.GetFarmerID(ctx, carrots.ID); err != nil || owner != farmer.ID {
+		t.Errorf("GetFarmerID = %d, %v; want %d", owner, err, farmer.ID)
+	}
+	if _, total, err := s.Products.GetStockHistory(ctx, carrots.ID, 10, 0); err != nil || total != 1 {
+		t.Errorf("GetStockHistory total %d, %v; want the initial stock kept", total, err)
+	}
+
+	update := *carrots
+	update.Quantity = 20
+	wantNoRows(t, "Update after Delete", s.Products.Update(ctx, &update, "restock"))
+	wantNoRows(t, "Add after Delete", s.Carts.Add(ctx, buyer.ID, carrots.ID, 1, 0))
+}
+
+func testCarts(t *testing.T, s *Store) {
+	ctx := context.Background()
+
+	farmer := mustCreateFarmer(t, s, "ana@example.com")
+	buyer := mustCreateBuyer(t, s, "ben@example.com")
+	rival := mustCreateBuyer(t, s, "rita@example.com")
+	carrots := mustCreateProduct(t, s, farmer.ID, "Carrots", 5)
+
+	if err := s.Carts.Add(ctx, buyer.ID, carrots.ID, 2, 0); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := s.Carts.Add(ctx, buyer.ID, carrots.ID, 1, 0); err != nil {
+		t.Fatalf("second Add: %v", err)
+	}
+	cart, err := s.Carts.Get(ctx, buyer.ID)
+	if err != nil || len(cart) != 1 || cart[0].Product.ID != carrots.ID || cart[0].Quantity != 3 {
+		t.Fatalf("Get = %+v, %v; want 3 carrots", cart, err)
+	}
+	if err := s.Carts.Add(ctx, buyer.ID, carrots.ID, 3, 0); !errors.Is(err, models.ErrInsufficientStock) {
+		t.Errorf("Add past the stock: %v, want ErrInsufficientStock", err)
+	}
+	if err := s.Carts.Add(ctx, buyer.ID, carrots.ID, 0, 0); err == nil {
+		t.Error("Add accepted a zero quantity")
+	}
+	wantNoRows(t, "Add missing product", s.Carts.Add(ctx, buyer.ID, carrots.ID+100, 1, 0))
+
+	// A hold keeps the stock from other buyers until it expires
+	if err := s.Carts.Update(ctx, buyer.ID, carrots.ID, 4, time.Hour); err != nil {
+		t.Fatalf("Update with a hold: %v", err)
+	}
+	if err := s.Carts.Add(ctx, rival.ID, carrots.ID, 2, 0); !errors.Is(err, models.ErrInsufficientStock) {
+		t.Errorf("Add against another buyer's hold: %v, want ErrInsufficientStock", err)
+	}
+	if err := s.Carts.Add(ctx, rival.ID, carrots.ID, 1, 0); err != nil {
+		t.Errorf("Add of the unheld stock: %v", err)
+	}
+	if err := s.Carts.Update(ctx, rival.ID, carrots.ID, 0, 0); err != nil {
+		t.Errorf("Update to zero: %v", err)
+	}
+	if cart, _ := s.Carts.Get(ctx, rival.ID); len(cart) != 0 {
+		t.Errorf("Update to zero left %+v", cart)
+	}
+	if err := s.Carts.Remove(ctx, rival.ID, carrots.ID); err == nil {
+		t.Error("Remove of a product not in the cart succeeded")
+	}
+
+	// Checkout deducts the stock and empties the cart
+	orderID, err := s.Carts.Checkout(ctx, buyer.ID, models.CheckoutOptions{PaymentMethod: models.PaymentMethodCashOnDelivery})
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	if orderID == 0 {
+		t.Error("Checkout returned no order ID")
+	}
+	if cart, _ := s.Carts.Get(ctx, buyer.ID); len(cart) != 0 {
+		t.Errorf("cart after Checkout: %+v", cart)
+	}
+	if got, _ := s.Products.GetByID(ctx, carrots.ID); got == nil || got.Quantity != 1 || got.Available != 1 {
+		t.Errorf("product after Checkout: %+v, want 1 left", got)
+	}
+	if _, err := s.Carts.Checkout(ctx, buyer.ID, models.CheckoutOptions{PaymentMethod: models.PaymentMethodCashOnDelivery}); !errors.Is(err, models.ErrEmptyCart) {
+		t.Errorf("Checkout of an empty cart: %v, want ErrEmptyCart", err)
+	}
+}
+
+func testSessions(t *testing.T, s *Store) {
+	ctx := context.Background()
+
+	session, err := models.NewSession(7, "buyer", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sessions.Create(ctx, session); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	got, err := s.Sessions.Get(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.UserID != 7 || got.UserType != "buyer" || got.Expired() {
+		t.Errorf("Get = %+v", got)
+	}
+
+	if err := s.Sessions.Delete(ctx, session.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err = s.Sessions.Get(ctx, session.ID)
+	wantNoRows(t, "Get after Delete", err)
+	if err := s.Sessions.Delete(ctx, session.ID); err != nil {
+		t.Errorf("Delete of a missing session: %v", err)
+	}
+}
@@ -0,0 +1,1815 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+)
+
+// NewMemory returns stores that keep everything in process memory, so the
+// handlers and the end-to-end flows can run without a database. They follow
+// the Postgres behavior closely enough for the flows' golden files, and the
+// farmer, buyer, product, cart and session stores pass the same contract
+// tests as the Postgres ones. Cart holds are not written to the stock ledger.
+func NewMemory() *Store {
+	m := &memory{
+		sequences: make(map[string]int),
+		admins:    make(map[int]models.Admin),
+		invites:   make(map[int]models.AdminInvitation),
+		farmers:   make(map[int]models.Farmer),
+		buyers:    make(map[int]models.Buyer),
+		products:  make(map[int]models.Product),
+		deleted:   make(map[int]bool),
+		carts:     make(map[int]map[int]int),
+		holds:     make(map[int]map[int]memoryHold),
+		orders:    make(map[int]models.Order),
+		subOrders: make(map[int]models.SubOrder),
+		payments:  make(map[int]models.Payment),
+		refunds:   make(map[int]models.Refund),
+		sessions:  make(map[string]models.Session),
+	}
+
+	return &Store{
+		Admins:        memAdmins{m},
+		Farmers:       memFarmers{m},
+		Buyers:        memBuyers{m},
+		Products:      memProducts{m},
+		Carts:         memCarts{m},
+		Orders:        memOrders{m},
+		Refunds:       memRefunds{m},
+		Payments:      memPayments{m},
+		Sessions:      memSessions{m},
+		Notifications: memNotifications{m},
+		Outbox:        memOutbox{m},
+	}
+}
+
+type memoryHold struct {
+	quantity  int
+	expiresAt time.Time
+}
+
+type memory struct {
+	mu            sync.Mutex
+	sequences     map[string]int
+	admins        map[int]models.Admin
+	invites       map[int]models.AdminInvitation
+	farmers       map[int]models.Farmer
+	buyers        map[int]models.Buyer
+	products      map[int]models.Product
+	deleted       map[int]bool // soft-deleted product IDs; the products stay for their ledger
+	movements     []models.InventoryMovement
+	carts         map[int]map[int]int // buyer ID -> product ID -> quantity
+	holds         map[int]map[int]memoryHold
+	orders        map[int]models.Order // headers; sub-orders and items are kept apart
+	subOrders     map[int]models.SubOrder
+	orderItems    []memoryOrderItem
+	history       []models.OrderStatusChange
+	payments      map[int]models.Payment // order ID -> payment
+	refunds       map[int]models.Refund
+	sessions      map[string]models.Session
+	notifications []models.Notification
+	outbox        []models.OutboxEntry
+}
+
+// id hands out IDs per table, like a Postgres SERIAL column
+func (m *memory) id(table string) int {
+	m.sequences[table]++
+	return m.sequences[table]
+}
+
+// reservedByOthers sums the live holds on a product, skipping the given buyer
+func (m *memory) reservedByOthers(productID, buyerID int) int {
+	reserved := 0
+	now := time.Now()
+	for holder, holds := range m.holds {
+		if hold, ok := holds[productID]; ok && holder != buyerID && hold.expiresAt.After(now) {
+			reserved += hold.quantity
+		}
+	}
+	return reserved
+}
+
+func (m *memory) withAvailable(p models.Product) models.Product {
+	p.Available = p.Quantity - m.reservedByOthers(p.ID, 0)
+	p.Images = append([]string(nil), p.Images...)
+	return p
+}
+
+// enqueue adds pending outbox entries; the caller holds the lock
+func (m *memory) enqueue(outbox []models.OutboxEntry) {
+	now := time.Now()
+	for _, entry := range outbox {
+		entry.ID = m.id("outbox")
+		entry.Status = models.OutboxPending
+		entry.Attempts = 0
+		entry.NextAttemptAt = now
+		entry.CreatedAt = now
+		m.outbox = append(m.outbox, entry)
+	}
+}
+
+func (m *memory) createAdmin(admin *models.Admin) {
+	admin.ID = m.id("admins")
+	admin.CreatedAt = time.Now()
+	admin.UpdatedAt = admin.CreatedAt
+	m.admins[admin.ID] = *admin
+}
+
+func (m *memory) adjustStock(productID, delta int, movement models.InventoryMovement) {
+	p := m.products[productID]
+	p.Quantity += delta
+	p.UpdatedAt = time.Now()
+	m.products[productID] = p
+
+	movement.ID = m.id("inventory_movements")
+	movement.ProductID = productID
+	movement.QuantityChange = delta
+	movement.Balance = p.Quantity
+	movement.CreatedAt = time.Now()
+	m.movements = append(m.movements, movement)
+}
+
+type memAdmins struct{ m *memory }
+
+func (s memAdmins) Exists(ctx context.Context, email string) (bool, error) {
+	_, err := s.GetByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s memAdmins) Create(ctx context.Context, admin *models.Admin) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.createAdmin(admin)
+	return nil
+}
+
+func (s memAdmins) GetByID(ctx context.Context, id int) (*models.Admin, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	admin, ok := s.m.admins[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &admin, nil
+}
+
+func (s memAdmins) GetByEmail(ctx context.Context, email string) (*models.Admin, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, admin := range s.m.admins {
+		if admin.Email == email {
+			return &admin, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s memAdmins) GetAll(ctx context.Context) ([]models.Admin, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var admins []models.Admin
+	for _, admin := range s.m.admins {
+		admin.PasswordHash = ""
+		admins = append(admins, admin)
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i].Email < admins[j].Email })
+	return admins, nil
+}
+
+func (s memAdmins) SetRole(ctx context.Context, id int, role models.Role) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	admin, ok := s.m.admins[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if admin.Role == models.RoleSuperAdmin && role != models.RoleSuperAdmin {
+		superAdmins := 0
+		for _, other := range s.m.admins {
+			if other.Role == models.RoleSuperAdmin {
+				superAdmins++
+			}
+		}
+		if superAdmins == 1 {
+			return models.ErrLastSuperAdmin
+		}
+	}
+	admin.Role = role
+	admin.UpdatedAt = time.Now()
+	s.m.admins[id] = admin
+	return nil
+}
+
+func (s memAdmins) Invite(ctx context.Context, invitation *models.AdminInvitation, outbox ...models.OutboxEntry) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for id, pending := range s.m.invites {
+		if pending.Email == invitation.Email && pending.AcceptedAt == nil {
+			delete(s.m.invites, id)
+		}
+	}
+	invitation.ID = s.m.id("admin_invitations")
+	invitation.CreatedAt = time.Now()
+	s.m.invites[invitation.ID] = *invitation
+	s.m.enqueue(outbox)
+	return nil
+}
+
+func (s memAdmins) GetInvitation(ctx context.Context, tokenHash string) (*models.AdminInvitation, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, invitation := range s.m.invites {
+		if invitation.TokenHash == tokenHash {
+			return &invitation, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s memAdmins) PendingInvitations(ctx context.Context) ([]models.AdminInvitation, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var invitations []models.AdminInvitation
+	for _, invitation := range s.m.invites {
+		if invitation.Usable() {
+			invitations = append(invitations, invitation)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].ID > invitations[j].ID })
+	return invitations, nil
+}
+
+func (s memAdmins) AcceptInvitation(ctx context.Context, invitationID int, admin *models.Admin) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	invitation, ok := s.m.invites[invitationID]
+	if !ok || !invitation.Usable() {
+		return sql.ErrNoRows
+	}
+	for _, existing := range s.m.admins {
+		if existing.Email == invitation.Email {
+			return models.ErrAdminExists
+		}
+	}
+	now := time.Now()
+	invitation.AcceptedAt = &now
+	s.m.invites[invitationID] = invitation
+
+	admin.Email = invitation.Email
+	admin.Role = invitation.Role
+	s.m.createAdmin(admin)
+	return nil
+}
+
+func (s memAdmins) RevokeInvitation(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	invitation, ok := s.m.invites[id]
+	if !ok || invitation.AcceptedAt != nil {
+		return sql.ErrNoRows
+	}
+	delete(s.m.invites, id)
+	return nil
+}
+
+type memFarmers struct{ m *memory }
+
+func (s memFarmers) list(keep func(models.Farmer) bool) []models.Farmer {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var farmers []models.Farmer
+	for _, farmer := range s.m.farmers {
+		if keep(farmer) {
+			farmer.PasswordHash = ""
+			farmers = append(farmers, farmer)
+		}
+	}
+	sort.Slice(farmers, func(i, j int) bool { return farmers[i].ID < farmers[j].ID })
+	return farmers
+}
+
+func (s memFarmers) GetPending(ctx context.Context) ([]models.Farmer, error) {
+	return s.list(func(f models.Farmer) bool { return f.Status == "pending" }), nil
+}
+
+func (s memFarmers) GetAll(ctx context.Context) ([]models.Farmer, error) {
+	return s.list(func(models.Farmer) bool { return true }), nil
+}
+
+func (s memFarmers) GetByID(ctx context.Context, id int) (*models.Farmer, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	farmer, ok := s.m.farmers[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	farmer.PasswordHash = ""
+	return &farmer, nil
+}
+
+func (s memFarmers) GetByEmail(ctx context.Context, email string) (*models.Farmer, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, farmer := range s.m.farmers {
+		if farmer.Email == email {
+			return &farmer, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// Create registers the farmer as pending and inactive, like models.CreateFarmer
+func (s memFarmers) Create(ctx context.Context, farmer *models.Farmer) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, existing := range s.m.farmers {
+		if existing.Email == farmer.Email {
+			return fmt.Errorf("farmer with email %s already exists", farmer.Email)
+		}
+	}
+
+	farmer.ID = s.m.id("farmers")
+	stored := *farmer
+	stored.Status = "pending"
+	stored.IsActive = false
+	stored.CreatedAt = time.Now()
+	stored.UpdatedAt = stored.CreatedAt
+	s.m.farmers[farmer.ID] = stored
+	return nil
+}
+
+func (s memFarmers) update(id int, change func(*models.Farmer), outbox ...models.OutboxEntry) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	farmer, ok := s.m.farmers[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	change(&farmer)
+	farmer.UpdatedAt = time.Now()
+	s.m.farmers[id] = farmer
+
+	s.m.enqueue(outbox)
+	return nil
+}
+
+func (s memFarmers) Update(ctx context.Context, farmer models.Farmer) error {
+	err := s.update(farmer.ID, func(f *models.Farmer) {
+		f.Email = farmer.Email
+		f.FirstName = farmer.FirstName
+		f.LastName = farmer.LastName
+		f.FarmName = farmer.FarmName
+		f.FarmSize = farmer.FarmSize
+		f.Location = farmer.Location
+		f.Status = farmer.Status
+		f.IsActive = farmer.IsActive
+	})
+	// UPDATE matching no rows is not an error in Postgres
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+func (s memFarmers) Approve(ctx context.Context, id int, outbox ...models.OutboxEntry) error {
+	return s.update(id, func(f *models.Farmer) { f.Status = "approved" }, outbox...)
+}
+
+func (s memFarmers) Reject(ctx context.Context, id int, reason string, outbox ...models.OutboxEntry) error {
+	return s.update(id, func(f *models.Farmer) { f.Status = "rejected" }, outbox...)
+}
+
+func (s memFarmers) SetActive(ctx context.Context, id int, isActive bool) error {
+	return s.update(id, func(f *models.Farmer) { f.IsActive = isActive })
+}
+
+func (s memFarmers) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.farmers[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.m.farmers, id)
+
+	// Their products go with them; the ledger rows stay without the link
+	for productID, product := range s.m.products {
+		if product.FarmerID != id {
+			continue
+		}
+		delete(s.m.products, productID)
+		delete(s.m.deleted, productID)
+		for _, cart := range s.m.carts {
+			delete(cart, productID)
+		}
+		for _, holds := range s.m.holds {
+			delete(holds, productID)
+		}
+		for i := range s.m.movements {
+			if s.m.movements[i].ProductID == productID {
+				s.m.movements[i].ProductID = 0
+			}
+		}
+	}
+	return nil
+}
+
+type memBuyers struct{ m *memory }
+
+func (s memBuyers) GetAll(ctx context.Context) ([]models.Buyer, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var buyers []models.Buyer
+	for _, buyer := range s.m.buyers {
+		buyer.PasswordHash = ""
+		buyers = append(buyers, buyer)
+	}
+	sort.Slice(buyers, func(i, j int) bool { return buyers[i].ID < buyers[j].ID })
+	return buyers, nil
+}
+
+func (s memBuyers) GetByID(ctx context.Context, id int) (*models.Buyer, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	buyer, ok := s.m.buyers[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	buyer.PasswordHash = ""
+	return &buyer, nil
+}
+
+func (s memBuyers) GetByEmail(ctx context.Context, email string) (*models.Buyer, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, buyer := range s.m.buyers {
+		if buyer.Email == email {
+			return &buyer, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s memBuyers) Create(ctx context.Context, buyer *models.Buyer) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, existing := range s.m.buyers {
+		if existing.Email == buyer.Email {
+			return fmt.Errorf("buyer with email %s already exists", buyer.Email)
+		}
+	}
+
+	buyer.ID = s.m.id("buyers")
+	buyer.CreatedAt = time.Now()
+	buyer.UpdatedAt = buyer.CreatedAt
+	s.m.buyers[buyer.ID] = *buyer
+	return nil
+}
+
+func (s memBuyers) Update(ctx context.Context, buyer models.Buyer) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	existing, ok := s.m.buyers[buyer.ID]
+	if !ok {
+		return nil
+	}
+	existing.Email = buyer.Email
+	existing.FirstName = buyer.FirstName
+	existing.LastName = buyer.LastName
+	existing.DeliveryAddress = buyer.DeliveryAddress
+	existing.IsActive = buyer.IsActive
+	existing.UpdatedAt = time.Now()
+	s.m.buyers[buyer.ID] = existing
+	return nil
+}
+
+func (s memBuyers) SetActive(ctx context.Context, id int, isActive bool) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	buyer, ok := s.m.buyers[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	buyer.IsActive = isActive
+	buyer.UpdatedAt = time.Now()
+	s.m.buyers[id] = buyer
+	return nil
+}
+
+func (s memBuyers) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.buyers[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.m.buyers, id)
+	delete(s.m.carts, id)
+	delete(s.m.holds, id)
+	return nil
+}
+
+type memProducts struct{ m *memory }
+
+func (s memProducts) Create(ctx context.Context, product *models.Product) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	product.ID = s.m.id("products")
+	stored := *product
+	stored.Quantity = 0
+	s.m.products[product.ID] = stored
+
+	if product.Quantity != 0 {
+		s.m.adjustStock(product.ID, product.Quantity, models.InventoryMovement{
+			MovementType: models.MovementRestock,
+			ActorType:    "farmer",
+			ActorID:      product.FarmerID,
+			Reason:       "initial stock",
+		})
+	}
+	return nil
+}
+
+func (s memProducts) GetByID(ctx context.Context, id int) (*models.Product, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	product, ok := s.m.products[id]
+	if !ok || !product.IsActive || s.m.deleted[id] {
+		return nil, sql.ErrNoRows
+	}
+	product = s.m.withAvailable(product)
+	return &product, nil
+}
+
+func (s memProducts) list(keep func(models.Product) bool) []models.Product {
+	var products []models.Product
+	for _, product := range s.m.products {
+		if keep(product) {
+			products = append(products, s.m.withAvailable(product))
+		}
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	return products
+}
+
+func (s memProducts) GetActiveByFarmer(ctx context.Context, farmerID int) ([]models.Product, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.list(func(p models.Product) bool { return p.FarmerID == farmerID && p.IsActive }), nil
+}
+
+func (s memProducts) GetLowStock(ctx context.Context, farmerID, threshold int) ([]models.Product, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.list(func(p models.Product) bool {
+		return p.FarmerID == farmerID && p.IsActive && p.Quantity <= threshold
+	}), nil
+}
+
+// Search applies the same category, search, sort and paging rules as models.GetProductsWithFilters
+func (s memProducts) Search(ctx context.Context, filters map[string]string, limit, offset int) ([]models.Product, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	categoryID := -1
+	if category := filters["category"]; category != "" && strings.ToLower(category) != "all" {
+		categoryID = models.CategoryIDByName(category)
+	}
+	search := strings.ToLower(filters["search"])
+
+	products := s.list(func(p models.Product) bool {
+		if !p.IsActive {
+			return false
+		}
+		if categoryID != -1 && p.CategoryID != categoryID {
+			return false
+		}
+		return search == "" || strings.Contains(strings.ToLower(p.Name), search)
+	})
+
+	switch filters["sort"] {
+	case "price_asc":
+		sort.SliceStable(products, func(i, j int) bool { return products[i].Price < products[j].Price })
+	case "price_desc":
+		sort.SliceStable(products, func(i, j int) bool { return products[i].Price > products[j].Price })
+	case "date_asc":
+		sort.SliceStable(products, func(i, j int) bool { return products[i].CreatedAt.Before(products[j].CreatedAt) })
+	default:
+		sort.SliceStable(products, func(i, j int) bool { return products[i].CreatedAt.After(products[j].CreatedAt) })
+	}
+
+	if offset >= len(products) {
+		return nil, nil
+	}
+	products = products[offset:]
+	if limit < len(products) {
+		products = products[:limit]
+	}
+	return products, nil
+}
+
+func (s memProducts) Update(ctx context.Context, product *models.Product, stockReason string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	existing, ok := s.m.products[product.ID]
+	if !ok || existing.FarmerID != product.FarmerID || s.m.deleted[product.ID] {
+		return sql.ErrNoRows
+	}
+
+	previousQuantity := existing.Quantity
+	stored := *product
+	stored.Quantity = previousQuantity
+	stored.CreatedAt = existing.CreatedAt
+	stored.Images = append([]string(nil), product.Images...)
+	s.m.products[product.ID] = stored
+
+	if product.Quantity != previousQuantity {
+		s.m.adjustStock(product.ID, product.Quantity-previousQuantity, models.InventoryMovement{
+			MovementType: models.MovementAdjustment,
+			ActorType:    "farmer",
+			ActorID:      product.FarmerID,
+			Reason:       stockReason,
+		})
+	}
+	return nil
+}
+
+func (s memProducts) Delete(ctx context.Context, id, farmerID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	product, ok := s.m.products[id]
+	if !ok || product.FarmerID != farmerID || s.m.deleted[id] {
+		return sql.ErrNoRows
+	}
+
+	// Soft-deleted like models.DeleteProduct: the product and its ledger stay,
+	// carts and holds lose it
+	product.IsActive = false
+	product.Images = nil
+	product.UpdatedAt = time.Now()
+	s.m.products[id] = product
+	s.m.deleted[id] = true
+	for _, cart := range s.m.carts {
+		delete(cart, id)
+	}
+	for _, holds := range s.m.holds {
+		delete(holds, id)
+	}
+	return nil
+}
+
+func (s memProducts) GetFarmerID(ctx context.Context, productID int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	product, ok := s.m.products[productID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return product.FarmerID, nil
+}
+
+func (s memProducts) GetStockHistory(ctx context.Context, productID, limit, offset int) ([]models.InventoryMovement, int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	// Newest first
+	movements := []models.InventoryMovement{}
+	for i := len(s.m.movements) - 1; i >= 0; i-- {
+		if s.m.movements[i].ProductID == productID {
+			movements = append(movements, s.m.movements[i])
+		}
+	}
+
+	total := len(movements)
+	if offset >= total {
+		return []models.InventoryMovement{}, total, nil
+	}
+	movements = movements[offset:]
+	if limit < len(movements) {
+		movements = movements[:limit]
+	}
+	return movements, total, nil
+}
+
+type memCarts struct{ m *memory }
+
+func (s memCarts) Get(ctx context.Context, buyerID int) ([]models.CartItem, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var items []models.CartItem
+	for productID, quantity := range s.m.carts[buyerID] {
+		items = append(items, models.CartItem{
+			Product:  s.m.withAvailable(s.m.products[productID]),
+			Quantity: quantity,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Product.ID < items[j].Product.ID })
+	return items, nil
+}
+
+// setQuantity checks stock and stores the new cart quantity with its hold
+func (m *memory) setQuantity(buyerID, productID, quantity int, reserveFor time.Duration) error {
+	product, ok := m.products[productID]
+	if !ok || m.deleted[productID] {
+		return sql.ErrNoRows
+	}
+	if quantity > product.Quantity-m.reservedByOthers(productID, buyerID) {
+		return models.ErrInsufficientStock
+	}
+
+	if m.carts[buyerID] == nil {
+		m.carts[buyerID] = make(map[int]int)
+	}
+	m.carts[buyerID][productID] = quantity
+
+	if reserveFor > 0 {
+		if m.holds[buyerID] == nil {
+			m.holds[buyerID] = make(map[int]memoryHold)
+		}
+		m.holds[buyerID][productID] = memoryHold{quantity: quantity, expiresAt: time.Now().Add(reserveFor)}
+	}
+	return nil
+}
+
+func (s memCarts) Add(ctx context.Context, buyerID, productID, quantity int, reserveFor time.Duration) error {
+	if quantity < 1 {
+		return errors.New("quantity must be at least 1")
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.m.setQuantity(buyerID, productID, s.m.carts[buyerID][productID]+quantity, reserveFor)
+}
+
+func (s memCarts) Update(ctx context.Context, buyerID, productID, quantity int, reserveFor time.Duration) error {
+	if quantity < 0 {
+		return errors.New("quantity cannot be negative")
+	}
+	if quantity == 0 {
+		return s.Remove(ctx, buyerID, productID)
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.carts[buyerID][productID]; !ok {
+		if _, exists := s.m.products[productID]; !exists || s.m.deleted[productID] {
+			return sql.ErrNoRows
+		}
+		return errors.New("product not found in cart")
+	}
+	return s.m.setQuantity(buyerID, productID, quantity, reserveFor)
+}
+
+func (s memCarts) Remove(ctx context.Context, buyerID, productID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.carts[buyerID][productID]; !ok {
+		return errors.New("product not found in cart")
+	}
+	delete(s.m.carts[buyerID], productID)
+	delete(s.m.holds[buyerID], productID)
+	return nil
+}
+
+// Checkout places the order the way models.Checkout does: card payments are
+// authorized before anything changes, then the stock is deducted and the cart emptied.
+func (s memCarts) Checkout(ctx context.Context, buyerID int, opts models.CheckoutOptions) (int, error) {
+	if opts.PaymentMethod == "" {
+		opts.PaymentMethod = models.PaymentMethodCard
+	}
+	if !models.IsValidPaymentMethod(opts.PaymentMethod) {
+		return 0, fmt.Errorf("invalid payment method %q", opts.PaymentMethod)
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	cart := s.m.carts[buyerID]
+	if len(cart) == 0 {
+		return 0, models.ErrEmptyCart
+	}
+
+	var productIDs []int
+	for productID := range cart {
+		productIDs = append(productIDs, productID)
+	}
+	sort.Ints(productIDs)
+
+	order := models.Order{
+		BuyerID:       buyerID,
+		Status:        models.OrderStatusPendingPayment,
+		PaymentMethod: opts.PaymentMethod,
+	}
+	for _, productID := range productIDs {
+		product := s.m.products[productID]
+		if product.Quantity-s.m.reservedByOthers(productID, buyerID) < cart[productID] {
+			return 0, fmt.Errorf("%w for product ID %d", models.ErrInsufficientStock, productID)
+		}
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID:   productID,
+			FarmerID:    product.FarmerID,
+			ProductName: product.Name,
+			UnitPrice:   product.Price,
+			Quantity:    cart[productID],
+		})
+	}
+	if err := order.Split(opts.DeliveryMethods); err != nil {
+		return 0, err
+	}
+
+	var payment *models.Payment
+	if opts.PaymentMethod == models.PaymentMethodCard {
+		auth, err := opts.Payments.Authorize(ctx, payments.AuthorizeRequest{
+			Amount:         payments.ToMinorUnits(order.TotalAmount),
+			Currency:       opts.Currency,
+			Token:          opts.PaymentToken,
+			IdempotencyKey: fmt.Sprintf("checkout-%d", s.m.id("checkouts")),
+		})
+		if err != nil {
+			return 0, err
+		}
+		payment = &models.Payment{
+			ID:          s.m.id("payments"),
+			Provider:    opts.Payments.Name(),
+			ProviderRef: auth.ID,
+			Amount:      order.TotalAmount,
+			Currency:    opts.Currency,
+			Status:      models.PaymentStatusAuthorized,
+		}
+	}
+
+	order.ID = s.m.id("orders")
+	s.m.createOrder(order)
+	if payment != nil {
+		payment.OrderID = order.ID
+		payment.CreatedAt = time.Now()
+		payment.UpdatedAt = payment.CreatedAt
+		s.m.payments[order.ID] = *payment
+	}
+	s.m.setOrderStatus(order.ID, models.OrderStatusPlaced, "buyer", buyerID)
+
+	for _, item := range order.Items {
+		s.m.adjustStock(item.ProductID, -item.Quantity, models.InventoryMovement{
+			MovementType: models.MovementSale,
+			ActorType:    "buyer",
+			ActorID:      buyerID,
+			OrderID:      order.ID,
+		})
+	}
+	delete(s.m.carts, buyerID)
+	delete(s.m.holds, buyerID)
+
+	return order.ID, nil
+}
+
+// memoryOrderItem is an order line with the quantity refunded so far
+type memoryOrderItem struct {
+	models.OrderItem
+	refunded int
+}
+
+// createOrder saves a split order with its sub-orders and items; the caller holds the lock
+func (m *memory) createOrder(order models.Order) {
+	now := time.Now()
+	order.CreatedAt = now
+	order.UpdatedAt = now
+
+	subOrderIDs := make(map[int]int)
+	for _, so := range order.SubOrders {
+		so.ID = m.id("sub_orders")
+		so.OrderID = order.ID
+		so.CreatedAt = now
+		so.UpdatedAt = now
+		m.subOrders[so.ID] = so
+		subOrderIDs[so.FarmerID] = so.ID
+	}
+	for _, item := range order.Items {
+		item.ID = m.id("order_items")
+		item.OrderID = order.ID
+		item.SubOrderID = subOrderIDs[item.FarmerID]
+		item.Images = nil
+		m.orderItems = append(m.orderItems, memoryOrderItem{OrderItem: item})
+	}
+
+	order.SubOrders = nil
+	order.Items = nil
+	m.orders[order.ID] = order
+	m.recordStatusChange(order.ID, 0, "", order.Status, "buyer", order.BuyerID, "")
+}
+
+// setOrderStatus moves an order and all its sub-orders to status, like placing a paid order
+func (m *memory) setOrderStatus(orderID int, status, actorType string, actorID int) {
+	now := time.Now()
+	order := m.orders[orderID]
+	from := order.Status
+	order.Status = status
+	order.UpdatedAt = now
+	m.orders[orderID] = order
+
+	for id, so := range m.subOrders {
+		if so.OrderID == orderID {
+			so.Status = status
+			so.UpdatedAt = now
+			m.subOrders[id] = so
+		}
+	}
+	m.recordStatusChange(orderID, 0, from, status, actorType, actorID, "")
+}
+
+func (m *memory) recordStatusChange(orderID, subOrderID int, from, to, actorType string, actorID int, note string) {
+	m.history = append(m.history, models.OrderStatusChange{
+		ID:            m.id("order_status_history"),
+		OrderID:       orderID,
+		SubOrderID:    subOrderID,
+		FromStatus:    from,
+		ToStatus:      to,
+		ChangedByType: actorType,
+		ChangedByID:   actorID,
+		Note:          note,
+		CreatedAt:     time.Now(),
+	})
+}
+
+// subOrdersOf returns the sub-orders of an order by ID, without their items
+func (m *memory) subOrdersOf(orderID int) []models.SubOrder {
+	var subOrders []models.SubOrder
+	for _, so := range m.subOrders {
+		if so.OrderID == orderID {
+			subOrders = append(subOrders, so)
+		}
+	}
+	sort.Slice(subOrders, func(i, j int) bool { return subOrders[i].ID < subOrders[j].ID })
+	return subOrders
+}
+
+// itemsOf returns the line items of an order, or of one of its sub-orders when
+// subOrderID is not zero, with the product's current images
+func (m *memory) itemsOf(orderID, subOrderID int) []models.OrderItem {
+	var items []models.OrderItem
+	for _, stored := range m.orderItems {
+		if stored.OrderID != orderID || (subOrderID != 0 && stored.SubOrderID != subOrderID) {
+			continue
+		}
+		item := stored.OrderItem
+		if product, ok := m.products[item.ProductID]; ok && len(product.Images) > 0 {
+			item.Images = append([]string(nil), product.Images...)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// subOrderFor finds the farmer's sub-order of an order
+func (m *memory) subOrderFor(orderID, farmerID int) (models.SubOrder, error) {
+	for _, so := range m.subOrders {
+		if so.OrderID == orderID && so.FarmerID == farmerID {
+			return so, nil
+		}
+	}
+	return models.SubOrder{}, sql.ErrNoRows
+}
+
+func (m *memory) withItems(so models.SubOrder) *models.SubOrder {
+	so.Items = m.itemsOf(so.OrderID, so.ID)
+	return &so
+}
+
+// updateSubOrder changes a sub-order's status, recording the change
+func (m *memory) updateSubOrder(so models.SubOrder, status, actorType string, actorID int, note string) {
+	from := so.Status
+	so.Status = status
+	so.UpdatedAt = time.Now()
+	m.subOrders[so.ID] = so
+	m.recordStatusChange(so.OrderID, so.ID, from, status, actorType, actorID, note)
+}
+
+// syncOrderStatus rolls the sub-order statuses up to the order
+func (m *memory) syncOrderStatus(orderID int, actorType string, actorID int) {
+	var statuses []string
+	for _, so := range m.subOrdersOf(orderID) {
+		statuses = append(statuses, so.Status)
+	}
+
+	order := m.orders[orderID]
+	rolled := models.RollUpOrderStatus(statuses)
+	if rolled == order.Status {
+		return
+	}
+	from := order.Status
+	order.Status = rolled
+	order.UpdatedAt = time.Now()
+	m.orders[orderID] = order
+	m.recordStatusChange(orderID, 0, from, rolled, actorType, actorID, "")
+
+	// The outbox worker settles the payment, as with Postgres
+	if rolled == models.OrderStatusDelivered || rolled == models.OrderStatusCancelled {
+		m.enqueue([]models.OutboxEntry{models.SettlementEntry(orderID)})
+	}
+}
+
+// restock returns quantity to a product's stock unless it has been deleted
+func (m *memory) restock(productID, quantity int, movement models.InventoryMovement) {
+	if _, ok := m.products[productID]; ok && !m.deleted[productID] {
+		m.adjustStock(productID, quantity, movement)
+	}
+}
+
+// inRange reports whether a created_at falls inside the filter's dates
+func inRange(createdAt time.Time, filter models.OrderFilter) bool {
+	return (filter.From.IsZero() || !createdAt.Before(filter.From)) &&
+		(filter.To.IsZero() || createdAt.Before(filter.To))
+}
+
+type memOrders struct{ m *memory }
+
+func (s memOrders) GetByBuyer(ctx context.Context, buyerID int, filter models.OrderFilter) ([]models.Order, int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	orders := []models.Order{}
+	for _, order := range s.m.orders {
+		if order.BuyerID == buyerID && (filter.Status == "" || order.Status == filter.Status) && inRange(order.CreatedAt, filter) {
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].CreatedAt.After(orders[j].CreatedAt)
+		}
+		return orders[i].ID > orders[j].ID
+	})
+
+	total := len(orders)
+	if filter.Offset >= total {
+		return []models.Order{}, total, nil
+	}
+	orders = orders[filter.Offset:]
+	if filter.Limit < len(orders) {
+		orders = orders[:filter.Limit]
+	}
+	return orders, total, nil
+}
+
+func (s memOrders) GetByID(ctx context.Context, id int) (*models.Order, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	order, ok := s.m.orders[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	order.SubOrders = s.m.subOrdersOf(id)
+	order.Items = s.m.itemsOf(id, 0)
+	return &order, nil
+}
+
+func (s memOrders) FarmerSubtotals(ctx context.Context, orderID int) ([]models.FarmerSubtotal, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var subtotals []models.FarmerSubtotal
+	for _, so := range s.m.subOrdersOf(orderID) {
+		subtotals = append(subtotals, models.FarmerSubtotal{
+			FarmerID:  so.FarmerID,
+			FarmName:  s.m.farmers[so.FarmerID].FarmName,
+			ItemCount: so.ItemCount,
+			Subtotal:  so.Subtotal,
+		})
+	}
+	return subtotals, nil
+}
+
+func (s memOrders) GetByFarmer(ctx context.Context, farmerID int, filter models.OrderFilter) ([]models.SubOrder, int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	subOrders := []models.SubOrder{}
+	for _, so := range s.m.subOrders {
+		if so.FarmerID == farmerID && (filter.Status == "" || so.Status == filter.Status) && inRange(so.CreatedAt, filter) {
+			subOrders = append(subOrders, so)
+		}
+	}
+	sort.Slice(subOrders, func(i, j int) bool {
+		if !subOrders[i].CreatedAt.Equal(subOrders[j].CreatedAt) {
+			return subOrders[i].CreatedAt.After(subOrders[j].CreatedAt)
+		}
+		return subOrders[i].ID > subOrders[j].ID
+	})
+
+	total := len(subOrders)
+	if filter.Offset >= total {
+		return []models.SubOrder{}, total, nil
+	}
+	subOrders = subOrders[filter.Offset:]
+	if filter.Limit < len(subOrders) {
+		subOrders = subOrders[:filter.Limit]
+	}
+	for i := range subOrders {
+		subOrders[i] = *s.m.withItems(subOrders[i])
+	}
+	return subOrders, total, nil
+}
+
+func (s memOrders) GetForFarmer(ctx context.Context, orderID, farmerID int) (*models.SubOrder, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	so, err := s.m.subOrderFor(orderID, farmerID)
+	if err != nil {
+		return nil, err
+	}
+	return s.m.withItems(so), nil
+}
+
+func (s memOrders) History(ctx context.Context, orderID int) ([]models.OrderStatusChange, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var history []models.OrderStatusChange
+	for _, change := range s.m.history {
+		if change.OrderID == orderID {
+			history = append(history, change)
+		}
+	}
+	return history, nil
+}
+
+func (s memOrders) UpdateStatus(ctx context.Context, orderID, farmerID int, status, note string) (*models.SubOrder, error) {
+	if !models.IsValidOrderStatus(status) {
+		return nil, models.ErrUnknownStatus
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	so, err := s.m.subOrderFor(orderID, farmerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := models.CheckFarmerTransition(so.Status, status, so.DeliveryMethod); err != nil {
+		return nil, err
+	}
+
+	if status == models.OrderStatusCancelled {
+		for _, item := range s.m.itemsOf(orderID, so.ID) {
+			s.m.restock(item.ProductID, item.Quantity, models.InventoryMovement{
+				MovementType: models.MovementCancellationReturn,
+				ActorType:    "farmer",
+				ActorID:      farmerID,
+				Reason:       note,
+				OrderID:      orderID,
+			})
+		}
+	}
+	s.m.updateSubOrder(so, status, "farmer", farmerID, note)
+	s.m.syncOrderStatus(orderID, "farmer", farmerID)
+
+	return s.m.withItems(s.m.subOrders[so.ID]), nil
+}
+
+func (s memOrders) MarkPaid(ctx context.Context, orderID, farmerID int) (*models.SubOrder, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	so, err := s.m.subOrderFor(orderID, farmerID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case so.PaymentStatus == models.SubOrderPaymentPaid:
+		return nil, models.ErrAlreadyPaid
+	case so.PaymentStatus != models.SubOrderPaymentUnpaid:
+		return nil, models.ErrNotCashPayment
+	case so.Status == models.OrderStatusCancelled || so.Status == models.OrderStatusRefunded:
+		return nil, models.ErrOrderClosed
+	}
+
+	now := time.Now()
+	so.PaymentStatus = models.SubOrderPaymentPaid
+	so.PaidAt = &now
+	so.UpdatedAt = now
+	s.m.subOrders[so.ID] = so
+	return s.m.withItems(so), nil
+}
+
+type memRefunds struct{ m *memory }
+
+// createRefund checks the requested lines against what is left to refund and
+// saves the refund as requested; the caller holds the lock
+func (m *memory) createRefund(req models.RefundRequest) (models.Refund, error) {
+	available := make(map[int]memoryOrderItem)
+	var order []int
+	for _, item := range m.orderItems {
+		if item.OrderID != req.OrderID || (req.FarmerID != 0 && item.FarmerID != req.FarmerID) {
+			continue
+		}
+		available[item.ID] = item
+		order = append(order, item.ID)
+	}
+	if len(order) == 0 {
+		return models.Refund{}, sql.ErrNoRows
+	}
+	delivered := func(item memoryOrderItem) bool {
+		return m.subOrders[item.SubOrderID].Status == models.OrderStatusDelivered
+	}
+
+	lines := req.Lines
+	if len(lines) == 0 {
+		for _, id := range order {
+			if item := available[id]; item.Quantity-item.refunded > 0 && delivered(item) {
+				lines = append(lines, models.RefundLine{OrderItemID: id, Quantity: item.Quantity - item.refunded})
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return models.Refund{}, models.ErrNothingToRefund
+	}
+
+	refund := models.Refund{
+		OrderID:         req.OrderID,
+		Status:          models.RefundStatusRequested,
+		Reason:          req.Reason,
+		Restock:         req.Restock,
+		RequestedByType: req.RequestedByType,
+		RequestedByID:   req.RequestedByID,
+		CreatedAt:       time.Now(),
+	}
+
+	requested := make(map[int]int)
+	for _, line := range lines {
+		item, ok := available[line.OrderItemID]
+		if !ok {
+			return models.Refund{}, fmt.Errorf("%w: order item %d is not part of this order", models.ErrRefundQuantity, line.OrderItemID)
+		}
+		if !delivered(item) {
+			return models.Refund{}, models.ErrNotDelivered
+		}
+		requested[line.OrderItemID] += line.Quantity
+		if line.Quantity < 1 || requested[line.OrderItemID] > item.Quantity-item.refunded {
+			return models.Refund{}, models.ErrRefundQuantity
+		}
+
+		amount := item.UnitPrice * float64(line.Quantity)
+		refund.Amount += amount
+		refund.Items = append(refund.Items, models.RefundItem{
+			OrderItemID: item.ID,
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    line.Quantity,
+			Amount:      amount,
+		})
+	}
+
+	refund.ID = m.id("refunds")
+	for i := range refund.Items {
+		refund.Items[i].ID = m.id("refund_items")
+		refund.Items[i].RefundID = refund.ID
+	}
+	m.refunds[refund.ID] = refund
+	return refund, nil
+}
+
+// processRefund is models.processRefund over the maps. Everything that can
+// fail is checked before anything changes; the caller holds the lock.
+func (m *memory) processRefund(ctx context.Context, provider payments.PaymentProvider, refund *models.Refund, actorType string, actorID int, note string) error {
+	itemIndex := make(map[int]int)
+	for i, item := range m.orderItems {
+		itemIndex[item.ID] = i
+	}
+	refunding := make(map[int]int)
+	for _, item := range refund.Items {
+		refunding[item.OrderItemID] += item.Quantity
+		stored := m.orderItems[itemIndex[item.OrderItemID]]
+		if stored.refunded+refunding[item.OrderItemID] > stored.Quantity {
+			return models.ErrRefundQuantity
+		}
+	}
+
+	// Card orders are refunded through the provider; cash is handed back in person
+	payment, paid := m.payments[refund.OrderID]
+	if paid {
+		if payment.Status != models.PaymentStatusCaptured {
+			return models.ErrPaymentNotCaptured
+		}
+		providerRefund, err := provider.Refund(ctx, payment.ProviderRef, payments.ToMinorUnits(refund.Amount), refund.Reason)
+		if err != nil {
+			return fmt.Errorf("provider refund failed: %w", err)
+		}
+		refund.ProviderRefundID = providerRefund.ID
+
+		payment.RefundedAmount += refund.Amount
+		if payment.RefundedAmount >= payment.CapturedAmount {
+			payment.Status = models.PaymentStatusRefunded
+		}
+		payment.UpdatedAt = time.Now()
+		m.payments[refund.OrderID] = payment
+	}
+
+	touchedSubOrders := make(map[int]bool)
+	for _, item := range refund.Items {
+		stored := &m.orderItems[itemIndex[item.OrderItemID]]
+		stored.refunded += item.Quantity
+		touchedSubOrders[stored.SubOrderID] = true
+
+		if refund.Restock {
+			m.restock(item.ProductID, item.Quantity, models.InventoryMovement{
+				MovementType: models.MovementRefundReturn,
+				ActorType:    actorType,
+				ActorID:      actorID,
+				Reason:       refund.Reason,
+				OrderID:      refund.OrderID,
+			})
+		}
+	}
+
+	// Sub-orders whose every item has now been refunded move to refunded
+	var subOrderIDs []int
+	for id := range touchedSubOrders {
+		subOrderIDs = append(subOrderIDs, id)
+	}
+	sort.Ints(subOrderIDs)
+	for _, id := range subOrderIDs {
+		outstanding := 0
+		for _, item := range m.orderItems {
+			if item.SubOrderID == id {
+				outstanding += item.Quantity - item.refunded
+			}
+		}
+		if so := m.subOrders[id]; outstanding == 0 && models.CanTransition(so.Status, models.OrderStatusRefunded) {
+			m.updateSubOrder(so, models.OrderStatusRefunded, actorType, actorID, refund.Reason)
+		}
+	}
+	m.syncOrderStatus(refund.OrderID, actorType, actorID)
+
+	now := time.Now()
+	refund.Status = models.RefundStatusCompleted
+	refund.ProcessedByType = actorType
+	refund.ProcessedByID = actorID
+	refund.DecisionNote = note
+	refund.ProcessedAt = &now
+	m.refunds[refund.ID] = *refund
+	return nil
+}
+
+func (s memRefunds) Request(ctx context.Context, req models.RefundRequest) (*models.Refund, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	refund, err := s.m.createRefund(req)
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (s memRefunds) Issue(ctx context.Context, provider payments.PaymentProvider, req models.RefundRequest) (*models.Refund, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	refund, err := s.m.createRefund(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.m.processRefund(ctx, provider, &refund, req.RequestedByType, req.RequestedByID, ""); err != nil {
+		delete(s.m.refunds, refund.ID)
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (s memRefunds) Approve(ctx context.Context, provider payments.PaymentProvider, refundID int, restock bool, actorType string, actorID int, note string) (*models.Refund, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	refund, ok := s.m.refunds[refundID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if refund.Status != models.RefundStatusRequested {
+		return nil, models.ErrRefundNotPending
+	}
+	refund.Items = append([]models.RefundItem(nil), refund.Items...)
+	refund.Restock = restock
+
+	if err := s.m.processRefund(ctx, provider, &refund, actorType, actorID, note); err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (s memRefunds) Reject(ctx context.Context, refundID int, actorType string, actorID int, note string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	refund, ok := s.m.refunds[refundID]
+	if !ok || refund.Status != models.RefundStatusRequested {
+		return models.ErrRefundNotPending
+	}
+	now := time.Now()
+	refund.Status = models.RefundStatusRejected
+	refund.ProcessedByType = actorType
+	refund.ProcessedByID = actorID
+	refund.DecisionNote = note
+	refund.ProcessedAt = &now
+	s.m.refunds[refundID] = refund
+	return nil
+}
+
+func (s memRefunds) list(keep func(models.Refund) bool) []models.Refund {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	refunds := []models.Refund{}
+	for _, refund := range s.m.refunds {
+		if keep(refund) {
+			refund.Items = append([]models.RefundItem(nil), refund.Items...)
+			refunds = append(refunds, refund)
+		}
+	}
+	sort.Slice(refunds, func(i, j int) bool { return refunds[i].ID < refunds[j].ID })
+	return refunds
+}
+
+func (s memRefunds) GetPending(ctx context.Context) ([]models.Refund, error) {
+	return s.list(func(r models.Refund) bool { return r.Status == models.RefundStatusRequested }), nil
+}
+
+func (s memRefunds) GetByOrder(ctx context.Context, orderID int) ([]models.Refund, error) {
+	return s.list(func(r models.Refund) bool { return r.OrderID == orderID }), nil
+}
+
+type memPayments struct{ m *memory }
+
+func (s memPayments) GetByOrder(ctx context.Context, orderID int) (*models.Payment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	payment, ok := s.m.payments[orderID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &payment, nil
+}
+
+// Settle captures the delivered sub-orders of a delivered order and voids
+// the payment of a cancelled one, like models.SettleOrderPayment
+func (s memPayments) Settle(ctx context.Context, provider payments.PaymentProvider, orderID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	payment, ok := s.m.payments[orderID]
+	if !ok || payment.Status != models.PaymentStatusAuthorized {
+		return nil
+	}
+
+	switch s.m.orders[orderID].Status {
+	case models.OrderStatusDelivered:
+		var deliveredTotal float64
+		for _, so := range s.m.subOrdersOf(orderID) {
+			if so.Status == models.OrderStatusDelivered {
+				deliveredTotal += so.Subtotal
+			}
+		}
+		if err := provider.Capture(ctx, payment.ProviderRef, payments.ToMinorUnits(deliveredTotal)); err != nil {
+			return fmt.Errorf("Settle: capture failed: %w", err)
+		}
+		payment.Status = models.PaymentStatusCaptured
+		payment.CapturedAmount = deliveredTotal
+
+	case models.OrderStatusCancelled:
+		if err := provider.Void(ctx, payment.ProviderRef); err != nil {
+			return fmt.Errorf("Settle: void failed: %w", err)
+		}
+		payment.Status = models.PaymentStatusVoided
+
+	default:
+		return nil
+	}
+
+	payment.UpdatedAt = time.Now()
+	s.m.payments[orderID] = payment
+	return nil
+}
+
+func (s memPayments) ApplyWebhook(ctx context.Context, event *payments.WebhookEvent) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for orderID, payment := range s.m.payments {
+		if payment.ProviderRef != event.PaymentID {
+			continue
+		}
+		switch event.Type {
+		case payments.EventPaymentCaptured:
+			payment.Status = models.PaymentStatusCaptured
+			payment.CapturedAmount = payments.FromMinorUnits(event.Amount)
+		case payments.EventPaymentVoided:
+			payment.Status = models.PaymentStatusVoided
+		case payments.EventPaymentFailed:
+			payment.Status = models.PaymentStatusFailed
+		case payments.EventPaymentRefunded:
+			payment.RefundedAmount = payments.FromMinorUnits(event.Amount)
+			if payment.RefundedAmount >= payment.CapturedAmount {
+				payment.Status = models.PaymentStatusRefunded
+			}
+		default:
+			return nil
+		}
+		payment.UpdatedAt = time.Now()
+		s.m.payments[orderID] = payment
+	}
+	return nil
+}
+
+type memSessions struct{ m *memory }
+
+func (s memSessions) Create(ctx context.Context, session *models.Session) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.sessions[session.ID] = *session
+	return nil
+}
+
+func (s memSessions) Get(ctx context.Context, sessionID string) (*models.Session, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	session, ok := s.m.sessions[sessionID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &session, nil
+}
+
+func (s memSessions) Delete(ctx context.Context, sessionID string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	delete(s.m.sessions, sessionID)
+	return nil
+}
+
+type memNotifications struct{ m *memory }
+
+func (s memNotifications) Create(ctx context.Context, recipientType string, recipientID int, notificationType, message string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	exists := false
+	switch recipientType {
+	case models.RecipientFarmer:
+		_, exists = s.m.farmers[recipientID]
+	case models.RecipientBuyer:
+		_, exists = s.m.buyers[recipientID]
+	default:
+		return fmt.Errorf("CreateNotification: unknown recipient type %q", recipientType)
+	}
+	if !exists {
+		return fmt.Errorf("CreateNotification: recipient_id %d does not exist in %ss table", recipientID, recipientType)
+	}
+
+	now := time.Now()
+	s.m.notifications = append(s.m.notifications, models.Notification{
+		ID:               s.m.id("notifications"),
+		RecipientType:    recipientType,
+		RecipientID:      recipientID,
+		NotificationType: notificationType,
+		Message:          message,
+		IsSent:           true,
+		SentAt:           now,
+		CreatedAt:        now,
+	})
+	return nil
+}
+
+func (s memNotifications) List(ctx context.Context, recipientType string, recipientID int, filter models.NotificationFilter) ([]models.Notification, int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	// Notifications are appended in order, so walking backwards is newest first
+	matched := []models.Notification{}
+	for i := len(s.m.notifications) - 1; i >= 0; i-- {
+		n := s.m.notifications[i]
+		if n.RecipientType != recipientType || n.RecipientID != recipientID || (filter.UnreadOnly && n.IsRead) {
+			continue
+		}
+		matched = append(matched, n)
+	}
+
+	total := len(matched)
+	if filter.Offset >= total {
+		return []models.Notification{}, total, nil
+	}
+	matched = matched[filter.Offset:]
+	if len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, total, nil
+}
+
+func (s memNotifications) Since(ctx context.Context, recipientType string, recipientID, afterID, limit int) ([]models.Notification, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	matched := []models.Notification{}
+	for _, n := range s.m.notifications {
+		if len(matched) == limit {
+			break
+		}
+		if n.RecipientType == recipientType && n.RecipientID == recipientID && n.ID > afterID {
+			matched = append(matched, n)
+		}
+	}
+	return matched, nil
+}
+
+func (s memNotifications) CountUnread(ctx context.Context, recipientType string, recipientID int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	count := 0
+	for _, n := range s.m.notifications {
+		if n.RecipientType == recipientType && n.RecipientID == recipientID && !n.IsRead {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s memNotifications) MarkRead(ctx context.Context, recipientType string, recipientID, notificationID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for i := range s.m.notifications {
+		n := &s.m.notifications[i]
+		if n.ID == notificationID && n.RecipientType == recipientType && n.RecipientID == recipientID {
+			if !n.IsRead {
+				now := time.Now()
+				n.IsRead, n.ReadAt = true, &now
+			}
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s memNotifications) MarkAllRead(ctx context.Context, recipientType string, recipientID int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	marked := 0
+	for i := range s.m.notifications {
+		n := &s.m.notifications[i]
+		if n.RecipientType == recipientType && n.RecipientID == recipientID && !n.IsRead {
+			n.IsRead, n.ReadAt = true, &now
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (s memNotifications) Delete(ctx context.Context, recipientType string, recipientID, notificationID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for i, n := range s.m.notifications {
+		if n.ID == notificationID && n.RecipientType == recipientType && n.RecipientID == recipientID {
+			s.m.notifications = append(s.m.notifications[:i], s.m.notifications[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+type memOutbox struct{ m *memory }
+
+func (s memOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEntry, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	var claimed []models.OutboxEntry
+	for i := range s.m.outbox {
+		entry := &s.m.outbox[i]
+		if len(claimed) == limit {
+			break
+		}
+		if entry.Status != models.OutboxPending || entry.NextAttemptAt.After(now) {
+			continue
+		}
+		entry.NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, *entry)
+	}
+	return claimed, nil
+}
+
+func (s memOutbox) MarkDelivered(ctx context.Context, id int) error {
+	return s.update(id, func(entry *models.OutboxEntry) {
+		now := time.Now()
+		entry.Status = models.OutboxDelivered
+		entry.Attempts++
+		entry.LastError = ""
+		entry.DeliveredAt = &now
+	})
+}
+
+func (s memOutbox) MarkFailed(ctx context.Context, id int, deliveryErr string, retryAt time.Time, dead bool) error {
+	return s.update(id, func(entry *models.OutboxEntry) {
+		entry.Status = models.OutboxPending
+		if dead {
+			entry.Status = models.OutboxDead
+		}
+		entry.Attempts++
+		entry.LastError = deliveryErr
+		entry.NextAttemptAt = retryAt
+	})
+}
+
+func (s memOutbox) GetDead(ctx context.Context) ([]models.OutboxEntry, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var dead []models.OutboxEntry
+	for i := len(s.m.outbox) - 1; i >= 0; i-- {
+		if s.m.outbox[i].Status == models.OutboxDead {
+			dead = append(dead, s.m.outbox[i])
+		}
+	}
+	return dead, nil
+}
+
+func (s memOutbox) Retry(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for i := range s.m.outbox {
+		entry := &s.m.outbox[i]
+		if entry.ID == id && entry.Status == models.OutboxDead {
+			entry.Status = models.OutboxPending
+			entry.Attempts = 0
+			entry.NextAttemptAt = time.Now()
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s memOutbox) update(id int, change func(*models.OutboxEntry)) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for i := range s.m.outbox {
+		if s.m.outbox[i].ID == id {
+			change(&s.m.outbox[i])
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
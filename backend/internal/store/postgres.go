@@ -0,0 +1,280 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+)
+
+// NewPostgres returns stores that read and write the application database
+func NewPostgres(db *sql.DB) *Store {
+	return &Store{
+		Admins:        pgAdmins{db},
+		Farmers:       pgFarmers{db},
+		Buyers:        pgBuyers{db},
+		Products:      pgProducts{db},
+		Carts:         pgCarts{db},
+		Orders:        pgOrders{db},
+		Refunds:       pgRefunds{db},
+		Payments:      pgPayments{db},
+		Sessions:      pgSessions{db},
+		Notifications: pgNotifications{db},
+		Outbox:        pgOutbox{db},
+	}
+}
+
+type pgAdmins struct{ db *sql.DB }
+
+func (s pgAdmins) Exists(ctx context.Context, email string) (bool, error) {
+	return models.CheckAdminExists(ctx, s.db, email)
+}
+func (s pgAdmins) Create(ctx context.Context, admin *models.Admin) error {
+	return models.CreateAdmin(ctx, s.db, admin)
+}
+func (s pgAdmins) GetByID(ctx context.Context, id int) (*models.Admin, error) {
+	return models.GetAdminByID(ctx, s.db, id)
+}
+func (s pgAdmins) GetByEmail(ctx context.Context, email string) (*models.Admin, error) {
+	return models.GetAdminByEmail(ctx, s.db, email)
+}
+func (s pgAdmins) GetAll(ctx context.Context) ([]models.Admin, error) {
+	return models.GetAllAdmins(ctx, s.db)
+}
+func (s pgAdmins) SetRole(ctx context.Context, id int, role models.Role) error {
+	return models.SetAdminRole(ctx, s.db, id, role)
+}
+func (s pgAdmins) Invite(ctx context.Context, invitation *models.AdminInvitation, outbox ...models.OutboxEntry) error {
+	return models.CreateAdminInvitation(ctx, s.db, invitation, outbox...)
+}
+func (s pgAdmins) GetInvitation(ctx context.Context, tokenHash string) (*models.AdminInvitation, error) {
+	return models.GetAdminInvitationByToken(ctx, s.db, tokenHash)
+}
+func (s pgAdmins) PendingInvitations(ctx context.Context) ([]models.AdminInvitation, error) {
+	return models.GetPendingAdminInvitations(ctx, s.db)
+}
+func (s pgAdmins) AcceptInvitation(ctx context.Context, invitationID int, admin *models.Admin) error {
+	return models.AcceptAdminInvitation(ctx, s.db, invitationID, admin)
+}
+func (s pgAdmins) RevokeInvitation(ctx context.Context, id int) error {
+	return models.DeleteAdminInvitation(ctx, s.db, id)
+}
+
+type pgFarmers struct{ db *sql.DB }
+
+func (s pgFarmers) GetPending(ctx context.Context) ([]models.Farmer, error) {
+	return models.GetPendingFarmers(ctx, s.db)
+}
+func (s pgFarmers) GetAll(ctx context.Context) ([]models.Farmer, error) {
+	return models.GetAllFarmers(ctx, s.db)
+}
+func (s pgFarmers) GetByID(ctx context.Context, id int) (*models.Farmer, error) {
+	return models.GetFarmerByID(ctx, s.db, id)
+}
+func (s pgFarmers) GetByEmail(ctx context.Context, email string) (*models.Farmer, error) {
+	return models.GetFarmerByEmail(ctx, s.db, email)
+}
+func (s pgFarmers) Create(ctx context.Context, farmer *models.Farmer) error {
+	return models.CreateFarmer(ctx, s.db, farmer)
+}
+func (s pgFarmers) Update(ctx context.Context, farmer models.Farmer) error {
+	return models.UpdateFarmer(ctx, s.db, farmer)
+}
+func (s pgFarmers) Approve(ctx context.Context, id int, outbox ...models.OutboxEntry) error {
+	return models.ApproveFarmer(ctx, s.db, id, outbox...)
+}
+func (s pgFarmers) Reject(ctx context.Context, id int, reason string, outbox ...models.OutboxEntry) error {
+	return models.RejectFarmer(ctx, s.db, id, reason, outbox...)
+}
+func (s pgFarmers) SetActive(ctx context.Context, id int, isActive bool) error {
+	return models.SetFarmerActive(ctx, s.db, id, isActive)
+}
+func (s pgFarmers) Delete(ctx context.Context, id int) error {
+	return models.DeleteFarmer(ctx, s.db, id)
+}
+
+type pgBuyers struct{ db *sql.DB }
+
+func (s pgBuyers) GetAll(ctx context.Context) ([]models.Buyer, error) {
+	return models.GetAllBuyers(ctx, s.db)
+}
+func (s pgBuyers) GetByID(ctx context.Context, id int) (*models.Buyer, error) {
+	return models.GetBuyerByID(ctx, s.db, id)
+}
+func (s pgBuyers) GetByEmail(ctx context.Context, email string) (*models.Buyer, error) {
+	return models.GetBuyerByEmail(ctx, s.db, email)
+}
+func (s pgBuyers) Create(ctx context.Context, buyer *models.Buyer) error {
+	return models.CreateBuyer(ctx, s.db, buyer)
+}
+func (s pgBuyers) Update(ctx context.Context, buyer models.Buyer) error {
+	return models.UpdateBuyer(ctx, s.db, buyer)
+}
+func (s pgBuyers) SetActive(ctx context.Context, id int, isActive bool) error {
+	return models.SetBuyerActive(ctx, s.db, id, isActive)
+}
+func (s pgBuyers) Delete(ctx context.Context, id int) error { return models.DeleteBuyer(ctx, s.db, id) }
+
+type pgProducts struct{ db *sql.DB }
+
+func (s pgProducts) Create(ctx context.Context, product *models.Product) error {
+	return models.CreateProduct(ctx, s.db, product)
+}
+func (s pgProducts) GetByID(ctx context.Context, id int) (*models.Product, error) {
+	return models.GetProductByID(ctx, s.db, id)
+}
+func (s pgProducts) GetActiveByFarmer(ctx context.Context, farmerID int) ([]models.Product, error) {
+	return models.GetActiveProducts(ctx, s.db, farmerID)
+}
+func (s pgProducts) GetLowStock(ctx context.Context, farmerID, threshold int) ([]models.Product, error) {
+	return models.GetFarmerLowStockProducts(ctx, s.db, farmerID, threshold)
+}
+func (s pgProducts) Search(ctx context.Context, filters map[string]string, limit, offset int) ([]models.Product, error) {
+	return models.GetProductsWithFilters(ctx, s.db, filters, limit, offset)
+}
+func (s pgProducts) Update(ctx context.Context, product *models.Product, stockReason string) error {
+	return models.UpdateProduct(ctx, s.db, product, stockReason)
+}
+func (s pgProducts) Delete(ctx context.Context, id, farmerID int) error {
+	return models.DeleteProduct(ctx, s.db, id, farmerID)
+}
+func (s pgProducts) GetFarmerID(ctx context.Context, productID int) (int, error) {
+	return models.GetProductFarmerID(ctx, s.db, productID)
+}
+func (s pgProducts) GetStockHistory(ctx context.Context, productID, limit, offset int) ([]models.InventoryMovement, int, error) {
+	return models.GetInventoryMovements(ctx, s.db, productID, limit, offset)
+}
+
+type pgCarts struct{ db *sql.DB }
+
+func (s pgCarts) Get(ctx context.Context, buyerID int) ([]models.CartItem, error) {
+	return models.GetCartByBuyerID(ctx, s.db, buyerID)
+}
+func (s pgCarts) Add(ctx context.Context, buyerID, productID, quantity int, reserveFor time.Duration) error {
+	return models.AddProductToCart(ctx, s.db, buyerID, productID, quantity, reserveFor)
+}
+func (s pgCarts) Update(ctx context.Context, buyerID, productID, quantity int, reserveFor time.Duration) error {
+	return models.UpdateCartItem(ctx, s.db, buyerID, productID, quantity, reserveFor)
+}
+func (s pgCarts) Remove(ctx context.Context, buyerID, productID int) error {
+	return models.RemoveProductFromCart(ctx, s.db, buyerID, productID)
+}
+func (s pgCarts) Checkout(ctx context.Context, buyerID int, opts models.CheckoutOptions) (int, error) {
+	return models.Checkout(ctx, s.db, buyerID, opts)
+}
+
+type pgOrders struct{ db *sql.DB }
+
+func (s pgOrders) GetByBuyer(ctx context.Context, buyerID int, filter models.OrderFilter) ([]models.Order, int, error) {
+	return models.GetOrdersByBuyerID(ctx, s.db, buyerID, filter)
+}
+func (s pgOrders) GetByID(ctx context.Context, id int) (*models.Order, error) {
+	return models.GetOrderByID(ctx, s.db, id)
+}
+func (s pgOrders) FarmerSubtotals(ctx context.Context, orderID int) ([]models.FarmerSubtotal, error) {
+	return models.GetOrderFarmerSubtotals(ctx, s.db, orderID)
+}
+func (s pgOrders) GetByFarmer(ctx context.Context, farmerID int, filter models.OrderFilter) ([]models.SubOrder, int, error) {
+	return models.GetSubOrdersByFarmerID(ctx, s.db, farmerID, filter)
+}
+func (s pgOrders) GetForFarmer(ctx context.Context, orderID, farmerID int) (*models.SubOrder, error) {
+	return models.GetSubOrderForFarmer(ctx, s.db, orderID, farmerID)
+}
+func (s pgOrders) History(ctx context.Context, orderID int) ([]models.OrderStatusChange, error) {
+	return models.GetOrderStatusHistory(ctx, s.db, orderID)
+}
+func (s pgOrders) UpdateStatus(ctx context.Context, orderID, farmerID int, status, note string) (*models.SubOrder, error) {
+	return models.UpdateSubOrderStatus(ctx, s.db, orderID, farmerID, status, note)
+}
+func (s pgOrders) MarkPaid(ctx context.Context, orderID, farmerID int) (*models.SubOrder, error) {
+	return models.MarkSubOrderPaid(ctx, s.db, orderID, farmerID)
+}
+
+type pgRefunds struct{ db *sql.DB }
+
+func (s pgRefunds) Request(ctx context.Context, req models.RefundRequest) (*models.Refund, error) {
+	return models.RequestRefund(ctx, s.db, req)
+}
+func (s pgRefunds) Issue(ctx context.Context, provider payments.PaymentProvider, req models.RefundRequest) (*models.Refund, error) {
+	return models.IssueRefund(ctx, s.db, provider, req)
+}
+func (s pgRefunds) Approve(ctx context.Context, provider payments.PaymentProvider, refundID int, restock bool, actorType string, actorID int, note string) (*models.Refund, error) {
+	return models.ApproveRefund(ctx, s.db, provider, refundID, restock, actorType, actorID, note)
+}
+func (s pgRefunds) Reject(ctx context.Context, refundID int, actorType string, actorID int, note string) error {
+	return models.RejectRefund(ctx, s.db, refundID, actorType, actorID, note)
+}
+func (s pgRefunds) GetPending(ctx context.Context) ([]models.Refund, error) {
+	return models.GetPendingRefunds(ctx, s.db)
+}
+func (s pgRefunds) GetByOrder(ctx context.Context, orderID int) ([]models.Refund, error) {
+	return models.GetRefundsByOrderID(ctx, s.db, orderID)
+}
+
+type pgPayments struct{ db *sql.DB }
+
+func (s pgPayments) GetByOrder(ctx context.Context, orderID int) (*models.Payment, error) {
+	return models.GetPaymentByOrderID(ctx, s.db, orderID)
+}
+func (s pgPayments) Settle(ctx context.Context, provider payments.PaymentProvider, orderID int) error {
+	return models.SettleOrderPayment(ctx, s.db, provider, orderID)
+}
+func (s pgPayments) ApplyWebhook(ctx context.Context, event *payments.WebhookEvent) error {
+	return models.ApplyPaymentWebhook(ctx, s.db, event)
+}
+
+type pgSessions struct{ db *sql.DB }
+
+func (s pgSessions) Create(ctx context.Context, session *models.Session) error {
+	return models.CreateSession(ctx, s.db, session)
+}
+func (s pgSessions) Get(ctx context.Context, sessionID string) (*models.Session, error) {
+	return models.GetSession(ctx, s.db, sessionID)
+}
+func (s pgSessions) Delete(ctx context.Context, sessionID string) error {
+	return models.DeleteSession(ctx, s.db, sessionID)
+}
+
+type pgNotifications struct{ db *sql.DB }
+
+func (s pgNotifications) Create(ctx context.Context, recipientType string, recipientID int, notificationType, message string) error {
+	return models.CreateNotification(ctx, s.db, recipientType, recipientID, notificationType, message)
+}
+func (s pgNotifications) List(ctx context.Context, recipientType string, recipientID int, filter models.NotificationFilter) ([]models.Notification, int, error) {
+	return models.GetNotifications(ctx, s.db, recipientType, recipientID, filter)
+}
+func (s pgNotifications) Since(ctx context.Context, recipientType string, recipientID, afterID, limit int) ([]models.Notification, error) {
+	return models.GetNotificationsSince(ctx, s.db, recipientType, recipientID, afterID, limit)
+}
+func (s pgNotifications) CountUnread(ctx context.Context, recipientType string, recipientID int) (int, error) {
+	return models.CountUnreadNotifications(ctx, s.db, recipientType, recipientID)
+}
+func (s pgNotifications) MarkRead(ctx context.Context, recipientType string, recipientID, notificationID int) error {
+	return models.MarkNotificationRead(ctx, s.db, recipientType, recipientID, notificationID)
+}
+func (s pgNotifications) MarkAllRead(ctx context.Context, recipientType string, recipientID int) (int, error) {
+	return models.MarkAllNotificationsRead(ctx, s.db, recipientType, recipientID)
+}
+func (s pgNotifications) Delete(ctx context.Context, recipientType string, recipientID, notificationID int) error {
+	return models.DeleteNotification(ctx, s.db, recipientType, recipientID, notificationID)
+}
+
+type pgOutbox struct{ db *sql.DB }
+
+func (s pgOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEntry, error) {
+	return models.ClaimOutbox(ctx, s.db, limit, lease)
+}
+func (s pgOutbox) MarkDelivered(ctx context.Context, id int) error {
+	return models.MarkOutboxDelivered(ctx, s.db, id)
+}
+func (s pgOutbox) MarkFailed(ctx context.Context, id int, deliveryErr string, retryAt time.Time, dead bool) error {
+	return models.MarkOutboxFailed(ctx, s.db, id, deliveryErr, retryAt, dead)
+}
+func (s pgOutbox) GetDead(ctx context.Context) ([]models.OutboxEntry, error) {
+	return models.GetDeadOutbox(ctx, s.db)
+}
+func (s pgOutbox) Retry(ctx context.Context, id int) error {
+	return models.RetryOutbox(ctx, s.db, id)
+}
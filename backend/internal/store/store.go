@@ -0,0 +1,165 @@
+// Package store defines the data access interfaces the HTTP handlers depend on,
+// with a Postgres implementation backed by the models package and an in-memory
+// implementation for tests. Both pass the contract tests in contract_test.go.
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/models"
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/payments"
+)
+
+// Lookups of a missing record return sql.ErrNoRows in every implementation.
+
+type AdminStore interface {
+	Exists(ctx context.Context, email string) (bool, error)
+	Create(ctx context.Context, admin *models.Admin) error
+	GetByID(ctx context.Context, id int) (*models.Admin, error)
+	GetByEmail(ctx context.Context, email string) (*models.Admin, error)
+	GetAll(ctx context.Context) ([]models.Admin, error)
+	// SetRole returns models.ErrLastSuperAdmin if no super admin would be left
+	SetRole(ctx context.Context, id int, role models.Role) error
+
+	// Invite saves the outbox entries in the same transaction as the invitation
+	Invite(ctx context.Context, invitation *models.AdminInvitation, outbox ...models.OutboxEntry) error
+	GetInvitation(ctx context.Context, tokenHash string) (*models.AdminInvitation, error)
+	PendingInvitations(ctx context.Context) ([]models.AdminInvitation, error)
+	// AcceptInvitation creates admin with the invitation's email and role
+	AcceptInvitation(ctx context.Context, invitationID int, admin *models.Admin) error
+	RevokeInvitation(ctx context.Context, id int) error
+}
+
+type FarmerStore interface {
+	GetPending(ctx context.Context) ([]models.Farmer, error)
+	GetAll(ctx context.Context) ([]models.Farmer, error)
+	GetByID(ctx context.Context, id int) (*models.Farmer, error)
+	GetByEmail(ctx context.Context, email string) (*models.Farmer, error)
+	Create(ctx context.Context, farmer *models.Farmer) error
+	Update(ctx context.Context, farmer models.Farmer) error
+	// Approve and Reject save the outbox entries in the same transaction as the status change
+	Approve(ctx context.Context, id int, outbox ...models.OutboxEntry) error
+	Reject(ctx context.Context, id int, reason string, outbox ...models.OutboxEntry) error
+	SetActive(ctx context.Context, id int, isActive bool) error
+	Delete(ctx context.Context, id int) error
+}
+
+type BuyerStore interface {
+	GetAll(ctx context.Context) ([]models.Buyer, error)
+	GetByID(ctx context.Context, id int) (*models.Buyer, error)
+	GetByEmail(ctx context.Context, email string) (*models.Buyer, error)
+	Create(ctx context.Context, buyer *models.Buyer) error
+	Update(ctx context.Context, buyer models.Buyer) error
+	SetActive(ctx context.Context, id int, isActive bool) error
+	Delete(ctx context.Context, id int) error
+}
+
+type ProductStore interface {
+	Create(ctx context.Context, product *models.Product) error
+	// GetByID only returns active products
+	GetByID(ctx context.Context, id int) (*models.Product, error)
+	GetActiveByFarmer(ctx context.Context, farmerID int) ([]models.Product, error)
+	GetLowStock(ctx context.Context, farmerID, threshold int) ([]models.Product, error)
+	Search(ctx context.Context, filters map[string]string, limit, offset int) ([]models.Product, error)
+	Update(ctx context.Context, product *models.Product, stockReason string) error
+	// Delete soft-deletes the product and keeps its stock ledger
+	Delete(ctx context.Context, id, farmerID int) error
+	// GetFarmerID returns the owner of any product, active, inactive or deleted
+	GetFarmerID(ctx context.Context, productID int) (int, error)
+	GetStockHistory(ctx context.Context, productID, limit, offset int) ([]models.InventoryMovement, int, error)
+}
+
+type CartStore interface {
+	Get(ctx context.Context, buyerID int) ([]models.CartItem, error)
+	Add(ctx context.Context, buyerID, productID, quantity int, reserveFor time.Duration) error
+	Update(ctx context.Context, buyerID, productID, quantity int, reserveFor time.Duration) error
+	Remove(ctx context.Context, buyerID, productID int) error
+	Checkout(ctx context.Context, buyerID int, opts models.CheckoutOptions) (int, error)
+}
+
+// OrderStore covers placed orders, the per-farmer sub-orders they are split
+// into and their status history. The farmer methods return sql.ErrNoRows for
+// an order that has none of the farmer's products.
+type OrderStore interface {
+	GetByBuyer(ctx context.Context, buyerID int, filter models.OrderFilter) ([]models.Order, int, error)
+	// GetByID returns the order with its sub-orders and line items
+	GetByID(ctx context.Context, id int) (*models.Order, error)
+	FarmerSubtotals(ctx context.Context, orderID int) ([]models.FarmerSubtotal, error)
+	GetByFarmer(ctx context.Context, farmerID int, filter models.OrderFilter) ([]models.SubOrder, int, error)
+	GetForFarmer(ctx context.Context, orderID, farmerID int) (*models.SubOrder, error)
+	History(ctx context.Context, orderID int) ([]models.OrderStatusChange, error)
+	// UpdateStatus returns a *models.TransitionError for a change the farmer may not make
+	UpdateStatus(ctx context.Context, orderID, farmerID int, status, note string) (*models.SubOrder, error)
+	MarkPaid(ctx context.Context, orderID, farmerID int) (*models.SubOrder, error)
+}
+
+// RefundStore records refunds and processes them; card payments are returned
+// through the given provider
+type RefundStore interface {
+	// Request records a refund for an admin to review
+	Request(ctx context.Context, req models.RefundRequest) (*models.Refund, error)
+	// Issue creates and processes a refund at once
+	Issue(ctx context.Context, provider payments.PaymentProvider, req models.RefundRequest) (*models.Refund, error)
+	Approve(ctx context.Context, provider payments.PaymentProvider, refundID int, restock bool, actorType string, actorID int, note string) (*models.Refund, error)
+	Reject(ctx context.Context, refundID int, actorType string, actorID int, note string) error
+	GetPending(ctx context.Context) ([]models.Refund, error)
+	GetByOrder(ctx context.Context, orderID int) ([]models.Refund, error)
+}
+
+// PaymentStore tracks the provider payment behind each card order
+type PaymentStore interface {
+	GetByOrder(ctx context.Context, orderID int) (*models.Payment, error)
+	// Settle captures or voids the order's payment once fulfillment is over.
+	// The outbox worker calls it for the settlements that status changes queue.
+	Settle(ctx context.Context, provider payments.PaymentProvider, orderID int) error
+	// ApplyWebhook records a verified provider event; unknown payments are ignored
+	ApplyWebhook(ctx context.Context, event *payments.WebhookEvent) error
+}
+
+type SessionStore interface {
+	Create(ctx context.Context, session *models.Session) error
+	Get(ctx context.Context, sessionID string) (*models.Session, error)
+	Delete(ctx context.Context, sessionID string) error
+}
+
+// NotificationStore is the in-app inbox of farmers and buyers. A recipient is
+// identified by its type (models.RecipientFarmer or models.RecipientBuyer) and
+// ID; MarkRead and Delete return sql.ErrNoRows for a notification the
+// recipient does not have.
+type NotificationStore interface {
+	Create(ctx context.Context, recipientType string, recipientID int, notificationType, message string) error
+	List(ctx context.Context, recipientType string, recipientID int, filter models.NotificationFilter) ([]models.Notification, int, error)
+	// Since returns up to limit notifications with an ID above afterID, oldest first
+	Since(ctx context.Context, recipientType string, recipientID, afterID, limit int) ([]models.Notification, error)
+	CountUnread(ctx context.Context, recipientType string, recipientID int) (int, error)
+	MarkRead(ctx context.Context, recipientType string, recipientID, notificationID int) error
+	MarkAllRead(ctx context.Context, recipientType string, recipientID int) (int, error)
+	Delete(ctx context.Context, recipientType string, recipientID, notificationID int) error
+}
+
+// OutboxStore is the queue of emails and notifications waiting for the outbox worker
+type OutboxStore interface {
+	// Claim returns due pending entries and holds them for lease
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEntry, error)
+	MarkDelivered(ctx context.Context, id int) error
+	MarkFailed(ctx context.Context, id int, deliveryErr string, retryAt time.Time, dead bool) error
+	GetDead(ctx context.Context) ([]models.OutboxEntry, error)
+	// Retry requeues a dead entry; it returns sql.ErrNoRows if the entry is not dead
+	Retry(ctx context.Context, id int) error
+}
+
+// Store bundles one implementation of every interface
+type Store struct {
+	Admins        AdminStore
+	Farmers       FarmerStore
+	Buyers        BuyerStore
+	Products      ProductStore
+	Carts         CartStore
+	Orders        OrderStore
+	Refunds       RefundStore
+	Payments      PaymentStore
+	Sessions      SessionStore
+	Notifications NotificationStore
+	Outbox        OutboxStore
+}
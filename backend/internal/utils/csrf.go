@@ -6,9 +6,11 @@ import (
 	"errors"
 	"net/http"
 	"time"
+
+	"github.com/Neroframe/FarmerMarketSystem/backend/internal/config"
 )
 
-func SetCSRFToken(w http.ResponseWriter) (string, error) {
+func SetCSRFToken(w http.ResponseWriter, settings config.Session) (string, error) {
 	tokenBytes := make([]byte, 32)
 	_, err := rand.Read(tokenBytes)
 	if err != nil {
@@ -22,9 +24,8 @@ func SetCSRFToken(w http.ResponseWriter) (string, error) {
 		Path:     "/",
 		Expires:  time.Now().Add(24 * time.Hour),
 		HttpOnly: true, // Prevents JavaScript access
-		Secure:   true,
-		SameSite: http.SameSiteNoneMode, // Allows cross-site cookie
-		// SameSite: http.SameSiteStrictMode,   // Prevents CSRF attacks
+		Secure:   settings.CookieSecure,
+		SameSite: settings.SameSite(),
 	}
 	http.SetCookie(w, cookie)
 	return token, nil
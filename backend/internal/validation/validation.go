@@ -0,0 +1,262 @@
+// Package validation checks decoded request bodies against the rules in their
+// `validate` struct tags, such as
+//
+//	Email  string   `json:"email" validate:"required,email,max=255"`
+//	Images []string `json:"images" validate:"max=10,dive,url"`
+//
+// Rules are separated by commas and checked in order:
+//
+//   - required: the value is not empty or zero. Without it an empty value
+//     skips the other rules, which makes the field optional.
+//   - min=N, max=N: the length of a string (in characters), slice or map, or
+//     the value of a number
+//   - email: a bare address such as ada@example.com
+//   - password: at least 8 characters with a letter and a digit, and at most
+//     MaxPasswordBytes bytes
+//   - url: an absolute http or https URL
+//   - oneof=a b c: one of the space-separated values
+//   - dive: the rules after it apply to each element of a slice or each value
+//     of a map instead of the field itself. Struct elements also have their
+//     own fields checked.
+//
+// Fields are reported under their JSON names; elements as name[index], and
+// the fields of struct elements as name[index].field.
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxPasswordBytes is the longest password bcrypt can hash. It counts bytes,
+// so a password in Cyrillic reaches it at 36 characters.
+const MaxPasswordBytes = 72
+
+// Errors maps a JSON field to what is wrong with it
+type Errors map[string][]string
+
+func (e Errors) Add(field, message string) {
+	e[field] = append(e[field], message)
+}
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field+" "+strings.Join(e[field], ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Rule is one rule of a validate tag, like {Name: "max", Param: "255"}
+type Rule struct {
+	Name  string
+	Param string
+}
+
+// ParseTag splits a validate tag into its rules
+func ParseTag(tag string) []Rule {
+	var rules []Rule
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, param, _ := strings.Cut(part, "=")
+		rules = append(rules, Rule{Name: name, Param: param})
+	}
+	return rules
+}
+
+// Struct checks the fields of the struct v points to, or v itself. It
+// returns nil when every field is valid. It panics on a malformed tag, which
+// is a programming error.
+func Struct(v interface{}) Errors {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	errs := make(Errors)
+	checkStruct(errs, "", value)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func checkStruct(errs Errors, prefix string, value reflect.Value) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		fieldValue := value.Field(i)
+		if tag, ok := field.Tag.Lookup("validate"); ok {
+			checkValue(errs, name, fieldValue, ParseTag(tag))
+		}
+		if fieldValue.Kind() == reflect.Struct {
+			checkStruct(errs, name, fieldValue)
+		}
+	}
+}
+
+func checkValue(errs Errors, name string, value reflect.Value, rules []Rule) {
+	for i, rule := range rules {
+		if rule.Name == "required" {
+			if value.IsZero() || (value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "") {
+				errs.Add(name, "is required")
+				return
+			}
+			continue
+		}
+		if value.IsZero() {
+			// Optional and not given
+			return
+		}
+		if rule.Name == "dive" {
+			checkElements(errs, name, value, rules[i+1:])
+			return
+		}
+		if message := check(rule, value); message != "" {
+			errs.Add(name, message)
+		}
+	}
+}
+
+func checkElements(errs Errors, name string, value reflect.Value, rules []Rule) {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			checkElement(errs, fmt.Sprintf("%s[%d]", name, i), value.Index(i), rules)
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			checkElement(errs, fmt.Sprintf("%s[%v]", name, iter.Key()), iter.Value(), rules)
+		}
+	default:
+		panic(fmt.Sprintf("validation: dive on %s, which is not a slice or map", name))
+	}
+}
+
+// checkElement checks one element under dive. An element must be given, and
+// a struct element has its own fields checked as well.
+func checkElement(errs Errors, name string, value reflect.Value, rules []Rule) {
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Struct && !value.IsZero() {
+		checkValue(errs, name, value, rules)
+		checkStruct(errs, name, value)
+		return
+	}
+	checkValue(errs, name, value, append([]Rule{{Name: "required"}}, rules...))
+}
+
+// check returns what is wrong with value under rule, or "" when nothing is
+func check(rule Rule, value reflect.Value) string {
+	switch rule.Name {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(rule.Param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validation: bad %s=%q", rule.Name, rule.Param))
+		}
+		return checkLimit(rule.Name, limit, value)
+	case "email":
+		address, err := mail.ParseAddress(value.String())
+		if err != nil || address.Address != value.String() {
+			return "must be a valid email address"
+		}
+	case "password":
+		if !strongPassword(value.String()) {
+			return "must be at least 8 characters and contain a letter and a digit"
+		}
+		if len(value.String()) > MaxPasswordBytes {
+			return "must be at most " + strconv.Itoa(MaxPasswordBytes) + " bytes"
+		}
+	case "url":
+		u, err := url.Parse(value.String())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be an http or https URL"
+		}
+	case "oneof":
+		allowed := strings.Fields(rule.Param)
+		for _, option := range allowed {
+			if value.String() == option {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(allowed, ", ")
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %q", rule.Name))
+	}
+	return ""
+}
+
+func checkLimit(name string, limit float64, value reflect.Value) string {
+	var size float64
+	var unit string
+	switch value.Kind() {
+	case reflect.String:
+		size, unit = float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size, unit = float64(value.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	default:
+		panic(fmt.Sprintf("validation: %s on a %s", name, value.Kind()))
+	}
+
+	formatted := strconv.FormatFloat(limit, 'f', -1, 64)
+	if name == "min" && size < limit {
+		return "must be at least " + formatted + unit
+	}
+	if name == "max" && size > limit {
+		return "must be at most " + formatted + unit
+	}
+	return ""
+}
+
+func strongPassword(password string) bool {
+	if utf8.RuneCountInString(password) < 8 {
+		return false
+	}
+	var letter, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return letter && digit
+}
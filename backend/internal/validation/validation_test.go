@@ -0,0 +1,235 @@
+package validation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkErrors runs Struct on v and compares the errors it reports
+func checkErrors(t *testing.T, v interface{}, want Errors) {
+	t.Helper()
+
+	got := Struct(v)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Struct(%+v) = %v, want %v", v, got, want)
+	}
+}
+
+func TestRequired(t *testing.T) {
+	type request struct {
+		Name  string   `json:"name" validate:"required"`
+		Count int      `json:"count" validate:"required"`
+		Tags  []string `json:"tags" validate:"required"`
+	}
+	missing := []string{"is required"}
+
+	tests := []struct {
+		name    string
+		request request
+		want    Errors
+	}{
+		{"all given", request{Name: "Ada", Count: 1, Tags: []string{"a"}}, nil},
+		{"all empty", request{}, Errors{"name": missing, "count": missing, "tags": missing}},
+		{"blank string", request{Name: "  ", Count: 1, Tags: []string{"a"}}, Errors{"name": missing}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { checkErrors(t, tt.request, tt.want) })
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	type request struct {
+		Name  string         `json:"name" validate:"min=2,max=5"`
+		Price float64        `json:"price" validate:"min=0.5,max=10"`
+		Stock int            `json:"stock" validate:"max=3"`
+		Tags  []string       `json:"tags" validate:"max=2"`
+		Attrs map[string]int `json:"attrs" validate:"min=2"`
+	}
+
+	tests := []struct {
+		name    string
+		request request
+		want    Errors
+	}{
+		{"within limits", request{Name: "Ada", Price: 1, Stock: 3, Tags: []string{"a", "b"}, Attrs: map[string]int{"a": 1, "b": 2}}, nil},
+		{"empty values are optional", request{}, nil},
+		{"string counts characters, not bytes", request{Name: "Ёжик"}, nil},
+		{"too short", request{Name: "A"}, Errors{"name": {"must be at least 2 characters"}}},
+		{"too long", request{Name: "Adalbert"}, Errors{"name": {"must be at most 5 characters"}}},
+		{"number below minimum", request{Price: 0.25}, Errors{"price": {"must be at least 0.5"}}},
+		{"number above maximum", request{Price: 10.5, Stock: 4}, Errors{"price": {"must be at most 10"}, "stock": {"must be at most 3"}}},
+		{"too many items", request{Tags: []string{"a", "b", "c"}}, Errors{"tags": {"must be at most 2 items"}}},
+		{"too few map entries", request{Attrs: map[string]int{"a": 1}}, Errors{"attrs": {"must be at least 2 items"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { checkErrors(t, tt.request, tt.want) })
+	}
+}
+
+func TestEmail(t *testing.T) {
+	type request struct {
+		Email string `json:"email" validate:"email"`
+	}
+	invalid := Errors{"email": {"must be a valid email address"}}
+
+	tests := []struct {
+		email string
+		want  Errors
+	}{
+		{"ada@example.com", nil},
+		{"", nil},
+		{"not-an-email", invalid},
+		{"Ada <ada@example.com>", invalid},
+		{"ada@example.com ", invalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) { checkErrors(t, request{Email: tt.email}, tt.want) })
+	}
+}
+
+func TestPassword(t *testing.T) {
+	type request struct {
+		Password string `json:"password" validate:"password"`
+	}
+	weak := Errors{"password": {"must be at least 8 characters and contain a letter and a digit"}}
+	tooLong := Errors{"password": {"must be at most 72 bytes"}}
+
+	tests := []struct {
+		name     string
+		password string
+		want     Errors
+	}{
+		{"letters and digits", "harvest-2024", nil},
+		{"too short", "abc123", weak},
+		{"no digit", "harvesting", weak},
+		{"no letter", "12345678", weak},
+		{"72 bytes", strings.Repeat("a", 71) + "1", nil},
+		{"73 bytes", strings.Repeat("a", 72) + "1", tooLong},
+		// 40 characters, but 79 bytes: bcrypt cannot hash it
+		{"multibyte over 72 bytes", strings.Repeat("п", 39) + "1", tooLong},
+		{"multibyte within 72 bytes", strings.Repeat("п", 35) + "1", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { checkErrors(t, request{Password: tt.password}, tt.want) })
+	}
+}
+
+func TestURL(t *testing.T) {
+	type request struct {
+		Link string `json:"link" validate:"url"`
+	}
+	invalid := Errors{"link": {"must be an http or https URL"}}
+
+	tests := []struct {
+		link string
+		want Errors
+	}{
+		{"https://images.example.com/a.jpg", nil},
+		{"http://example.com", nil},
+		{"tomatoes.jpg", invalid},
+		{"ftp://example.com/a.jpg", invalid},
+		{"https://", invalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) { checkErrors(t, request{Link: tt.link}, tt.want) })
+	}
+}
+
+func TestOneOf(t *testing.T) {
+	type request struct {
+		Method string `json:"method" validate:"oneof=card cash_on_delivery"`
+	}
+
+	checkErrors(t, request{Method: "card"}, nil)
+	checkErrors(t, request{}, nil)
+	checkErrors(t, request{Method: "cheque"}, Errors{"method": {"must be one of: card, cash_on_delivery"}})
+}
+
+func TestDive(t *testing.T) {
+	type request struct {
+		Images  []string          `json:"images" validate:"max=2,dive,url"`
+		Methods map[string]string `json:"methods" validate:"dive,oneof=delivery pickup"`
+	}
+
+	tests := []struct {
+		name    string
+		request request
+		want    Errors
+	}{
+		{"valid elements", request{Images: []string{"https://example.com/a.jpg"}, Methods: map[string]string{"1": "pickup"}}, nil},
+		{"each element is checked", request{Images: []string{"https://example.com/a.jpg", "b.jpg"}}, Errors{"images[1]": {"must be an http or https URL"}}},
+		{"empty elements are required", request{Images: []string{""}}, Errors{"images[0]": {"is required"}}},
+		{"map values are checked", request{Methods: map[string]string{"7": "drone"}}, Errors{"methods[7]": {"must be one of: delivery, pickup"}}},
+		// Rules before dive still apply to the field itself
+		{"rules before dive", request{Images: []string{"https://a.com", "https://b.com", "https://c.com"}}, Errors{"images": {"must be at most 2 items"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { checkErrors(t, tt.request, tt.want) })
+	}
+}
+
+func TestNestedStructs(t *testing.T) {
+	type address struct {
+		City string `json:"city" validate:"required"`
+	}
+	type request struct {
+		Address address `json:"address"`
+	}
+
+	checkErrors(t, &request{}, Errors{"address.city": {"is required"}})
+}
+
+func TestDiveIntoStructs(t *testing.T) {
+	type line struct {
+		ID       int `json:"id" validate:"required,min=1"`
+		Quantity int `json:"quantity" validate:"required,min=1"`
+	}
+	type request struct {
+		Lines []line `json:"lines" validate:"max=2,dive"`
+	}
+
+	tests := []struct {
+		name    string
+		request request
+		want    Errors
+	}{
+		{"valid lines", request{Lines: []line{{ID: 1, Quantity: 2}}}, nil},
+		{"fields of each line", request{Lines: []line{{ID: 1, Quantity: 2}, {ID: 3, Quantity: -1}}}, Errors{"lines[1].quantity": {"must be at least 1"}}},
+		{"empty line", request{Lines: []line{{}}}, Errors{"lines[0]": {"is required"}}},
+		{"missing field", request{Lines: []line{{Quantity: 1}}}, Errors{"lines[0].id": {"is required"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { checkErrors(t, tt.request, tt.want) })
+	}
+}
+
+func TestMalformedTagPanics(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"unknown rule", struct {
+			Name string `json:"name" validate:"shiny"`
+		}{Name: "x"}},
+		{"limit that is not a number", struct {
+			Name string `json:"name" validate:"max=ten"`
+		}{Name: "x"}},
+		{"limit on a bool", struct {
+			Active bool `json:"active" validate:"max=1"`
+		}{Active: true}},
+		{"dive on a string", struct {
+			Name string `json:"name" validate:"dive,url"`
+		}{Name: "x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Struct did not panic")
+				}
+			}()
+			Struct(tt.value)
+		})
+	}
+}